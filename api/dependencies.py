@@ -1,10 +1,24 @@
 """FastAPI dependency injection functions."""
 
 import os
-from fastapi import Header, HTTPException
+import uuid
+from functools import lru_cache
+from typing import Optional, Dict, Any, Tuple
+from fastapi import Depends, Header, HTTPException, Query, Request
 
+from core.auth import WS_TOKEN_AUDIENCE, InvalidTokenError, get_jwt_manager, get_user_roles
+from core.rate_limit import FixedWindowRateLimiter
+from services.agent_capabilities import AgentCapabilitiesService
+from services.deepagents_client import DEFAULT_DEEPAGENTS_RUNTIME_URL, DeepAgentsRuntimeClient
 from services.workflow_service import WorkflowService
 from services.orchestration_service import OrchestrationService
+from services.event_store import EventStore
+from services.outbox_service import OutboxService
+from services.snapshot_service import ThreadSnapshotService
+from services.system_status import SystemStatusService
+from services.token_revocation_service import TokenRevocationService
+from services.user_service import UserService
+from services.workflow_access import can_write
 
 
 def get_database_url():
@@ -25,18 +39,212 @@ def get_orchestration_service():
     return OrchestrationService(get_database_url())
 
 
-def get_current_user_id(authorization: str = Header(...)) -> str:
+def get_outbox_service():
+    """Get outbox service instance."""
+    return OutboxService(get_database_url())
+
+
+def get_event_store():
+    """Get event store instance."""
+    return EventStore(get_database_url())
+
+
+def get_snapshot_service():
+    """Get thread snapshot service instance."""
+    return ThreadSnapshotService(get_database_url())
+
+
+def get_user_service():
+    """Get user service instance."""
+    return UserService(get_database_url())
+
+
+def get_token_revocation_service():
+    """Get token revocation service instance."""
+    return TokenRevocationService(get_database_url())
+
+
+@lru_cache(maxsize=None)
+def _capabilities_service_for(deepagents_url: str) -> AgentCapabilitiesService:
+    """Build one capabilities service per runtime URL so the cache is shared across requests."""
+    return AgentCapabilitiesService(DeepAgentsRuntimeClient(deepagents_url))
+
+
+def get_capabilities_service():
+    """Get the process-wide agent capabilities service."""
+    return _capabilities_service_for(os.getenv("DEEPAGENTS_RUNTIME_URL", DEFAULT_DEEPAGENTS_RUNTIME_URL))
+
+
+@lru_cache(maxsize=None)
+def _system_status_service_for(database_url: str, deepagents_url: str) -> SystemStatusService:
+    """Build one status service per configuration so its cache is shared across requests."""
+    return SystemStatusService(database_url, DeepAgentsRuntimeClient(deepagents_url))
+
+
+def get_system_status_service():
+    """Get the process-wide system status service."""
+    return _system_status_service_for(
+        get_database_url(), os.getenv("DEEPAGENTS_RUNTIME_URL", DEFAULT_DEEPAGENTS_RUNTIME_URL)
+    )
+
+
+@lru_cache(maxsize=None)
+def _status_rate_limiter() -> FixedWindowRateLimiter:
+    """Build the status endpoint's rate limiter from STATUS_RATE_LIMIT_PER_MINUTE once."""
+    return FixedWindowRateLimiter(int(os.getenv("STATUS_RATE_LIMIT_PER_MINUTE", "60")), 60)
+
+
+def limit_status_requests(request: Request) -> None:
+    """Refuse clients that poll the status endpoint too often with 429."""
+    limiter = _status_rate_limiter()
+    client_ip = request.client.host if request.client else "unknown"
+    if not limiter.allow(client_ip):
+        raise HTTPException(
+            status_code=429,
+            detail="Too many status requests",
+            headers={"Retry-After": str(limiter.retry_after(client_ip))}
+        )
+
+
+# Message of every 401 caused by a request carrying no credentials
+MISSING_CREDENTIALS_MESSAGE = "Authorization header required"
+
+
+def unauthorized_body(detail: str) -> Dict[str, Any]:
+    """Build the body shared by all 401 responses, from REST routes and the WebSocket handshake."""
+    return {"detail": detail, "code": 401}
+
+
+def validate_access_token(
+    token: str,
+    accepted_audiences: Tuple[Optional[str], ...] = (None,)
+) -> Dict[str, Any]:
     """
-    Extract user_id from Authorization header.
+    Validate a token's signature and claims, then refuse it if it has been revoked.
+    
+    The denylist and the user's token cutoff are only consulted for tokens
+    that pass validation, so forged or expired tokens never cost a database
+    round trip.
     
-    For testing: Accepts "Bearer <user_id>" where user_id is a UUID string.
-    TODO: Replace with proper JWT validation using SDK.
+    Raises:
+        InvalidTokenError: If the token is invalid or revoked
     """
+    claims = get_jwt_manager().validate_token(token, accepted_audiences=accepted_audiences)
+    if get_token_revocation_service().is_revoked(claims):
+        raise InvalidTokenError("Token has been revoked")
+    return claims
+
+
+def get_token_claims(authorization: Optional[str] = Header(None)) -> Dict[str, Any]:
+    """Validate the bearer token from the Authorization header and return its claims."""
+    if not authorization:
+        raise HTTPException(status_code=401, detail=MISSING_CREDENTIALS_MESSAGE)
+    
     if not authorization.startswith("Bearer "):
         raise HTTPException(status_code=401, detail="Invalid authorization header")
     
     token = authorization[7:]  # Remove "Bearer " prefix
-    # todo
-    # For testing: token IS the user_id (UUID string)
-    # In production: decode JWT and extract user_id claim
-    return token
+    try:
+        return validate_access_token(token)
+    except InvalidTokenError as e:
+        raise HTTPException(status_code=401, detail=str(e))
+
+
+def get_stream_user_id(
+    token: Optional[str] = Query(None),
+    authorization: Optional[str] = Header(None)
+) -> str:
+    """
+    Authenticate a streaming request the way the WebSocket handshake is authenticated.
+    
+    The token is read from ?token= first, since EventSource cannot send
+    headers, then from the Authorization header. WS-scoped tokens from
+    POST /api/auth/ws-token are accepted as well as regular ones.
+    """
+    if not token and authorization and authorization.startswith("Bearer "):
+        token = authorization[7:]
+    if not token:
+        raise HTTPException(status_code=401, detail=MISSING_CREDENTIALS_MESSAGE)
+    
+    try:
+        claims = validate_access_token(token, accepted_audiences=(None, WS_TOKEN_AUDIENCE))
+    except InvalidTokenError as e:
+        raise HTTPException(status_code=401, detail=str(e))
+    return claims["user_id"]
+
+
+def get_optional_token_claims(
+    request: Request,
+    authorization: Optional[str] = Header(None)
+) -> Optional[Dict[str, Any]]:
+    """
+    Validate the bearer token if one is sent, continuing anonymously otherwise.
+    
+    A rejected token does not fail the request, but request.state.auth_present_but_invalid
+    is set so handlers can tell "no token" apart from "bad token" and warn the user.
+    """
+    request.state.auth_present_but_invalid = False
+    if not authorization:
+        return None
+    
+    try:
+        if not authorization.startswith("Bearer "):
+            raise InvalidTokenError("Invalid authorization header")
+        return validate_access_token(authorization[7:])
+    except InvalidTokenError:
+        request.state.auth_present_but_invalid = True
+        return None
+
+
+def get_optional_user_id(
+    claims: Optional[Dict[str, Any]] = Depends(get_optional_token_claims)
+) -> Optional[str]:
+    """Extract the user_id from optional token claims, or None for anonymous requests."""
+    return claims["user_id"] if claims else None
+
+
+def get_current_user_id(claims: Dict[str, Any] = Depends(get_token_claims)) -> str:
+    """Extract the authenticated user_id from validated token claims."""
+    return claims["user_id"]
+
+
+def get_admin_user_id(user_id: str = Depends(get_current_user_id)) -> str:
+    """Require the current user to be an administrator."""
+    if "admin" not in get_user_roles(user_id):
+        raise HTTPException(status_code=403, detail="Admin access required")
+    return user_id
+
+
+def get_proposal_id(proposal_id: str) -> str:
+    """
+    Read the proposal_id path parameter shared by all proposal routes.
+    
+    Proposal IDs are UUIDs; malformed ones cannot name a proposal, so they
+    are answered like unknown proposals instead of failing in the database.
+    """
+    try:
+        return str(uuid.UUID(proposal_id))
+    except ValueError:
+        raise HTTPException(status_code=404, detail="Proposal not found")
+
+
+def get_version_number(version_number: str) -> int:
+    """
+    Read the version_number path parameter shared by all version routes.
+    
+    Versions are numbered from 1; anything else is answered with 400
+    instead of failing the conversion.
+    """
+    try:
+        number = int(version_number)
+    except ValueError:
+        raise HTTPException(status_code=400, detail="version_number must be a positive integer")
+    if number < 1:
+        raise HTTPException(status_code=400, detail="version_number must be a positive integer")
+    return number
+
+
+def require_workflow_write_access(workflow: Dict[str, Any]) -> None:
+    """Refuse changes to a workflow the user can only view."""
+    if not can_write(workflow["access_type"]):
+        raise HTTPException(status_code=403, detail="Write access to workflow required")
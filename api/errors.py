@@ -0,0 +1,58 @@
+"""
+Internal server error responses.
+
+Every 500 has the same body, {"detail": message}, whether a handler gave
+up on a failed operation (InternalError) or an exception escaped. The
+underlying error never reaches clients unless DEBUG_ERRORS is on, in which
+case the body also carries the error and its traceback for development.
+"""
+
+import os
+import traceback
+from typing import Any, Dict
+
+from fastapi import Request
+from fastapi.responses import JSONResponse
+
+from core.request_context import REQUEST_ID_HEADER
+
+DEFAULT_INTERNAL_ERROR_MESSAGE = "Internal server error"
+
+
+class InternalError(Exception):
+    """
+    Raised by handlers to answer 500 with a fixed message.
+
+    Raise it `from` the original error so DEBUG_ERRORS can report it.
+    """
+
+    def __init__(self, message: str):
+        super().__init__(message)
+        self.message = message
+
+
+def debug_errors_enabled() -> bool:
+    """Whether DEBUG_ERRORS adds error details to 500 responses."""
+    return os.getenv("DEBUG_ERRORS", "false").lower() == "true"
+
+
+def internal_error_body(exc: Exception) -> Dict[str, Any]:
+    """Build the body of a 500 response for an exception."""
+    if isinstance(exc, InternalError):
+        body: Dict[str, Any] = {"detail": exc.message}
+        cause = exc.__cause__ or exc
+    else:
+        body = {"detail": DEFAULT_INTERNAL_ERROR_MESSAGE}
+        cause = exc
+
+    if debug_errors_enabled():
+        body["error"] = f"{type(cause).__name__}: {cause}"
+        body["traceback"] = traceback.format_exception(cause)
+    return body
+
+
+async def handle_internal_error(request: Request, exc: Exception) -> JSONResponse:
+    """Exception handler answering any unhandled exception with a uniform 500, keeping its request ID."""
+    request_id = getattr(request.state, "request_id", None)
+    headers = {REQUEST_ID_HEADER: request_id} if request_id else None
+    return JSONResponse(internal_error_body(exc), status_code=500, headers=headers)
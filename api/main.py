@@ -1,26 +1,133 @@
 """FastAPI application for IDE Orchestrator."""
 
+import asyncio
+import logging
 import os
-from fastapi import FastAPI, Header, HTTPException
-from typing import Optional
+import uvicorn
+from fastapi import Depends, FastAPI, Request
+from fastapi.exception_handlers import http_exception_handler
+from fastapi.responses import JSONResponse
+from starlette.exceptions import HTTPException as StarletteHTTPException
+from typing import Dict, Any
 from contextlib import asynccontextmanager
 
-from api.routers import health, workflows, refinements, websockets
+from api.routers import health, auth, workflows, refinements, websockets, admin, agents
+from api.routers.websockets import drain_refinement_streams, get_heartbeat_settings, get_shutdown_timeout
+from api.errors import handle_internal_error
+from api.middleware import (
+    DEFAULT_MAX_DRAFT_FILE_BODY_SIZE,
+    DEFAULT_MAX_REQUEST_BODY_SIZE,
+    DRAFT_FILE_PATH_PATTERN,
+    ApiVersionMiddleware,
+    HttpMetricsMiddleware,
+    MaxBodySizeMiddleware,
+    RequestIdMiddleware,
+)
+from api.dependencies import (
+    get_database_url,
+    get_orchestration_service,
+    get_outbox_service,
+    get_token_claims,
+    unauthorized_body,
+)
+from core.database import (
+    close_pools,
+    connect_with_retry,
+    get_connect_timeout,
+    get_pool,
+    get_pool_settings,
+    get_statement_timeout,
+)
 from core.metrics import metrics
+from core.structured_logging import configure_logging
+from services.cleanup_job_service import CleanupWorker
+from services.outbox_service import OutboxPoller, publisher_from_env
+from services.proposal_reconciler import ProposalReconciler
+from services.proposal_retention import ProposalRetentionJob
+
+# Log JSON lines, each carrying the ID of the request it belongs to
+configure_logging(os.getenv("LOG_LEVEL", "info"))
+logger = logging.getLogger(__name__)
 
 
 @asynccontextmanager
 async def lifespan(app: FastAPI):
     """Application lifespan manager."""
     # Startup
+    # Wait for the database; DatabaseUnavailableError aborts startup after DB_CONNECT_TIMEOUT
+    database_url = get_database_url()
+    connection = await connect_with_retry(database_url, get_connect_timeout())
+    connection.close()
+    pool_settings = get_pool_settings()
+    get_pool(database_url)
+    logger.info(
+        "Database pool ready",
+        extra={
+            "min_conns": pool_settings["min_size"],
+            "max_conns": pool_settings["max_size"],
+            "max_conn_lifetime_seconds": pool_settings["max_lifetime"],
+            "max_conn_idle_time_seconds": pool_settings["max_idle"],
+            "statement_timeout_seconds": get_statement_timeout(),
+        }
+    )
+    
     metrics_port = int(os.getenv("METRICS_PORT", "8090"))
     metrics.start_metrics_server(metrics_port)
-    print(f"🔢 Prometheus metrics server started on port {metrics_port}")
+    logger.info("Prometheus metrics server started", extra={"port": metrics_port})
+    
+    outbox_poller = None
+    outbox_task = None
+    if os.getenv("OUTBOX_POLLER_ENABLED", "true").lower() == "true":
+        outbox_poller = OutboxPoller(get_outbox_service(), publisher_from_env())
+        outbox_task = asyncio.create_task(outbox_poller.run())
+        logger.info("Outbox poller started")
+    
+    reconciler = None
+    reconciler_task = None
+    if os.getenv("PROPOSAL_RECONCILER_ENABLED", "true").lower() == "true":
+        orchestration_service = get_orchestration_service()
+        reconciler = ProposalReconciler(
+            orchestration_service.proposal_service,
+            orchestration_service.deepagents_client.get_execution_state
+        )
+        reconciler_task = asyncio.create_task(reconciler.run())
+        logger.info("Proposal reconciler started")
+    
+    cleanup_worker = None
+    cleanup_task = None
+    if os.getenv("CLEANUP_WORKER_ENABLED", "true").lower() == "true":
+        orchestration_service = get_orchestration_service()
+        cleanup_worker = CleanupWorker(
+            orchestration_service.cleanup_job_service,
+            orchestration_service.deepagents_client.cleanup_thread
+        )
+        cleanup_task = asyncio.create_task(cleanup_worker.run())
+        logger.info("Cleanup worker started")
+    
+    retention_job = None
+    retention_task = None
+    if os.getenv("PROPOSAL_RETENTION_ENABLED", "true").lower() == "true":
+        retention_job = ProposalRetentionJob(get_orchestration_service().proposal_service)
+        retention_task = asyncio.create_task(retention_job.run())
+        logger.info("Proposal retention job started", extra={"retention_days": retention_job.retention_days})
     
     yield
     
     # Shutdown
-    print("🔄 Application shutting down...")
+    logger.info("Application shutting down")
+    if outbox_poller:
+        outbox_poller.stop()
+        await outbox_task
+    if reconciler:
+        reconciler.stop()
+        await reconciler_task
+    if cleanup_worker:
+        cleanup_worker.stop()
+        await cleanup_task
+    if retention_job:
+        retention_job.stop()
+        await retention_task
+    close_pools()
 
 
 app = FastAPI(
@@ -28,49 +135,113 @@ app = FastAPI(
     lifespan=lifespan
 )
 
+app.add_middleware(
+    MaxBodySizeMiddleware,
+    max_body_size=int(os.getenv("MAX_REQUEST_BODY_SIZE", str(DEFAULT_MAX_REQUEST_BODY_SIZE))),
+    path_limits={
+        DRAFT_FILE_PATH_PATTERN: int(
+            os.getenv("MAX_DRAFT_FILE_BODY_SIZE", str(DEFAULT_MAX_DRAFT_FILE_BODY_SIZE))
+        ),
+    }
+)
+
+# Strips the version from /api/v1 paths before body limits and routing see them
+app.add_middleware(ApiVersionMiddleware)
+
+# Wraps everything but the request ID, so it also counts rejected bodies
+app.add_middleware(HttpMetricsMiddleware)
+
+# Added last so every response, including rejected bodies, carries the request ID
+app.add_middleware(RequestIdMiddleware)
+
+
+# Uniform 500 body for unhandled exceptions; DEBUG_ERRORS adds the error and traceback
+app.add_exception_handler(Exception, handle_internal_error)
+
+
+@app.exception_handler(StarletteHTTPException)
+async def handle_http_exception(request: Request, exc: StarletteHTTPException):
+    """Give every 401 the same body as the WebSocket handshake rejection."""
+    if exc.status_code == 401:
+        return JSONResponse(unauthorized_body(exc.detail), status_code=401, headers=exc.headers)
+    return await http_exception_handler(request, exc)
+
+
 # Include routers
 app.include_router(health.router)
 app.include_router(health.health_router)  # Root level health endpoints
+app.include_router(auth.router)
 app.include_router(workflows.router)
 app.include_router(refinements.router)
 app.include_router(websockets.router)
+app.include_router(admin.router)
+app.include_router(agents.router)
 
 
 @app.get("/api/protected")
-async def protected(authorization: Optional[str] = Header(None)):
+async def protected(claims: Dict[str, Any] = Depends(get_token_claims)):
     """
     Protected endpoint that requires authentication.
     
-    Note: Authentication will be handled by SDK middleware in future implementation.
     This endpoint is kept for integration tests.
     """
-    # Temporary check for Authorization header until SDK middleware is integrated
-    if not authorization:
-        raise HTTPException(status_code=401, detail="Not authenticated")
-    
-    # TODO: Replace with SDK-based authentication
     return {
-        "user_id": "pending-sdk-integration",
-        "email": "pending-sdk-integration",
+        "user_id": claims["user_id"],
+        "email": claims.get("username"),
         "message": "Access granted"
     }
 
 
+class DrainingServer(uvicorn.Server):
+    """
+    Uvicorn server that drains refinement streams before shutting down.
+    
+    Uvicorn closes open WebSocket connections before the lifespan shutdown
+    runs, so draining has to happen here: otherwise every stream is cut off
+    mid-refinement and looks like a client that walked away.
+    """
+    
+    async def shutdown(self, sockets=None):
+        await drain_refinement_streams(get_shutdown_timeout())
+        await super().shutdown(sockets)
+
+
 def main():
     """Main entry point for the application."""
-    import uvicorn
-    
     host = os.getenv("HOST", "0.0.0.0")
     port = int(os.getenv("PORT", "8080"))
     
-    print(f"🚀 Starting IDE Orchestrator on {host}:{port}")
+    # Ping WebSocket clients so silently dropped connections are closed
+    ws_ping_interval, ws_ping_timeout = get_heartbeat_settings()
+    
+    logger.info("Starting IDE Orchestrator", extra={"host": host, "port": port})
+    
+    if os.getenv("ENVIRONMENT") == "development":
+        # The reloader runs its own server processes, which restart without draining
+        uvicorn.run(
+            "api.main:app",
+            host=host,
+            port=port,
+            reload=True,
+            ws_ping_interval=ws_ping_interval,
+            ws_ping_timeout=ws_ping_timeout,
+            log_config=None
+        )
+        return
     
-    uvicorn.run(
+    config = uvicorn.Config(
         "api.main:app",
         host=host,
         port=port,
-        reload=os.getenv("ENVIRONMENT") == "development"
+        ws_ping_interval=ws_ping_interval,
+        ws_ping_timeout=ws_ping_timeout,
+        # Uvicorn's own records go through the JSON handler instead of its text formatters
+        log_config=None,
+        log_level=os.getenv("LOG_LEVEL", "info").lower(),
+        access_log=os.getenv("ACCESS_LOG", "true").lower() == "true",
+        proxy_headers=True
     )
+    DrainingServer(config).run()
 
 
 if __name__ == "__main__":
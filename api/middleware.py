@@ -0,0 +1,259 @@
+"""ASGI middleware for IDE Orchestrator."""
+
+import json
+import re
+import time
+from typing import Dict, Optional
+
+from core.metrics import metrics
+from core.request_context import REQUEST_ID_HEADER, request_id_from_header, reset_request_id, set_request_id
+
+# Default limit for request bodies (1 MiB)
+DEFAULT_MAX_REQUEST_BODY_SIZE = 1024 * 1024
+
+# Default limit for draft file uploads, which carry whole specification files (10 MiB)
+DEFAULT_MAX_DRAFT_FILE_BODY_SIZE = 10 * 1024 * 1024
+
+# Draft file writes (PUT/PATCH /api/workflows/{id}/draft/files/{path}), limited separately
+DRAFT_FILE_PATH_PATTERN = r"/api/workflows/[^/]+/draft/files/"
+
+# Route label for requests that matched no route (404s, rejected bodies)
+UNMATCHED_ROUTE = "unmatched"
+
+# Header a client selects the API version with, and responses report the version in
+API_VERSION_HEADER = "API-Version"
+
+# API versions served, oldest first; the last one is used when a client names none
+SUPPORTED_API_VERSIONS = ("1",)
+
+# Versioned API paths (/api/v1/...), routed to the handlers mounted under /api
+VERSIONED_PATH_PATTERN = re.compile(r"^/api/v(\d+)(/.*)?$")
+
+
+class MaxBodySizeMiddleware:
+    """
+    Reject request bodies above a size limit with 413 Payload Too Large.
+
+    The declared Content-Length is checked up front; bodies without one
+    (chunked uploads) are buffered up to the limit before the app sees them,
+    so the 413 comes from here rather than from whatever the app makes of a
+    failed read. Endpoints that accept larger uploads get their own limit
+    through path_limits, keyed by a path pattern matched from the start of
+    the path; a limit of 0 disables the check.
+    """
+
+    def __init__(self, app, max_body_size: int, path_limits: Optional[Dict[str, int]] = None):
+        self.app = app
+        self.max_body_size = max_body_size
+        self.path_limits = [(re.compile(pattern), limit) for pattern, limit in (path_limits or {}).items()]
+
+    def limit_for(self, path: str) -> int:
+        """Get the body size limit for a request path."""
+        for pattern, limit in self.path_limits:
+            if pattern.match(path):
+                return limit
+        return self.max_body_size
+
+    async def __call__(self, scope, receive, send):
+        if scope["type"] != "http":
+            await self.app(scope, receive, send)
+            return
+
+        limit = self.limit_for(scope["path"])
+        if not limit:
+            await self.app(scope, receive, send)
+            return
+
+        content_length = dict(scope["headers"]).get(b"content-length")
+        if content_length and content_length.isdigit():
+            if int(content_length) > limit:
+                await self._send_too_large(send, limit)
+                return
+            # The server refuses to read past the declared length
+            await self.app(scope, receive, send)
+            return
+
+        chunks = []
+        received = 0
+        more_body = True
+        while more_body:
+            message = await receive()
+            if message["type"] != "http.request":
+                # Client went away before finishing the body
+                return
+            chunk = message.get("body", b"")
+            received += len(chunk)
+            if received > limit:
+                await self._send_too_large(send, limit)
+                return
+            chunks.append(chunk)
+            more_body = message.get("more_body", False)
+
+        body_sent = False
+
+        async def buffered_receive():
+            nonlocal body_sent
+            if body_sent:
+                return await receive()
+            body_sent = True
+            return {"type": "http.request", "body": b"".join(chunks), "more_body": False}
+
+        await self.app(scope, buffered_receive, send)
+
+    @staticmethod
+    async def _send_too_large(send, limit: int):
+        body = json.dumps({"detail": f"Request body exceeds {limit} bytes"}).encode("utf-8")
+        await send({
+            "type": "http.response.start",
+            "status": 413,
+            "headers": [
+                (b"content-type", b"application/json"),
+                (b"content-length", str(len(body)).encode("ascii")),
+            ],
+        })
+        await send({"type": "http.response.body", "body": body})
+
+
+class HttpMetricsMiddleware:
+    """
+    Record request count, duration and in-flight requests for the SLO dashboards.
+
+    Requests are labelled with the template of the route that handled them
+    (e.g. /api/workflows/{workflow_id}), never the raw path, so IDs in the
+    URL do not create a new time series per request. The route is only
+    known after routing, so the in-flight gauge is labelled by method alone.
+    """
+
+    def __init__(self, app):
+        self.app = app
+
+    async def __call__(self, scope, receive, send):
+        if scope["type"] != "http":
+            await self.app(scope, receive, send)
+            return
+
+        method = scope["method"]
+        status_code = 500
+        start_time = time.perf_counter()
+
+        async def recording_send(message):
+            nonlocal status_code
+            if message["type"] == "http.response.start":
+                status_code = message["status"]
+            await send(message)
+
+        metrics.record_http_request_started(method)
+        try:
+            await self.app(scope, receive, recording_send)
+        finally:
+            metrics.record_http_request_finished(
+                method, route_template(scope), status_code, time.perf_counter() - start_time
+            )
+
+
+class RequestIdMiddleware:
+    """
+    Give every request an ID for log correlation and return it as X-Request-ID.
+
+    The X-Request-ID a client or the gateway sent is kept if well-formed,
+    otherwise a new ID is generated. WebSocket sessions get one as well,
+    returned on the handshake. The ID is also stored in the request state,
+    so the 500 handler, which runs outside all middleware, can return it.
+    """
+
+    def __init__(self, app):
+        self.app = app
+
+    async def __call__(self, scope, receive, send):
+        if scope["type"] not in ("http", "websocket"):
+            await self.app(scope, receive, send)
+            return
+
+        header = dict(scope["headers"]).get(REQUEST_ID_HEADER.lower().encode("ascii"))
+        request_id = request_id_from_header(header.decode("latin-1") if header else None)
+        scope.setdefault("state", {})["request_id"] = request_id
+
+        async def send_with_request_id(message):
+            if message["type"] in ("http.response.start", "websocket.accept"):
+                headers = list(message.get("headers", []))
+                headers.append((REQUEST_ID_HEADER.lower().encode("ascii"), request_id.encode("ascii")))
+                message = {**message, "headers": headers}
+            await send(message)
+
+        token = set_request_id(request_id)
+        try:
+            await self.app(scope, receive, send_with_request_id)
+        finally:
+            reset_request_id(token)
+
+
+class ApiVersionMiddleware:
+    """
+    Serve the API under /api/v{version} and negotiate the version of /api paths.
+
+    Routes are mounted under /api; a versioned path is routed to the same
+    handler with its version segment stripped. Unversioned /api paths stay
+    an alias of the version named in the API-Version header, or of the
+    latest version when the client names none, so existing clients keep
+    working. Unsupported versions are refused: 404 in the path, 400 in the
+    header. API responses and WebSocket handshakes report the version served.
+    """
+
+    def __init__(self, app):
+        self.app = app
+
+    async def __call__(self, scope, receive, send):
+        path = scope.get("path", "")
+        if scope["type"] not in ("http", "websocket") or not (path == "/api" or path.startswith("/api/")):
+            await self.app(scope, receive, send)
+            return
+
+        match = VERSIONED_PATH_PATTERN.match(path)
+        if match:
+            version, rest = match.group(1), match.group(2) or ""
+            if version not in SUPPORTED_API_VERSIONS:
+                await self._refuse(scope, receive, send, 404, f"Unsupported API version v{version}")
+                return
+            # Rewritten in place: outer middleware reads the matched route from this scope
+            scope["path"] = "/api" + rest
+            scope["raw_path"] = scope["path"].encode("utf-8")
+        else:
+            header = dict(scope["headers"]).get(API_VERSION_HEADER.lower().encode("ascii"))
+            version = header.decode("latin-1").strip() if header else SUPPORTED_API_VERSIONS[-1]
+            if version not in SUPPORTED_API_VERSIONS:
+                await self._refuse(scope, receive, send, 400, f"Unsupported API version {version}")
+                return
+        scope.setdefault("state", {})["api_version"] = version
+
+        async def send_with_api_version(message):
+            if message["type"] in ("http.response.start", "websocket.accept"):
+                headers = list(message.get("headers", []))
+                headers.append((API_VERSION_HEADER.lower().encode("ascii"), version.encode("latin-1")))
+                message = {**message, "headers": headers}
+            await send(message)
+
+        await self.app(scope, receive, send_with_api_version)
+
+    @staticmethod
+    async def _refuse(scope, receive, send, status_code: int, detail: str):
+        if scope["type"] == "websocket":
+            # Closing before accepting makes the server answer the handshake with 403
+            await receive()
+            await send({"type": "websocket.close", "code": 1008, "reason": detail})
+            return
+        body = json.dumps({"detail": detail, "supported_versions": list(SUPPORTED_API_VERSIONS)}).encode("utf-8")
+        await send({
+            "type": "http.response.start",
+            "status": status_code,
+            "headers": [
+                (b"content-type", b"application/json"),
+                (b"content-length", str(len(body)).encode("ascii")),
+            ],
+        })
+        await send({"type": "http.response.body", "body": body})
+
+
+def route_template(scope) -> str:
+    """Get the path template of the route that handled a request."""
+    route = scope.get("route")
+    return getattr(route, "path", None) or UNMATCHED_ROUTE
@@ -0,0 +1,61 @@
+"""Administrative endpoints."""
+
+from fastapi import APIRouter, Depends, HTTPException, Query
+
+from services.errors import InvalidTransitionError, NotFoundError
+from services.outbox_service import OutboxService
+from api.dependencies import get_outbox_service, get_admin_user_id
+
+router = APIRouter(prefix="/api/admin", tags=["admin"])
+
+
+@router.get("/outbox/dead-letters")
+async def list_dead_letters(
+    limit: int = Query(50, ge=1, le=500),
+    offset: int = Query(0, ge=0),
+    outbox_service: OutboxService = Depends(get_outbox_service),
+    admin_user_id: str = Depends(get_admin_user_id),
+):
+    """List outbox events that exhausted their delivery retries."""
+    events = outbox_service.list_dead_letters(limit, offset)
+    return {"events": events, "limit": limit, "offset": offset}
+
+
+@router.post("/outbox/dead-letters/{event_id}/requeue", status_code=200)
+async def requeue_dead_letter(
+    event_id: str,
+    outbox_service: OutboxService = Depends(get_outbox_service),
+    admin_user_id: str = Depends(get_admin_user_id),
+):
+    """Requeue a dead-lettered outbox event for another delivery attempt."""
+    try:
+        event = outbox_service.requeue_dead_letter(event_id)
+        return {
+            "event_id": event["id"],
+            "status": event["status"],
+            "message": "Outbox event requeued"
+        }
+    except NotFoundError as e:
+        raise HTTPException(status_code=404, detail=str(e))
+    except InvalidTransitionError as e:
+        raise HTTPException(status_code=409, detail=str(e))
+
+
+@router.post("/outbox/{event_id}/redeliver", status_code=200)
+async def redeliver_event(
+    event_id: str,
+    outbox_service: OutboxService = Depends(get_outbox_service),
+    admin_user_id: str = Depends(get_admin_user_id),
+):
+    """Reset an undelivered outbox event so the publisher delivers it again."""
+    try:
+        event = outbox_service.redeliver_event(event_id)
+        return {
+            "event_id": event["id"],
+            "status": event["status"],
+            "message": "Outbox event scheduled for redelivery"
+        }
+    except NotFoundError as e:
+        raise HTTPException(status_code=404, detail=str(e))
+    except InvalidTransitionError as e:
+        raise HTTPException(status_code=409, detail=str(e))
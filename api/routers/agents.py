@@ -0,0 +1,21 @@
+"""Agent capability endpoints."""
+
+from fastapi import APIRouter, Depends
+
+from services.agent_capabilities import AgentCapabilitiesService
+from api.dependencies import get_capabilities_service, get_current_user_id
+
+router = APIRouter(prefix="/api/agents", tags=["agents"])
+
+
+@router.get("/capabilities")
+async def get_capabilities(
+    capabilities_service: AgentCapabilitiesService = Depends(get_capabilities_service),
+    user_id: str = Depends(get_current_user_id),
+):
+    """
+    List the agent types deepagents-runtime supports and their config schemas.
+    
+    Note: Authentication will be handled by SDK middleware in future implementation.
+    """
+    return await capabilities_service.get_capabilities()
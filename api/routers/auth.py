@@ -0,0 +1,153 @@
+"""Authentication endpoints."""
+
+import asyncio
+import logging
+import os
+from datetime import datetime, timezone
+from typing import Dict, Any
+from fastapi import APIRouter, Depends, HTTPException
+
+from core.auth import WS_TOKEN_AUDIENCE, get_jwt_manager, get_user_roles
+from models.auth import (
+    LoginRequest,
+    LoginResponse,
+    PasswordChangeRequest,
+    TokenRefreshResponse,
+    UserInfo,
+    WebSocketTokenResponse,
+)
+from services.errors import UserNotFoundError
+from services.token_revocation_service import TokenRevocationService
+from services.user_service import IncorrectPasswordError, UserService, WeakPasswordError
+from api.dependencies import (
+    get_current_user_id,
+    get_token_claims,
+    get_token_revocation_service,
+    get_user_service,
+)
+
+router = APIRouter(prefix="/api/auth", tags=["auth"])
+logger = logging.getLogger(__name__)
+
+
+@router.post("/login", response_model=LoginResponse)
+async def login(
+    credentials: LoginRequest,
+    user_service: UserService = Depends(get_user_service),
+):
+    """Authenticate with email and password and receive a JWT plus the user's profile."""
+    user = user_service.authenticate(credentials.email, credentials.password)
+    if not user:
+        logger.warning("Login failed: invalid credentials", extra={"email": credentials.email})
+        raise HTTPException(status_code=401, detail="Invalid email or password")
+    
+    roles = get_user_roles(user["id"])
+    jwt_manager = get_jwt_manager()
+    token, expires_at = jwt_manager.create_token(
+        user["id"], user["email"], roles, jwt_manager.token_ttl_seconds
+    )
+    
+    return LoginResponse(
+        token=token,
+        user_id=user["id"],
+        expires_at=expires_at,
+        user=UserInfo(
+            id=user["id"], name=user["name"], email=user["email"], roles=roles, created_at=user["created_at"]
+        ),
+    )
+
+
+@router.get("/me", response_model=UserInfo)
+async def get_current_user(
+    user_id: str = Depends(get_current_user_id),
+    user_service: UserService = Depends(get_user_service),
+):
+    """Return the authenticated user's current profile from the database."""
+    user = user_service.get_user(user_id)
+    if not user:
+        # The token is still valid but the account no longer exists
+        raise HTTPException(status_code=404, detail="User not found")
+    
+    return UserInfo(
+        id=user["id"],
+        name=user["name"],
+        email=user["email"],
+        roles=get_user_roles(user["id"]),
+        created_at=user["created_at"],
+    )
+
+
+@router.post("/password", status_code=200)
+async def change_password(
+    request: PasswordChangeRequest,
+    user_id: str = Depends(get_current_user_id),
+    user_service: UserService = Depends(get_user_service),
+):
+    """Change the authenticated user's password after verifying the current one."""
+    try:
+        await asyncio.to_thread(
+            user_service.change_password, user_id, request.current_password, request.new_password
+        )
+    except WeakPasswordError as e:
+        raise HTTPException(status_code=400, detail=str(e))
+    except UserNotFoundError as e:
+        raise HTTPException(status_code=404, detail=str(e))
+    except IncorrectPasswordError as e:
+        logger.warning("Password change failed: incorrect current password", extra={"user_id": user_id})
+        raise HTTPException(status_code=401, detail=str(e))
+    
+    return {"message": "Password changed successfully"}
+
+
+@router.post("/logout", status_code=200)
+async def logout(
+    claims: Dict[str, Any] = Depends(get_token_claims),
+    revocation_service: TokenRevocationService = Depends(get_token_revocation_service),
+):
+    """
+    Revoke the token used for this request and every other token of the user.
+    
+    The token is denylisted until its own expiry, and the user's token
+    cutoff moves to now, so tokens minted earlier by login or /refresh are
+    refused too. Logging in again issues a token that is accepted.
+    """
+    jti = claims.get("jti")
+    if not jti:
+        raise HTTPException(status_code=400, detail="Token has no ID and cannot be revoked")
+    
+    revocation_service.revoke_token(jti, datetime.fromtimestamp(claims["exp"], tz=timezone.utc))
+    revocation_service.revoke_user_tokens(claims["user_id"])
+    return {"message": "Logged out successfully"}
+
+
+@router.post("/refresh", response_model=TokenRefreshResponse)
+async def refresh_token(claims: Dict[str, Any] = Depends(get_token_claims)):
+    """
+    Exchange a valid token for a new one with a full lifetime.
+    
+    Expired or otherwise invalid tokens are refused with 401 by the auth
+    dependency, so clients must log in again once their token has lapsed.
+    """
+    jwt_manager = get_jwt_manager()
+    token, expires_at = jwt_manager.refresh_token(claims, jwt_manager.token_ttl_seconds)
+    return TokenRefreshResponse(token=token, expires_at=expires_at)
+
+
+@router.post("/ws-token", response_model=WebSocketTokenResponse)
+async def create_websocket_token(claims: Dict[str, Any] = Depends(get_token_claims)):
+    """
+    Mint a short-lived token for WebSocket connections.
+    
+    Browsers must pass WebSocket tokens in the query string, where they can
+    leak through logs and referrers. These tokens are scoped to the WebSocket
+    audience, so a leaked one cannot be used against the REST API.
+    """
+    duration_seconds = int(os.getenv("WS_TOKEN_TTL_SECONDS", "60"))
+    token, expires_at = get_jwt_manager().create_token(
+        claims["user_id"],
+        claims.get("username", ""),
+        claims.get("roles", []),
+        duration_seconds,
+        audience=WS_TOKEN_AUDIENCE,
+    )
+    return WebSocketTokenResponse(token=token, expires_at=expires_at)
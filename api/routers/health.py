@@ -1,20 +1,40 @@
-"""Health check endpoints."""
+"""
+Health check endpoints.
 
-from fastapi import APIRouter
+/health is pure liveness: it must never call the database or any other
+dependency, and answers 200 as long as the process can serve HTTP, so a
+database outage does not get every pod restarted. /ready is readiness and
+checks the dependencies this instance needs before it takes traffic,
+including the deepagents-runtime circuit breaker.
+"""
+
+from fastapi import APIRouter, Depends
+from fastapi.responses import JSONResponse
+
+from services.system_status import SystemStatusService
+from api.dependencies import get_system_status_service, limit_status_requests
 
 router = APIRouter(prefix="/api", tags=["health"])
 
 
+async def readiness_response(status_service: SystemStatusService) -> JSONResponse:
+    """Build the /ready answer from the readiness checks."""
+    readiness = await status_service.check_ready()
+    if not readiness["ready"]:
+        return JSONResponse({"status": "not_ready", "checks": readiness["checks"]}, status_code=503)
+    return JSONResponse({"status": "ready", "checks": readiness["checks"]})
+
+
 @router.get("/health")
 async def health():
-    """Health check endpoint."""
+    """Liveness check endpoint; never touches dependencies."""
     return {"status": "healthy"}
 
 
 @router.get("/ready")
-async def ready():
-    """Readiness check endpoint."""
-    return {"status": "ready"}
+async def ready(status_service: SystemStatusService = Depends(get_system_status_service)):
+    """Readiness check endpoint; 503 while the database is unreachable or the breaker is open."""
+    return await readiness_response(status_service)
 
 
 # Root level health endpoint for Kubernetes probes
@@ -23,11 +43,22 @@ health_router = APIRouter(tags=["health"])
 
 @health_router.get("/health")
 async def health_root():
-    """Health check endpoint at root level."""
+    """Liveness check endpoint at root level; never touches dependencies."""
     return {"status": "healthy"}
 
 
 @health_router.get("/ready")
-async def ready_root():
-    """Readiness check endpoint at root level."""
-    return {"status": "ready"}
\ No newline at end of file
+async def ready_root(status_service: SystemStatusService = Depends(get_system_status_service)):
+    """Readiness check endpoint at root level; 503 while the database is unreachable or the breaker is open."""
+    return await readiness_response(status_service)
+
+
+@health_router.get("/status", dependencies=[Depends(limit_status_requests)])
+async def system_status(status_service: SystemStatusService = Depends(get_system_status_service)):
+    """
+    Aggregated system status for status pages, cached for a few seconds and rate limited per client.
+    
+    Always answers 200; check "status" for "ok" or "degraded". Not meant for
+    Kubernetes probes, which should keep using /health and /ready.
+    """
+    return await status_service.get_status()
@@ -1,15 +1,94 @@
 """Refinement workflow endpoints."""
 
-from fastapi import APIRouter, Depends, HTTPException, status
+import hashlib
+import json
+import os
+from typing import Any, Dict, List, Optional
+
+from fastapi import APIRouter, Depends, Header, HTTPException, Query, Response, status
+from fastapi.responses import JSONResponse, StreamingResponse
 from datetime import datetime
 
+from models.job import validate_runtime_config
+from services.errors import (
+    AccessDeniedError,
+    DeepAgentsUnavailableError,
+    DraftFileVersionConflict,
+    InvalidTransitionError,
+    NotFoundError,
+    ProposalNotFoundError,
+    ProposalNotReadyError,
+)
+from services.event_store import EventVersionConflict
 from services.workflow_service import WorkflowService
 from services.orchestration_service import OrchestrationService
-from api.dependencies import get_workflow_service, get_orchestration_service, get_current_user_id
+from services.file_diff import diff_files
+from api.errors import InternalError
+from api.dependencies import (
+    get_current_user_id,
+    get_orchestration_service,
+    get_proposal_id,
+    get_stream_user_id,
+    get_version_number,
+    get_workflow_service,
+    require_workflow_write_access,
+)
+from api.routers import websockets as refinement_streams
+from api.routers.websockets import close_refinement_stream
 
 router = APIRouter(prefix="/api", tags=["refinements"])
 
 
+def compute_etag(body: Dict[str, Any]) -> str:
+    """Strong ETag of a JSON response body."""
+    digest = hashlib.sha256(json.dumps(body, sort_keys=True).encode()).hexdigest()
+    return f'"{digest[:32]}"'
+
+
+def etag_matches(if_none_match: Optional[str], etag: str) -> bool:
+    """Whether an If-None-Match header lists etag (weak comparison) or is *."""
+    if not if_none_match:
+        return False
+    tags = [tag.strip() for tag in if_none_match.split(",")]
+    return "*" in tags or any(tag.removeprefix("W/") == etag for tag in tags)
+
+
+def accepts_event_stream(accept: Optional[str]) -> bool:
+    """Whether an Accept header admits text/event-stream; a missing header admits anything."""
+    if not accept:
+        return True
+    for media_range in accept.split(","):
+        media_type, *params = [part.strip() for part in media_range.split(";")]
+        if media_type.lower() not in ("text/event-stream", "text/*", "*/*"):
+            continue
+        if media_range_quality(params) > 0:
+            return True
+    return False
+
+
+def media_range_quality(params: List[str]) -> float:
+    """Quality value of a media range's parameters; 1 when absent or malformed."""
+    for param in params:
+        name, _, value = param.partition("=")
+        if name.strip().lower() == "q":
+            try:
+                return float(value)
+            except ValueError:
+                return 1.0
+    return 1.0
+
+
+def require_event_stream_accept(accept: Optional[str] = Header(None)) -> None:
+    """Refuse requests that cannot take an event stream with 406, before any lookups are made."""
+    if not accepts_event_stream(accept):
+        raise HTTPException(status_code=406, detail="This endpoint only serves text/event-stream")
+
+
+def refinement_requires_spec() -> bool:
+    """Whether REFINEMENT_REQUIRES_SPEC blocks refining workflows that have no spec yet."""
+    return os.getenv("REFINEMENT_REQUIRES_SPEC", "false").lower() == "true"
+
+
 @router.post("/workflows/{workflow_id}/refinements", status_code=202)
 async def create_refinement(
     workflow_id: str,
@@ -27,11 +106,29 @@ async def create_refinement(
     workflow = workflow_service.get_workflow(workflow_id, user_id)
     if not workflow:
         raise HTTPException(status_code=404, detail="Workflow not found")
+    require_workflow_write_access(workflow)
     
     # Validate required fields - match Go test expectations
     if "instructions" not in refinement_data:
         raise HTTPException(status_code=400, detail="Invalid request")
     
+    # Without a draft or production version the agent has nothing to refine
+    if refinement_requires_spec() and not workflow_service.has_specification(workflow_id):
+        raise HTTPException(
+            status_code=409,
+            detail="Workflow has no specification to refine; create an initial draft or publish a version first"
+        )
+    
+    try:
+        runtime_config = validate_runtime_config(refinement_data.get("runtime_config"))
+    except ValueError as e:
+        raise HTTPException(status_code=400, detail=str(e))
+    
+    # resume=true continues the draft's last refinement thread instead of starting a new one
+    resume = refinement_data.get("resume", False)
+    if not isinstance(resume, bool):
+        raise HTTPException(status_code=400, detail="resume must be a boolean")
+    
     try:
         # Get or create draft
         draft_id = await orchestration_service.get_or_create_draft(
@@ -44,7 +141,9 @@ async def create_refinement(
             user_id=user_id,
             user_prompt=refinement_data["instructions"],
             context_file_path=refinement_data.get("context_file_path"),
-            context_selection=refinement_data.get("context_selection")
+            context_selection=refinement_data.get("context_selection"),
+            runtime_config=runtime_config,
+            resume=resume
         )
         
         # Return response matching Go implementation format
@@ -56,52 +155,104 @@ async def create_refinement(
             "created_at": datetime.utcnow().isoformat() + "Z"
         }
         
+    except NotFoundError as e:
+        raise HTTPException(status_code=404, detail=str(e))
+    except AccessDeniedError as e:
+        raise HTTPException(status_code=403, detail=str(e))
+    except InvalidTransitionError as e:
+        raise HTTPException(status_code=409, detail=str(e))
     except ValueError as e:
-        if "not found" in str(e).lower():
-            raise HTTPException(status_code=404, detail=str(e))
-        elif "access denied" in str(e).lower():
-            raise HTTPException(status_code=403, detail=str(e))
-        else:
-            raise HTTPException(status_code=400, detail=str(e))
+        raise HTTPException(status_code=400, detail=str(e))
+    except DeepAgentsUnavailableError:
+        raise HTTPException(status_code=503, detail="AI service temporarily unavailable")
     except Exception as e:
-        if "deepagents-runtime unavailable" in str(e):
-            raise HTTPException(status_code=503, detail="AI service temporarily unavailable")
-        else:
-            raise HTTPException(status_code=500, detail="Failed to create refinement proposal")
+        raise InternalError("Failed to create refinement proposal") from e
+
+
+# Checked as a route dependency so it runs before authentication
+@router.get("/refinements/{thread_id}/events", dependencies=[Depends(require_event_stream_accept)])
+async def stream_refinement_events(
+    thread_id: str,
+    last_event_id: Optional[str] = Header(None),
+    user_id: str = Depends(get_stream_user_id),
+):
+    """
+    Stream a refinement's progress as Server-Sent Events, for clients behind proxies that block WebSockets.
+    
+    Events are the same as on the WebSocket stream. State updates carry
+    their seq as the event ID, so a reconnecting EventSource resumes after
+    the Last-Event-ID it sends.
+    """
+    if not refinement_streams.is_valid_thread_id(thread_id):
+        raise HTTPException(status_code=400, detail="Invalid thread_id")
+    if refinement_streams.draining:
+        raise HTTPException(status_code=503, detail="Server restarting")
+    if not await refinement_streams.can_access_thread(user_id, thread_id):
+        raise HTTPException(status_code=403, detail="Access denied to thread")
+    limiter = refinement_streams.stream_limiter
+    if limiter.limit and limiter.count(user_id) >= limiter.limit:
+        raise HTTPException(status_code=429, detail=refinement_streams.TOO_MANY_STREAMS_MESSAGE)
+    
+    try:
+        after_sequence = int(last_event_id or 0)
+    except ValueError:
+        after_sequence = 0
+    
+    return StreamingResponse(
+        refinement_streams.stream_refinement_events(thread_id, user_id, after_sequence),
+        media_type="text/event-stream",
+        # Keep intermediaries from caching or buffering the stream
+        headers={"Cache-Control": "no-cache", "X-Accel-Buffering": "no"}
+    )
 
 
 @router.post("/refinements/{proposal_id}/approve", status_code=200)
+@router.post("/proposals/{proposal_id}/approve", status_code=200)
 async def approve_proposal(
-    proposal_id: str,
+    proposal_id: str = Depends(get_proposal_id),
     orchestration_service: OrchestrationService = Depends(get_orchestration_service),
     user_id: str = Depends(get_current_user_id),
 ):
     """
     Approve a refinement proposal.
     
+    Generated files that are malformed or outside the workspace are not
+    applied; if any were skipped the response is 207 Multi-Status and
+    lists them with the reason.
+    
     Note: Authentication will be handled by SDK middleware in future implementation.
     """
     try:
-        orchestration_service.approve_proposal(proposal_id, user_id)
+        result = orchestration_service.approve_proposal(proposal_id, user_id)
         
-        return {
+        body = {
             "proposal_id": proposal_id,
             "approved_at": datetime.utcnow().isoformat() + "Z",
-            "message": "Proposal approved and changes applied to draft"
+            "message": "Proposal approved and changes applied to draft",
+            "applied_files": result["applied_files"],
+            "skipped_files": [
+                {"path": path, "reason": reason} for path, reason in result["skipped_files"].items()
+            ]
         }
+        if body["skipped_files"]:
+            body["message"] = "Proposal approved; some generated files could not be applied"
+            return JSONResponse(body, status_code=status.HTTP_207_MULTI_STATUS)
+        return body
         
+    except ProposalNotFoundError:
+        raise HTTPException(status_code=404, detail="Proposal not found")
+    except ProposalNotReadyError:
+        raise HTTPException(status_code=400, detail="Proposal is not ready for approval")
+    except (InvalidTransitionError, DraftFileVersionConflict, EventVersionConflict) as e:
+        raise HTTPException(status_code=409, detail=str(e))
     except ValueError as e:
-        if "not found" in str(e).lower():
-            raise HTTPException(status_code=404, detail="Proposal not found")
-        elif "not ready" in str(e).lower():
-            raise HTTPException(status_code=400, detail="Proposal is not ready for approval")
-        else:
-            raise HTTPException(status_code=500, detail="Failed to approve proposal")
+        raise InternalError("Failed to approve proposal") from e
 
 
 @router.post("/refinements/{proposal_id}/reject", status_code=200)
+@router.post("/proposals/{proposal_id}/reject", status_code=200)
 async def reject_proposal(
-    proposal_id: str,
+    proposal_id: str = Depends(get_proposal_id),
     orchestration_service: OrchestrationService = Depends(get_orchestration_service),
     user_id: str = Depends(get_current_user_id),
 ):
@@ -118,22 +269,114 @@ async def reject_proposal(
             "message": "Proposal rejected and discarded"
         }
         
+    except ProposalNotFoundError:
+        raise HTTPException(status_code=404, detail="Proposal not found")
+    except (InvalidTransitionError, EventVersionConflict) as e:
+        raise HTTPException(status_code=409, detail=str(e))
     except ValueError as e:
-        if "not found" in str(e).lower():
-            raise HTTPException(status_code=404, detail="Proposal not found")
-        else:
-            raise HTTPException(status_code=500, detail="Failed to reject proposal")
+        raise InternalError("Failed to reject proposal") from e
+
+
+@router.post("/proposals/{proposal_id}/cancel", status_code=200)
+async def cancel_proposal(
+    proposal_id: str = Depends(get_proposal_id),
+    orchestration_service: OrchestrationService = Depends(get_orchestration_service),
+    user_id: str = Depends(get_current_user_id),
+):
+    """
+    Abort an in-flight refinement.
+    
+    Only pending or processing proposals can be cancelled; the runtime is
+    asked to stop the thread and open streams for it are closed.
+    
+    Note: Authentication will be handled by SDK middleware in future implementation.
+    """
+    try:
+        thread_id = await orchestration_service.cancel_proposal(proposal_id, user_id)
+    except ProposalNotFoundError:
+        raise HTTPException(status_code=404, detail="Proposal not found")
+    except InvalidTransitionError as e:
+        raise HTTPException(status_code=409, detail=str(e))
+    except ValueError as e:
+        raise InternalError("Failed to cancel proposal") from e
+    
+    if thread_id:
+        await close_refinement_stream(thread_id)
+    
+    return {
+        "proposal_id": proposal_id,
+        "status": "cancelled",
+        "cancelled_at": datetime.utcnow().isoformat() + "Z",
+        "message": "Refinement cancelled"
+    }
 
 
 @router.get("/proposals/{proposal_id}", status_code=200)
 async def get_proposal(
-    proposal_id: str,
+    proposal_id: str = Depends(get_proposal_id),
+    files: bool = Query(True),
     orchestration_service: OrchestrationService = Depends(get_orchestration_service),
     user_id: str = Depends(get_current_user_id),
 ):
     """
     Get proposal details and generated files.
     
+    Pass ?files=false to get only the metadata; clients polling a proposal's
+    status then don't download its (possibly large) generated files.
+    
+    Note: Authentication will be handled by SDK middleware in future implementation.
+    """
+    # Validate access
+    if not orchestration_service.can_access_proposal(proposal_id, user_id):
+        raise HTTPException(status_code=403, detail="Access denied to proposal")
+    
+    proposal = orchestration_service.get_proposal(proposal_id, include_files=files)
+    if not proposal:
+        raise HTTPException(status_code=404, detail="Proposal not found")
+    
+    return proposal
+
+@router.get("/proposals/{proposal_id}/status", status_code=200)
+async def get_proposal_status(
+    proposal_id: str = Depends(get_proposal_id),
+    if_none_match: Optional[str] = Header(None),
+    orchestration_service: OrchestrationService = Depends(get_orchestration_service),
+    user_id: str = Depends(get_current_user_id),
+):
+    """
+    Poll a refinement's progress, as a fallback for clients that cannot stream.
+    
+    The response carries an ETag; sending it back as If-None-Match gets a
+    304 until the status, step or file count changes.
+    
+    Note: Authentication will be handled by SDK middleware in future implementation.
+    """
+    # Validate access
+    if not orchestration_service.can_access_proposal(proposal_id, user_id):
+        raise HTTPException(status_code=403, detail="Access denied to proposal")
+    
+    proposal_status = orchestration_service.get_proposal_status(proposal_id)
+    if not proposal_status:
+        raise HTTPException(status_code=404, detail="Proposal not found")
+    
+    etag = compute_etag(proposal_status)
+    headers = {"ETag": etag, "Cache-Control": "no-cache"}
+    if etag_matches(if_none_match, etag):
+        return Response(status_code=304, headers=headers)
+    return JSONResponse(proposal_status, headers=headers)
+
+
+@router.get("/proposals/{proposal_id}/compare/{version_number}", status_code=200)
+async def compare_proposal_with_version(
+    version_number: int = Depends(get_version_number),
+    proposal_id: str = Depends(get_proposal_id),
+    workflow_service: WorkflowService = Depends(get_workflow_service),
+    orchestration_service: OrchestrationService = Depends(get_orchestration_service),
+    user_id: str = Depends(get_current_user_id),
+):
+    """
+    Diff a proposal's generated files against a published version of its workflow.
+    
     Note: Authentication will be handled by SDK middleware in future implementation.
     """
     # Validate access
@@ -144,4 +387,22 @@ async def get_proposal(
     if not proposal:
         raise HTTPException(status_code=404, detail="Proposal not found")
     
-    return proposal
\ No newline at end of file
+    workflow_id = orchestration_service.proposal_service.get_proposal_workflow_id(proposal_id)
+    if not workflow_id or not workflow_service.get_workflow(workflow_id, user_id):
+        raise HTTPException(status_code=404, detail="Workflow not found")
+    
+    version = workflow_service.get_version(workflow_id, version_number)
+    if not version:
+        raise HTTPException(status_code=404, detail="Version not found")
+    
+    comparison = diff_files(
+        version["files"],
+        proposal.get("generated_files") or {},
+        base_label=f"v{version_number}",
+        proposed_label="proposal"
+    )
+    return {
+        "proposal_id": proposal_id,
+        "version_number": version_number,
+        **comparison
+    }
@@ -1,22 +1,429 @@
 """WebSocket endpoints for real-time streaming."""
 
-import json
 import asyncio
 import logging
 import os
-from typing import Optional
+import re
+import time
+from collections import deque
+from typing import AsyncIterator, Awaitable, Callable, Dict, List, Optional, Set, Tuple
 from fastapi import APIRouter, WebSocket, WebSocketDisconnect, HTTPException, Query, Header
+from fastapi.responses import JSONResponse
 from fastapi.security import HTTPBearer
 import websockets
 import httpx
 
+from core.auth import WS_TOKEN_AUDIENCE, InvalidTokenError
 from core.metrics import metrics
+from core.origins import OriginPolicy
+from core.rate_limit import ConnectionLimiter
+from core.request_context import request_id_headers
+from services.deepagents_client import CancelEvent, get_operation_timeout
+from services.refinement_progress import FILES_PATHS, extract_progress, state_files
+from services.stream_events import StreamEvent
 from services.orchestration_service import OrchestrationService
-from api.dependencies import get_orchestration_service, get_database_url
+from api.dependencies import (
+    MISSING_CREDENTIALS_MESSAGE,
+    get_database_url,
+    get_orchestration_service,
+    get_snapshot_service,
+    unauthorized_body,
+    validate_access_token,
+)
 
 router = APIRouter(prefix="/api/ws", tags=["websockets"])
 logger = logging.getLogger(__name__)
 
+# Thread IDs are UUIDs or runtime-generated slugs; anything else is rejected before touching the DB
+THREAD_ID_PATTERN = re.compile(r"^[A-Za-z0-9][A-Za-z0-9_-]{0,254}$")
+
+# Heartbeat pings on both proxy legs so a peer that vanishes without a close
+# frame is detected instead of leaving the proxy tasks waiting forever
+DEFAULT_WS_HEARTBEAT_INTERVAL_SECONDS = 30
+DEFAULT_WS_HEARTBEAT_TIMEOUT_SECONDS = 10
+
+# Seconds without an upstream event before a refinement stream is failed; 0 disables
+DEFAULT_WEBSOCKET_IDLE_TIMEOUT_SECONDS = 300
+
+# How events are forwarded to a client that reads slower than the runtime streams:
+# "block" waits for the client, "drop_oldest" buffers and coalesces state updates,
+# "close" disconnects a client whose buffer fills up
+BACKPRESSURE_STRATEGIES = ("block", "drop_oldest", "close")
+DEFAULT_BACKPRESSURE_STRATEGY = "block"
+DEFAULT_WS_SEND_BUFFER_SIZE = 100
+
+# Minimum seconds between writes of a running refinement's progress to its proposal; 0 writes every update
+DEFAULT_PROGRESS_WRITE_INTERVAL_SECONDS = 1.0
+
+# Parsed once at startup from ALLOWED_ORIGINS
+origin_policy = OriginPolicy.from_env()
+
+# Open refinement streams (WebSocket or SSE) per user; 0 disables the limit
+DEFAULT_MAX_STREAMS_PER_USER = 10
+stream_limiter = ConnectionLimiter(int(os.getenv("MAX_STREAMS_PER_USER", str(DEFAULT_MAX_STREAMS_PER_USER))))
+TOO_MANY_STREAMS_MESSAGE = "Too many open refinement streams"
+
+# What to do when a refinement ends without proposing any files:
+# "complete" keeps it reviewable with an empty file set, "fail" fails it with no_changes
+EMPTY_RESULT_POLICIES = ("complete", "fail")
+DEFAULT_EMPTY_RESULT_POLICY = "complete"
+NO_CHANGES_SUMMARY = "No changes proposed"
+
+
+# Seconds shutdown waits for open refinement streams to finish before closing them
+DEFAULT_WS_SHUTDOWN_TIMEOUT_SECONDS = 25
+
+# Seconds a refinement keeps running after its WebSocket client disconnected, so
+# the client can reconnect with last_event_seq; 0 cancels it as soon as the client leaves
+DEFAULT_WS_DISCONNECT_GRACE_SECONDS = 30
+
+# Why a session is ended from outside the proxy: (close code, message)
+SESSION_CLOSE_REASONS = {
+    "cancelled": (1000, "Refinement cancelled"),
+    "server_restarting": (1012, "Server restarting"),
+}
+
+# Close callbacks of the proxy sessions open in this process, keyed by thread_id;
+# each takes a SESSION_CLOSE_REASONS key
+active_streams: Dict[str, Set[Callable[[str], Awaitable[None]]]] = {}
+
+# Proposal updates started by finished streams that have not been written yet
+pending_proposal_updates: Set[asyncio.Task] = set()
+
+# Pending cancellations of refinements whose client disconnected, keyed by thread_id
+abandoned_refinements: Dict[str, asyncio.Task] = {}
+
+# Set once shutdown starts draining; new streams are refused from then on
+draining = False
+
+
+async def close_refinement_stream(thread_id: str) -> int:
+    """
+    Close the open proxy sessions of a cancelled refinement.
+    
+    Only sessions served by this process are reached; sessions on other
+    replicas end when the runtime stops the cancelled thread.
+    
+    Returns:
+        Number of sessions closed
+    """
+    closed = await _close_sessions(thread_id, "cancelled")
+    if closed:
+        logger.info("Closed cancelled streams", extra={"thread_id": thread_id, "streams": closed})
+    return closed
+
+
+async def _close_sessions(thread_id: str, reason: str) -> int:
+    """Close the open proxy sessions of a thread for one of SESSION_CLOSE_REASONS."""
+    closers = list(active_streams.get(thread_id, ()))
+    for close in closers:
+        try:
+            await close(reason)
+        except Exception as e:
+            logger.error("Failed to close stream", extra={"thread_id": thread_id, "reason": reason, "error": str(e)})
+    return len(closers)
+
+
+def get_shutdown_timeout() -> float:
+    """Read WS_SHUTDOWN_TIMEOUT_SECONDS."""
+    return float(os.getenv("WS_SHUTDOWN_TIMEOUT_SECONDS", str(DEFAULT_WS_SHUTDOWN_TIMEOUT_SECONDS)))
+
+
+async def drain_refinement_streams(timeout: float) -> int:
+    """
+    Let open refinement streams finish before the server shuts down.
+    
+    New streams are refused, then open ones get up to timeout seconds to
+    reach their end event. Streams still open after that are closed with
+    1012 "Server restarting" without cancelling their refinement: the
+    client can reconnect to another replica with last_event_seq, and the
+    proposal reconciler finalizes the proposal if nobody does. Finally the
+    proposal updates of finished streams are written before returning.
+    
+    Args:
+        timeout: Seconds to wait for streams and proposal updates in total
+        
+    Returns:
+        Number of streams that had to be closed
+    """
+    global draining
+    draining = True
+    loop = asyncio.get_running_loop()
+    deadline = loop.time() + timeout
+    
+    while active_streams and loop.time() < deadline:
+        await asyncio.sleep(0.1)
+    
+    closed = 0
+    for thread_id in list(active_streams):
+        closed += await _close_sessions(thread_id, "server_restarting")
+    if closed:
+        logger.warning("Closed refinement streams still open at shutdown", extra={"streams": closed})
+    
+    if pending_proposal_updates:
+        _, unfinished = await asyncio.wait(
+            set(pending_proposal_updates), timeout=max(deadline - loop.time(), 1.0)
+        )
+        if unfinished:
+            logger.error("Proposal updates did not finish before shutdown", extra={"updates": len(unfinished)})
+    
+    return closed
+
+
+def get_disconnect_grace() -> float:
+    """Read WS_DISCONNECT_GRACE_SECONDS."""
+    return float(os.getenv("WS_DISCONNECT_GRACE_SECONDS", str(DEFAULT_WS_DISCONNECT_GRACE_SECONDS)))
+
+
+def schedule_abandoned_refinement_cancel(thread_id: str, grace: float) -> asyncio.Task:
+    """
+    Cancel a refinement whose client disconnected unless a client reattaches within grace seconds.
+    
+    Only reconnects to this process are seen; a client reconnecting to
+    another replica after the grace period finds the refinement cancelled.
+    """
+    async def cancel_unless_reattached():
+        await asyncio.sleep(grace)
+        if thread_id not in active_streams:
+            await cancel_abandoned_refinement(thread_id)
+    
+    def forget(task: asyncio.Task):
+        if abandoned_refinements.get(thread_id) is task:
+            del abandoned_refinements[thread_id]
+    
+    previous = abandoned_refinements.pop(thread_id, None)
+    if previous:
+        previous.cancel()
+    task = asyncio.create_task(cancel_unless_reattached())
+    abandoned_refinements[thread_id] = task
+    task.add_done_callback(forget)
+    return task
+
+
+def reattach_refinement(thread_id: str):
+    """Keep a refinement running whose client reconnected within the disconnect grace period."""
+    pending_cancel = abandoned_refinements.pop(thread_id, None)
+    if pending_cancel:
+        pending_cancel.cancel()
+        logger.info("Client reattached to refinement", extra={"thread_id": thread_id})
+
+
+def track_proposal_update(update: Awaitable[None]) -> asyncio.Task:
+    """Run a proposal update in the background, keeping it for shutdown to wait on."""
+    task = asyncio.create_task(update)
+    pending_proposal_updates.add(task)
+    task.add_done_callback(pending_proposal_updates.discard)
+    return task
+
+
+def get_progress_write_interval() -> float:
+    """Read PROGRESS_WRITE_INTERVAL_SECONDS."""
+    return float(os.getenv("PROGRESS_WRITE_INTERVAL_SECONDS", str(DEFAULT_PROGRESS_WRITE_INTERVAL_SECONDS)))
+
+
+class ProgressRecorder:
+    """
+    Persist a running refinement's progress on its proposal as state updates stream in.
+    
+    Writes run in the background and are throttled to one per interval;
+    updates arriving in between are coalesced so only the newest is
+    written, once the interval has passed. flush() writes the newest
+    progress right away.
+    """
+    
+    def __init__(self, thread_id: str, interval: float, clock: Callable[[], float] = time.monotonic):
+        self.thread_id = thread_id
+        self.interval = interval
+        self._clock = clock
+        self._pending: Optional[dict] = None
+        self._last_write: Optional[float] = None
+        self._writer: Optional[asyncio.Task] = None
+        self._flush_now = asyncio.Event()
+    
+    def record(self, state: dict):
+        """Note the progress of an on_state_update state, writing it when the throttle allows."""
+        self._pending = extract_progress(state)
+        if self._writer is None or self._writer.done():
+            self._writer = track_proposal_update(self._write_pending())
+    
+    async def flush(self):
+        """Write the newest progress now, regardless of the throttle."""
+        self._flush_now.set()
+        if self._writer is not None and not self._writer.done():
+            await self._writer
+        elif self._pending is not None:
+            await self._write_pending()
+    
+    async def _write_pending(self):
+        while self._pending is not None:
+            if self._last_write is not None and not self._flush_now.is_set():
+                wait = self._last_write + self.interval - self._clock()
+                if wait > 0:
+                    try:
+                        await asyncio.wait_for(self._flush_now.wait(), wait)
+                    except TimeoutError:
+                        pass
+            progress, self._pending = self._pending, None
+            self._last_write = self._clock()
+            await update_proposal_progress(self.thread_id, progress)
+
+
+class UpstreamIdleTimeout(Exception):
+    """Raised when deepagents-runtime sends no event within the idle timeout."""
+
+
+class ClientTooSlow(Exception):
+    """Raised when a client's send buffer overflows under the close strategy."""
+
+
+async def send_event(websocket, event: StreamEvent):
+    """Send an event to a WebSocket client as a text frame."""
+    await websocket.send_text(event.to_json())
+
+
+class ClientEventSender:
+    """
+    Forward events to the client according to a backpressure strategy.
+    
+    With "block" every send waits for the client. The other strategies queue
+    events for a writer task so reading from the runtime never waits on the
+    client: "drop_oldest" replaces a queued state update with a newer one and
+    drops the oldest event when the buffer is full, "close" raises
+    ClientTooSlow instead.
+    """
+    
+    def __init__(self, client_ws, strategy: str, buffer_size: int):
+        self.client_ws = client_ws
+        self.strategy = strategy
+        self.buffer_size = max(buffer_size, 1)
+        self.pending = deque()
+        self._queued = asyncio.Event()
+        self._idle = asyncio.Event()
+        self._idle.set()
+        self._writer = None
+        self._error = None
+    
+    async def send(self, event: StreamEvent):
+        """Send or queue an event; raises if the client failed or ClientTooSlow on overflow."""
+        if self.strategy == "block":
+            await send_event(self.client_ws, event)
+            return
+        if self._error:
+            raise self._error
+        
+        if self.strategy == "drop_oldest" and self._is_state_update(event) and self.pending \
+                and self._is_state_update(self.pending[-1]):
+            # Only the newest state matters to the client
+            self.pending[-1] = event
+        elif len(self.pending) >= self.buffer_size:
+            if self.strategy == "close":
+                raise ClientTooSlow(f"Client send buffer of {self.buffer_size} events overflowed")
+            self.pending.popleft()
+            self.pending.append(event)
+        else:
+            self.pending.append(event)
+        
+        self._idle.clear()
+        self._queued.set()
+        if self._writer is None:
+            self._writer = asyncio.create_task(self._write())
+    
+    async def drain(self):
+        """Wait until every queued event was sent (or the client failed)."""
+        await self._idle.wait()
+    
+    def stop(self):
+        """Stop the writer task, discarding unsent events."""
+        if self._writer:
+            self._writer.cancel()
+    
+    async def _write(self):
+        while True:
+            await self._queued.wait()
+            self._queued.clear()
+            try:
+                while self.pending:
+                    await send_event(self.client_ws, self.pending.popleft())
+            except Exception as e:
+                self._error = e
+                self.pending.clear()
+            self._idle.set()
+            if self._error:
+                return
+    
+    @staticmethod
+    def _is_state_update(event: StreamEvent) -> bool:
+        return event.event_type == "on_state_update"
+
+
+def get_backpressure_settings() -> Tuple[str, int]:
+    """Read WS_BACKPRESSURE_STRATEGY and WS_SEND_BUFFER_SIZE, falling back to blocking for unknown strategies."""
+    strategy = os.getenv("WS_BACKPRESSURE_STRATEGY", DEFAULT_BACKPRESSURE_STRATEGY)
+    if strategy not in BACKPRESSURE_STRATEGIES:
+        logger.warning(
+            "Unknown WS_BACKPRESSURE_STRATEGY, using the default",
+            extra={"strategy": strategy, "default": DEFAULT_BACKPRESSURE_STRATEGY}
+        )
+        strategy = DEFAULT_BACKPRESSURE_STRATEGY
+    buffer_size = int(os.getenv("WS_SEND_BUFFER_SIZE", str(DEFAULT_WS_SEND_BUFFER_SIZE)))
+    return strategy, buffer_size
+
+
+async def receive_with_idle_timeout(upstream, idle_timeout: float):
+    """Iterate over upstream messages, raising UpstreamIdleTimeout if one takes longer than idle_timeout."""
+    messages = aiter(upstream)
+    while True:
+        try:
+            # The window restarts with every message received
+            message = await asyncio.wait_for(anext(messages), idle_timeout or None)
+        except StopAsyncIteration:
+            return
+        except TimeoutError:
+            raise UpstreamIdleTimeout(f"No event from deepagents-runtime within {idle_timeout:g}s")
+        yield message
+
+
+def get_heartbeat_settings() -> Tuple[Optional[float], Optional[float]]:
+    """
+    Read the WebSocket ping interval and pong timeout from the environment.
+    
+    Returns:
+        Tuple of (interval, timeout) in seconds; both None when
+        WS_HEARTBEAT_INTERVAL_SECONDS is 0, which disables heartbeats
+    """
+    interval = float(os.getenv("WS_HEARTBEAT_INTERVAL_SECONDS", str(DEFAULT_WS_HEARTBEAT_INTERVAL_SECONDS)))
+    if interval <= 0:
+        return None, None
+    timeout = float(os.getenv("WS_HEARTBEAT_TIMEOUT_SECONDS", str(DEFAULT_WS_HEARTBEAT_TIMEOUT_SECONDS)))
+    return interval, timeout
+
+
+def get_empty_result_policy() -> str:
+    """Read EMPTY_REFINEMENT_POLICY, falling back to the default for unknown values."""
+    policy = os.getenv("EMPTY_REFINEMENT_POLICY", DEFAULT_EMPTY_RESULT_POLICY)
+    if policy not in EMPTY_RESULT_POLICIES:
+        logger.warning(
+            "Unknown EMPTY_REFINEMENT_POLICY, using the default",
+            extra={"policy": policy, "default": DEFAULT_EMPTY_RESULT_POLICY}
+        )
+        return DEFAULT_EMPTY_RESULT_POLICY
+    return policy
+
+
+def is_valid_thread_id(thread_id: str) -> bool:
+    """Check that a thread_id has the shape of a runtime thread ID."""
+    return bool(THREAD_ID_PATTERN.match(thread_id))
+
+
+async def reject_websocket(websocket: WebSocket, status_code: int, detail: str):
+    """Refuse a WebSocket handshake with an HTTP error response."""
+    body = unauthorized_body(detail) if status_code == 401 else {"detail": detail}
+    try:
+        await websocket.send_denial_response(JSONResponse(body, status_code=status_code))
+    except RuntimeError:
+        # Server lacks the denial response extension - fall back to a policy-violation close
+        await websocket.close(code=1008, reason=detail)
+
 
 async def validate_websocket_auth(
     websocket: WebSocket,
@@ -30,7 +437,10 @@ async def validate_websocket_auth(
     1. Query parameter: ?token=<jwt_token> (WebSocket standard)
     2. Authorization header: Authorization: Bearer <jwt_token> (fallback)
     
-    Note: JWT validation will be handled by SDK middleware in future implementation.
+    Accepts regular tokens as well as short-lived WS-scoped tokens from
+    POST /api/auth/ws-token, which are preferred in the query string.
+    Must run before the handshake is accepted: failures are refused with
+    the same 401 body as REST routes.
     """
     jwt_token = None
     
@@ -42,14 +452,17 @@ async def validate_websocket_auth(
         jwt_token = authorization[7:]
     
     if not jwt_token:
-        await websocket.close(code=1008, reason="Missing JWT token")
+        await reject_websocket(websocket, 401, MISSING_CREDENTIALS_MESSAGE)
         return None
     
-    # TODO: Replace with SDK-based JWT validation
-    # For now, this will fail until SDK middleware is integrated
-    logger.warning("JWT validation not yet implemented - SDK integration pending")
-    await websocket.close(code=1008, reason="Authentication not configured")
-    return None
+    try:
+        claims = validate_access_token(jwt_token, accepted_audiences=(None, WS_TOKEN_AUDIENCE))
+    except InvalidTokenError as e:
+        logger.warning("WebSocket JWT validation failed", extra={"error": str(e)})
+        await reject_websocket(websocket, 401, str(e))
+        return None
+    
+    return claims["user_id"]
 
 
 async def can_access_thread(user_id: str, thread_id: str) -> bool:
@@ -66,16 +479,44 @@ async def can_access_thread(user_id: str, thread_id: str) -> bool:
         return orchestration_service.can_access_proposal(proposal["id"], user_id)
         
     except Exception as e:
-        logger.error(f"Error checking thread access: {e}")
+        logger.error("Error checking thread access", extra={"thread_id": thread_id, "error": str(e)})
         return False
 
 
+def upstream_handshake_headers() -> dict:
+    """Keyword argument forwarding the request ID on the runtime stream handshake."""
+    # websockets 14 made connect() its new client, which renamed extra_headers
+    major_version = int(websockets.__version__.split(".")[0])
+    keyword = "additional_headers" if major_version >= 14 else "extra_headers"
+    return {keyword: request_id_headers()}
+
+
+def get_upstream_stream_url(thread_id: str) -> str:
+    """Build the deepagents-runtime WebSocket URL streaming a thread's events."""
+    # Use separate WS URL if provided, otherwise derive from HTTP URL
+    deepagents_ws_url = os.getenv("DEEPAGENTS_RUNTIME_WS_URL")
+    if not deepagents_ws_url:
+        deepagents_base_url = os.getenv("DEEPAGENTS_RUNTIME_URL", "http://deepagents-runtime:8000")
+        # Convert HTTP URL to WebSocket URL
+        deepagents_ws_url = deepagents_base_url.replace("http://", "ws://").replace("https://", "wss://")
+    return f"{deepagents_ws_url}/stream/{thread_id}"
+
+
+@router.get("/refinements/{thread_id}", include_in_schema=False)
+async def refinement_stream_without_upgrade(thread_id: str):
+    """Answer plain HTTP requests to the refinement stream with 400 instead of 404, without any lookups."""
+    raise HTTPException(
+        status_code=400, detail="WebSocket upgrade required", headers={"Upgrade": "websocket"}
+    )
+
+
 @router.websocket("/refinements/{thread_id}")
 async def stream_refinement(
     websocket: WebSocket,
     thread_id: str,
     token: Optional[str] = Query(None),
-    authorization: Optional[str] = Header(None)
+    authorization: Optional[str] = Header(None),
+    last_event_seq: int = Query(0)
 ):
     """
     WebSocket endpoint to stream real-time progress from deepagents-runtime.
@@ -83,41 +524,66 @@ async def stream_refinement(
     Authentication via:
     - Query parameter: ?token=<jwt_token>
     - Authorization header: Authorization: Bearer <jwt_token>
+    
+    on_state_update events carry a "seq" number. A reconnecting client
+    passes the last one it saw as ?last_event_seq= and first receives the
+    stored state updates it missed, before live events are forwarded.
     """
-    await websocket.accept()
+    if not is_valid_thread_id(thread_id):
+        logger.warning("Rejected WebSocket connection with malformed thread_id", extra={"thread_id": thread_id[:64]})
+        await reject_websocket(websocket, 400, "Invalid thread_id")
+        return
+    
+    origin = websocket.headers.get("origin")
+    if not origin_policy.is_allowed(origin, websocket.headers.get("host")):
+        logger.warning("Rejected WebSocket connection from disallowed origin", extra={"origin": origin[:256]})
+        await reject_websocket(websocket, 403, "Origin not allowed")
+        return
+    
+    if draining:
+        await reject_websocket(websocket, 503, "Server restarting")
+        return
+    
+    # Validate authentication
+    user_id = await validate_websocket_auth(websocket, token, authorization)
+    if not user_id:
+        return  # Handshake already refused by validate_websocket_auth
+    
+    if not stream_limiter.acquire(user_id):
+        logger.warning("Rejected WebSocket connection: too many open streams", extra={"user_id": user_id})
+        await reject_websocket(websocket, 429, TOO_MANY_STREAMS_MESSAGE)
+        return
     
     # Record WebSocket connection metrics
     metrics.record_websocket_connection(thread_id)
     
     try:
-        # Validate authentication
-        user_id = await validate_websocket_auth(websocket, token, authorization)
-        if not user_id:
-            return  # Connection already closed by validate_websocket_auth
+        # Accepted inside the try so the stream slot is released however the session ends
+        await websocket.accept()
         
-        logger.info(f"WebSocket connection for thread_id: {thread_id}, user_id: {user_id}")
+        logger.info("WebSocket connection", extra={"thread_id": thread_id, "user_id": user_id})
         
         # Verify user can access this thread_id
         if not await can_access_thread(user_id, thread_id):
-            logger.warning(f"Access denied for user {user_id} to thread {thread_id}")
+            logger.warning("Access denied to thread", extra={"thread_id": thread_id, "user_id": user_id})
             await websocket.close(code=1008, reason="Access denied to thread")
             return
         
-        # Connect to deepagents-runtime WebSocket using environment variable
-        # Use separate WS URL if provided, otherwise derive from HTTP URL
-        deepagents_ws_url = os.getenv("DEEPAGENTS_RUNTIME_WS_URL")
-        if not deepagents_ws_url:
-            deepagents_base_url = os.getenv("DEEPAGENTS_RUNTIME_URL", "http://deepagents-runtime:8000")
-            # Convert HTTP URL to WebSocket URL
-            deepagents_ws_url = deepagents_base_url.replace("http://", "ws://").replace("https://", "wss://")
+        await replay_thread_snapshots(websocket, thread_id, last_event_seq)
         
         try:
             # Connect to deepagents WebSocket endpoint
-            ws_url = f"{deepagents_ws_url}/stream/{thread_id}"
-            logger.info(f"Attempting WebSocket connection to: {ws_url}")
+            ws_url = get_upstream_stream_url(thread_id)
+            logger.info("Attempting WebSocket connection", extra={"url": ws_url})
             
-            async with websockets.connect(ws_url) as deepagents_ws:
-                logger.info(f"Connected to deepagents-runtime WebSocket for thread: {thread_id}")
+            # The client leg is pinged by the server itself (see api.main)
+            ping_interval, ping_timeout = get_heartbeat_settings()
+            # Only the handshake has a deadline; the stream may run for as long as the refinement does
+            async with websockets.connect(
+                ws_url, ping_interval=ping_interval, ping_timeout=ping_timeout,
+                open_timeout=get_operation_timeout("stream_connect"), **upstream_handshake_headers()
+            ) as deepagents_ws:
+                logger.info("Connected to deepagents-runtime WebSocket", extra={"thread_id": thread_id})
                 
                 # Start bidirectional proxying
                 await proxy_websocket_with_state_extraction(
@@ -125,17 +591,14 @@ async def stream_refinement(
                 )
                 
         except Exception as e:
-            logger.error(f"Failed to connect to deepagents-runtime: {e}")
+            logger.error("Failed to connect to deepagents-runtime", extra={"thread_id": thread_id, "error": str(e)})
             # Send error to client
-            await websocket.send_json({
-                "event_type": "error",
-                "data": {"error": "Failed to connect to AI service"}
-            })
+            await send_event(websocket, StreamEvent.error("Failed to connect to AI service"))
             
     except WebSocketDisconnect:
-        logger.info(f"WebSocket disconnected for thread: {thread_id}")
+        logger.info("WebSocket disconnected", extra={"thread_id": thread_id})
     except Exception as e:
-        logger.error(f"WebSocket error for thread {thread_id}: {e}")
+        logger.error("WebSocket error", extra={"thread_id": thread_id, "error": str(e)})
         try:
             await websocket.close(code=1011, reason="Internal server error")
         except:
@@ -143,6 +606,7 @@ async def stream_refinement(
     finally:
         # Record WebSocket disconnection metrics
         metrics.record_websocket_disconnection(thread_id)
+        stream_limiter.release(user_id)
 
 
 async def proxy_websocket_with_state_extraction(
@@ -152,58 +616,145 @@ async def proxy_websocket_with_state_extraction(
     user_id: str
 ):
     """Handle bidirectional WebSocket proxying with state extraction."""
-    final_files = {}
+    final_files: Optional[dict] = None
+    stream_finished = False
+    # Safety valve against a runaway upstream; 0 disables the limit
+    max_events = int(os.getenv("WS_MAX_EVENTS_PER_SESSION", "10000"))
+    events_received = 0
+    idle_timeout = float(os.getenv("WEBSOCKET_IDLE_TIMEOUT", str(DEFAULT_WEBSOCKET_IDLE_TIMEOUT_SECONDS)))
+    sender = ClientEventSender(client_ws, *get_backpressure_settings())
+    progress = ProgressRecorder(thread_id, get_progress_write_interval())
+    
+    async def close_session(reason: str):
+        """End the session because its refinement was cancelled or the server is shutting down."""
+        nonlocal stream_finished
+        # The disconnect must not fail or cancel the refinement
+        stream_finished = True
+        sender.stop()
+        code, message = SESSION_CLOSE_REASONS[reason]
+        try:
+            await send_event(client_ws, StreamEvent.error(message, reason))
+            await client_ws.close(code=code, reason=message)
+        except RuntimeError:
+            pass  # Client already gone
+        if reason == "cancelled":
+            await send_upstream_cancel(deepagents_ws, thread_id, reason)
+        await deepagents_ws.close()
     
     async def client_to_deepagents():
         """Forward messages from client to deepagents-runtime."""
+        nonlocal stream_finished
         try:
             while True:
                 # Receive message from client
                 message = await client_ws.receive_text()
                 # Forward to deepagents-runtime
                 await deepagents_ws.send(message)
-                logger.debug(f"Forwarded client message to deepagents-runtime for thread: {thread_id}")
+                logger.debug("Forwarded client message to deepagents-runtime", extra={"thread_id": thread_id})
         except WebSocketDisconnect:
-            logger.info(f"Client disconnected for thread: {thread_id}")
+            logger.info("Client disconnected", extra={"thread_id": thread_id})
+            if not stream_finished:
+                grace = get_disconnect_grace()
+                if grace > 0:
+                    # The client may reconnect with last_event_seq; the run is only
+                    # cancelled if nobody does before the grace period ends
+                    stream_finished = True
+                    schedule_abandoned_refinement_cancel(thread_id, grace)
+                else:
+                    # Nobody is listening anymore - stop the upstream run instead of letting it burn resources
+                    await send_upstream_cancel(deepagents_ws, thread_id, "client_disconnected")
+                    await cancel_abandoned_refinement(thread_id)
+                await deepagents_ws.close()
         except Exception as e:
-            logger.error(f"Client->DeepAgents proxy error for thread {thread_id}: {e}")
+            logger.error("Client->DeepAgents proxy error", extra={"thread_id": thread_id, "error": str(e)})
     
     async def deepagents_to_client():
         """Forward events from deepagents-runtime to client and extract state."""
-        nonlocal final_files
+        nonlocal final_files, stream_finished, events_received
         try:
-            async for message in deepagents_ws:
+            async for message in receive_with_idle_timeout(deepagents_ws, idle_timeout):
+                events_received += 1
+                if max_events and events_received > max_events:
+                    stream_finished = True
+                    logger.error(
+                        "Event limit exceeded, terminating session",
+                        extra={"thread_id": thread_id, "max_events": max_events}
+                    )
+                    await update_proposal_status_to_failed(thread_id, "event_flood")
+                    await sender.drain()
+                    await send_event(
+                        client_ws, StreamEvent.error("Refinement produced too many events", "event_flood")
+                    )
+                    await client_ws.close(code=1008, reason="Event limit exceeded")
+                    await deepagents_ws.close()
+                    break
+                
                 try:
-                    event = json.loads(message)
-                    logger.debug(f"Received event from deepagents-runtime for thread {thread_id}: {event.get('event_type')}")
+                    event = StreamEvent.from_message(message)
+                    logger.debug(
+                        "Received event from deepagents-runtime",
+                        extra={"thread_id": thread_id, "event_type": event.event_type}
+                    )
                     
                     # Extract files from on_state_update events
-                    if event.get("event_type") == "on_state_update":
-                        if "files" in event.get("data", {}):
-                            final_files = event["data"]["files"]
-                            logger.info(f"Extracted {len(final_files)} files from on_state_update for thread: {thread_id}")
+                    files = record_state_update(thread_id, event, progress)
+                    if files is not None:
+                        final_files = files
                     
                     # Forward event to client
-                    await client_ws.send_json(event)
+                    await sender.send(event)
                     
                     # Handle completion
-                    if event.get("event_type") == "end":
-                        logger.info(f"Received end event for thread: {thread_id}, updating proposal with files")
-                        # Update proposal with final files in background
-                        asyncio.create_task(update_proposal_with_files(thread_id, final_files))
+                    if event.event_type == "end":
+                        stream_finished = True
+                        await progress.flush()
+                        finish_refinement(thread_id, final_files)
                         break
                         
-                except json.JSONDecodeError as e:
-                    logger.error(f"Failed to parse deepagents message: {e}")
+                except ValueError as e:
+                    logger.error("Failed to parse deepagents message", extra={"thread_id": thread_id, "error": str(e)})
+                except ClientTooSlow:
+                    raise
                 except Exception as e:
-                    logger.error(f"Error processing deepagents message: {e}")
-                    
+                    logger.error("Error processing deepagents message", extra={"thread_id": thread_id, "error": str(e)})
+            
+            # Deliver what is still buffered, including the end event
+            await sender.drain()
+            
+        except ClientTooSlow as e:
+            # The refinement itself is unaffected; the client may reconnect with
+            # last_event_seq, otherwise the reconciler finalizes the proposal
+            stream_finished = True
+            logger.warning("Client too slow, closing client", extra={"thread_id": thread_id, "error": str(e)})
+            sender.stop()
+            try:
+                await client_ws.close(code=1013, reason="Client too slow")
+            except RuntimeError:
+                pass  # Client already gone
+            await deepagents_ws.close()
+        except UpstreamIdleTimeout as e:
+            stream_finished = True
+            logger.error("Upstream idle timeout, terminating session", extra={"thread_id": thread_id, "error": str(e)})
+            await update_proposal_status_to_failed(thread_id, "idle_timeout")
+            await sender.drain()
+            await send_event(client_ws, StreamEvent.error("Refinement timed out", "idle_timeout"))
+            await client_ws.close(code=1011, reason="Refinement timed out")
+            await deepagents_ws.close()
         except Exception as e:
-            logger.error(f"DeepAgents->Client proxy error for thread {thread_id}: {e}")
+            logger.error("DeepAgents->Client proxy error", extra={"thread_id": thread_id, "error": str(e)})
             # Update proposal status to failed
-            asyncio.create_task(update_proposal_status_to_failed(thread_id, str(e)))
+            track_proposal_update(update_proposal_status_to_failed(thread_id, str(e)))
+            if not stream_finished:
+                # The upstream is gone (e.g. missed heartbeat) - release the client side too
+                stream_finished = True
+                try:
+                    await client_ws.close(code=1011, reason="Upstream connection lost")
+                except RuntimeError:
+                    pass  # Client already gone
     
     # Run both proxy directions concurrently
+    reattach_refinement(thread_id)
+    active_streams.setdefault(thread_id, set()).add(close_session)
     try:
         await asyncio.gather(
             client_to_deepagents(),
@@ -211,41 +762,298 @@ async def proxy_websocket_with_state_extraction(
             return_exceptions=True
         )
     except Exception as e:
-        logger.error(f"WebSocket proxy error for thread {thread_id}: {e}")
+        logger.error("WebSocket proxy error", extra={"thread_id": thread_id, "error": str(e)})
+    finally:
+        sender.stop()
+        sessions = active_streams.get(thread_id)
+        if sessions is not None:
+            sessions.discard(close_session)
+            if not sessions:
+                del active_streams[thread_id]
+        # Every way out (end, timeout, failure, flood, cancel, disconnect) trims the snapshots
+        prune_thread_snapshots(thread_id)
+    
+    logger.info("WebSocket proxy session ended", extra={"thread_id": thread_id})
+
+
+def record_state_update(thread_id: str, event: StreamEvent, progress: ProgressRecorder) -> Optional[dict]:
+    """
+    Store an on_state_update event's snapshot and progress, tagging the event with its sequence.
+    
+    Returns:
+        The files the state carries, or None for other events and states without files
+    """
+    if event.event_type != "on_state_update":
+        return None
+    sequence = save_thread_snapshot(thread_id, event.data)
+    if sequence is not None:
+        event.seq = sequence
+    progress.record(event.data)
+    files = state_files(event.data)
+    if files is None:
+        return None
+    logger.info("Extracted files from on_state_update", extra={"thread_id": thread_id, "files": len(files)})
+    return files
+
+
+def finish_refinement(thread_id: str, final_files: Optional[dict]):
+    """
+    Finalize the proposal of a refinement whose end event arrived, in the background.
+    
+    final_files is None when no state update carried files under any known
+    path, which is logged since the runtime may have moved them elsewhere.
+    """
+    if final_files is None:
+        logger.warning(
+            "No files found in refinement state updates",
+            extra={"thread_id": thread_id, "files_paths": [".".join(path) for path in FILES_PATHS]}
+        )
+    if final_files:
+        logger.info("Received end event, updating proposal with files", extra={"thread_id": thread_id})
+        # Update proposal with final files in background
+        track_proposal_update(update_proposal_with_files(thread_id, final_files))
+    elif get_empty_result_policy() == "fail":
+        logger.info("Refinement proposed no changes, failing proposal", extra={"thread_id": thread_id})
+        track_proposal_update(update_proposal_status_to_failed(thread_id, "no_changes"))
+    else:
+        logger.info("Refinement proposed no changes", extra={"thread_id": thread_id})
+        track_proposal_update(update_proposal_with_files(thread_id, {}, NO_CHANGES_SUMMARY))
+
+
+def format_sse(event: StreamEvent) -> str:
+    """Encode an event as a Server-Sent Events message, using its seq as the event ID."""
+    lines = []
+    if event.seq is not None:
+        lines.append(f"id: {event.seq}")
+    lines.append(f"data: {event.to_json()}")
+    return "\n".join(lines) + "\n\n"
+
+
+async def stream_refinement_events(thread_id: str, user_id: str, after_sequence: int) -> AsyncIterator[str]:
+    """
+    Stream a refinement's events as Server-Sent Events for clients that cannot use WebSockets.
+    
+    Missed state updates after after_sequence are replayed first, then the
+    runtime's events are relayed live. The stream counts towards the user's
+    open streams while it runs.
+    """
+    # Taken here rather than by the route, so the slot is released whenever the stream ends
+    if not stream_limiter.acquire(user_id):
+        yield format_sse(StreamEvent.error(TOO_MANY_STREAMS_MESSAGE, "too_many_streams"))
+        return
+    
+    try:
+        for event in load_replay_events(thread_id, after_sequence):
+            yield format_sse(event)
+        
+        try:
+            ping_interval, ping_timeout = get_heartbeat_settings()
+            upstream = await websockets.connect(
+                get_upstream_stream_url(thread_id), ping_interval=ping_interval, ping_timeout=ping_timeout,
+                open_timeout=get_operation_timeout("stream_connect"), **upstream_handshake_headers()
+            )
+        except Exception as e:
+            logger.error("Failed to connect to deepagents-runtime", extra={"thread_id": thread_id, "error": str(e)})
+            yield format_sse(StreamEvent.error("Failed to connect to AI service"))
+            return
+        
+        try:
+            async for message in relay_upstream_events(upstream, thread_id):
+                yield message
+        finally:
+            await upstream.close()
+    finally:
+        stream_limiter.release(user_id)
+
+
+async def relay_upstream_events(upstream, thread_id: str) -> AsyncIterator[str]:
+    """
+    Re-emit deepagents-runtime events as Server-Sent Events, finalizing the proposal like the WebSocket proxy.
+    
+    A client that goes away does not cancel the refinement: EventSource
+    reconnects by itself with Last-Event-ID, and otherwise the proposal
+    reconciler finalizes the proposal.
+    """
+    final_files: Optional[dict] = None
+    closed_by = None
+    progress = ProgressRecorder(thread_id, get_progress_write_interval())
+    # Safety valve against a runaway upstream; 0 disables the limit
+    max_events = int(os.getenv("WS_MAX_EVENTS_PER_SESSION", "10000"))
+    events_received = 0
+    idle_timeout = float(os.getenv("WEBSOCKET_IDLE_TIMEOUT", str(DEFAULT_WEBSOCKET_IDLE_TIMEOUT_SECONDS)))
+    
+    async def close_session(reason: str):
+        """End the stream because its refinement was cancelled or the server is shutting down."""
+        nonlocal closed_by
+        closed_by = reason
+        if reason == "cancelled":
+            await send_upstream_cancel(upstream, thread_id, reason)
+        await upstream.close()
+    
+    active_streams.setdefault(thread_id, set()).add(close_session)
+    try:
+        async for message in receive_with_idle_timeout(upstream, idle_timeout):
+            events_received += 1
+            if max_events and events_received > max_events:
+                logger.error(
+                    "Event limit exceeded, terminating stream",
+                    extra={"thread_id": thread_id, "max_events": max_events}
+                )
+                await update_proposal_status_to_failed(thread_id, "event_flood")
+                yield format_sse(StreamEvent.error("Refinement produced too many events", "event_flood"))
+                return
+            
+            try:
+                event = StreamEvent.from_message(message)
+            except ValueError as e:
+                logger.error("Failed to parse deepagents message", extra={"thread_id": thread_id, "error": str(e)})
+                continue
+            
+            files = record_state_update(thread_id, event, progress)
+            if files is not None:
+                final_files = files
+            
+            yield format_sse(event)
+            
+            if event.event_type == "end":
+                await progress.flush()
+                finish_refinement(thread_id, final_files)
+                return
+    except UpstreamIdleTimeout as e:
+        logger.error("Upstream idle timeout, terminating stream", extra={"thread_id": thread_id, "error": str(e)})
+        await update_proposal_status_to_failed(thread_id, "idle_timeout")
+        yield format_sse(StreamEvent.error("Refinement timed out", "idle_timeout"))
+    except Exception as e:
+        # Closing the upstream ourselves must not fail the refinement
+        if not closed_by:
+            logger.error("DeepAgents->SSE relay error", extra={"thread_id": thread_id, "error": str(e)})
+            track_proposal_update(update_proposal_status_to_failed(thread_id, str(e)))
+            yield format_sse(StreamEvent.error("Upstream connection lost"))
+    finally:
+        sessions = active_streams.get(thread_id)
+        if sessions is not None:
+            sessions.discard(close_session)
+            if not sessions:
+                del active_streams[thread_id]
+        prune_thread_snapshots(thread_id)
+    
+    if closed_by:
+        _, message = SESSION_CLOSE_REASONS[closed_by]
+        yield format_sse(StreamEvent.error(message, closed_by))
+
+
+def save_thread_snapshot(thread_id: str, state: dict) -> Optional[int]:
+    """Persist an on_state_update snapshot and return its sequence; failures never interrupt streaming."""
+    try:
+        sequence = get_snapshot_service().save_snapshot(thread_id, state)
+        logger.debug("Stored snapshot", extra={"thread_id": thread_id, "sequence": sequence})
+        return sequence
+    except Exception as e:
+        logger.error("Failed to store snapshot", extra={"thread_id": thread_id, "error": str(e)})
+        return None
+
+
+def load_replay_events(thread_id: str, after_sequence: int) -> List[StreamEvent]:
+    """Load the newest stored state updates after after_sequence as replayed on_state_update events."""
+    try:
+        snapshot_service = get_snapshot_service()
+        snapshots = snapshot_service.list_snapshots(
+            thread_id, after_sequence, limit=snapshot_service.snapshot_limit
+        )
+    except Exception as e:
+        logger.error("Failed to load snapshots", extra={"thread_id": thread_id, "error": str(e)})
+        return []
     
-    logger.info(f"WebSocket proxy session ended for thread: {thread_id}")
+    if snapshots:
+        logger.info("Replaying snapshots", extra={"thread_id": thread_id, "snapshots": len(snapshots)})
+    return [
+        StreamEvent("on_state_update", snapshot["state"], seq=snapshot["sequence"], replayed=True)
+        for snapshot in snapshots
+    ]
+
+
+async def replay_thread_snapshots(websocket: WebSocket, thread_id: str, after_sequence: int):
+    """Send a reconnecting client the newest stored state updates after after_sequence."""
+    for event in load_replay_events(thread_id, after_sequence):
+        await send_event(websocket, event)
+
+
+def prune_thread_snapshots(thread_id: str):
+    """Trim the snapshots of a thread whose stream ended down to the retention limit."""
+    try:
+        deleted = get_snapshot_service().prune_snapshots(thread_id)
+        logger.debug("Pruned snapshots", extra={"thread_id": thread_id, "snapshots": deleted})
+    except Exception as e:
+        logger.error("Failed to prune snapshots", extra={"thread_id": thread_id, "error": str(e)})
+
+
+async def send_upstream_cancel(deepagents_ws, thread_id: str, reason: str):
+    """Ask the runtime to stop a thread over its open stream; the connection may already be gone."""
+    try:
+        await deepagents_ws.send(CancelEvent(thread_id, reason).to_message())
+        logger.info("Sent cancel event upstream", extra={"thread_id": thread_id, "reason": reason})
+    except Exception as e:
+        logger.debug("Could not send cancel event upstream", extra={"thread_id": thread_id, "error": str(e)})
+
+
+async def cancel_abandoned_refinement(thread_id: str):
+    """Cancel the upstream run of a refinement whose client disconnected mid-stream."""
+    try:
+        orchestration_service = get_orchestration_service()
+        
+        logger.info("Cancelling abandoned refinement", extra={"thread_id": thread_id})
+        await orchestration_service.cancel_refinement_from_stream(thread_id, "client_disconnected")
+        
+    except Exception as e:
+        logger.error("Failed to cancel abandoned refinement", extra={"thread_id": thread_id, "error": str(e)})
 
 
-async def update_proposal_with_files(thread_id: str, files: dict):
-    """Update the proposal with generated files."""
+async def update_proposal_progress(thread_id: str, progress: dict):
+    """Record a running refinement's progress on its proposal; failures never interrupt streaming."""
+    try:
+        orchestration_service = get_orchestration_service()
+        await orchestration_service.update_proposal_progress_from_stream(thread_id, progress)
+        logger.debug("Recorded progress", extra={"thread_id": thread_id, "progress": progress})
+    except Exception as e:
+        logger.error("Failed to record progress", extra={"thread_id": thread_id, "error": str(e)})
+
+
+async def update_proposal_with_files(thread_id: str, files: dict, summary: Optional[str] = None):
+    """Update the proposal with generated files and an optional result summary."""
     try:
         orchestration_service = get_orchestration_service()
         
         # Update the proposal in the database using the orchestration service
-        logger.info(f"Updating proposal for thread {thread_id} with {len(files)} files")
+        logger.info("Updating proposal with files", extra={"thread_id": thread_id, "files": len(files)})
         
         # Use the orchestration service to update proposal with files
-        await orchestration_service.update_proposal_files_from_stream(thread_id, files)
+        await orchestration_service.update_proposal_files_from_stream(thread_id, files, summary)
         
-        logger.info(f"Successfully updated proposal for thread {thread_id}")
+        logger.info("Successfully updated proposal", extra={"thread_id": thread_id})
         
     except Exception as e:
-        logger.error(f"Failed to update proposal files for thread {thread_id}: {e}")
+        logger.error("Failed to update proposal files", extra={"thread_id": thread_id, "error": str(e)})
 
 
 async def update_proposal_status_to_failed(thread_id: str, error_message: str):
-    """Update the proposal status to failed with error details."""
+    """
+    Update the proposal status to failed with error details.
+    
+    Only a proposal still in flight is failed: a session can stay open on
+    the thread after its result was stored, and timing out or losing that
+    session must not fail a completed, resolved or cancelled proposal.
+    """
     try:
         orchestration_service = get_orchestration_service()
         
         # Update the proposal status in the database
-        logger.info(f"Updating proposal for thread {thread_id} to failed status: {error_message}")
+        logger.info("Updating proposal to failed status", extra={"thread_id": thread_id, "error": error_message})
         
         # Use the orchestration service to update proposal status
         await orchestration_service.update_proposal_status_from_stream(thread_id, "failed", error_message)
         
     except Exception as e:
-        logger.error(f"Failed to update proposal status for thread {thread_id}: {e}")
+        logger.error("Failed to update proposal status", extra={"thread_id": thread_id, "error": str(e)})
         
     except Exception as e:
-        logger.error(f"Failed to update proposal status for thread {thread_id}: {e}")
\ No newline at end of file
+        logger.error("Failed to update proposal status", extra={"thread_id": thread_id, "error": str(e)})
\ No newline at end of file
@@ -1,10 +1,41 @@
 """Workflow management endpoints."""
 
-from fastapi import APIRouter, Depends, HTTPException, status
+from datetime import datetime
+from typing import Literal, Optional
+from uuid import UUID
 
-from models.workflow import WorkflowCreate, WorkflowResponse
-from services.workflow_service import WorkflowService
-from api.dependencies import get_workflow_service, get_current_user_id
+from fastapi import APIRouter, Depends, HTTPException, Query, status
+
+from models.validation import ValidationResult
+from models.workflow import (
+    DraftFileEdit,
+    DraftFileWrite,
+    DraftReset,
+    ProposalFilter,
+    WorkflowCreate,
+    WorkflowResponse,
+    WorkflowShareRequest,
+    WorkflowTransferRequest,
+)
+from services.errors import AccessDeniedError, ConflictError, DraftFileVersionConflict, GoneError, NotFoundError
+from services.event_store import EventStore, EventVersionConflict
+from services.file_edit import InvalidFileEdit
+from services.generated_files import check_file_path
+from services.spec_templates import TemplateNotFoundError, load_template_files
+from services.spec_validator import InvalidSpecificationError, validate_specification
+from services.workflow_service import WorkflowService, WorkflowValidationError
+from services.orchestration_service import OrchestrationService
+from services.proposal_service import DEFAULT_PROPOSAL_LIST_SORT
+from core.auth import get_user_roles, normalize_user_id
+from api.dependencies import (
+    get_current_user_id,
+    get_event_store,
+    get_orchestration_service,
+    get_version_number,
+    get_workflow_service,
+    require_workflow_write_access,
+)
+from api.routers.websockets import close_refinement_stream
 
 router = APIRouter(prefix="/api/workflows", tags=["workflows"])
 
@@ -18,13 +49,26 @@ async def create_workflow(
     """
     Create a new workflow.
     
+    With a template_id, the workflow's draft is seeded with that starter
+    specification instead of starting empty.
+    
     Note: Authentication will be handled by SDK middleware in future implementation.
     """
-    result = workflow_service.create_workflow(
-        name=workflow.name,
-        user_id=user_id,
-        description=workflow.description,
-    )
+    draft_files = None
+    if workflow.template_id:
+        try:
+            draft_files = load_template_files(workflow.template_id)
+        except TemplateNotFoundError as e:
+            raise HTTPException(status_code=400, detail=str(e))
+    try:
+        result = workflow_service.create_workflow(
+            name=workflow.name,
+            user_id=user_id,
+            description=workflow.description,
+            draft_files=draft_files,
+        )
+    except WorkflowValidationError as e:
+        raise HTTPException(status_code=400, detail={"message": str(e), "fields": e.fields})
     return result
 
 
@@ -47,15 +91,78 @@ async def get_workflow(
     return result
 
 
+@router.delete("/{workflow_id}", status_code=200)
+async def delete_workflow(
+    workflow_id: str,
+    workflow_service: WorkflowService = Depends(get_workflow_service),
+    orchestration_service: OrchestrationService = Depends(get_orchestration_service),
+    user_id: str = Depends(get_current_user_id),
+):
+    """
+    Soft-delete a workflow, discarding its draft and closing open proposals.
+    
+    Running refinements are cancelled, and their runtime threads and open
+    streams are stopped; completed proposals are rejected.
+    
+    Note: Authentication will be handled by SDK middleware in future implementation.
+    """
+    try:
+        result = workflow_service.delete_workflow(workflow_id, user_id)
+    except NotFoundError as e:
+        raise HTTPException(status_code=404, detail=str(e))
+    except AccessDeniedError as e:
+        raise HTTPException(status_code=403, detail=str(e))
+    except ValueError as e:
+        raise HTTPException(status_code=400, detail=str(e))
+    
+    # Stop the refinements the deletion cancelled before their runtime data is cleaned up
+    await orchestration_service.cancel_threads(result["cancelled_thread_ids"])
+    for thread_id in result["cancelled_thread_ids"]:
+        await close_refinement_stream(thread_id)
+    orchestration_service.cleanup_threads(result["thread_ids"])
+    return {
+        "message": "Workflow deleted successfully",
+        "deleted_at": result["deleted_at"].isoformat() + "Z",
+        "restore_grace_days": workflow_service.restore_grace_days
+    }
+
+
+@router.post("/{workflow_id}/restore", response_model=WorkflowResponse)
+async def restore_workflow(
+    workflow_id: str,
+    workflow_service: WorkflowService = Depends(get_workflow_service),
+    user_id: str = Depends(get_current_user_id),
+):
+    """
+    Restore a soft-deleted workflow within the restore grace period.
+    
+    Note: Authentication will be handled by SDK middleware in future implementation.
+    """
+    try:
+        return workflow_service.restore_workflow(workflow_id, user_id)
+    except NotFoundError as e:
+        raise HTTPException(status_code=404, detail=str(e))
+    except AccessDeniedError as e:
+        raise HTTPException(status_code=403, detail=str(e))
+    except GoneError as e:
+        raise HTTPException(status_code=410, detail=str(e))
+    except ValueError as e:
+        raise HTTPException(status_code=400, detail=str(e))
+
+
 @router.get("/{workflow_id}/versions")
 async def get_versions(
     workflow_id: str,
+    expand: Optional[Literal["publisher"]] = Query(None),
     workflow_service: WorkflowService = Depends(get_workflow_service),
     user_id: str = Depends(get_current_user_id),
 ):
     """
     Get all versions for a workflow.
     
+    ?expand=publisher adds the publishing user's id, name and email to each
+    version as a publisher object.
+    
     Note: Authentication will be handled by SDK middleware in future implementation.
     """
     # Validate workflow access
@@ -63,19 +170,45 @@ async def get_versions(
     if not workflow:
         raise HTTPException(status_code=404, detail="Workflow not found")
     
-    versions = workflow_service.get_versions(workflow_id)
+    versions = workflow_service.get_versions(workflow_id, expand_publisher=expand == "publisher")
     return {"versions": versions}
 
 
+# Registered before /versions/{version_number} so "latest" is not read as a version number
+@router.get("/{workflow_id}/versions/latest")
+async def get_latest_version(
+    workflow_id: str,
+    workflow_service: WorkflowService = Depends(get_workflow_service),
+    user_id: str = Depends(get_current_user_id),
+):
+    """
+    Get the most recently published version of a workflow with its specification files.
+    
+    Unlike /production, this is the highest version number whether or not it is deployed.
+    
+    Note: Authentication will be handled by SDK middleware in future implementation.
+    """
+    # Validate workflow access
+    workflow = workflow_service.get_workflow(workflow_id, user_id)
+    if not workflow:
+        raise HTTPException(status_code=404, detail="Workflow not found")
+    
+    version = workflow_service.get_latest_version(workflow_id)
+    if not version:
+        raise HTTPException(status_code=404, detail="No version has been published")
+    
+    return version
+
+
 @router.get("/{workflow_id}/versions/{version_number}")
 async def get_version(
     workflow_id: str,
-    version_number: int,
+    version_number: int = Depends(get_version_number),
     workflow_service: WorkflowService = Depends(get_workflow_service),
     user_id: str = Depends(get_current_user_id),
 ):
     """
-    Get a specific version of a workflow.
+    Get a specific version of a workflow with its specification files.
     
     Note: Authentication will be handled by SDK middleware in future implementation.
     """
@@ -91,6 +224,57 @@ async def get_version(
     return version
 
 
+@router.get("/{workflow_id}/versions/{version_number}/files")
+async def get_version_files(
+    workflow_id: str,
+    version_number: int = Depends(get_version_number),
+    contents: bool = Query(True),
+    workflow_service: WorkflowService = Depends(get_workflow_service),
+    user_id: str = Depends(get_current_user_id),
+):
+    """
+    Read a version's specification files in bulk.
+    
+    Pass ?contents=false to get only the file tree (paths, types and sizes)
+    when browsing large specs without downloading every file.
+    
+    Note: Authentication will be handled by SDK middleware in future implementation.
+    """
+    # Validate workflow access
+    workflow = workflow_service.get_workflow(workflow_id, user_id)
+    if not workflow:
+        raise HTTPException(status_code=404, detail="Workflow not found")
+    
+    files = workflow_service.get_version_files(workflow_id, version_number, include_contents=contents)
+    if files is None:
+        raise HTTPException(status_code=404, detail="Version not found")
+    
+    return {"version_number": version_number, "files": files}
+
+
+@router.get("/{workflow_id}/production")
+async def get_production_version(
+    workflow_id: str,
+    workflow_service: WorkflowService = Depends(get_workflow_service),
+    user_id: str = Depends(get_current_user_id),
+):
+    """
+    Get the currently deployed version of a workflow with its specification files.
+    
+    Note: Authentication will be handled by SDK middleware in future implementation.
+    """
+    # Validate workflow access
+    workflow = workflow_service.get_workflow(workflow_id, user_id)
+    if not workflow:
+        raise HTTPException(status_code=404, detail="Workflow not found")
+    
+    version = workflow_service.get_production_version(workflow_id)
+    if not version:
+        raise HTTPException(status_code=404, detail="No version is deployed")
+    
+    return version
+
+
 @router.post("/{workflow_id}/versions", status_code=201)
 async def publish_draft(
     workflow_id: str,
@@ -100,20 +284,352 @@ async def publish_draft(
     """
     Publish draft as a new version.
     
+    Files declared as JSON that do not parse are listed under warnings, or
+    refuse the publish when PUBLISH_JSON_LINT is error.
+    
     Note: Authentication will be handled by SDK middleware in future implementation.
     """
     # Validate workflow access
     workflow = workflow_service.get_workflow(workflow_id, user_id)
     if not workflow:
         raise HTTPException(status_code=404, detail="Workflow not found")
+    require_workflow_write_access(workflow)
     
     try:
         version = workflow_service.publish_draft(workflow_id, user_id)
         return {
             "version_id": version["id"],
             "version_number": version["version_number"],
-            "message": "Draft published successfully"
+            "message": "Draft published successfully",
+            "warnings": [issue.model_dump() for issue in version["warnings"]]
         }
+    except InvalidSpecificationError as e:
+        raise HTTPException(
+            status_code=422,
+            detail={"message": str(e), "issues": [issue.model_dump() for issue in e.result.issues]}
+        )
+    except EventVersionConflict as e:
+        raise HTTPException(status_code=409, detail=str(e))
+    except NotFoundError as e:
+        raise HTTPException(status_code=404, detail=str(e))
+    except ValueError as e:
+        raise HTTPException(status_code=400, detail=str(e))
+
+
+@router.get("/{workflow_id}/proposals")
+async def list_proposals(
+    workflow_id: str,
+    status: Optional[str] = Query(None),
+    file: Optional[str] = Query(None),
+    draft_id: Optional[UUID] = Query(None),
+    created_after: Optional[datetime] = Query(None),
+    created_before: Optional[datetime] = Query(None),
+    sort: str = Query(DEFAULT_PROPOSAL_LIST_SORT),
+    limit: int = Query(50, ge=1, le=500),
+    offset: int = Query(0, ge=0),
+    workflow_service: WorkflowService = Depends(get_workflow_service),
+    orchestration_service: OrchestrationService = Depends(get_orchestration_service),
+    user_id: str = Depends(get_current_user_id),
+):
+    """
+    List the workflow's refinement proposals, newest first by default.
+    
+    Optionally filtered by status, draft, creation time and by ?file=, which
+    matches the file path the refinement was scoped to. ?sort= takes
+    created_at or completed_at, prefixed with "-" for descending order.
+    The response carries the total number of matching proposals for paging.
+    
+    Note: Authentication will be handled by SDK middleware in future implementation.
+    """
+    # Validate workflow access
+    workflow = workflow_service.get_workflow(workflow_id, user_id)
+    if not workflow:
+        raise HTTPException(status_code=404, detail="Workflow not found")
+    
+    filters = ProposalFilter(
+        status=status,
+        draft_id=str(draft_id) if draft_id else None,
+        context_file_path=file,
+        created_after=created_after,
+        created_before=created_before
+    )
+    try:
+        proposals, total = orchestration_service.proposal_service.list_proposals(
+            workflow_id, user_id, filters, limit, offset, sort
+        )
+    except ValueError as e:
+        raise HTTPException(status_code=400, detail=str(e))
+    
+    return {"proposals": proposals, "total": total, "limit": limit, "offset": offset}
+
+
+@router.get("/{workflow_id}/stats")
+async def get_workflow_stats(
+    workflow_id: str,
+    workflow_service: WorkflowService = Depends(get_workflow_service),
+    orchestration_service: OrchestrationService = Depends(get_orchestration_service),
+    user_id: str = Depends(get_current_user_id),
+):
+    """
+    Get workflow statistics: the draft's proposal counts by status.
+    
+    Note: Authentication will be handled by SDK middleware in future implementation.
+    """
+    # Validate workflow access
+    workflow = workflow_service.get_workflow(workflow_id, user_id)
+    if not workflow:
+        raise HTTPException(status_code=404, detail="Workflow not found")
+    
+    return {
+        "workflow_id": workflow_id,
+        "proposals_by_status": orchestration_service.proposal_service.count_draft_proposals_by_status(workflow_id)
+    }
+
+
+@router.get("/{workflow_id}/events")
+async def list_events(
+    workflow_id: str,
+    after_version: int = Query(0, ge=0),
+    limit: int = Query(100, ge=1, le=500),
+    workflow_service: WorkflowService = Depends(get_workflow_service),
+    event_store: EventStore = Depends(get_event_store),
+    user_id: str = Depends(get_current_user_id),
+):
+    """
+    Replay the workflow's event history in order.
+    
+    Clients page through the history by passing the last version they
+    received as ?after_version=.
+    
+    Note: Authentication will be handled by SDK middleware in future implementation.
+    """
+    workflow = workflow_service.get_workflow(workflow_id, user_id)
+    if not workflow:
+        raise HTTPException(status_code=404, detail="Workflow not found")
+    
+    events = event_store.list_events(workflow_id, after_version, limit)
+    return {"events": events, "after_version": after_version, "limit": limit}
+
+
+@router.get("/{workflow_id}/audit")
+async def get_audit_log(
+    workflow_id: str,
+    limit: int = Query(100, ge=1, le=500),
+    offset: int = Query(0, ge=0),
+    workflow_service: WorkflowService = Depends(get_workflow_service),
+    user_id: str = Depends(get_current_user_id),
+):
+    """
+    Download the workflow's audit log: proposals, publishes, deployments and
+    sharing changes in one chronological feed with the acting user of each.
+    
+    Only the owner and administrators may read it. The response carries the
+    total number of entries for paging.
+    
+    Note: Authentication will be handled by SDK middleware in future implementation.
+    """
+    if "admin" in get_user_roles(user_id):
+        if not workflow_service.workflow_exists(workflow_id):
+            raise HTTPException(status_code=404, detail="Workflow not found")
+    else:
+        workflow = workflow_service.get_workflow(workflow_id, user_id)
+        if not workflow:
+            raise HTTPException(status_code=404, detail="Workflow not found")
+        if workflow["access_type"] != "owner":
+            raise HTTPException(status_code=403, detail="Only the workflow owner can read its audit log")
+    
+    entries, total = workflow_service.list_audit_log(workflow_id, limit, offset)
+    return {"entries": entries, "total": total, "limit": limit, "offset": offset}
+
+
+@router.get("/{workflow_id}/draft")
+async def get_draft(
+    workflow_id: str,
+    workflow_service: WorkflowService = Depends(get_workflow_service),
+    orchestration_service: OrchestrationService = Depends(get_orchestration_service),
+    user_id: str = Depends(get_current_user_id),
+):
+    """
+    Get the current draft and its specification files without creating one.
+    
+    Note: Authentication will be handled by SDK middleware in future implementation.
+    """
+    # Validate workflow access
+    workflow = workflow_service.get_workflow(workflow_id, user_id)
+    if not workflow:
+        raise HTTPException(status_code=404, detail="Workflow not found")
+    
+    # Drafts are only created by refinement or from a starter template
+    draft = orchestration_service.draft_service.get_draft_by_workflow(workflow_id)
+    if not draft:
+        raise HTTPException(status_code=404, detail="Draft not found")
+    
+    return {
+        "id": draft["id"],
+        "name": draft["name"],
+        "status": draft["status"],
+        "updated_at": draft["updated_at"],
+        "files": orchestration_service.draft_service.get_draft_files(draft["id"])
+    }
+
+
+@router.post("/{workflow_id}/draft/validate", response_model=ValidationResult)
+async def validate_draft(
+    workflow_id: str,
+    workflow_service: WorkflowService = Depends(get_workflow_service),
+    orchestration_service: OrchestrationService = Depends(get_orchestration_service),
+    user_id: str = Depends(get_current_user_id),
+):
+    """
+    Validate the current draft's specification and list every issue found.
+    
+    Note: Authentication will be handled by SDK middleware in future implementation.
+    """
+    # Validate workflow access
+    workflow = workflow_service.get_workflow(workflow_id, user_id)
+    if not workflow:
+        raise HTTPException(status_code=404, detail="Workflow not found")
+    
+    draft = orchestration_service.draft_service.get_draft_by_workflow(workflow_id)
+    if not draft:
+        raise HTTPException(status_code=404, detail="Draft not found")
+    
+    return validate_specification(orchestration_service.draft_service.get_draft_files(draft["id"]))
+
+
+@router.patch("/{workflow_id}/draft/files/{file_path:path}")
+async def edit_draft_file(
+    workflow_id: str,
+    file_path: str,
+    edit: DraftFileEdit,
+    workflow_service: WorkflowService = Depends(get_workflow_service),
+    orchestration_service: OrchestrationService = Depends(get_orchestration_service),
+    user_id: str = Depends(get_current_user_id),
+):
+    """
+    Autosave an incremental edit (append or line range replacement) to a draft file.
+    
+    Note: Authentication will be handled by SDK middleware in future implementation.
+    """
+    # Validate workflow access
+    workflow = workflow_service.get_workflow(workflow_id, user_id)
+    if not workflow:
+        raise HTTPException(status_code=404, detail="Workflow not found")
+    require_workflow_write_access(workflow)
+    
+    # Draft file paths are absolute, as the runtime generates them
+    file_path = "/" + file_path.lstrip("/")
+    
+    try:
+        return orchestration_service.draft_service.edit_draft_file(workflow_id, user_id, file_path, edit)
+    except InvalidFileEdit as e:
+        raise HTTPException(status_code=422, detail=str(e))
+    except DraftFileVersionConflict as e:
+        raise HTTPException(status_code=409, detail=str(e))
+    except NotFoundError as e:
+        raise HTTPException(status_code=404, detail=str(e))
+    except ValueError as e:
+        raise HTTPException(status_code=400, detail=str(e))
+
+
+@router.put("/{workflow_id}/draft/files/{file_path:path}")
+async def write_draft_file(
+    workflow_id: str,
+    file_path: str,
+    write: DraftFileWrite,
+    workflow_service: WorkflowService = Depends(get_workflow_service),
+    orchestration_service: OrchestrationService = Depends(get_orchestration_service),
+    user_id: str = Depends(get_current_user_id),
+):
+    """
+    Create or replace a draft file edited by hand, returning its new version.
+    
+    Note: Authentication will be handled by SDK middleware in future implementation.
+    """
+    # Validate workflow access
+    workflow = workflow_service.get_workflow(workflow_id, user_id)
+    if not workflow:
+        raise HTTPException(status_code=404, detail="Workflow not found")
+    require_workflow_write_access(workflow)
+    
+    file_path = "/" + file_path.lstrip("/")
+    problem = check_file_path(file_path)
+    if problem:
+        raise HTTPException(status_code=422, detail=f"Invalid file path: {problem}")
+    
+    try:
+        return orchestration_service.draft_service.write_draft_file(workflow_id, user_id, file_path, write)
+    except DraftFileVersionConflict as e:
+        raise HTTPException(status_code=409, detail=str(e))
+    except NotFoundError as e:
+        raise HTTPException(status_code=404, detail=str(e))
+    except ValueError as e:
+        raise HTTPException(status_code=400, detail=str(e))
+
+
+@router.delete("/{workflow_id}/draft/files/{file_path:path}")
+async def delete_draft_file(
+    workflow_id: str,
+    file_path: str,
+    expected_version: Optional[int] = Query(None, description="Version the file must still be at"),
+    workflow_service: WorkflowService = Depends(get_workflow_service),
+    orchestration_service: OrchestrationService = Depends(get_orchestration_service),
+    user_id: str = Depends(get_current_user_id),
+):
+    """
+    Remove a file from the draft.
+    
+    Note: Authentication will be handled by SDK middleware in future implementation.
+    """
+    # Validate workflow access
+    workflow = workflow_service.get_workflow(workflow_id, user_id)
+    if not workflow:
+        raise HTTPException(status_code=404, detail="Workflow not found")
+    require_workflow_write_access(workflow)
+    
+    file_path = "/" + file_path.lstrip("/")
+    
+    try:
+        version = orchestration_service.draft_service.delete_draft_file(
+            workflow_id, user_id, file_path, expected_version
+        )
+    except DraftFileVersionConflict as e:
+        raise HTTPException(status_code=409, detail=str(e))
+    except NotFoundError as e:
+        raise HTTPException(status_code=404, detail=str(e))
+    
+    return {"file_path": file_path, "version": version, "message": "Draft file deleted"}
+
+
+@router.post("/{workflow_id}/draft/reset")
+async def reset_draft(
+    workflow_id: str,
+    reset: DraftReset,
+    workflow_service: WorkflowService = Depends(get_workflow_service),
+    orchestration_service: OrchestrationService = Depends(get_orchestration_service),
+    user_id: str = Depends(get_current_user_id),
+):
+    """
+    Replace the draft's files with those of the production version, discarding draft edits.
+    
+    Without a production version the draft is emptied. The body must set
+    confirm to true.
+    
+    Note: Authentication will be handled by SDK middleware in future implementation.
+    """
+    # Validate workflow access
+    workflow = workflow_service.get_workflow(workflow_id, user_id)
+    if not workflow:
+        raise HTTPException(status_code=404, detail="Workflow not found")
+    require_workflow_write_access(workflow)
+    
+    if not reset.confirm:
+        raise HTTPException(status_code=400, detail="Resetting the draft discards its changes; set confirm to true")
+    
+    try:
+        return orchestration_service.draft_service.reset_draft_to_production(workflow_id, user_id)
+    except NotFoundError as e:
+        raise HTTPException(status_code=404, detail=str(e))
     except ValueError as e:
         raise HTTPException(status_code=400, detail=str(e))
 
@@ -122,10 +638,11 @@ async def publish_draft(
 async def discard_draft(
     workflow_id: str,
     workflow_service: WorkflowService = Depends(get_workflow_service),
+    orchestration_service: OrchestrationService = Depends(get_orchestration_service),
     user_id: str = Depends(get_current_user_id),
 ):
     """
-    Discard the current draft.
+    Discard the current draft along with its files and in-flight proposals.
     
     Note: Authentication will be handled by SDK middleware in future implementation.
     """
@@ -133,10 +650,16 @@ async def discard_draft(
     workflow = workflow_service.get_workflow(workflow_id, user_id)
     if not workflow:
         raise HTTPException(status_code=404, detail="Workflow not found")
+    require_workflow_write_access(workflow)
     
     try:
-        workflow_service.discard_draft(workflow_id, user_id)
-        return {"message": "Draft discarded successfully"}
+        deleted_proposals = orchestration_service.discard_draft(workflow_id, user_id)
+        return {
+            "message": "Draft discarded successfully",
+            "deleted_proposals": deleted_proposals
+        }
+    except NotFoundError as e:
+        raise HTTPException(status_code=404, detail=str(e))
     except ValueError as e:
         raise HTTPException(status_code=400, detail=str(e))
 
@@ -149,7 +672,7 @@ async def deploy_version(
     user_id: str = Depends(get_current_user_id),
 ):
     """
-    Deploy a version to production.
+    Deploy a published version to production.
     
     Note: Authentication will be handled by SDK middleware in future implementation.
     """
@@ -157,10 +680,11 @@ async def deploy_version(
     workflow = workflow_service.get_workflow(workflow_id, user_id)
     if not workflow:
         raise HTTPException(status_code=404, detail="Workflow not found")
+    require_workflow_write_access(workflow)
     
     version_number = deploy_data.get("version_number")
-    if not version_number:
-        raise HTTPException(status_code=400, detail="version_number is required")
+    if not isinstance(version_number, int) or version_number < 1:
+        raise HTTPException(status_code=400, detail="version_number must be a positive integer")
     
     try:
         deployment = workflow_service.deploy_version(
@@ -168,8 +692,102 @@ async def deploy_version(
         )
         return {
             "deployment_id": deployment["id"],
+            "version_number": deployment["version_number"],
             "status": deployment["status"],
-            "message": "Deployment initiated successfully"
+            "deployed_at": deployment["deployed_at"].isoformat() + "Z",
+            "message": "Version deployed to production"
         }
+    except NotFoundError as e:
+        raise HTTPException(status_code=404, detail=str(e))
+    except ConflictError as e:
+        raise HTTPException(status_code=409, detail=str(e))
+    except ValueError as e:
+        raise HTTPException(status_code=400, detail=str(e))
+
+
+@router.post("/{workflow_id}/share", status_code=200)
+async def share_workflow(
+    workflow_id: str,
+    share_request: WorkflowShareRequest,
+    workflow_service: WorkflowService = Depends(get_workflow_service),
+    user_id: str = Depends(get_current_user_id),
+):
+    """
+    Share a workflow with another user as editor or viewer. Only the owner can share.
+    
+    Note: Authentication will be handled by SDK middleware in future implementation.
+    """
+    try:
+        grant = workflow_service.share_workflow(
+            workflow_id, user_id, share_request.email, share_request.access_type
+        )
+    except NotFoundError as e:
+        raise HTTPException(status_code=404, detail=str(e))
+    except AccessDeniedError as e:
+        raise HTTPException(status_code=403, detail=str(e))
+    except ValueError as e:
+        raise HTTPException(status_code=400, detail=str(e))
+    
+    return {"workflow_id": workflow_id, **grant}
+
+
+@router.delete("/{workflow_id}/share/{shared_user_id}", status_code=200)
+async def revoke_workflow_share(
+    workflow_id: str,
+    shared_user_id: str,
+    workflow_service: WorkflowService = Depends(get_workflow_service),
+    user_id: str = Depends(get_current_user_id),
+):
+    """
+    Revoke a user's shared access to a workflow. Only the owner can revoke.
+    
+    Note: Authentication will be handled by SDK middleware in future implementation.
+    """
+    try:
+        shared_user_id = normalize_user_id(shared_user_id)
+    except ValueError:
+        raise HTTPException(status_code=404, detail="Access grant not found")
+    
+    try:
+        workflow_service.revoke_workflow_access(workflow_id, user_id, shared_user_id)
+    except NotFoundError as e:
+        raise HTTPException(status_code=404, detail=str(e))
+    except AccessDeniedError as e:
+        raise HTTPException(status_code=403, detail=str(e))
     except ValueError as e:
-        raise HTTPException(status_code=400, detail=str(e))
\ No newline at end of file
+        raise HTTPException(status_code=400, detail=str(e))
+    
+    return {"message": "Access revoked successfully"}
+
+
+@router.post("/{workflow_id}/transfer", status_code=200)
+async def transfer_workflow(
+    workflow_id: str,
+    transfer_request: WorkflowTransferRequest,
+    workflow_service: WorkflowService = Depends(get_workflow_service),
+    user_id: str = Depends(get_current_user_id),
+):
+    """
+    Transfer ownership of a workflow to another user. Only the owner can transfer.
+    
+    The previous owner loses access unless the new owner shares the workflow back.
+    
+    Note: Authentication will be handled by SDK middleware in future implementation.
+    """
+    try:
+        new_owner_id = normalize_user_id(transfer_request.user_id)
+    except ValueError:
+        raise HTTPException(status_code=404, detail="User not found")
+    
+    try:
+        transfer = workflow_service.transfer_ownership(workflow_id, user_id, new_owner_id)
+    except NotFoundError as e:
+        raise HTTPException(status_code=404, detail=str(e))
+    except AccessDeniedError as e:
+        raise HTTPException(status_code=403, detail=str(e))
+    except ConflictError as e:
+        raise HTTPException(status_code=409, detail=str(e))
+    except ValueError as e:
+        raise HTTPException(status_code=400, detail=str(e))
+    
+    return {"workflow_id": workflow_id, **transfer}
@@ -0,0 +1,270 @@
+"""
+JWT authentication for IDE Orchestrator.
+
+Provides token issuance and validation with the same claim layout as the
+Go JWTManager (user_id, username, roles) so tokens stay interchangeable.
+Tokens are signed with a shared secret (HS256) or with an RSA key pair
+(RS256), which lets other services validate them with only the public key.
+"""
+
+import functools
+import os
+import uuid
+from datetime import datetime, timedelta, timezone
+from typing import Dict, Any, List, Optional, Tuple
+
+import jwt
+from cryptography.hazmat.primitives import serialization
+
+# Audience for short-lived tokens that are only valid for the WebSocket handshake
+WS_TOKEN_AUDIENCE = "ide-orchestrator:ws"
+
+# Signing algorithms a JWTManager can be configured with
+SUPPORTED_ALGORITHMS = ("HS256", "RS256")
+
+# Lifetime of tokens issued at login or refresh, unless JWT_TOKEN_TTL says otherwise
+DEFAULT_TOKEN_TTL_SECONDS = 24 * 3600
+
+
+class InvalidTokenError(Exception):
+    """Raised when a token fails signature, expiry, or claim validation."""
+
+
+def normalize_user_id(user_id: str) -> str:
+    """
+    Normalize a user ID to canonical UUID form.
+
+    User IDs are UUIDs everywhere (users.id is a UUID column), so anything
+    else is rejected at the auth boundary instead of failing later in SQL.
+
+    Raises:
+        ValueError: If user_id is not a valid UUID
+    """
+    return str(uuid.UUID(str(user_id)))
+
+
+def get_user_roles(user_id: str) -> List[str]:
+    """
+    Get the roles granted to a user.
+
+    Administrators are listed by user ID in the comma-separated
+    ADMIN_USER_IDS environment variable.
+    """
+    admin_user_ids = {
+        admin_id.strip()
+        for admin_id in os.getenv("ADMIN_USER_IDS", "").split(",")
+        if admin_id.strip()
+    }
+    return ["admin"] if user_id in admin_user_ids else []
+
+
+def load_pem_private_key(path: str):
+    """Read an unencrypted PEM private key; keys are parsed once per file."""
+    return _load_pem_key(path, private=True)
+
+
+def load_pem_public_key(path: str):
+    """Read a PEM public key; keys are parsed once per file."""
+    return _load_pem_key(path, private=False)
+
+
+@functools.lru_cache(maxsize=8)
+def _load_pem_key(path: str, private: bool):
+    with open(path, "rb") as key_file:
+        data = key_file.read()
+    if private:
+        return serialization.load_pem_private_key(data, password=None)
+    return serialization.load_pem_public_key(data)
+
+
+class JWTManager:
+    """
+    Issues and validates signed JWT access tokens.
+
+    HS256 signs and validates with secret_key. RS256 signs with private_key
+    and validates with public_key; a manager without a private key can only
+    validate. Tokens are only accepted when signed with the configured
+    algorithm, so an HS256 token cannot pass as RS256 or the other way round.
+    """
+
+    def __init__(
+        self,
+        secret_key: Optional[str] = None,
+        algorithm: str = "HS256",
+        issuer: str = "ide-orchestrator",
+        private_key: Any = None,
+        public_key: Any = None,
+        token_ttl_seconds: int = DEFAULT_TOKEN_TTL_SECONDS
+    ):
+        if algorithm not in SUPPORTED_ALGORITHMS:
+            raise ValueError(f"Unsupported JWT algorithm {algorithm}; use one of {', '.join(SUPPORTED_ALGORITHMS)}")
+        if algorithm == "HS256" and not secret_key:
+            raise ValueError("HS256 needs a secret key")
+        if algorithm == "RS256" and public_key is None:
+            raise ValueError("RS256 needs a public key")
+        self.secret_key = secret_key
+        self.algorithm = algorithm
+        self.issuer = issuer
+        self.private_key = private_key
+        self.public_key = public_key
+        self.token_ttl_seconds = token_ttl_seconds
+
+    @property
+    def signing_key(self) -> Any:
+        """Key tokens are signed with."""
+        if self.algorithm == "HS256":
+            return self.secret_key
+        if self.private_key is None:
+            raise ValueError("No private key configured; this JWT manager can only validate tokens")
+        return self.private_key
+
+    @property
+    def verification_key(self) -> Any:
+        """Key token signatures are checked with."""
+        return self.secret_key if self.algorithm == "HS256" else self.public_key
+
+    def create_token(
+        self,
+        user_id: str,
+        username: str,
+        roles: List[str],
+        duration_seconds: int,
+        audience: Optional[str] = None
+    ) -> Tuple[str, datetime]:
+        """
+        Create a signed token.
+
+        Args:
+            user_id: User ID (must be a UUID)
+            username: Username or email for display
+            roles: Roles granted to the user
+            duration_seconds: Token lifetime in seconds
+            audience: Optional audience restricting where the token is accepted
+
+        Returns:
+            Tuple of (token, expires_at)
+
+        Raises:
+            ValueError: If user_id is not a valid UUID, or the manager has no key to sign with
+        """
+        user_id = normalize_user_id(user_id)
+        now = datetime.now(timezone.utc)
+        expires_at = now + timedelta(seconds=duration_seconds)
+
+        claims = {
+            "user_id": user_id,
+            "username": username,
+            "roles": roles,
+            "jti": str(uuid.uuid4()),
+            "iss": self.issuer,
+            "sub": user_id,
+            "iat": now,
+            "nbf": now,
+            "exp": expires_at,
+        }
+        if audience:
+            claims["aud"] = audience
+        token = jwt.encode(claims, self.signing_key, algorithm=self.algorithm)
+        return token, expires_at
+
+    def refresh_token(self, claims: Dict[str, Any], duration_seconds: int) -> Tuple[str, datetime]:
+        """
+        Issue a new token carrying the identity of an already validated one.
+
+        Args:
+            claims: Claims returned by validate_token; expired tokens never get here
+            duration_seconds: Lifetime of the new token in seconds
+
+        Returns:
+            Tuple of (token, expires_at)
+        """
+        return self.create_token(
+            claims["user_id"],
+            claims.get("username", ""),
+            claims.get("roles", []),
+            duration_seconds,
+        )
+
+    async def generate_token(
+        self,
+        user_id: str,
+        username: str,
+        roles: List[str],
+        duration_seconds: int
+    ) -> str:
+        """Create a signed token and return only the token string."""
+        token, _ = self.create_token(user_id, username, roles, duration_seconds)
+        return token
+
+    def validate_token(
+        self,
+        token: str,
+        accepted_audiences: Tuple[Optional[str], ...] = (None,)
+    ) -> Dict[str, Any]:
+        """
+        Validate a token and return its claims.
+
+        Args:
+            token: Encoded JWT
+            accepted_audiences: Audiences the caller accepts; None stands for
+                regular tokens without an audience. The default only accepts
+                regular tokens, so audience-scoped tokens are refused by REST.
+
+        Returns:
+            Decoded claims with user_id normalized to canonical UUID form
+
+        Raises:
+            InvalidTokenError: If the token is malformed, expired, wrongly
+                signed, scoped to another audience, or carries a user_id that
+                is not a UUID
+        """
+        try:
+            claims = jwt.decode(
+                token,
+                self.verification_key,
+                algorithms=[self.algorithm],
+                issuer=self.issuer,
+                options={"require": ["exp", "iat", "user_id"], "verify_aud": False},
+            )
+        except jwt.ExpiredSignatureError:
+            raise InvalidTokenError("Token has expired")
+        except jwt.PyJWTError as e:
+            raise InvalidTokenError(f"Invalid token: {e}")
+
+        if claims.get("aud") not in accepted_audiences:
+            raise InvalidTokenError("Token audience not accepted")
+
+        try:
+            claims["user_id"] = normalize_user_id(claims["user_id"])
+        except ValueError:
+            raise InvalidTokenError("Invalid user ID")
+
+        return claims
+
+
+def get_jwt_manager() -> JWTManager:
+    """
+    Get JWT manager configured from environment.
+
+    JWT_ALGORITHM selects HS256 (default), which needs JWT_SECRET, or RS256,
+    which needs JWT_PUBLIC_KEY_FILE and, to issue tokens, JWT_PRIVATE_KEY_FILE.
+    JWT_TOKEN_TTL sets the lifetime of issued tokens in seconds.
+    """
+    algorithm = os.getenv("JWT_ALGORITHM", "HS256").upper()
+    token_ttl_seconds = int(os.getenv("JWT_TOKEN_TTL", str(DEFAULT_TOKEN_TTL_SECONDS)))
+    if algorithm == "RS256":
+        public_key_file = os.getenv("JWT_PUBLIC_KEY_FILE")
+        if not public_key_file:
+            raise ValueError("JWT_PUBLIC_KEY_FILE environment variable is required for RS256")
+        private_key_file = os.getenv("JWT_PRIVATE_KEY_FILE")
+        return JWTManager(
+            algorithm=algorithm,
+            private_key=load_pem_private_key(private_key_file) if private_key_file else None,
+            public_key=load_pem_public_key(public_key_file),
+            token_ttl_seconds=token_ttl_seconds
+        )
+
+    secret_key = os.getenv("JWT_SECRET")
+    if not secret_key:
+        raise ValueError("JWT_SECRET environment variable is required")
+    return JWTManager(secret_key, algorithm=algorithm, token_ttl_seconds=token_ttl_seconds)
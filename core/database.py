@@ -0,0 +1,199 @@
+"""
+Database connections.
+
+Services borrow connections from a process-wide pool per database URL,
+sized by the DB_POOL_* environment variables, instead of opening one per
+call. Pool usage is exported as Prometheus gauges.
+
+The database often comes up after the orchestrator (both start together
+under docker-compose and on a fresh cluster), so startup retries the first
+connection with exponential backoff and jitter instead of failing at once.
+The total wait is capped by DB_CONNECT_TIMEOUT, and the retry loop is an
+ordinary coroutine, so cancelling startup (e.g. on SIGTERM) stops it at once.
+
+Every statement on a pooled connection is bounded by DB_STATEMENT_TIMEOUT,
+enforced by PostgreSQL itself, so a slow query is cancelled at the deadline
+whether or not the client that caused it is still connected.
+"""
+
+import asyncio
+import logging
+import os
+import random
+import threading
+import time
+from contextlib import contextmanager
+from typing import Any, Dict, Iterator
+
+import psycopg
+from psycopg.rows import RowFactory, tuple_row
+from psycopg_pool import ConnectionPool
+
+from core.metrics import metrics
+
+logger = logging.getLogger(__name__)
+
+# Pool sizing; lifetimes are in seconds
+DEFAULT_DB_POOL_MAX_CONNS = 10
+DEFAULT_DB_POOL_MIN_CONNS = 1
+DEFAULT_DB_POOL_MAX_CONN_LIFETIME_SECONDS = 3600
+DEFAULT_DB_POOL_MAX_CONN_IDLE_TIME_SECONDS = 600
+
+DEFAULT_DB_CONNECT_TIMEOUT_SECONDS = 60
+
+# Upper bound on a single statement; 0 disables it
+DEFAULT_DB_STATEMENT_TIMEOUT_SECONDS = 30
+
+# Backoff between attempts: doubles from the base delay up to the maximum
+DB_CONNECT_BASE_DELAY_SECONDS = 0.5
+DB_CONNECT_MAX_DELAY_SECONDS = 10
+
+# Upper bound on a single connection attempt
+DB_CONNECT_ATTEMPT_TIMEOUT_SECONDS = 5
+
+
+class DatabaseUnavailableError(RuntimeError):
+    """Raised when the database cannot be reached before the connect timeout."""
+
+
+def get_connect_timeout() -> float:
+    """Read DB_CONNECT_TIMEOUT, the total seconds to keep retrying."""
+    return float(os.getenv("DB_CONNECT_TIMEOUT", str(DEFAULT_DB_CONNECT_TIMEOUT_SECONDS)))
+
+
+def backoff_delay(attempt: int) -> float:
+    """Delay before retrying after the given (0-based) failed attempt, with jitter."""
+    delay = min(DB_CONNECT_MAX_DELAY_SECONDS, DB_CONNECT_BASE_DELAY_SECONDS * 2 ** attempt)
+    return random.uniform(delay / 2, delay)
+
+
+async def connect_with_retry(database_url: str, timeout: float) -> psycopg.Connection:
+    """
+    Open a database connection, retrying until it succeeds or timeout passes.
+
+    Args:
+        database_url: Database URL
+        timeout: Total seconds to keep retrying
+
+    Returns:
+        An open connection; the caller closes it
+
+    Raises:
+        DatabaseUnavailableError: If no attempt succeeded within timeout
+        asyncio.CancelledError: If the calling task is cancelled while waiting
+    """
+    deadline = time.monotonic() + timeout
+    attempt = 0
+    while True:
+        attempt_timeout = max(1, min(DB_CONNECT_ATTEMPT_TIMEOUT_SECONDS, int(deadline - time.monotonic())))
+        try:
+            return await asyncio.to_thread(psycopg.connect, database_url, connect_timeout=attempt_timeout)
+        except psycopg.OperationalError as e:
+            remaining = deadline - time.monotonic()
+            if remaining <= 0:
+                raise DatabaseUnavailableError(
+                    f"Database unreachable after {attempt + 1} attempts in {timeout:g}s: {e}"
+                ) from e
+            delay = min(backoff_delay(attempt), remaining)
+            logger.warning(
+                "Database connection attempt failed, retrying",
+                extra={"attempt": attempt + 1, "retry_in_seconds": round(delay, 1), "error": str(e)}
+            )
+            await asyncio.sleep(delay)
+            attempt += 1
+
+
+def get_pool_settings() -> Dict[str, Any]:
+    """
+    Read the DB_POOL_* settings as ConnectionPool arguments.
+
+    Raises:
+        ValueError: If DB_POOL_MIN_CONNS exceeds DB_POOL_MAX_CONNS
+    """
+    settings = {
+        "min_size": int(os.getenv("DB_POOL_MIN_CONNS", str(DEFAULT_DB_POOL_MIN_CONNS))),
+        "max_size": int(os.getenv("DB_POOL_MAX_CONNS", str(DEFAULT_DB_POOL_MAX_CONNS))),
+        "max_lifetime": float(
+            os.getenv("DB_POOL_MAX_CONN_LIFETIME", str(DEFAULT_DB_POOL_MAX_CONN_LIFETIME_SECONDS))
+        ),
+        "max_idle": float(
+            os.getenv("DB_POOL_MAX_CONN_IDLE_TIME", str(DEFAULT_DB_POOL_MAX_CONN_IDLE_TIME_SECONDS))
+        ),
+    }
+    if settings["min_size"] > settings["max_size"]:
+        raise ValueError(
+            f"DB_POOL_MIN_CONNS ({settings['min_size']}) exceeds DB_POOL_MAX_CONNS ({settings['max_size']})"
+        )
+    return settings
+
+
+def get_statement_timeout() -> float:
+    """Read DB_STATEMENT_TIMEOUT, the seconds a statement may run before it is cancelled."""
+    return float(os.getenv("DB_STATEMENT_TIMEOUT", str(DEFAULT_DB_STATEMENT_TIMEOUT_SECONDS)))
+
+
+def get_connection_kwargs() -> Dict[str, Any]:
+    """Build the connection arguments that apply DB_STATEMENT_TIMEOUT to pooled connections."""
+    timeout_ms = int(get_statement_timeout() * 1000)
+    if timeout_ms <= 0:
+        return {}
+    return {"options": f"-c statement_timeout={timeout_ms}"}
+
+
+_pools: Dict[str, ConnectionPool] = {}
+_pools_lock = threading.Lock()
+
+
+def get_pool(database_url: str) -> ConnectionPool:
+    """Get the connection pool for a database URL, creating it on first use."""
+    pool = _pools.get(database_url)
+    if pool is not None:
+        return pool
+    with _pools_lock:
+        if database_url not in _pools:
+            _pools[database_url] = ConnectionPool(
+                database_url,
+                open=True,
+                # Idle connections may have been dropped by a database restart
+                check=ConnectionPool.check_connection,
+                kwargs=get_connection_kwargs(),
+                **get_pool_settings()
+            )
+        return _pools[database_url]
+
+
+@contextmanager
+def connect(database_url: str, row_factory: RowFactory = tuple_row) -> Iterator[psycopg.Connection]:
+    """
+    Borrow a pooled connection, like psycopg.connect used as a context manager.
+
+    The transaction is committed when the block exits normally and rolled
+    back on an exception, then the connection goes back to the pool.
+    A statement running past DB_STATEMENT_TIMEOUT raises
+    psycopg.errors.QueryCanceled.
+    """
+    with get_pool(database_url).connection() as conn:
+        conn.row_factory = row_factory
+        yield conn
+
+
+def close_pools() -> None:
+    """Close every connection pool."""
+    with _pools_lock:
+        for pool in _pools.values():
+            pool.close()
+        _pools.clear()
+
+
+def get_pool_stats() -> Dict[str, int]:
+    """Count connections across all pools: acquired (in use), idle and total."""
+    total = 0
+    idle = 0
+    for pool in list(_pools.values()):
+        stats = pool.get_stats()
+        total += stats.get("pool_size", 0)
+        idle += stats.get("pool_available", 0)
+    return {"acquired": total - idle, "idle": idle, "total": total}
+
+
+metrics.track_db_pool(get_pool_stats)
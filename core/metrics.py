@@ -9,7 +9,7 @@ Based on archived/internal/metrics package patterns.
 
 from prometheus_client import Counter, Histogram, Gauge, start_http_server
 import time
-from typing import Optional
+from typing import Callable, Dict, Optional
 from contextlib import contextmanager
 
 
@@ -33,6 +33,22 @@ agent_builder_jobs_active = Gauge(
     ['job_type']
 )
 
+# Refinement job counters; unlabelled, since proposal and workflow IDs are unbounded
+ide_orchestrator_refinement_jobs_created = Counter(
+    'ide_orchestrator_refinement_jobs_created_total',
+    'Refinement jobs created'
+)
+
+ide_orchestrator_refinement_jobs_completed = Counter(
+    'ide_orchestrator_refinement_jobs_completed_total',
+    'Refinement jobs finalized as completed by the WebSocket proxy'
+)
+
+ide_orchestrator_refinement_jobs_failed = Counter(
+    'ide_orchestrator_refinement_jobs_failed_total',
+    'Refinement jobs finalized as failed'
+)
+
 # WebSocket proxy metrics (from design.md requirements)
 ide_orchestrator_websocket_connections = Gauge(
     'ide_orchestrator_websocket_connections',
@@ -53,6 +69,58 @@ ide_orchestrator_deepagents_requests = Counter(
     ['endpoint', 'status']
 )
 
+# HTTP server metrics, labelled by route template rather than raw path
+ide_orchestrator_http_requests = Counter(
+    'ide_orchestrator_http_requests_total',
+    'Total HTTP requests handled',
+    ['method', 'route', 'status']
+)
+
+ide_orchestrator_http_request_duration = Histogram(
+    'ide_orchestrator_http_request_duration_seconds',
+    'Duration of HTTP requests',
+    ['method', 'route', 'status'],
+    buckets=[0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1.0, 2.5, 5.0, 10.0]
+)
+
+ide_orchestrator_http_requests_in_flight = Gauge(
+    'ide_orchestrator_http_requests_in_flight',
+    'HTTP requests currently being handled',
+    ['method']
+)
+
+# Outbox publisher metrics
+ide_orchestrator_outbox_pending_events = Gauge(
+    'ide_orchestrator_outbox_pending_events',
+    'Number of outbox events waiting to be published'
+)
+
+ide_orchestrator_outbox_oldest_pending_age = Gauge(
+    'ide_orchestrator_outbox_oldest_pending_age_seconds',
+    'Age of the oldest outbox event waiting to be published'
+)
+
+# Database connection pool usage, read from the pools when scraped
+ide_orchestrator_db_pool_connections = Gauge(
+    'ide_orchestrator_db_pool_connections',
+    'Database pool connections by state: acquired, idle, total',
+    ['state']
+)
+
+# deepagents-runtime circuit breaker, read from the breaker when scraped
+CIRCUIT_BREAKER_STATE_VALUES = {"closed": 0, "half-open": 1, "open": 2}
+
+ide_orchestrator_deepagents_circuit_breaker_state = Gauge(
+    'ide_orchestrator_deepagents_circuit_breaker_state',
+    'deepagents-runtime circuit breaker state: 0 closed, 1 half-open, 2 open'
+)
+
+ide_orchestrator_deepagents_circuit_breaker_rejections = Counter(
+    'ide_orchestrator_deepagents_circuit_breaker_rejections_total',
+    'deepagents-runtime requests refused because the circuit breaker was open',
+    ['endpoint']
+)
+
 
 class MetricsManager:
     """Manager for Prometheus metrics with context managers for timing."""
@@ -76,6 +144,21 @@ class MetricsManager:
         agent_builder_job_duration.labels(job_type=job_type, status=status).observe(duration)
         agent_builder_jobs_active.labels(job_type=job_type).dec()
     
+    def record_refinement_created(self) -> None:
+        """Record a new refinement job."""
+        self.record_job_created("refinement")
+        ide_orchestrator_refinement_jobs_created.inc()
+    
+    def record_refinement_completed(self, duration: float) -> None:
+        """Record a refinement job that finished with a result."""
+        self.record_job_completed("refinement", "completed", duration)
+        ide_orchestrator_refinement_jobs_completed.inc()
+    
+    def record_refinement_failed(self, duration: float) -> None:
+        """Record a refinement job that failed."""
+        self.record_job_completed("refinement", "failed", duration)
+        ide_orchestrator_refinement_jobs_failed.inc()
+    
     @contextmanager
     def time_job(self, job_type: str):
         """Context manager for timing job execution."""
@@ -120,6 +203,40 @@ class MetricsManager:
     def record_deepagents_request(self, endpoint: str, status: str) -> None:
         """Record request to deepagents-runtime."""
         ide_orchestrator_deepagents_requests.labels(endpoint=endpoint, status=status).inc()
+    
+    def record_http_request_started(self, method: str) -> None:
+        """Record an HTTP request entering the server."""
+        ide_orchestrator_http_requests_in_flight.labels(method=method).inc()
+    
+    def record_http_request_finished(self, method: str, route: str, status: int, duration: float) -> None:
+        """Record a handled HTTP request with its route template and status code."""
+        ide_orchestrator_http_requests_in_flight.labels(method=method).dec()
+        ide_orchestrator_http_requests.labels(method=method, route=route, status=str(status)).inc()
+        ide_orchestrator_http_request_duration.labels(
+            method=method, route=route, status=str(status)
+        ).observe(duration)
+    
+    def record_outbox_backlog(self, pending_count: int, oldest_pending_age: float) -> None:
+        """Record outbox backlog size and lag."""
+        ide_orchestrator_outbox_pending_events.set(pending_count)
+        ide_orchestrator_outbox_oldest_pending_age.set(oldest_pending_age)
+    
+    def track_db_pool(self, get_stats: Callable[[], Dict[str, int]]) -> None:
+        """Report database pool connections by state from get_stats on every scrape."""
+        for state in ("acquired", "idle", "total"):
+            ide_orchestrator_db_pool_connections.labels(state=state).set_function(
+                lambda state=state: get_stats()[state]
+            )
+    
+    def track_circuit_breaker(self, get_state: Callable[[], str]) -> None:
+        """Report the circuit breaker state from get_state on every scrape."""
+        ide_orchestrator_deepagents_circuit_breaker_state.set_function(
+            lambda: CIRCUIT_BREAKER_STATE_VALUES[get_state()]
+        )
+    
+    def record_circuit_breaker_rejection(self, endpoint: str) -> None:
+        """Record a deepagents-runtime request refused by the open circuit breaker."""
+        ide_orchestrator_deepagents_circuit_breaker_rejections.labels(endpoint=endpoint).inc()
 
 
 # Global metrics manager instance
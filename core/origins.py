@@ -0,0 +1,71 @@
+"""
+Origin checks for WebSocket handshakes.
+
+Browsers do not apply CORS to WebSockets, so without an origin check any
+site a user visits could open a refinement stream with their token.
+"""
+
+import os
+from typing import Iterable, List, Optional
+from urllib.parse import urlsplit
+
+
+def parse_allowed_origins(value: Optional[str]) -> List[str]:
+    """Split a comma-separated ALLOWED_ORIGINS value into normalized entries."""
+    if not value:
+        return []
+    return [origin.strip().rstrip("/").lower() for origin in value.split(",") if origin.strip()]
+
+
+class OriginPolicy:
+    """
+    Decides which Origin headers may open a WebSocket.
+
+    Entries are exact origins (https://app.bizmatters.dev) or wildcard
+    subdomain patterns with or without a scheme (*.bizmatters.dev,
+    https://*.bizmatters.dev). Same-origin requests and clients that send
+    no Origin header (non-browser clients) are always allowed; with no
+    entries, every cross-origin request is denied.
+    """
+
+    def __init__(self, allowed_origins: Iterable[str] = ()):
+        self.allowed_origins = [origin.rstrip("/").lower() for origin in allowed_origins]
+
+    @classmethod
+    def from_env(cls) -> "OriginPolicy":
+        """Build the policy from the ALLOWED_ORIGINS environment variable."""
+        return cls(parse_allowed_origins(os.getenv("ALLOWED_ORIGINS")))
+
+    def is_allowed(self, origin: Optional[str], host: Optional[str] = None) -> bool:
+        """
+        Check an Origin header against the policy.
+
+        Args:
+            origin: Value of the Origin header, if any
+            host: Value of the Host header, used to recognize same-origin requests
+        """
+        if not origin:
+            return True
+
+        origin = origin.rstrip("/").lower()
+        parts = urlsplit(origin)
+        if not parts.scheme or not parts.netloc:
+            return False
+
+        if host and parts.netloc == host.lower():
+            return True
+
+        return any(self._matches(entry, parts.scheme, parts.netloc) for entry in self.allowed_origins)
+
+    @staticmethod
+    def _matches(entry: str, scheme: str, netloc: str) -> bool:
+        """Match one allow-list entry against an origin's scheme and host."""
+        entry_scheme, _, entry_host = entry.rpartition("://")
+        if entry_scheme and entry_scheme != scheme:
+            return False
+
+        if entry_host.startswith("*."):
+            # *.example.com matches subdomains only, not example.com itself
+            return netloc.endswith(entry_host[1:])
+
+        return netloc == entry_host
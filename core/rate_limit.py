@@ -0,0 +1,170 @@
+"""
+In-process request rate limiting and connection counting.
+
+Limits are per replica; they protect cheap public endpoints from being
+hammered, not a substitute for limits at the ingress.
+
+Both limiters keep their per-key entries in shards, each with its own lock,
+so concurrent requests for different keys rarely contend. Entries of keys
+that went idle are evicted and the number of keys is bounded, so departed
+users and IPs do not accumulate.
+"""
+
+import threading
+import time
+import zlib
+from typing import Callable, Dict, Generic, List, Tuple, TypeVar
+
+DEFAULT_SHARD_COUNT = 16
+DEFAULT_MAX_KEYS = 10000
+
+Entry = TypeVar("Entry")
+
+
+class _Shard(Generic[Entry]):
+    """One lock-protected part of a sharded key map."""
+
+    def __init__(self):
+        self.lock = threading.Lock()
+        self.entries: Dict[str, Entry] = {}
+        self.last_sweep = 0.0
+
+
+class _ShardedMap(Generic[Entry]):
+    """Key map split into shards by a stable hash of the key."""
+
+    def __init__(self, shard_count: int, max_keys: int):
+        self.shards: List[_Shard[Entry]] = [_Shard() for _ in range(max(shard_count, 1))]
+        # Each shard holds its share of the bound, so the total never exceeds max_keys
+        self.max_keys_per_shard = max(max_keys // len(self.shards), 1)
+
+    def shard_for(self, key: str) -> _Shard[Entry]:
+        return self.shards[zlib.crc32(key.encode()) % len(self.shards)]
+
+    def __len__(self) -> int:
+        return sum(len(shard.entries) for shard in self.shards)
+
+
+class FixedWindowRateLimiter:
+    """Allow at most limit requests per key in each window of window_seconds."""
+
+    def __init__(
+        self,
+        limit: int,
+        window_seconds: float,
+        clock: Callable[[], float] = time.monotonic,
+        shard_count: int = DEFAULT_SHARD_COUNT,
+        max_keys: int = DEFAULT_MAX_KEYS
+    ):
+        self.limit = limit
+        self.window_seconds = window_seconds
+        self._clock = clock
+        self._windows: _ShardedMap[Tuple[float, int]] = _ShardedMap(shard_count, max_keys)
+
+    def allow(self, key: str) -> bool:
+        """Count a request for key and report whether it is within the limit; a limit of 0 allows all."""
+        if self.limit <= 0:
+            return True
+
+        now = self._clock()
+        shard = self._windows.shard_for(key)
+        with shard.lock:
+            if now - shard.last_sweep >= self.window_seconds:
+                self._drop_expired(shard, now)
+
+            window_start, count = shard.entries.get(key, (now, 0))
+            if now - window_start >= self.window_seconds:
+                window_start, count = now, 0
+            if count >= self.limit:
+                return False
+
+            if key not in shard.entries and len(shard.entries) >= self._windows.max_keys_per_shard:
+                self._drop_expired(shard, now)
+                if len(shard.entries) >= self._windows.max_keys_per_shard:
+                    # Every tracked key is active; forget the one whose window ends first
+                    del shard.entries[min(shard.entries, key=lambda k: shard.entries[k][0])]
+            shard.entries[key] = (window_start, count + 1)
+            return True
+
+    def retry_after(self, key: str) -> int:
+        """Seconds until key's current window ends."""
+        shard = self._windows.shard_for(key)
+        with shard.lock:
+            window_start, _ = shard.entries.get(key, (self._clock(), 0))
+        return max(1, int(window_start + self.window_seconds - self._clock() + 0.999))
+
+    def tracked_keys(self) -> int:
+        """Number of keys currently holding a window."""
+        return len(self._windows)
+
+    def _drop_expired(self, shard: _Shard[Tuple[float, int]], now: float) -> None:
+        """Forget a shard's keys whose window has ended so idle clients do not accumulate; needs the shard lock."""
+        shard.entries = {
+            key: window for key, window in shard.entries.items()
+            if now - window[0] < self.window_seconds
+        }
+        shard.last_sweep = now
+
+
+class ConnectionLimiter:
+    """
+    Allow at most limit concurrent connections per key.
+
+    Every successful acquire must be paired with a release. A key's entry
+    is removed as soon as its last connection is released, so only keys
+    with open connections are tracked.
+    """
+
+    def __init__(
+        self,
+        limit: int,
+        shard_count: int = DEFAULT_SHARD_COUNT,
+        max_keys: int = DEFAULT_MAX_KEYS
+    ):
+        self.limit = limit
+        self._counts: _ShardedMap[int] = _ShardedMap(shard_count, max_keys)
+
+    def acquire(self, key: str) -> bool:
+        """
+        Count a new connection for key.
+
+        Returns:
+            False if key is at its limit or no more keys can be tracked;
+            a limit of 0 allows all
+        """
+        if self.limit <= 0:
+            return True
+
+        shard = self._counts.shard_for(key)
+        with shard.lock:
+            count = shard.entries.get(key, 0)
+            if count >= self.limit:
+                return False
+            # Open connections cannot be forgotten, so new keys are refused instead
+            if count == 0 and len(shard.entries) >= self._counts.max_keys_per_shard:
+                return False
+            shard.entries[key] = count + 1
+            return True
+
+    def release(self, key: str) -> None:
+        """Count a connection of key as closed."""
+        if self.limit <= 0:
+            return
+
+        shard = self._counts.shard_for(key)
+        with shard.lock:
+            count = shard.entries.get(key, 0) - 1
+            if count > 0:
+                shard.entries[key] = count
+            else:
+                shard.entries.pop(key, None)
+
+    def count(self, key: str) -> int:
+        """Number of open connections of key."""
+        shard = self._counts.shard_for(key)
+        with shard.lock:
+            return shard.entries.get(key, 0)
+
+    def tracked_keys(self) -> int:
+        """Number of keys with open connections."""
+        return len(self._counts)
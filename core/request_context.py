@@ -0,0 +1,67 @@
+"""
+Request ID correlation for logs and outbound calls.
+
+Every HTTP request and WebSocket session gets an ID, taken from its
+X-Request-ID header or generated, which is kept in a context variable
+while the request is handled. Log records carry it as request_id and
+calls to deepagents-runtime forward it, so one user action can be followed
+through the gateway, the orchestrator and the runtime from their logs.
+It complements the OpenTelemetry trace context, which needs a tracing
+backend to be useful.
+"""
+
+import contextvars
+import logging
+import re
+import uuid
+from typing import Dict, Optional
+
+REQUEST_ID_HEADER = "X-Request-ID"
+
+# Incoming IDs end up in logs and headers, so only short, plain ones are kept
+REQUEST_ID_PATTERN = re.compile(r"^[A-Za-z0-9._:-]{1,128}$")
+
+# Logged as request_id outside of any request (startup, background loops)
+NO_REQUEST_ID = "-"
+
+_request_id: contextvars.ContextVar[Optional[str]] = contextvars.ContextVar("request_id", default=None)
+
+
+def get_request_id() -> Optional[str]:
+    """ID of the request being handled, or None outside of a request."""
+    return _request_id.get()
+
+
+def set_request_id(request_id: Optional[str]) -> contextvars.Token:
+    """Make request_id the current request's ID; pass the returned token to reset_request_id."""
+    return _request_id.set(request_id)
+
+
+def reset_request_id(token: contextvars.Token) -> None:
+    """Restore the request ID that was current before set_request_id."""
+    _request_id.reset(token)
+
+
+def request_id_from_header(value: Optional[str]) -> str:
+    """Keep a well-formed incoming request ID, or generate a new one."""
+    if value and REQUEST_ID_PATTERN.match(value):
+        return value
+    return uuid.uuid4().hex
+
+
+def request_id_headers() -> Dict[str, str]:
+    """Headers forwarding the current request ID to another service; empty outside of a request."""
+    request_id = get_request_id()
+    return {REQUEST_ID_HEADER: request_id} if request_id else {}
+
+
+def install_request_id_logging() -> None:
+    """Tag every log record with the current request ID."""
+    record_factory = logging.getLogRecordFactory()
+
+    def record_with_request_id(*args, **kwargs) -> logging.LogRecord:
+        record = record_factory(*args, **kwargs)
+        record.request_id = get_request_id() or NO_REQUEST_ID
+        return record
+
+    logging.setLogRecordFactory(record_with_request_id)
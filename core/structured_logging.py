@@ -0,0 +1,49 @@
+"""
+Structured JSON logging.
+
+Every log record is written as one JSON object per line, so values such as
+emails, error messages or thread IDs are escaped by the encoder instead of
+being pasted into the line, and cannot break the log pipeline's parsing or
+forge extra lines. Log calls keep a constant message and pass their values
+as key/value pairs through extra, each of which becomes a field:
+
+    logger.warning("Access denied to thread", extra={"user_id": user_id, "thread_id": thread_id})
+"""
+
+import json
+import logging
+from datetime import datetime, timezone
+from typing import Any, Dict
+
+from .request_context import NO_REQUEST_ID, install_request_id_logging
+
+# Attributes every LogRecord has; anything else on a record came from extra
+RESERVED_RECORD_ATTRIBUTES = frozenset(logging.makeLogRecord({}).__dict__) | {"message", "asctime", "request_id"}
+
+
+class JsonFormatter(logging.Formatter):
+    """Format records as single-line JSON objects with their extra fields."""
+
+    def format(self, record: logging.LogRecord) -> str:
+        entry: Dict[str, Any] = {
+            "time": datetime.fromtimestamp(record.created, timezone.utc).isoformat(timespec="milliseconds"),
+            "level": record.levelname,
+            "logger": record.name,
+            "message": record.getMessage(),
+            "request_id": getattr(record, "request_id", NO_REQUEST_ID),
+        }
+        for key, value in record.__dict__.items():
+            # An extra named like a core field must not forge the entry's level, time or message
+            if key not in RESERVED_RECORD_ATTRIBUTES and not key.startswith("_"):
+                entry.setdefault(key, value)
+        if record.exc_info:
+            entry["exception"] = self.formatException(record.exc_info)
+        return json.dumps(entry, ensure_ascii=False, default=str)
+
+
+def configure_logging(level: str = "INFO") -> None:
+    """Log every record as JSON to stderr, tagged with the current request ID."""
+    install_request_id_logging()
+    handler = logging.StreamHandler()
+    handler.setFormatter(JsonFormatter())
+    logging.basicConfig(level=level.upper(), handlers=[handler], force=True)
@@ -0,0 +1,7 @@
+-- Rollback transactional outbox table
+
+DROP INDEX IF EXISTS idx_outbox_events_aggregate;
+DROP INDEX IF EXISTS idx_outbox_events_dead_letter;
+DROP INDEX IF EXISTS idx_outbox_events_deliverable;
+
+DROP TABLE IF EXISTS outbox_events;
@@ -0,0 +1,38 @@
+-- Create transactional outbox table for downstream event delivery
+-- Supports retry tracking and dead-lettering of permanently failed events
+
+CREATE TABLE IF NOT EXISTS outbox_events (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    aggregate_type VARCHAR(100) NOT NULL,
+    aggregate_id UUID NOT NULL,
+    event_type VARCHAR(100) NOT NULL,
+    payload JSONB NOT NULL DEFAULT '{}'::jsonb,
+    status VARCHAR(50) NOT NULL DEFAULT 'PENDING',
+    retry_count INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    published_at TIMESTAMP WITH TIME ZONE,
+    dead_lettered_at TIMESTAMP WITH TIME ZONE,
+
+    -- Constraints
+    CONSTRAINT status_valid CHECK (status IN ('PENDING', 'PUBLISHED', 'FAILED', 'DEAD_LETTER')),
+    CONSTRAINT retry_count_non_negative CHECK (retry_count >= 0),
+    CONSTRAINT payload_is_object CHECK (jsonb_typeof(payload) = 'object')
+);
+
+-- Indexes for the publisher (pending/failed scan) and the dead-letter listing
+CREATE INDEX IF NOT EXISTS idx_outbox_events_deliverable ON outbox_events(created_at)
+    WHERE status IN ('PENDING', 'FAILED');
+CREATE INDEX IF NOT EXISTS idx_outbox_events_dead_letter ON outbox_events(dead_lettered_at DESC)
+    WHERE status = 'DEAD_LETTER';
+CREATE INDEX IF NOT EXISTS idx_outbox_events_aggregate ON outbox_events(aggregate_type, aggregate_id);
+
+-- Add comments for documentation
+COMMENT ON TABLE outbox_events IS 'Transactional outbox of domain events awaiting delivery to downstream consumers';
+COMMENT ON COLUMN outbox_events.aggregate_type IS 'Type of entity the event belongs to (workflow, proposal, version)';
+COMMENT ON COLUMN outbox_events.aggregate_id IS 'ID of the entity the event belongs to';
+COMMENT ON COLUMN outbox_events.event_type IS 'Domain event name, e.g. proposal.approved';
+COMMENT ON COLUMN outbox_events.status IS 'Delivery status: PENDING, PUBLISHED, FAILED (will retry), DEAD_LETTER (retries exhausted)';
+COMMENT ON COLUMN outbox_events.retry_count IS 'Number of failed delivery attempts';
+COMMENT ON COLUMN outbox_events.last_error IS 'Error from the most recent failed delivery attempt';
+COMMENT ON COLUMN outbox_events.dead_lettered_at IS 'Timestamp when the event exhausted its retries';
@@ -0,0 +1,5 @@
+-- Rollback thread_snapshots table
+
+DROP INDEX IF EXISTS idx_thread_snapshots_created_at;
+
+DROP TABLE IF EXISTS thread_snapshots;
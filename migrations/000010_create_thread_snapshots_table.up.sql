@@ -0,0 +1,23 @@
+-- Create thread_snapshots table for refinement state history
+-- Supports replay-on-reconnect and post-hoc inspection of how a refinement evolved
+
+CREATE TABLE IF NOT EXISTS thread_snapshots (
+    thread_id VARCHAR(255) NOT NULL,
+    sequence INTEGER NOT NULL,
+    state JSONB NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+
+    -- Constraints
+    PRIMARY KEY (thread_id, sequence),
+    CONSTRAINT sequence_positive CHECK (sequence > 0),
+    CONSTRAINT state_is_object CHECK (jsonb_typeof(state) = 'object')
+);
+
+-- Add index for pruning by age
+CREATE INDEX IF NOT EXISTS idx_thread_snapshots_created_at ON thread_snapshots(created_at DESC);
+
+-- Add comments for documentation
+COMMENT ON TABLE thread_snapshots IS 'on_state_update snapshots streamed from deepagents-runtime, per thread';
+COMMENT ON COLUMN thread_snapshots.thread_id IS 'deepagents-runtime execution thread ID';
+COMMENT ON COLUMN thread_snapshots.sequence IS 'Per-thread sequence number, starting at 1';
+COMMENT ON COLUMN thread_snapshots.state IS 'Event data of the on_state_update event';
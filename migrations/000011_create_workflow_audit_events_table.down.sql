@@ -0,0 +1,5 @@
+-- Rollback workflow_audit_events table
+
+DROP INDEX IF EXISTS idx_workflow_audit_events_workflow;
+
+DROP TABLE IF EXISTS workflow_audit_events;
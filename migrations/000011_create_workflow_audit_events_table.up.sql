@@ -0,0 +1,28 @@
+-- Create workflow_audit_events table for workflow-level audit trail
+-- Records actions that are not tied to a single proposal (draft discards, deployments, ...)
+
+CREATE TABLE IF NOT EXISTS workflow_audit_events (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    workflow_id UUID NOT NULL,
+    user_id UUID NOT NULL,
+    action VARCHAR(100) NOT NULL,
+    details JSONB NOT NULL DEFAULT '{}'::jsonb,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+
+    -- Constraints
+    CONSTRAINT details_is_object CHECK (jsonb_typeof(details) = 'object'),
+    CONSTRAINT fk_workflow_audit_events_workflow FOREIGN KEY (workflow_id)
+        REFERENCES workflows(id) ON DELETE CASCADE,
+    CONSTRAINT fk_workflow_audit_events_user FOREIGN KEY (user_id)
+        REFERENCES users(id) ON DELETE RESTRICT
+);
+
+-- Add index for per-workflow chronological listing
+CREATE INDEX IF NOT EXISTS idx_workflow_audit_events_workflow ON workflow_audit_events(workflow_id, created_at);
+
+-- Add comments for documentation
+COMMENT ON TABLE workflow_audit_events IS 'Workflow-level audit trail of user actions';
+COMMENT ON COLUMN workflow_audit_events.workflow_id IS 'Workflow the action was performed on';
+COMMENT ON COLUMN workflow_audit_events.user_id IS 'User who performed the action';
+COMMENT ON COLUMN workflow_audit_events.action IS 'Action name, e.g. draft_discarded';
+COMMENT ON COLUMN workflow_audit_events.details IS 'Action-specific details';
@@ -0,0 +1,9 @@
+-- Rollback proposal preservation on draft delete
+
+DELETE FROM proposals WHERE draft_id IS NULL;
+
+ALTER TABLE proposals DROP CONSTRAINT IF EXISTS fk_proposals_draft;
+ALTER TABLE proposals ADD CONSTRAINT fk_proposals_draft FOREIGN KEY (draft_id)
+    REFERENCES drafts(id) ON DELETE CASCADE;
+
+ALTER TABLE proposals ALTER COLUMN draft_id SET NOT NULL;
@@ -0,0 +1,10 @@
+-- Keep resolved proposals when their draft is discarded or published
+-- Non-terminal proposals are deleted explicitly; the rest keep their audit trail with draft_id cleared
+
+ALTER TABLE proposals ALTER COLUMN draft_id DROP NOT NULL;
+
+ALTER TABLE proposals DROP CONSTRAINT IF EXISTS fk_proposals_draft;
+ALTER TABLE proposals ADD CONSTRAINT fk_proposals_draft FOREIGN KEY (draft_id)
+    REFERENCES drafts(id) ON DELETE SET NULL;
+
+COMMENT ON COLUMN proposals.draft_id IS 'Foreign key to parent draft (NULL once the draft is discarded or published)';
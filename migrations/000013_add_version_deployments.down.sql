@@ -0,0 +1,12 @@
+-- Rollback version deployment tracking
+
+DROP INDEX IF EXISTS idx_workflow_deployments_workflow;
+
+DROP TABLE IF EXISTS workflow_deployments;
+
+ALTER TABLE versions DROP COLUMN IF EXISTS deployed_at;
+
+UPDATE versions SET status = 'published' WHERE status = 'deployed';
+ALTER TABLE versions DROP CONSTRAINT IF EXISTS status_valid;
+ALTER TABLE versions ADD CONSTRAINT status_valid
+    CHECK (status IN ('draft', 'published', 'deprecated'));
@@ -0,0 +1,36 @@
+-- Add deployment tracking for versions
+-- Supports the production version pointer, a deployed version status, and deployment history
+
+-- Allow 'deployed' status for the version workflows.production_version_id points at
+ALTER TABLE versions DROP CONSTRAINT IF EXISTS status_valid;
+ALTER TABLE versions ADD CONSTRAINT status_valid
+    CHECK (status IN ('draft', 'published', 'deployed', 'deprecated'));
+
+ALTER TABLE versions
+ADD COLUMN IF NOT EXISTS deployed_at TIMESTAMP WITH TIME ZONE;
+
+-- workflow_deployments table: history of production deployments
+CREATE TABLE IF NOT EXISTS workflow_deployments (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    workflow_id UUID NOT NULL,
+    version_id UUID NOT NULL,
+    deployed_by_user_id UUID NOT NULL,
+    deployed_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+
+    -- Constraints
+    CONSTRAINT fk_workflow_deployments_workflow FOREIGN KEY (workflow_id)
+        REFERENCES workflows(id) ON DELETE CASCADE,
+    CONSTRAINT fk_workflow_deployments_version FOREIGN KEY (version_id)
+        REFERENCES versions(id) ON DELETE CASCADE,
+    CONSTRAINT fk_workflow_deployments_deployed_by FOREIGN KEY (deployed_by_user_id)
+        REFERENCES users(id) ON DELETE RESTRICT
+);
+
+-- Add index for per-workflow deployment history
+CREATE INDEX IF NOT EXISTS idx_workflow_deployments_workflow ON workflow_deployments(workflow_id, deployed_at DESC);
+
+-- Add comments for documentation
+COMMENT ON COLUMN versions.deployed_at IS 'Timestamp when the version was last deployed to production';
+COMMENT ON TABLE workflow_deployments IS 'History of production deployments per workflow';
+COMMENT ON COLUMN workflow_deployments.version_id IS 'Version that was deployed';
+COMMENT ON COLUMN workflow_deployments.deployed_by_user_id IS 'User who deployed the version (audit trail)';
@@ -0,0 +1,5 @@
+-- Rollback workflow soft-delete support
+
+DROP INDEX IF EXISTS idx_workflows_live_owner;
+
+ALTER TABLE workflows DROP COLUMN IF EXISTS deleted_at;
@@ -0,0 +1,11 @@
+-- Add soft-delete support for workflows
+-- Deleted workflows keep their versions, deployments and audit events and can be restored within a grace period
+
+ALTER TABLE workflows
+ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP WITH TIME ZONE;
+
+-- Add partial index so read paths only scan live workflows
+CREATE INDEX IF NOT EXISTS idx_workflows_live_owner ON workflows(created_by_user_id) WHERE deleted_at IS NULL;
+
+-- Add comments for documentation
+COMMENT ON COLUMN workflows.deleted_at IS 'Timestamp when the workflow was soft-deleted; NULL for live workflows';
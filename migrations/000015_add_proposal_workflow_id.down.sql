@@ -0,0 +1,7 @@
+-- Rollback proposal workflow link
+
+DROP INDEX IF EXISTS idx_proposals_workflow_created;
+
+ALTER TABLE proposals DROP CONSTRAINT IF EXISTS fk_proposals_workflow;
+
+ALTER TABLE proposals DROP COLUMN IF EXISTS workflow_id;
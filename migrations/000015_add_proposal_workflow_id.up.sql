@@ -0,0 +1,21 @@
+-- Link proposals directly to their workflow
+-- Keeps a workflow's refinement history listable after its draft is published or discarded
+
+ALTER TABLE proposals
+ADD COLUMN IF NOT EXISTS workflow_id UUID;
+
+-- Backfill from the proposals' drafts
+UPDATE proposals p
+SET workflow_id = d.workflow_id
+FROM drafts d
+WHERE p.draft_id = d.id AND p.workflow_id IS NULL;
+
+ALTER TABLE proposals DROP CONSTRAINT IF EXISTS fk_proposals_workflow;
+ALTER TABLE proposals ADD CONSTRAINT fk_proposals_workflow FOREIGN KEY (workflow_id)
+    REFERENCES workflows(id) ON DELETE CASCADE;
+
+-- Add index for per-workflow proposal history
+CREATE INDEX IF NOT EXISTS idx_proposals_workflow_created ON proposals(workflow_id, created_at DESC);
+
+-- Add comment for new field
+COMMENT ON COLUMN proposals.workflow_id IS 'Workflow the proposal refines (kept when the draft is published or discarded)';
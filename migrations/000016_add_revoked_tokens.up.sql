@@ -0,0 +1,15 @@
+-- Add denylist of revoked JWTs
+-- Tokens are stateless, so logout records the token's jti here until the token would have expired anyway
+
+CREATE TABLE IF NOT EXISTS revoked_tokens (
+    jti TEXT PRIMARY KEY,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    revoked_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+-- Add index for pruning rows of tokens that have expired
+CREATE INDEX IF NOT EXISTS idx_revoked_tokens_expires_at ON revoked_tokens(expires_at);
+
+-- Add comments for documentation
+COMMENT ON TABLE revoked_tokens IS 'JWT IDs refused by auth until the token expires';
+COMMENT ON COLUMN revoked_tokens.expires_at IS 'Expiry of the revoked token; the row can be pruned after this';
@@ -0,0 +1,5 @@
+-- Rollback workflow sharing
+
+DROP INDEX IF EXISTS idx_workflow_access_user_id;
+
+DROP TABLE IF EXISTS workflow_access;
@@ -0,0 +1,35 @@
+-- Create workflow_access table for sharing workflows between users
+-- Mirrors proposal_access; editors may refine, publish and deploy, viewers may only read
+
+CREATE TABLE IF NOT EXISTS workflow_access (
+    workflow_id UUID NOT NULL,
+    user_id UUID NOT NULL,
+    access_type VARCHAR(50) NOT NULL DEFAULT 'viewer',
+    granted_by_user_id UUID,
+    granted_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+
+    -- Constraints
+    PRIMARY KEY (workflow_id, user_id),
+    CONSTRAINT workflow_access_type_valid CHECK (access_type IN ('owner', 'editor', 'viewer')),
+    CONSTRAINT fk_workflow_access_workflow FOREIGN KEY (workflow_id)
+        REFERENCES workflows(id) ON DELETE CASCADE,
+    CONSTRAINT fk_workflow_access_user FOREIGN KEY (user_id)
+        REFERENCES users(id) ON DELETE CASCADE,
+    CONSTRAINT fk_workflow_access_granted_by FOREIGN KEY (granted_by_user_id)
+        REFERENCES users(id) ON DELETE SET NULL
+);
+
+-- Backfill owner rows for existing workflows
+INSERT INTO workflow_access (workflow_id, user_id, access_type)
+SELECT id, created_by_user_id, 'owner'
+FROM workflows
+ON CONFLICT (workflow_id, user_id) DO NOTHING;
+
+-- Add index for listing workflows shared with a user
+CREATE INDEX IF NOT EXISTS idx_workflow_access_user_id ON workflow_access(user_id);
+
+-- Add comments for workflow_access table
+COMMENT ON TABLE workflow_access IS 'User authorization for workflow access';
+COMMENT ON COLUMN workflow_access.access_type IS 'Type of access: owner, editor, viewer';
+COMMENT ON COLUMN workflow_access.granted_by_user_id IS 'Owner who shared the workflow (NULL for owner rows)';
+COMMENT ON COLUMN workflow_access.granted_at IS 'Timestamp when access was granted';
@@ -0,0 +1,10 @@
+-- Rollback 'cancelled' proposal status
+
+-- Cancelled proposals fall back to failed, the closest status the old constraint allows
+UPDATE proposals SET status = 'failed' WHERE status = 'cancelled';
+
+COMMENT ON COLUMN proposals.status IS 'Proposal status: pending, approved, rejected, superseded';
+
+ALTER TABLE proposals DROP CONSTRAINT IF EXISTS status_valid;
+ALTER TABLE proposals ADD CONSTRAINT status_valid 
+    CHECK (status IN ('pending', 'processing', 'completed', 'failed', 'approved', 'rejected', 'superseded', 'resolved'));
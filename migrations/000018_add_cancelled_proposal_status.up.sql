@@ -0,0 +1,8 @@
+-- Add 'cancelled' proposal status
+-- Set when a user aborts an in-flight refinement; cancelled proposals are terminal
+
+ALTER TABLE proposals DROP CONSTRAINT IF EXISTS status_valid;
+ALTER TABLE proposals ADD CONSTRAINT status_valid 
+    CHECK (status IN ('pending', 'processing', 'completed', 'failed', 'approved', 'rejected', 'superseded', 'resolved', 'cancelled'));
+
+COMMENT ON COLUMN proposals.status IS 'Proposal status: pending, processing, completed, failed, resolved, cancelled';
@@ -0,0 +1,6 @@
+-- Rollback cleanup_jobs table
+
+DROP INDEX IF EXISTS idx_cleanup_jobs_thread_id;
+DROP INDEX IF EXISTS idx_cleanup_jobs_due;
+
+DROP TABLE IF EXISTS cleanup_jobs;
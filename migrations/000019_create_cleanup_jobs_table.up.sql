@@ -0,0 +1,29 @@
+-- Create cleanup_jobs table for deepagents-runtime thread cleanup
+-- Jobs are enqueued in the transaction that finishes a proposal and retried with backoff until done
+
+CREATE TABLE IF NOT EXISTS cleanup_jobs (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    thread_id VARCHAR(255) NOT NULL,
+    status VARCHAR(50) NOT NULL DEFAULT 'PENDING',
+    attempts INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT,
+    next_attempt_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    completed_at TIMESTAMP WITH TIME ZONE,
+    dead_lettered_at TIMESTAMP WITH TIME ZONE,
+
+    -- Constraints
+    CONSTRAINT cleanup_job_status_valid CHECK (status IN ('PENDING', 'DONE', 'DEAD_LETTER')),
+    CONSTRAINT cleanup_job_attempts_non_negative CHECK (attempts >= 0)
+);
+
+-- Indexes for the worker (due pending scan) and completing jobs by thread
+CREATE INDEX IF NOT EXISTS idx_cleanup_jobs_due ON cleanup_jobs(next_attempt_at)
+    WHERE status = 'PENDING';
+CREATE INDEX IF NOT EXISTS idx_cleanup_jobs_thread_id ON cleanup_jobs(thread_id);
+
+-- Add comments for documentation
+COMMENT ON TABLE cleanup_jobs IS 'Pending deletions of deepagents-runtime thread data, retried until they succeed';
+COMMENT ON COLUMN cleanup_jobs.status IS 'Job status: PENDING (due at next_attempt_at), DONE, DEAD_LETTER (attempts exhausted)';
+COMMENT ON COLUMN cleanup_jobs.attempts IS 'Number of failed cleanup attempts';
+COMMENT ON COLUMN cleanup_jobs.next_attempt_at IS 'Earliest time the worker retries the job; backs off exponentially';
@@ -0,0 +1,3 @@
+-- Rollback agent_events table
+
+DROP TABLE IF EXISTS agent_events;
@@ -0,0 +1,23 @@
+-- Create append-only agent_events table (event store)
+-- Each aggregate's events are numbered 1, 2, 3, ...; the unique version rejects concurrent writers
+
+CREATE TABLE IF NOT EXISTS agent_events (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    aggregate_type VARCHAR(100) NOT NULL,
+    aggregate_id UUID NOT NULL,
+    version INTEGER NOT NULL,
+    event_type VARCHAR(100) NOT NULL,
+    data JSONB NOT NULL DEFAULT '{}'::jsonb,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+
+    -- Constraints
+    CONSTRAINT agent_events_aggregate_version_unique UNIQUE (aggregate_id, version),
+    CONSTRAINT agent_events_version_positive CHECK (version > 0),
+    CONSTRAINT agent_events_data_is_object CHECK (jsonb_typeof(data) = 'object')
+);
+
+-- Add comments for documentation
+COMMENT ON TABLE agent_events IS 'Append-only history of domain events, replayable per aggregate';
+COMMENT ON COLUMN agent_events.aggregate_type IS 'Type of entity the event belongs to (workflow)';
+COMMENT ON COLUMN agent_events.version IS 'Position of the event in its aggregate''s history, starting at 1';
+COMMENT ON COLUMN agent_events.event_type IS 'Domain event name, e.g. workflow.created';
@@ -0,0 +1,13 @@
+-- Rollback workflow audit event sequence
+
+DROP INDEX IF EXISTS idx_workflow_audit_events_workflow_sequence;
+CREATE INDEX IF NOT EXISTS idx_workflow_audit_events_workflow ON workflow_audit_events(workflow_id, created_at);
+
+ALTER TABLE workflow_audit_events DROP CONSTRAINT IF EXISTS workflow_audit_events_sequence_unique;
+
+ALTER TABLE workflow_audit_events ALTER COLUMN created_at SET DEFAULT NOW();
+COMMENT ON COLUMN workflow_audit_events.created_at IS NULL;
+
+ALTER TABLE workflow_audit_events DROP COLUMN IF EXISTS sequence;
+
+DROP SEQUENCE IF EXISTS workflow_audit_events_sequence_seq;
@@ -0,0 +1,41 @@
+-- Give workflow audit events an exact order
+-- NOW() is the transaction start, so actions in one transaction (or within the
+-- same microsecond) tied on created_at; sequence is the insertion order
+
+CREATE SEQUENCE IF NOT EXISTS workflow_audit_events_sequence_seq AS BIGINT;
+
+ALTER TABLE workflow_audit_events
+ADD COLUMN IF NOT EXISTS sequence BIGINT;
+
+-- Backfill existing events in their best known order
+UPDATE workflow_audit_events e
+SET sequence = ordered.sequence
+FROM (
+    SELECT id, ROW_NUMBER() OVER (ORDER BY created_at, id) AS sequence
+    FROM workflow_audit_events
+) ordered
+WHERE e.id = ordered.id AND e.sequence IS NULL;
+
+SELECT setval(
+    'workflow_audit_events_sequence_seq',
+    COALESCE((SELECT MAX(sequence) FROM workflow_audit_events), 0) + 1,
+    false
+);
+
+ALTER TABLE workflow_audit_events
+    ALTER COLUMN sequence SET DEFAULT nextval('workflow_audit_events_sequence_seq'),
+    ALTER COLUMN sequence SET NOT NULL,
+    ALTER COLUMN created_at SET DEFAULT clock_timestamp();
+ALTER SEQUENCE workflow_audit_events_sequence_seq OWNED BY workflow_audit_events.sequence;
+
+ALTER TABLE workflow_audit_events DROP CONSTRAINT IF EXISTS workflow_audit_events_sequence_unique;
+ALTER TABLE workflow_audit_events ADD CONSTRAINT workflow_audit_events_sequence_unique UNIQUE (sequence);
+
+-- Replace the chronological index with one in exact order
+DROP INDEX IF EXISTS idx_workflow_audit_events_workflow;
+CREATE INDEX IF NOT EXISTS idx_workflow_audit_events_workflow_sequence
+    ON workflow_audit_events(workflow_id, sequence);
+
+-- Add comments for new field
+COMMENT ON COLUMN workflow_audit_events.sequence IS 'Strictly increasing insertion order; order the trail by this, not created_at';
+COMMENT ON COLUMN workflow_audit_events.created_at IS 'Wall-clock time of the action (clock_timestamp, not transaction start)';
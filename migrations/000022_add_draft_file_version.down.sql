@@ -0,0 +1,5 @@
+-- Rollback draft file versions
+
+ALTER TABLE proposals DROP COLUMN IF EXISTS base_file_versions;
+
+ALTER TABLE draft_specification_files DROP COLUMN IF EXISTS version;
@@ -0,0 +1,15 @@
+-- Add optimistic locking to draft files
+-- Every write to a draft file increments its version; writers that send the
+-- version they read are refused when the file changed in between
+
+ALTER TABLE draft_specification_files
+ADD COLUMN IF NOT EXISTS version INTEGER NOT NULL DEFAULT 1;
+
+-- Versions of the draft's files when a refinement started, so approving it
+-- cannot overwrite changes made to those files since
+ALTER TABLE proposals
+ADD COLUMN IF NOT EXISTS base_file_versions JSONB;
+
+-- Add comments for new fields
+COMMENT ON COLUMN draft_specification_files.version IS 'Incremented on every write; 1 for a new file';
+COMMENT ON COLUMN proposals.base_file_versions IS 'Draft file path to version when the refinement started; files absent then are omitted';
@@ -0,0 +1,9 @@
+-- Rollback proposal streaming progress
+
+ALTER TABLE proposals DROP CONSTRAINT IF EXISTS progress_percent_range;
+
+ALTER TABLE proposals
+DROP COLUMN IF EXISTS progress_updated_at,
+DROP COLUMN IF EXISTS progress_files_count,
+DROP COLUMN IF EXISTS progress_percent,
+DROP COLUMN IF EXISTS current_step;
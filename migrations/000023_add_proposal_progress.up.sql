@@ -0,0 +1,18 @@
+-- Add streaming progress to proposals
+-- The stream proxy records the latest step, percentage and file count while a
+-- refinement runs, so clients polling the proposal's status can show progress
+
+ALTER TABLE proposals
+ADD COLUMN IF NOT EXISTS current_step VARCHAR(255),
+ADD COLUMN IF NOT EXISTS progress_percent SMALLINT,
+ADD COLUMN IF NOT EXISTS progress_files_count INTEGER,
+ADD COLUMN IF NOT EXISTS progress_updated_at TIMESTAMP WITH TIME ZONE;
+
+ALTER TABLE proposals
+ADD CONSTRAINT progress_percent_range CHECK (progress_percent BETWEEN 0 AND 100);
+
+-- Add comments for new fields
+COMMENT ON COLUMN proposals.current_step IS 'Step named by the latest on_state_update, e.g. Analyzing';
+COMMENT ON COLUMN proposals.progress_percent IS 'Completion percentage reported by the latest on_state_update';
+COMMENT ON COLUMN proposals.progress_files_count IS 'Number of files in the latest on_state_update';
+COMMENT ON COLUMN proposals.progress_updated_at IS 'When the streaming progress was last recorded';
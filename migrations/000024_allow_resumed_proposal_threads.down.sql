@@ -0,0 +1,6 @@
+-- Rollback resumed proposal threads
+-- Fails while proposals still share a thread; resolve or delete them first
+
+DROP INDEX IF EXISTS idx_proposals_active_thread_id;
+
+ALTER TABLE proposals ADD CONSTRAINT unique_thread_id UNIQUE (thread_id);
@@ -0,0 +1,9 @@
+-- Let a follow-up refinement resume the runtime thread of an earlier proposal
+-- Several proposals may now share a thread_id, but only one of them can be
+-- running on the thread at a time
+
+ALTER TABLE proposals DROP CONSTRAINT IF EXISTS unique_thread_id;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_proposals_active_thread_id
+ON proposals(thread_id)
+WHERE status IN ('pending', 'processing');
@@ -0,0 +1,3 @@
+-- Rollback outbox event claims
+
+ALTER TABLE outbox_events DROP COLUMN IF EXISTS claimed_until;
@@ -0,0 +1,7 @@
+-- Let the outbox poller claim events before delivering them outside its transaction
+-- A claimed event is skipped by other pollers until claimed_until passes, so a
+-- poller that dies mid-delivery only delays its events instead of losing them
+
+ALTER TABLE outbox_events ADD COLUMN IF NOT EXISTS claimed_until TIMESTAMP WITH TIME ZONE;
+
+COMMENT ON COLUMN outbox_events.claimed_until IS 'Until when a poller is delivering the event; NULL when unclaimed';
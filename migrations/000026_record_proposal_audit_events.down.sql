@@ -0,0 +1,4 @@
+-- Rollback recorded proposal audit events
+
+DELETE FROM workflow_audit_events
+WHERE action IN ('proposal_created', 'proposal_approved', 'proposal_rejected', 'proposal_cancelled');
@@ -0,0 +1,33 @@
+-- Record proposal lifecycle actions in the workflow audit trail
+-- The audit log used to derive them from the proposals table, which loses
+-- history when retention purges proposals or a draft discard deletes them;
+-- they are now recorded when they happen, so backfill the existing ones
+
+INSERT INTO workflow_audit_events (workflow_id, user_id, action, details, created_at)
+SELECT history.workflow_id, history.user_id, history.action,
+       jsonb_build_object('proposal_id', history.proposal_id), history.occurred_at
+FROM (
+    SELECT p.workflow_id, p.created_by_user_id AS user_id, 'proposal_created' AS action,
+           p.id AS proposal_id, p.created_at AS occurred_at
+    FROM proposals p
+    UNION ALL
+    SELECT p.workflow_id, p.resolved_by_user_id, 'proposal_' || COALESCE(p.resolution, p.status),
+           p.id, p.resolved_at
+    FROM proposals p
+    WHERE p.resolved_at IS NOT NULL
+    UNION ALL
+    SELECT p.workflow_id, (p.ai_generated_content->'cancelled'->>'user_id')::uuid, 'proposal_cancelled',
+           p.id, p.completed_at
+    FROM proposals p
+    WHERE p.status = 'cancelled'
+) history
+JOIN users u ON u.id = history.user_id
+WHERE history.workflow_id IS NOT NULL
+  AND history.occurred_at IS NOT NULL
+  AND NOT EXISTS (
+      SELECT 1 FROM workflow_audit_events e
+      WHERE e.workflow_id = history.workflow_id
+        AND e.action = history.action
+        AND e.details->>'proposal_id' = history.proposal_id::text
+  )
+ORDER BY history.occurred_at;
@@ -0,0 +1,3 @@
+-- Rollback per-user token cutoff
+
+ALTER TABLE users DROP COLUMN IF EXISTS tokens_valid_after;
@@ -0,0 +1,8 @@
+-- Add a per-user token cutoff
+-- Logging out or changing the password refuses every token the user was issued
+-- before this time, not just the one presented; NULL means no cutoff
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS tokens_valid_after TIMESTAMP WITH TIME ZONE;
+
+-- Add comment for documentation
+COMMENT ON COLUMN users.tokens_valid_after IS 'Tokens issued before this time (JWT iat, whole seconds) are refused';
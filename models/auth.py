@@ -0,0 +1,46 @@
+"""Authentication models."""
+
+from pydantic import BaseModel, EmailStr
+from typing import List, Optional
+from datetime import datetime
+
+
+class LoginRequest(BaseModel):
+    """Login request."""
+    email: EmailStr
+    password: str
+
+
+class PasswordChangeRequest(BaseModel):
+    """Password change request."""
+    current_password: str
+    new_password: str
+
+
+class UserInfo(BaseModel):
+    """Public user profile embedded in auth responses."""
+    id: str
+    name: str
+    email: str
+    roles: List[str] = []
+    created_at: Optional[datetime] = None
+
+
+class LoginResponse(BaseModel):
+    """Login response."""
+    token: str
+    user_id: str
+    expires_at: datetime
+    user: UserInfo
+
+
+class WebSocketTokenResponse(BaseModel):
+    """Short-lived token accepted only by WebSocket endpoints."""
+    token: str
+    expires_at: datetime
+
+
+class TokenRefreshResponse(BaseModel):
+    """Replacement for a still-valid access token."""
+    token: str
+    expires_at: datetime
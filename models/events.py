@@ -0,0 +1,38 @@
+"""Outbox event models."""
+
+from pydantic import BaseModel
+from typing import Optional, Dict, Any
+from datetime import datetime
+
+
+# Outbox event delivery statuses
+OUTBOX_STATUS_PENDING = "PENDING"
+OUTBOX_STATUS_PUBLISHED = "PUBLISHED"
+OUTBOX_STATUS_FAILED = "FAILED"
+OUTBOX_STATUS_DEAD_LETTER = "DEAD_LETTER"
+
+
+class OutboxEvent(BaseModel):
+    """Domain event awaiting delivery to downstream consumers."""
+    id: str
+    aggregate_type: str
+    aggregate_id: str
+    event_type: str
+    payload: Dict[str, Any]
+    status: str
+    retry_count: int
+    last_error: Optional[str] = None
+    created_at: datetime
+    published_at: Optional[datetime] = None
+    dead_lettered_at: Optional[datetime] = None
+
+
+class AgentEvent(BaseModel):
+    """Entry in an aggregate's append-only event history."""
+    id: str
+    aggregate_type: str
+    aggregate_id: str
+    version: int
+    event_type: str
+    data: Dict[str, Any]
+    created_at: datetime
@@ -0,0 +1,95 @@
+"""Job request models for deepagents-runtime invocations."""
+
+from pydantic import BaseModel, Field
+from typing import Optional, List, Dict, Any
+
+# Runtime settings a refinement request may override; anything else is rejected
+ALLOWED_RUNTIME_CONFIG_KEYS = frozenset({"model", "temperature", "top_p", "max_tokens"})
+
+
+class JobMessage(BaseModel):
+    """Chat message passed to the agent."""
+    role: str
+    content: str
+
+
+class RefinementContext(BaseModel):
+    """Request context the user attached to a refinement."""
+    file_path: Optional[str] = None
+    selection: Optional[str] = None
+
+
+class JobInputPayload(BaseModel):
+    """Per-request input for a deepagents-runtime job."""
+    messages: List[JobMessage] = Field(default_factory=list)
+    instructions: str
+    context: RefinementContext = Field(default_factory=RefinementContext)
+
+
+class JobRequest(BaseModel):
+    """
+    Request body for deepagents-runtime /invoke.
+
+    agent_definition carries agent configuration only; anything describing
+    the current request (instructions, context) belongs in input_payload.
+    config holds per-request runtime overrides such as model or temperature.
+    thread_id names an existing runtime thread to resume from its
+    checkpoint; without it the runtime starts a new thread.
+    """
+    job_id: str
+    trace_id: str
+    agent_definition: Dict[str, Any] = Field(default_factory=dict)
+    input_payload: JobInputPayload
+    config: Dict[str, Any] = Field(default_factory=dict)
+    thread_id: Optional[str] = None
+
+
+def validate_runtime_config(runtime_config: Any) -> Dict[str, Any]:
+    """
+    Check a refinement's runtime config against the allowlist.
+
+    Raises:
+        ValueError: If the config is not an object, uses a key outside
+            ALLOWED_RUNTIME_CONFIG_KEYS, or has a non-scalar value
+    """
+    if runtime_config is None:
+        return {}
+    if not isinstance(runtime_config, dict):
+        raise ValueError("runtime_config must be an object")
+
+    forbidden = sorted(key for key in runtime_config if key not in ALLOWED_RUNTIME_CONFIG_KEYS)
+    if forbidden:
+        raise ValueError(f"runtime_config keys not allowed: {', '.join(forbidden)}")
+
+    for key, value in runtime_config.items():
+        if not isinstance(value, (str, int, float, bool)):
+            raise ValueError(f"runtime_config value for {key} must be a string, number, or boolean")
+
+    return dict(runtime_config)
+
+
+def build_refinement_job_request(
+    proposal_id: str,
+    user_prompt: str,
+    agent_definition: Optional[Dict[str, Any]] = None,
+    context_file_path: Optional[str] = None,
+    context_selection: Optional[str] = None,
+    runtime_config: Optional[Dict[str, Any]] = None,
+    thread_id: Optional[str] = None
+) -> JobRequest:
+    """Assemble the runtime job request for a refinement proposal."""
+    return JobRequest(
+        job_id=f"refinement-{proposal_id}",
+        trace_id=f"trace-{proposal_id}",
+        agent_definition=agent_definition or {},
+        input_payload=JobInputPayload(
+            messages=[JobMessage(role="user", content=user_prompt)],
+            instructions=user_prompt,
+            context=RefinementContext(
+                file_path=context_file_path,
+                selection=context_selection
+            )
+        ),
+        config=runtime_config or {},
+        thread_id=thread_id
+    )
@@ -0,0 +1,25 @@
+"""Specification validation models."""
+
+from pydantic import BaseModel, Field, computed_field
+from typing import List
+
+
+class ValidationIssue(BaseModel):
+    """A single problem found in a specification."""
+    code: str
+    path: str
+    message: str
+
+
+class ValidationResult(BaseModel):
+    """Outcome of validating a specification; valid when there are no issues."""
+    issues: List[ValidationIssue] = Field(default_factory=list)
+
+    @computed_field
+    @property
+    def valid(self) -> bool:
+        return not self.issues
+
+    def add(self, code: str, path: str, message: str) -> None:
+        """Record an issue."""
+        self.issues.append(ValidationIssue(code=code, path=path, message=message))
@@ -1,7 +1,7 @@
 """Workflow models."""
 
 from pydantic import BaseModel
-from typing import Optional
+from typing import Literal, Optional
 from datetime import datetime
 
 
@@ -9,6 +9,8 @@ class WorkflowCreate(BaseModel):
     """Workflow creation request."""
     name: str
     description: Optional[str] = None
+    # Starter specification to seed the draft with, e.g. "single-agent"
+    template_id: Optional[str] = None
 
 
 class WorkflowResponse(BaseModel):
@@ -19,3 +21,54 @@ class WorkflowResponse(BaseModel):
     created_by_user_id: str
     created_at: datetime
     updated_at: datetime
+    access_type: Optional[str] = None
+
+
+class WorkflowShareRequest(BaseModel):
+    """Request to share a workflow with another user."""
+    email: str
+    access_type: Literal["editor", "viewer"] = "viewer"
+
+
+class WorkflowTransferRequest(BaseModel):
+    """Request to transfer a workflow to a new owner."""
+    user_id: str
+
+
+class DraftFileEdit(BaseModel):
+    """
+    Partial edit to a draft file, sent by the IDE's autosave.
+    
+    append adds content to the end of the file; replace_range replaces the
+    1-based, inclusive lines start_line..end_line with content.
+    """
+    op: Literal["append", "replace_range"]
+    content: str
+    start_line: Optional[int] = None
+    end_line: Optional[int] = None
+    # File version the edit was made against; refused if the file changed since
+    expected_version: Optional[int] = None
+
+
+class DraftFileWrite(BaseModel):
+    """Whole content of a draft file written by hand in the IDE."""
+    content: str
+    type: Literal["markdown", "json", "yaml"] = "markdown"
+    # File version the content replaces, 0 for a new file; refused if the file changed since
+    expected_version: Optional[int] = None
+
+
+class DraftReset(BaseModel):
+    """Request to replace the draft with the production version's files."""
+    # Must be true: the reset discards every unpublished draft edit
+    confirm: bool = False
+
+
+class ProposalFilter(BaseModel):
+    """Filters for listing a workflow's proposals; unset fields match every proposal."""
+    status: Optional[str] = None
+    draft_id: Optional[str] = None
+    # File path the refinement was scoped to
+    context_file_path: Optional[str] = None
+    created_after: Optional[datetime] = None
+    created_before: Optional[datetime] = None
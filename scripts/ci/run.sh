@@ -52,15 +52,14 @@ fi
 
 echo "🔍 Final DEEPAGENTS_RUNTIME_URL: ${DEEPAGENTS_RUNTIME_URL:-not set}"
 
-# 3. Start the application using uvicorn
+# 3. Start the application
 # - Dependencies pre-installed in container
 # - Application code at /app/ 
-# - Uvicorn runs the FastAPI app from api.main:app
+# - api.main runs uvicorn itself so open refinement streams are drained on
+#   shutdown instead of being cut off mid-refinement
+# - WebSocket clients are pinged so silently dropped connections are closed
 echo "🚀 Starting ide-orchestrator service..."
 
-exec uvicorn api.main:app \
-    --host 0.0.0.0 \
-    --port "${PORT}" \
-    --log-level "${LOG_LEVEL}" \
-    --no-access-log \
-    --proxy-headers
\ No newline at end of file
+export PORT LOG_LEVEL
+export ACCESS_LOG=false
+exec python -m api.main
@@ -15,16 +15,13 @@ import asyncio
 import os
 import sys
 from pathlib import Path
+from typing import Optional
 
 # Add the project root to Python path
 project_root = Path(__file__).parent.parent
 sys.path.insert(0, str(project_root))
 
-import psycopg
-from psycopg.rows import dict_row
-from passlib.context import CryptContext
-import uuid
-from datetime import datetime
+from services.user_service import DuplicateEmailError, UserService, WeakPasswordError, validate_password_strength
 
 
 def get_database_url() -> str:
@@ -44,46 +41,21 @@ def get_database_url() -> str:
     return f"postgresql://{user}:{password}@{host}:{port}/{database}"
 
 
-def create_user(email: str, username: str, password: str, database_url: str) -> str:
+def create_user(email: str, username: str, password: str, database_url: str) -> Optional[str]:
     """
     Create a new user in the database.
     
     Returns:
-        User ID of created user
+        User ID of created user, or None if the email is already registered
     """
-    pwd_context = CryptContext(schemes=["bcrypt"], deprecated="auto")
-    hashed_password = pwd_context.hash(password)
-    user_id = str(uuid.uuid4())
-    now = datetime.utcnow()
+    try:
+        user = UserService(database_url).create_user(username, email, password)
+    except DuplicateEmailError:
+        print(f"❌ User with email '{email}' already exists")
+        return None
     
-    with psycopg.connect(database_url, row_factory=dict_row) as conn:
-        with conn.cursor() as cur:
-            # Check if user already exists
-            cur.execute(
-                "SELECT id FROM users WHERE email = %s OR username = %s",
-                (email, username)
-            )
-            existing_user = cur.fetchone()
-            
-            if existing_user:
-                print(f"❌ User with email '{email}' or username '{username}' already exists")
-                return str(existing_user["id"])
-            
-            # Create new user
-            cur.execute(
-                """
-                INSERT INTO users (id, username, email, password_hash, created_at, updated_at)
-                VALUES (%s, %s, %s, %s, %s, %s)
-                RETURNING id
-                """,
-                (user_id, username, email, hashed_password, now, now)
-            )
-            
-            result = cur.fetchone()
-            conn.commit()
-            
-            print(f"✅ Created user: {username} ({email}) with ID: {user_id}")
-            return str(result["id"])
+    print(f"✅ Created user: {username} ({email}) with ID: {user['id']}")
+    return user["id"]
 
 
 def main():
@@ -100,7 +72,7 @@ def main():
     if args.dev:
         email = "dev@example.com"
         username = "devuser"
-        password = "devpassword"
+        password = "devpassword1"
         print("🔧 Creating default development user...")
     else:
         if not all([args.email, args.username, args.password]):
@@ -111,6 +83,12 @@ def main():
         username = args.username
         password = args.password
     
+    try:
+        validate_password_strength(password)
+    except WeakPasswordError as e:
+        print(f"❌ Error: {e}")
+        sys.exit(1)
+    
     # Get database URL
     try:
         database_url = get_database_url()
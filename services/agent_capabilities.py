@@ -0,0 +1,68 @@
+"""
+Agent capabilities lookup with caching.
+
+The IDE asks which agent types and config schemas deepagents-runtime
+supports. The answer rarely changes, so it is cached for a while; when the
+runtime does not expose capabilities or cannot be reached, an empty
+"unavailable" answer (or the last known one) is served instead of an error.
+"""
+
+import logging
+import os
+import time
+from typing import Dict, Any, Optional, Callable
+
+from .deepagents_client import DeepAgentsRuntimeClient
+
+logger = logging.getLogger(__name__)
+
+DEFAULT_CAPABILITIES_CACHE_SECONDS = 300
+
+
+class AgentCapabilitiesService:
+    """Serve deepagents-runtime capabilities from a time-bounded cache."""
+    
+    def __init__(
+        self,
+        deepagents_client: DeepAgentsRuntimeClient,
+        cache_seconds: Optional[float] = None,
+        clock: Callable[[], float] = time.monotonic
+    ):
+        self.deepagents_client = deepagents_client
+        if cache_seconds is None:
+            cache_seconds = float(os.getenv(
+                "AGENT_CAPABILITIES_CACHE_SECONDS", str(DEFAULT_CAPABILITIES_CACHE_SECONDS)
+            ))
+        self.cache_seconds = cache_seconds
+        self._clock = clock
+        self._cached: Optional[Dict[str, Any]] = None
+        self._expires_at = 0.0
+    
+    async def get_capabilities(self) -> Dict[str, Any]:
+        """
+        Get the supported agent types and their config schemas.
+        
+        Returns:
+            Dictionary with "agents" (list of agent descriptions as reported by
+            the runtime) and "available" (False when the runtime does not
+            expose capabilities or could not be reached)
+        """
+        now = self._clock()
+        if self._cached is not None and now < self._expires_at:
+            return self._cached
+        
+        try:
+            response = await self.deepagents_client.get_capabilities()
+        except Exception as e:
+            logger.warning("Failed to fetch agent capabilities", extra={"error": str(e)})
+            # Prefer a stale answer over none at all; retry on the next request
+            return self._cached or {"agents": [], "available": False}
+        
+        if response is None:
+            capabilities = {"agents": [], "available": False}
+        else:
+            capabilities = {"agents": response.get("agents", []), "available": True}
+        
+        self._cached = capabilities
+        self._expires_at = now + self.cache_seconds
+        return capabilities
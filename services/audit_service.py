@@ -78,6 +78,10 @@ class AuditService:
             "files_count": len(generated_files) if generated_files else 0
         }
         
+        # Keep the full failure reason so clients can show why a refinement failed
+        if status == "failed" and result:
+            audit_trail["error"] = str(result)
+        
         return json.dumps(audit_trail)
     
     @staticmethod
@@ -147,6 +151,96 @@ class AuditService:
         
         return json.dumps(audit_trail)
     
+    @staticmethod
+    def add_cancellation_event(
+        current_audit_trail: Optional[Any],
+        user_id: str,
+        reason: Optional[str] = None
+    ) -> str:
+        """
+        Add cancellation event to audit trail.
+        
+        Args:
+            current_audit_trail: Current audit trail as JSON string or already-decoded dictionary
+            user_id: User who cancelled the proposal
+            reason: Optional reason the proxy cancelled it for (e.g., "client_disconnected")
+            
+        Returns:
+            Updated audit trail as JSON string
+        """
+        # Parse existing audit trail
+        audit_trail = {}
+        if isinstance(current_audit_trail, dict):
+            audit_trail = dict(current_audit_trail)
+        elif current_audit_trail:
+            try:
+                audit_trail = json.loads(current_audit_trail)
+            except (json.JSONDecodeError, TypeError):
+                audit_trail = {}
+        
+        # Add cancellation event
+        audit_trail["cancelled"] = {
+            "timestamp": datetime.utcnow().isoformat(),
+            "user_id": user_id,
+            "action": "proposal_cancelled"
+        }
+        if reason:
+            audit_trail["cancelled"]["reason"] = reason
+        
+        return json.dumps(audit_trail)
+    
+    @staticmethod
+    def record_workflow_event(
+        cur,
+        workflow_id: str,
+        user_id: str,
+        action: str,
+        details: Optional[Dict[str, Any]] = None
+    ) -> None:
+        """
+        Append an entry to the workflow-level audit trail.
+        
+        Takes the caller's cursor so the entry commits or rolls back together
+        with the change it records. Entries get a strictly increasing
+        sequence; render the trail ordered by it rather than by created_at.
+        
+        Args:
+            cur: Open database cursor
+            workflow_id: Workflow the action was performed on
+            user_id: User who performed the action
+            action: Action name (e.g. draft_discarded)
+            details: Optional action-specific details
+        """
+        cur.execute(
+            """
+            INSERT INTO workflow_audit_events (workflow_id, user_id, action, details)
+            VALUES (%s, %s, %s, %s)
+            """,
+            (workflow_id, user_id, action, json.dumps(details or {}))
+        )
+    
+    @staticmethod
+    def get_error(audit_trail: Optional[Any]) -> Optional[str]:
+        """
+        Get the stored failure reason of a proposal.
+        
+        Args:
+            audit_trail: Audit trail as JSON string or already-decoded dictionary
+            
+        Returns:
+            Failure reason or None if the proposal has not failed
+        """
+        if isinstance(audit_trail, str):
+            try:
+                audit_trail = json.loads(audit_trail)
+            except json.JSONDecodeError:
+                return None
+        
+        if not isinstance(audit_trail, dict):
+            return None
+        
+        return audit_trail.get("error")
+    
     @staticmethod
     def get_audit_summary(audit_trail_json: Optional[str]) -> Dict[str, Any]:
         """
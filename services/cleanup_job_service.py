@@ -0,0 +1,237 @@
+"""
+Cleanup job queue for deepagents-runtime thread data.
+
+Finishing a proposal enqueues a cleanup job in the same transaction, so
+the runtime's checkpointer data is never forgotten when the runtime is
+briefly unavailable. The CleanupWorker retries due jobs with exponential
+backoff and dead-letters them once their attempts are exhausted.
+"""
+
+import asyncio
+import logging
+import os
+from psycopg.rows import dict_row
+from typing import Any, Callable, Awaitable, Dict, Iterable, List, Optional
+
+from core.database import connect
+
+logger = logging.getLogger(__name__)
+
+# Cleanup job statuses
+CLEANUP_JOB_STATUS_PENDING = "PENDING"
+CLEANUP_JOB_STATUS_DONE = "DONE"
+CLEANUP_JOB_STATUS_DEAD_LETTER = "DEAD_LETTER"
+
+DEFAULT_CLEANUP_MAX_ATTEMPTS = 8
+DEFAULT_CLEANUP_RETRY_BASE_SECONDS = 30
+
+# Seconds a claimed job is left to its worker before another worker may retry it
+DEFAULT_CLEANUP_CLAIM_TIMEOUT_SECONDS = 300
+
+CleanupFn = Callable[[str], Awaitable[None]]
+
+
+class CleanupJobService:
+    """Service for managing deepagents-runtime cleanup jobs."""
+
+    def __init__(
+        self,
+        database_url: str,
+        max_attempts: Optional[int] = None,
+        retry_base_seconds: Optional[float] = None,
+        claim_timeout_seconds: Optional[float] = None
+    ):
+        self.database_url = database_url
+        if max_attempts is None:
+            max_attempts = int(os.getenv("CLEANUP_MAX_ATTEMPTS", str(DEFAULT_CLEANUP_MAX_ATTEMPTS)))
+        if retry_base_seconds is None:
+            retry_base_seconds = float(
+                os.getenv("CLEANUP_RETRY_BASE_SECONDS", str(DEFAULT_CLEANUP_RETRY_BASE_SECONDS))
+            )
+        if claim_timeout_seconds is None:
+            claim_timeout_seconds = float(
+                os.getenv("CLEANUP_CLAIM_TIMEOUT_SECONDS", str(DEFAULT_CLEANUP_CLAIM_TIMEOUT_SECONDS))
+            )
+        self.max_attempts = max_attempts
+        self.retry_base_seconds = retry_base_seconds
+        self.claim_timeout_seconds = claim_timeout_seconds
+
+    @staticmethod
+    def enqueue(cur, thread_ids: Iterable[str]) -> None:
+        """
+        Enqueue cleanup jobs for threads.
+
+        Takes the caller's cursor so the jobs commit or roll back together
+        with the proposal changes that made the threads obsolete.
+
+        Args:
+            cur: Open database cursor
+            thread_ids: Thread IDs whose runtime data is no longer needed
+        """
+        for thread_id in thread_ids:
+            cur.execute("INSERT INTO cleanup_jobs (thread_id) VALUES (%s)", (thread_id,))
+
+    def complete(self, thread_id: str) -> int:
+        """
+        Mark a thread's pending cleanup jobs as done.
+
+        Args:
+            thread_id: Thread ID that was cleaned up
+
+        Returns:
+            Number of jobs completed
+        """
+        with connect(self.database_url) as conn:
+            with conn.cursor() as cur:
+                cur.execute(
+                    """
+                    UPDATE cleanup_jobs
+                    SET status = %s, completed_at = NOW()
+                    WHERE thread_id = %s AND status = %s
+                    """,
+                    (CLEANUP_JOB_STATUS_DONE, thread_id, CLEANUP_JOB_STATUS_PENDING)
+                )
+                conn.commit()
+                return cur.rowcount
+
+    async def process_batch(self, cleanup_fn: CleanupFn, batch_size: int = 20) -> int:
+        """
+        Run a batch of due cleanup jobs.
+
+        Jobs are claimed with FOR UPDATE SKIP LOCKED in a short transaction
+        that moves their next_attempt_at past the claim timeout, so several
+        orchestrator replicas can run workers without cleaning up the same
+        thread twice. The runtime is called after that transaction committed,
+        so no connection or row lock is held meanwhile, and each outcome is
+        recorded in a transaction of its own. A failed job is retried after
+        retry_base_seconds * 2^attempts, or dead-lettered once it reaches
+        max_attempts; jobs of a worker that died are retried once their claim
+        expires.
+
+        Args:
+            cleanup_fn: Async callable that cleans up one thread, raising on failure
+            batch_size: Maximum number of jobs to claim
+
+        Returns:
+            Number of jobs completed successfully
+        """
+        completed = 0
+
+        for job in self._claim_batch(batch_size):
+            try:
+                await cleanup_fn(job["thread_id"])
+            except Exception as e:
+                with connect(self.database_url) as conn:
+                    with conn.cursor() as cur:
+                        status = self._record_failure(cur, job, str(e))
+                        conn.commit()
+                logger.warning(
+                    "Cleanup of thread failed",
+                    extra={
+                        "thread_id": job["thread_id"],
+                        "attempt": job["attempts"] + 1,
+                        "status": status,
+                        "error": str(e),
+                    }
+                )
+                continue
+
+            with connect(self.database_url) as conn:
+                with conn.cursor() as cur:
+                    cur.execute(
+                        "UPDATE cleanup_jobs SET status = %s, completed_at = NOW() WHERE id = %s",
+                        (CLEANUP_JOB_STATUS_DONE, job["id"])
+                    )
+                    conn.commit()
+            completed += 1
+
+        return completed
+
+    def _claim_batch(self, batch_size: int) -> List[Dict[str, Any]]:
+        """Claim up to batch_size due jobs by pushing their next attempt past the claim timeout."""
+        with connect(self.database_url, row_factory=dict_row) as conn:
+            with conn.transaction():
+                with conn.cursor() as cur:
+                    cur.execute(
+                        """
+                        UPDATE cleanup_jobs
+                        SET next_attempt_at = NOW() + make_interval(secs => %s)
+                        WHERE id IN (
+                            SELECT id FROM cleanup_jobs
+                            WHERE status = %s AND next_attempt_at <= NOW()
+                            ORDER BY next_attempt_at
+                            LIMIT %s
+                            FOR UPDATE SKIP LOCKED
+                        )
+                        RETURNING id, thread_id, attempts
+                        """,
+                        (self.claim_timeout_seconds, CLEANUP_JOB_STATUS_PENDING, batch_size)
+                    )
+                    return cur.fetchall()
+
+    def _record_failure(self, cur, job, error_message: str) -> str:
+        """Schedule a failed job's next attempt, dead-lettering it past the threshold."""
+        attempts = job["attempts"] + 1
+        if attempts >= self.max_attempts:
+            cur.execute(
+                """
+                UPDATE cleanup_jobs
+                SET attempts = %s, last_error = %s, status = %s, dead_lettered_at = NOW()
+                WHERE id = %s
+                """,
+                (attempts, error_message, CLEANUP_JOB_STATUS_DEAD_LETTER, job["id"])
+            )
+            return CLEANUP_JOB_STATUS_DEAD_LETTER
+
+        cur.execute(
+            """
+            UPDATE cleanup_jobs
+            SET attempts = %s, last_error = %s, next_attempt_at = NOW() + make_interval(secs => %s)
+            WHERE id = %s
+            """,
+            (attempts, error_message, self.retry_base_seconds * 2 ** job["attempts"], job["id"])
+        )
+        return CLEANUP_JOB_STATUS_PENDING
+
+
+class CleanupWorker:
+    """Background loop that retries due cleanup jobs."""
+
+    def __init__(
+        self,
+        cleanup_job_service: CleanupJobService,
+        cleanup_fn: CleanupFn,
+        interval_seconds: Optional[float] = None,
+        batch_size: int = 20
+    ):
+        self.cleanup_job_service = cleanup_job_service
+        self.cleanup_fn = cleanup_fn
+        if interval_seconds is None:
+            interval_seconds = float(os.getenv("CLEANUP_WORKER_INTERVAL_SECONDS", "30"))
+        self.interval_seconds = interval_seconds
+        self.batch_size = batch_size
+        self._stopped = asyncio.Event()
+
+    async def run_once(self) -> int:
+        """Run one batch of due cleanup jobs."""
+        completed = await self.cleanup_job_service.process_batch(self.cleanup_fn, self.batch_size)
+        if completed:
+            logger.info("Cleaned up deepagents-runtime threads", extra={"threads": completed})
+        return completed
+
+    async def run(self) -> None:
+        """Poll until stop() is called."""
+        while not self._stopped.is_set():
+            try:
+                await self.run_once()
+            except Exception as e:
+                logger.error("Cleanup worker iteration failed", extra={"error": str(e)})
+
+            try:
+                await asyncio.wait_for(self._stopped.wait(), timeout=self.interval_seconds)
+            except asyncio.TimeoutError:
+                pass
+
+    def stop(self) -> None:
+        """Signal the poll loop to exit."""
+        self._stopped.set()
@@ -6,30 +6,183 @@ including HTTP calls, WebSocket connections, and cleanup operations.
 """
 
 import asyncio
+import functools
+import json
+import os
+import time
 import httpx
 import pybreaker
+from dataclasses import dataclass
 from typing import Dict, Any, Optional
 from opentelemetry import trace
 from opentelemetry.propagate import inject
 from core.metrics import metrics
+from core.request_context import request_id_headers
+from models.job import build_refinement_job_request
 
 tracer = trace.get_tracer(__name__)
 
+DEFAULT_DEEPAGENTS_RUNTIME_URL = "http://deepagents-runtime.intelligence-deepagents.svc.cluster.local:8000"
+
+# Seconds each kind of runtime request may take, overridable with DEEPAGENTS_<OPERATION>_TIMEOUT;
+# "control" covers capabilities, cleanup and cancel requests, "stream_connect" the stream handshake.
+# Streams themselves have no deadline, only the proxy's idle timeout.
+DEFAULT_OPERATION_TIMEOUTS = {
+    "invoke": 10.0,
+    "state": 10.0,
+    "health": 3.0,
+    "control": 10.0,
+    "stream_connect": 10.0,
+}
+
+
+def get_operation_timeout(operation: str) -> Optional[float]:
+    """Read the timeout of a runtime operation from DEEPAGENTS_<OPERATION>_TIMEOUT; None when set to 0."""
+    default = DEFAULT_OPERATION_TIMEOUTS[operation]
+    timeout = float(os.getenv(f"DEEPAGENTS_{operation.upper()}_TIMEOUT", str(default)))
+    return timeout if timeout > 0 else None
+
+
+def operation_deadline(operation: str):
+    """Deadline for one runtime request, raising TimeoutError when the operation's timeout passes."""
+    return asyncio.timeout(get_operation_timeout(operation))
+
+
+def outbound_headers() -> Dict[str, str]:
+    """Headers for a runtime request: the OpenTelemetry trace context and the current request ID."""
+    headers = request_id_headers()
+    inject(headers)
+    return headers
+
+
+def describe_request_error(error: Exception, operation: str) -> str:
+    """Describe a failed runtime request, naming the timeout when it ran out."""
+    if isinstance(error, TimeoutError):
+        return f"no answer within {get_operation_timeout(operation):g}s"
+    return str(error)
+
+
+class InvalidRuntimeResponse(Exception):
+    """Raised when deepagents-runtime answers successfully but the body is unusable."""
+
+
+@dataclass(frozen=True)
+class CancelEvent:
+    """
+    Control message asking deepagents-runtime to stop a thread, sent over its open stream.
+    
+    It complements DeepAgentsRuntimeClient.cancel_thread: the stream
+    message reaches the runtime even when the HTTP call cannot, and the
+    HTTP call reaches it when no stream is open.
+    """
+    thread_id: str
+    reason: str
+    
+    def to_message(self) -> str:
+        """Encode the event as a stream message, shaped like the runtime's own events."""
+        return json.dumps({
+            "event_type": "cancel",
+            "data": {"thread_id": self.thread_id, "reason": self.reason}
+        })
+
+
+class BreakerOpenedListener(pybreaker.CircuitBreakerListener):
+    """Remember when the circuit breaker last opened."""
+    
+    def __init__(self):
+        self.opened_at: Optional[float] = None
+    
+    def state_change(self, cb, old_state, new_state) -> None:
+        if new_state.name == pybreaker.STATE_OPEN:
+            self.opened_at = time.monotonic()
+
+
+breaker_listener = BreakerOpenedListener()
+
 # Circuit breaker for deepagents-runtime calls
 deepagents_breaker = pybreaker.CircuitBreaker(
     fail_max=5,
     reset_timeout=60,
-    exclude=[httpx.HTTPStatusError]  # Don't break on HTTP errors, only on connection issues
+    # Don't break on HTTP errors or malformed bodies, only on connection issues
+    exclude=[httpx.HTTPStatusError, InvalidRuntimeResponse],
+    listeners=[breaker_listener]
 )
 
 
+def current_breaker_state() -> str:
+    """
+    State of the deepagents-runtime circuit breaker: "closed", "open" or "half-open".
+    
+    pybreaker only leaves the open state on the next call, so an open breaker
+    whose reset timeout has passed is reported as half-open: its next call
+    is let through as a trial.
+    """
+    state = deepagents_breaker.current_state
+    opened_at = breaker_listener.opened_at
+    if (
+        state == pybreaker.STATE_OPEN
+        and opened_at is not None
+        and time.monotonic() - opened_at >= deepagents_breaker.reset_timeout
+    ):
+        return pybreaker.STATE_HALF_OPEN
+    return state
+
+
+def _record_breaker_outcome(error: Optional[Exception]) -> None:
+    """Report a finished runtime call to the breaker; excluded errors count as successes."""
+    def outcome():
+        if error is not None:
+            raise error
+    
+    try:
+        deepagents_breaker.call(outcome)
+    except Exception:
+        # The call's own error, or CircuitBreakerError when it tripped the breaker
+        pass
+
+
+def guarded_by_breaker(endpoint: str):
+    """
+    Guard a runtime call with the circuit breaker, counting the calls it refuses.
+    
+    pybreaker cannot await coroutines, so the call runs outside the breaker
+    and its outcome is reported to it afterwards.
+    
+    Raises:
+        pybreaker.CircuitBreakerError: If the breaker is open
+    """
+    def decorate(func):
+        @functools.wraps(func)
+        async def guarded(*args, **kwargs):
+            if current_breaker_state() == pybreaker.STATE_OPEN:
+                metrics.record_circuit_breaker_rejection(endpoint)
+                raise pybreaker.CircuitBreakerError("deepagents-runtime circuit breaker is open")
+            
+            try:
+                result = await func(*args, **kwargs)
+            except Exception as e:
+                _record_breaker_outcome(e)
+                raise
+            _record_breaker_outcome(None)
+            return result
+        return guarded
+    return decorate
+
+
+metrics.track_circuit_breaker(current_breaker_state)
+
+
 class DeepAgentsRuntimeClient:
     """Client for communicating with deepagents-runtime service."""
     
     def __init__(self, base_url: str):
         self.base_url = base_url.rstrip('/')
     
-    @deepagents_breaker
+    def breaker_state(self) -> str:
+        """State of the circuit breaker guarding this client's calls: "closed", "open" or "half-open"."""
+        return current_breaker_state()
+    
+    @guarded_by_breaker("invoke")
     async def invoke_job(self, payload: Dict[str, Any]) -> Dict[str, Any]:
         """
         Invoke a job on deepagents-runtime.
@@ -38,9 +191,10 @@ class DeepAgentsRuntimeClient:
             payload: Job payload with job_id, trace_id, agent_definition, input_payload
             
         Returns:
-            Response from deepagents-runtime with thread_id
+            Response from deepagents-runtime with a non-empty thread_id
             
         Raises:
+            InvalidRuntimeResponse: If the job was accepted without a thread_id
             Exception: If the request fails
         """
         with tracer.start_as_current_span("deepagents_invoke") as span:
@@ -49,11 +203,10 @@ class DeepAgentsRuntimeClient:
                 "trace_id": payload.get("trace_id", "unknown")
             })
             
-            headers = {}
-            inject(headers)  # Inject OpenTelemetry trace context
+            headers = outbound_headers()
             
             try:
-                async with httpx.AsyncClient(timeout=30.0) as client:
+                async with httpx.AsyncClient(timeout=None) as client, operation_deadline("invoke"):
                     response = await client.post(
                         f"{self.base_url}/invoke",
                         json=payload,
@@ -63,19 +216,29 @@ class DeepAgentsRuntimeClient:
                     metrics.record_deepagents_request("invoke", str(response.status_code))
                     span.set_attributes({"http.status_code": response.status_code})
                     
-                    if response.status_code != 200:
+                    if response.status_code not in [200, 202]:
                         error_msg = f"Deepagents-runtime invoke failed: {response.status_code}"
                         span.record_exception(Exception(error_msg))
                         raise Exception(error_msg)
                     
-                    return response.json()
+                    result = response.json()
+                    # Without a thread_id the job can never be streamed or cleaned up
+                    thread_id = result.get("thread_id") if isinstance(result, dict) else None
+                    if not isinstance(thread_id, str) or not thread_id.strip():
+                        error = InvalidRuntimeResponse(
+                            f"Deepagents-runtime accepted the job ({response.status_code}) without a thread_id"
+                        )
+                        span.record_exception(error)
+                        raise error
+                    
+                    return result
                     
-            except httpx.RequestError as e:
+            except (httpx.RequestError, TimeoutError) as e:
                 metrics.record_deepagents_request("invoke", "error")
                 span.record_exception(e)
-                raise Exception(f"Network error calling deepagents-runtime: {str(e)}")
+                raise Exception(f"Network error calling deepagents-runtime: {describe_request_error(e, 'invoke')}")
     
-    @deepagents_breaker
+    @guarded_by_breaker("state")
     async def get_execution_state(self, thread_id: str) -> Dict[str, Any]:
         """
         Get execution state for a thread.
@@ -92,11 +255,10 @@ class DeepAgentsRuntimeClient:
         with tracer.start_as_current_span("deepagents_get_state") as span:
             span.set_attributes({"thread_id": thread_id})
             
-            headers = {}
-            inject(headers)
+            headers = outbound_headers()
             
             try:
-                async with httpx.AsyncClient(timeout=10.0) as client:
+                async with httpx.AsyncClient(timeout=None) as client, operation_deadline("state"):
                     response = await client.get(
                         f"{self.base_url}/state/{thread_id}",
                         headers=headers
@@ -112,16 +274,98 @@ class DeepAgentsRuntimeClient:
                         span.record_exception(Exception(error_msg))
                         raise Exception(error_msg)
                         
-            except httpx.RequestError as e:
+            except (httpx.RequestError, TimeoutError) as e:
                 metrics.record_deepagents_request("state", "error")
                 span.record_exception(e)
-                raise Exception(f"Network error getting execution state: {str(e)}")
+                raise Exception(f"Network error getting execution state: {describe_request_error(e, 'state')}")
+    
+    @guarded_by_breaker("capabilities")
+    async def get_capabilities(self) -> Optional[Dict[str, Any]]:
+        """
+        Get the agent types and config schemas the runtime supports.
+        
+        Returns:
+            Capabilities response, or None if the runtime does not expose
+            a capabilities endpoint
+            
+        Raises:
+            Exception: If the request fails
+        """
+        with tracer.start_as_current_span("deepagents_get_capabilities") as span:
+            headers = outbound_headers()
+            
+            try:
+                async with httpx.AsyncClient(timeout=None) as client, operation_deadline("control"):
+                    response = await client.get(
+                        f"{self.base_url}/capabilities",
+                        headers=headers
+                    )
+                    
+                    metrics.record_deepagents_request("capabilities", str(response.status_code))
+                    span.set_attributes({"http.status_code": response.status_code})
+                    
+                    if response.status_code == 200:
+                        return response.json()
+                    elif response.status_code in [404, 405, 501]:
+                        return None
+                    else:
+                        error_msg = f"Failed to get capabilities: {response.status_code}"
+                        span.record_exception(Exception(error_msg))
+                        raise Exception(error_msg)
+                        
+            except (httpx.RequestError, TimeoutError) as e:
+                metrics.record_deepagents_request("capabilities", "error")
+                span.record_exception(e)
+                raise Exception(f"Network error getting capabilities: {describe_request_error(e, 'control')}")
+    
+    @guarded_by_breaker("cleanup")
+    async def cleanup_thread(self, thread_id: str) -> None:
+        """
+        Delete a thread's checkpointer data from deepagents-runtime.
+        
+        A 404 means the thread was already cleaned up and counts as success.
+        
+        Args:
+            thread_id: Thread ID to clean up
+            
+        Raises:
+            Exception: If the request fails
+        """
+        with tracer.start_as_current_span("deepagents_cleanup") as span:
+            span.set_attributes({"thread_id": thread_id})
+            
+            headers = outbound_headers()
+            
+            try:
+                async with httpx.AsyncClient(timeout=None) as client, operation_deadline("control"):
+                    response = await client.delete(
+                        f"{self.base_url}/threads/{thread_id}",
+                        headers=headers
+                    )
+                    
+                    metrics.record_deepagents_request("cleanup", str(response.status_code))
+                    span.set_attributes({"http.status_code": response.status_code})
+                    
+                    if response.status_code not in [200, 202, 204, 404]:
+                        error_msg = f"Cleanup failed: {response.status_code}"
+                        span.set_attributes({"cleanup.success": False})
+                        span.record_exception(Exception(error_msg))
+                        raise Exception(error_msg)
+                    
+                    span.set_attributes({"cleanup.success": True})
+                    
+            except (httpx.RequestError, TimeoutError) as e:
+                metrics.record_deepagents_request("cleanup", "error")
+                span.set_attributes({"cleanup.success": False})
+                span.record_exception(e)
+                raise Exception(f"Network error cleaning up thread: {describe_request_error(e, 'control')}")
     
     async def cleanup_thread_data(self, thread_id: str) -> bool:
         """
         Clean up deepagents-runtime checkpointer data for a thread.
         
-        This is a best-effort operation that won't raise exceptions.
+        This is a best-effort operation that won't raise exceptions,
+        including when the circuit breaker is open.
         
         Args:
             thread_id: Thread ID to clean up
@@ -129,33 +373,71 @@ class DeepAgentsRuntimeClient:
         Returns:
             True if cleanup succeeded, False otherwise
         """
-        with tracer.start_as_current_span("deepagents_cleanup") as span:
+        try:
+            await self.cleanup_thread(thread_id)
+            return True
+        except Exception:
+            return False
+    
+    async def cancel_thread(self, thread_id: str) -> bool:
+        """
+        Ask deepagents-runtime to stop executing a thread.
+        
+        This is a best-effort operation that won't raise exceptions.
+        A 404 or 409 means the thread is unknown or already finished,
+        which counts as cancelled.
+        
+        Args:
+            thread_id: Thread ID to cancel
+            
+        Returns:
+            True if the thread is no longer running, False otherwise
+        """
+        with tracer.start_as_current_span("deepagents_cancel") as span:
             span.set_attributes({"thread_id": thread_id})
             
             try:
-                headers = {}
-                inject(headers)
+                headers = outbound_headers()
                 
-                async with httpx.AsyncClient(timeout=10.0) as client:
-                    response = await client.delete(
-                        f"{self.base_url}/cleanup/{thread_id}",
+                async with httpx.AsyncClient(timeout=None) as client, operation_deadline("control"):
+                    response = await client.post(
+                        f"{self.base_url}/cancel/{thread_id}",
                         headers=headers
                     )
                     
-                    metrics.record_deepagents_request("cleanup", str(response.status_code))
+                    metrics.record_deepagents_request("cancel", str(response.status_code))
                     span.set_attributes({"http.status_code": response.status_code})
                     
-                    if response.status_code in [200, 204, 404]:
+                    if response.status_code in [200, 202, 204, 404, 409]:
                         return True
                     else:
-                        span.record_exception(Exception(f"Cleanup failed: {response.status_code}"))
+                        span.record_exception(Exception(f"Cancel failed: {response.status_code}"))
                         return False
                         
             except Exception as e:
-                metrics.record_deepagents_request("cleanup", "error")
+                metrics.record_deepagents_request("cancel", "error")
                 span.record_exception(e)
                 return False
     
+    async def check_health(self) -> bool:
+        """
+        Probe the runtime's health endpoint.
+        
+        Not guarded by the circuit breaker, so status probes neither trip it
+        nor get refused while it is open. Never raises.
+        
+        Returns:
+            True if the runtime reports healthy, False otherwise
+        """
+        try:
+            async with httpx.AsyncClient(timeout=None) as client, operation_deadline("health"):
+                response = await client.get(f"{self.base_url}/health", headers=outbound_headers())
+                metrics.record_deepagents_request("health", str(response.status_code))
+                return response.status_code == 200
+        except Exception:
+            metrics.record_deepagents_request("health", "error")
+            return False
+    
     async def process_refinement_job(
         self,
         proposal_id: str,
@@ -183,16 +465,10 @@ class DeepAgentsRuntimeClient:
             Exception: If processing fails
         """
         # Prepare payload for deepagents-runtime
-        payload = {
-            "job_id": f"refinement-{proposal_id}",
-            "trace_id": f"trace-{proposal_id}",
-            "agent_definition": current_specification,
-            "input_payload": {
-                "instructions": user_prompt,
-                "context": context_selection or "",
-                "context_file_path": context_file_path
-            }
-        }
+        payload = build_refinement_job_request(
+            proposal_id, user_prompt, current_specification,
+            context_file_path, context_selection
+        ).model_dump()
         
         # Invoke the job
         invoke_result = await self.invoke_job(payload)
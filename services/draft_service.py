@@ -6,11 +6,19 @@ file management, and UPSERT operations for draft specification files.
 """
 
 import uuid
-import psycopg
 from psycopg.rows import dict_row
 from datetime import datetime
 from typing import Dict, Any, Optional
 
+from core.database import connect
+from models.workflow import DraftFileEdit, DraftFileWrite
+from .audit_service import AuditService
+from .cleanup_job_service import CleanupJobService
+from .errors import AccessDeniedError, DraftFileVersionConflict, DraftNotFoundError, WorkflowNotFoundError
+from .file_edit import apply_file_edit
+from .generated_files import InvalidGeneratedFiles, split_generated_files
+from .workflow_access import ACCESS_TYPE_SQL, WRITE_ACCESS_SQL, can_write
+
 
 class DraftService:
     """Service for managing workflow drafts and their files."""
@@ -30,24 +38,25 @@ class DraftService:
             Draft ID (UUID string)
             
         Raises:
-            ValueError: If workflow not found, access denied, or locked
+            WorkflowNotFoundError: If workflow not found or access denied
+            ValueError: If the workflow is locked
         """
-        with psycopg.connect(self.database_url, row_factory=dict_row) as conn:
+        with connect(self.database_url, row_factory=dict_row) as conn:
             with conn.transaction():
                 with conn.cursor() as cur:
                     # Lock workflow and validate access
                     cur.execute(
-                        """
-                        SELECT id, name, is_locked FROM workflows 
-                        WHERE id = %s AND created_by_user_id = %s 
+                        f"""
+                        SELECT w.id, w.name, w.is_locked FROM workflows w
+                        WHERE w.id = %s AND w.deleted_at IS NULL AND {WRITE_ACCESS_SQL}
                         FOR UPDATE
                         """,
-                        (workflow_id, user_id)
+                        (workflow_id, user_id, user_id)
                     )
                     workflow = cur.fetchone()
                     
                     if not workflow:
-                        raise ValueError("Workflow not found or access denied")
+                        raise WorkflowNotFoundError("Workflow not found or access denied")
                     
                     if workflow["is_locked"]:
                         raise ValueError("Workflow is locked by another operation")
@@ -77,73 +86,497 @@ class DraftService:
                     result = cur.fetchone()
                     return str(result["id"])
     
-    def apply_files_to_draft(self, draft_id: str, generated_files: Dict[str, Any]) -> int:
+    def discard_draft(self, workflow_id: str, user_id: str) -> Dict[str, Any]:
+        """
+        Discard a workflow's draft with its files and in-flight proposals.
+        
+        Pending and processing proposals are deleted with the draft; proposals
+        that already reached another state are kept (with draft_id cleared by
+        the foreign key) so their audit trail survives.
+        
+        Args:
+            workflow_id: Workflow ID
+            user_id: User ID (for access validation and audit)
+            
+        Returns:
+            Dictionary with draft_id and the deleted proposals' IDs and thread IDs
+            
+        Raises:
+            WorkflowNotFoundError: If workflow not found or access denied
+            DraftNotFoundError: If no draft exists
+        """
+        with connect(self.database_url, row_factory=dict_row) as conn:
+            with conn.transaction():
+                with conn.cursor() as cur:
+                    # Lock the workflow
+                    cur.execute(
+                        f"""
+                        SELECT w.id FROM workflows w
+                        WHERE w.id = %s AND w.deleted_at IS NULL AND {WRITE_ACCESS_SQL}
+                        FOR UPDATE
+                        """,
+                        (workflow_id, user_id, user_id)
+                    )
+                    if not cur.fetchone():
+                        raise WorkflowNotFoundError("Workflow not found or access denied")
+                    
+                    cur.execute(
+                        "SELECT id FROM drafts WHERE workflow_id = %s FOR UPDATE",
+                        (workflow_id,)
+                    )
+                    draft = cur.fetchone()
+                    if not draft:
+                        raise DraftNotFoundError("No draft found to discard")
+                    draft_id = str(draft["id"])
+                    
+                    cur.execute(
+                        """
+                        DELETE FROM proposals
+                        WHERE draft_id = %s AND status IN ('pending', 'processing')
+                        RETURNING id, thread_id
+                        """,
+                        (draft_id,)
+                    )
+                    deleted_proposals = cur.fetchall()
+                    thread_ids = [p["thread_id"] for p in deleted_proposals if p["thread_id"]]
+                    CleanupJobService.enqueue(cur, thread_ids)
+                    
+                    cur.execute("DELETE FROM draft_specification_files WHERE draft_id = %s", (draft_id,))
+                    cur.execute("DELETE FROM drafts WHERE id = %s", (draft_id,))
+                    
+                    AuditService.record_workflow_event(
+                        cur, workflow_id, user_id, "draft_discarded",
+                        {"draft_id": draft_id, "deleted_proposals": len(deleted_proposals)}
+                    )
+                    
+                    return {
+                        "draft_id": draft_id,
+                        "deleted_proposal_ids": [str(p["id"]) for p in deleted_proposals],
+                        "thread_ids": thread_ids
+                    }
+    
+    def reset_draft_to_production(self, workflow_id: str, user_id: str) -> Dict[str, Any]:
+        """
+        Replace a workflow's draft files with those of its production version.
+        
+        Draft edits are discarded: files the production version does not
+        have are removed, and the rest are overwritten with a new version
+        each. Without a production version the draft is left empty. The
+        draft is created if the workflow has none.
+        
+        Args:
+            workflow_id: Workflow ID
+            user_id: User ID (must own or edit the workflow)
+            
+        Returns:
+            Dictionary with the draft_id, the production version_number (None
+            without one) and the paths of the draft's files after the reset
+            
+        Raises:
+            WorkflowNotFoundError: If workflow not found or access denied
+            ValueError: If the workflow is locked
+        """
+        draft_id = self.get_or_create_draft(workflow_id, user_id)
+        
+        with connect(self.database_url, row_factory=dict_row) as conn:
+            with conn.transaction():
+                with conn.cursor() as cur:
+                    cur.execute("SELECT id FROM drafts WHERE id = %s FOR UPDATE", (draft_id,))
+                    if not cur.fetchone():
+                        raise DraftNotFoundError("Draft not found")
+                    
+                    cur.execute(
+                        """
+                        SELECT v.id, v.version_number
+                        FROM workflows w
+                        JOIN versions v ON v.id = w.production_version_id
+                        WHERE w.id = %s
+                        """,
+                        (workflow_id,)
+                    )
+                    production = cur.fetchone()
+                    files = {}
+                    if production:
+                        cur.execute(
+                            "SELECT file_path, content, file_type FROM specification_files WHERE version_id = %s",
+                            (production["id"],)
+                        )
+                        files = {row["file_path"]: row for row in cur.fetchall()}
+                    
+                    cur.execute(
+                        "DELETE FROM draft_specification_files WHERE draft_id = %s AND NOT (file_path = ANY(%s))",
+                        (draft_id, list(files))
+                    )
+                    # Overwrite rather than recreate, so versions keep increasing for optimistic locking
+                    now = datetime.utcnow()
+                    for file_path, file in files.items():
+                        self._upsert_file(cur, draft_id, file_path, file["content"], file["file_type"], now)
+                    cur.execute("UPDATE drafts SET updated_at = NOW() WHERE id = %s", (draft_id,))
+                    
+                    version_number = production["version_number"] if production else None
+                    AuditService.record_workflow_event(
+                        cur, workflow_id, user_id, "draft_reset",
+                        {"draft_id": draft_id, "version_number": version_number}
+                    )
+                    
+                    return {
+                        "draft_id": draft_id,
+                        "version_number": version_number,
+                        "files": sorted(files)
+                    }
+    
+    def apply_files_to_draft(
+        self,
+        draft_id: str,
+        generated_files: Dict[str, Any],
+        expected_versions: Optional[Dict[str, int]] = None
+    ) -> int:
         """
         Apply generated files to draft using UPSERT (INSERT ... ON CONFLICT) logic.
         
+        Each write increments the file's version. With expected_versions, a
+        file is only written if it is still at the version given for its path
+        (0 for a file that must not exist yet), so changes made since the
+        versions were read are not overwritten.
+        
         Args:
             draft_id: Draft ID
             generated_files: Dictionary of file paths to file data
+            expected_versions: Optional file path to the version the write is based on;
+                paths left out are written unconditionally
             
         Returns:
             Number of files applied
             
         Raises:
-            ValueError: If draft not found
+            DraftNotFoundError: If draft not found
+            InvalidGeneratedFiles: If any file is malformed or outside the workspace;
+                nothing is applied
+            DraftFileVersionConflict: If a file is not at its expected version;
+                nothing is applied
+        """
+        if not generated_files:
+            return 0
+        
+        with connect(self.database_url, row_factory=dict_row) as conn:
+            with conn.cursor() as cur:
+                files_applied = self.apply_files(cur, draft_id, generated_files, expected_versions)
+                conn.commit()
+        
+        return files_applied
+    
+    @staticmethod
+    def apply_files(
+        cur,
+        draft_id: str,
+        generated_files: Dict[str, Any],
+        expected_versions: Optional[Dict[str, int]] = None
+    ) -> int:
+        """
+        Apply generated files to draft like apply_files_to_draft, using the caller's cursor.
+        
+        Takes the caller's cursor so the files commit or roll back together
+        with the change that applies them, e.g. resolving the proposal that
+        generated them.
+        
+        Raises:
+            DraftNotFoundError: If draft not found
+            InvalidGeneratedFiles: If any file is malformed or outside the workspace
+            DraftFileVersionConflict: If a file is not at its expected version
         """
         if not generated_files:
             return 0
         
+        files, invalid = split_generated_files(generated_files)
+        if invalid:
+            raise InvalidGeneratedFiles(invalid)
+        
+        expected_versions = expected_versions or {}
         files_applied = 0
         now = datetime.utcnow()
         
-        with psycopg.connect(self.database_url, row_factory=dict_row) as conn:
+        # Validate draft exists
+        cur.execute("SELECT id FROM drafts WHERE id = %s", (draft_id,))
+        if not cur.fetchone():
+            raise DraftNotFoundError("Draft not found")
+        
+        for file_path, file_data in files.items():
+            DraftService._upsert_file(
+                cur, draft_id, file_path, file_data["content"], file_data["type"],
+                now, expected_versions.get(file_path)
+            )
+            files_applied += 1
+        
+        return files_applied
+    
+    @staticmethod
+    def _upsert_file(
+        cur,
+        draft_id: str,
+        file_path: str,
+        content: str,
+        file_type: str,
+        now: datetime,
+        expected_version: Optional[int] = None
+    ) -> Dict[str, Any]:
+        """
+        Insert or update a draft file using the caller's cursor, incrementing its version.
+        
+        Raises:
+            DraftFileVersionConflict: If expected_version is given and the file is not at it
+        """
+        # UPSERT: Insert or Update on Conflict, unless the file moved past the expected version
+        cur.execute(
+            """
+            INSERT INTO draft_specification_files 
+            (id, draft_id, file_path, content, file_type, created_at, updated_at)
+            VALUES (%s, %s, %s, %s, %s, %s, %s)
+            ON CONFLICT (draft_id, file_path) 
+            DO UPDATE SET 
+                content = EXCLUDED.content,
+                file_type = EXCLUDED.file_type,
+                updated_at = EXCLUDED.updated_at,
+                version = draft_specification_files.version + 1
+            WHERE %s::INTEGER IS NULL OR draft_specification_files.version = %s
+            RETURNING file_path, content, file_type, version, updated_at
+            """,
+            (str(uuid.uuid4()), draft_id, file_path, content, file_type, now, now, expected_version, expected_version)
+        )
+        written = cur.fetchone()
+        # A new file is written at version 1 and an update at one past the expected version
+        if expected_version is not None and (not written or written["version"] != expected_version + 1):
+            raise DraftFileVersionConflict(file_path)
+        return written
+    
+    def write_draft_file(
+        self,
+        workflow_id: str,
+        user_id: str,
+        file_path: str,
+        write: DraftFileWrite
+    ) -> Dict[str, Any]:
+        """
+        Create or replace a draft file with content written by hand.
+        
+        The workflow's draft is created if it has none yet.
+        
+        Args:
+            workflow_id: Workflow ID
+            user_id: User ID (must own or edit the workflow)
+            file_path: Path of the file to write
+            write: New content, type and optional expected version
+        
+        Returns:
+            Dictionary with the file's path, content, type, new version and update time
+        
+        Raises:
+            WorkflowNotFoundError: If workflow not found or access denied
+            DraftFileVersionConflict: If the file is no longer at write.expected_version
+            ValueError: If the workflow is locked
+        """
+        draft_id = self.get_or_create_draft(workflow_id, user_id)
+        
+        with connect(self.database_url, row_factory=dict_row) as conn:
+            with conn.transaction():
+                with conn.cursor() as cur:
+                    written = self._upsert_file(
+                        cur, draft_id, file_path, write.content, write.type,
+                        datetime.utcnow(), write.expected_version
+                    )
+                    cur.execute("UPDATE drafts SET updated_at = NOW() WHERE id = %s", (draft_id,))
+                    
+                    return {
+                        "file_path": written["file_path"],
+                        "content": written["content"],
+                        "type": written["file_type"],
+                        "version": written["version"],
+                        "updated_at": written["updated_at"].isoformat()
+                    }
+    
+    def delete_draft_file(
+        self,
+        workflow_id: str,
+        user_id: str,
+        file_path: str,
+        expected_version: Optional[int] = None
+    ) -> int:
+        """
+        Remove a file from a workflow's draft.
+        
+        Args:
+            workflow_id: Workflow ID
+            user_id: User ID (must own or edit the workflow)
+            file_path: Path of the file to remove
+            expected_version: Optional version the file must still be at
+        
+        Returns:
+            Version of the removed file
+        
+        Raises:
+            WorkflowNotFoundError: If workflow not found or access denied
+            DraftNotFoundError: If the draft or file does not exist
+            DraftFileVersionConflict: If the file is no longer at expected_version
+        """
+        with connect(self.database_url, row_factory=dict_row) as conn:
+            with conn.transaction():
+                with conn.cursor() as cur:
+                    cur.execute(
+                        f"""
+                        SELECT w.id FROM workflows w
+                        WHERE w.id = %s AND w.deleted_at IS NULL AND {WRITE_ACCESS_SQL}
+                        """,
+                        (workflow_id, user_id, user_id)
+                    )
+                    if not cur.fetchone():
+                        raise WorkflowNotFoundError("Workflow not found or access denied")
+                    
+                    cur.execute(
+                        """
+                        SELECT f.id, f.draft_id, f.version
+                        FROM draft_specification_files f
+                        JOIN drafts d ON d.id = f.draft_id
+                        WHERE d.workflow_id = %s AND f.file_path = %s
+                        FOR UPDATE OF f
+                        """,
+                        (workflow_id, file_path)
+                    )
+                    file = cur.fetchone()
+                    if not file:
+                        raise DraftNotFoundError(f"Draft file not found: {file_path}")
+                    if expected_version is not None and expected_version != file["version"]:
+                        raise DraftFileVersionConflict(file_path)
+                    
+                    cur.execute("DELETE FROM draft_specification_files WHERE id = %s", (file["id"],))
+                    cur.execute("UPDATE drafts SET updated_at = NOW() WHERE id = %s", (file["draft_id"],))
+                    
+                    return file["version"]
+    
+    def get_draft_file_versions(self, draft_id: str) -> Dict[str, int]:
+        """
+        Get the current version of each file in a draft.
+        
+        Args:
+            draft_id: Draft ID
+            
+        Returns:
+            Dictionary of file paths to versions
+        """
+        with connect(self.database_url, row_factory=dict_row) as conn:
             with conn.cursor() as cur:
-                # Validate draft exists
-                cur.execute("SELECT id FROM drafts WHERE id = %s", (draft_id,))
-                if not cur.fetchone():
-                    raise ValueError("Draft not found")
-                
-                for file_path, file_data in generated_files.items():
-                    if not isinstance(file_data, dict) or "content" not in file_data:
-                        continue
+                cur.execute(
+                    "SELECT file_path, version FROM draft_specification_files WHERE draft_id = %s",
+                    (draft_id,)
+                )
+                return {row["file_path"]: row["version"] for row in cur.fetchall()}
+    
+    def edit_draft_file(
+        self,
+        workflow_id: str,
+        user_id: str,
+        file_path: str,
+        edit: DraftFileEdit
+    ) -> Dict[str, Any]:
+        """
+        Apply a partial edit to an existing draft file.
+        
+        The file row is locked while the edit is applied, so concurrent
+        autosaves of the same file are applied one after the other. An edit
+        with an expected_version is refused if the file has changed since.
+        
+        Args:
+            workflow_id: Workflow ID
+            user_id: User ID (must own or edit the workflow)
+            file_path: Path of the file to edit
+            edit: Append or line range replacement
+        
+        Returns:
+            Dictionary with the file's path, new content, type, version and update time
+        
+        Raises:
+            WorkflowNotFoundError: If workflow not found or access denied
+            DraftNotFoundError: If the draft or file does not exist
+            DraftFileVersionConflict: If the file is no longer at edit.expected_version
+            InvalidFileEdit: If the edit does not fit the file
+        """
+        with connect(self.database_url, row_factory=dict_row) as conn:
+            with conn.transaction():
+                with conn.cursor() as cur:
+                    cur.execute(
+                        f"""
+                        SELECT w.id FROM workflows w
+                        WHERE w.id = %s AND w.deleted_at IS NULL AND {WRITE_ACCESS_SQL}
+                        """,
+                        (workflow_id, user_id, user_id)
+                    )
+                    if not cur.fetchone():
+                        raise WorkflowNotFoundError("Workflow not found or access denied")
                     
-                    content = file_data["content"]
-                    file_type = file_data.get("type", "markdown")
+                    cur.execute(
+                        """
+                        SELECT f.id, f.draft_id, f.content, f.version
+                        FROM draft_specification_files f
+                        JOIN drafts d ON d.id = f.draft_id
+                        WHERE d.workflow_id = %s AND f.file_path = %s
+                        FOR UPDATE OF f
+                        """,
+                        (workflow_id, file_path)
+                    )
+                    file = cur.fetchone()
+                    if not file:
+                        raise DraftNotFoundError(f"Draft file not found: {file_path}")
+                    if edit.expected_version is not None and edit.expected_version != file["version"]:
+                        raise DraftFileVersionConflict(file_path)
                     
-                    # Convert content list to string if needed
-                    if isinstance(content, list):
-                        content = "\n".join(str(line) for line in content)
-                    elif not isinstance(content, str):
-                        content = str(content)
+                    content = apply_file_edit(file["content"], edit)
                     
-                    # UPSERT: Insert or Update on Conflict
                     cur.execute(
                         """
-                        INSERT INTO draft_specification_files 
-                        (id, draft_id, file_path, content, file_type, created_at, updated_at)
-                        VALUES (%s, %s, %s, %s, %s, %s, %s)
-                        ON CONFLICT (draft_id, file_path) 
-                        DO UPDATE SET 
-                            content = EXCLUDED.content,
-                            file_type = EXCLUDED.file_type,
-                            updated_at = EXCLUDED.updated_at
+                        UPDATE draft_specification_files
+                        SET content = %s, updated_at = NOW(), version = version + 1
+                        WHERE id = %s
+                        RETURNING file_path, content, file_type, version, updated_at
                         """,
-                        (
-                            str(uuid.uuid4()),
-                            draft_id,
-                            file_path,
-                            content,
-                            file_type,
-                            now,
-                            now
-                        )
+                        (content, file["id"])
                     )
-                    files_applied += 1
-                
-                conn.commit()
+                    updated = cur.fetchone()
+                    cur.execute("UPDATE drafts SET updated_at = NOW() WHERE id = %s", (file["draft_id"],))
+                    
+                    return {
+                        "file_path": updated["file_path"],
+                        "content": updated["content"],
+                        "type": updated["file_type"],
+                        "version": updated["version"],
+                        "updated_at": updated["updated_at"].isoformat()
+                    }
+    
+    def get_draft_by_workflow(self, workflow_id: str) -> Optional[Dict[str, Any]]:
+        """
+        Get the draft of a workflow without creating one.
         
-        return files_applied
+        Args:
+            workflow_id: Workflow ID
+            
+        Returns:
+            Draft dictionary or None if the workflow has no draft
+        """
+        with connect(self.database_url, row_factory=dict_row) as conn:
+            with conn.cursor() as cur:
+                cur.execute(
+                    """
+                    SELECT id, workflow_id, name, description, status, created_by_user_id,
+                           created_at, updated_at
+                    FROM drafts
+                    WHERE workflow_id = %s
+                    """,
+                    (workflow_id,)
+                )
+                result = cur.fetchone()
+                if result:
+                    result = dict(result)
+                    for key, value in result.items():
+                        if hasattr(value, 'hex'):
+                            result[key] = str(value)
+                return result
     
     def get_draft_files(self, draft_id: str) -> Dict[str, Any]:
         """
@@ -155,11 +588,11 @@ class DraftService:
         Returns:
             Dictionary of file paths to file data
         """
-        with psycopg.connect(self.database_url, row_factory=dict_row) as conn:
+        with connect(self.database_url, row_factory=dict_row) as conn:
             with conn.cursor() as cur:
                 cur.execute(
                     """
-                    SELECT file_path, content, file_type, created_at, updated_at
+                    SELECT file_path, content, file_type, version, created_at, updated_at
                     FROM draft_specification_files
                     WHERE draft_id = %s
                     ORDER BY file_path
@@ -172,6 +605,7 @@ class DraftService:
                     files[row["file_path"]] = {
                         "content": row["content"],
                         "type": row["file_type"],
+                        "version": row["version"],
                         "created_at": row["created_at"].isoformat() if row["created_at"] else None,
                         "updated_at": row["updated_at"].isoformat() if row["updated_at"] else None
                     }
@@ -180,35 +614,36 @@ class DraftService:
     
     def validate_draft_access(self, draft_id: str, user_id: str) -> Dict[str, Any]:
         """
-        Validate user access to draft and return draft info.
+        Validate the user may change the draft and return draft info.
         
         Args:
             draft_id: Draft ID
-            user_id: User ID
+            user_id: User ID (must own or edit the draft's workflow)
             
         Returns:
             Draft information dictionary
             
         Raises:
-            ValueError: If draft not found or access denied
+            DraftNotFoundError: If draft not found
+            AccessDeniedError: If the user may not change the draft
         """
-        with psycopg.connect(self.database_url, row_factory=dict_row) as conn:
+        with connect(self.database_url, row_factory=dict_row) as conn:
             with conn.cursor() as cur:
                 cur.execute(
-                    """
-                    SELECT d.workflow_id, w.created_by_user_id, w.name
+                    f"""
+                    SELECT d.workflow_id, w.created_by_user_id, w.name, {ACCESS_TYPE_SQL} AS access_type
                     FROM drafts d
                     JOIN workflows w ON d.workflow_id = w.id
                     WHERE d.id = %s
                     """,
-                    (draft_id,)
+                    (user_id, user_id, draft_id)
                 )
                 draft_info = cur.fetchone()
                 
                 if not draft_info:
-                    raise ValueError("Draft not found")
+                    raise DraftNotFoundError("Draft not found")
                 
-                if str(draft_info["created_by_user_id"]) != user_id:
-                    raise ValueError("Access denied to draft")
+                if not can_write(draft_info["access_type"]):
+                    raise AccessDeniedError("Access denied to draft")
                 
                 return dict(draft_info)
\ No newline at end of file
@@ -0,0 +1,69 @@
+"""
+Error types raised by the orchestration services.
+
+Routers choose HTTP status codes by error type instead of matching
+messages, so messages can change without changing the API. Errors about
+the request subclass ValueError, so existing `except ValueError` handlers
+keep catching them; the original error of a failed runtime call is kept as
+__cause__.
+"""
+
+
+class NotFoundError(ValueError):
+    """Raised when a resource does not exist or the user may not see it (404)."""
+
+
+class WorkflowNotFoundError(NotFoundError):
+    """Raised when a workflow does not exist or the user may not change it."""
+
+
+class DraftNotFoundError(NotFoundError):
+    """Raised when a draft, or a file in it, does not exist."""
+
+
+class ProposalNotFoundError(NotFoundError):
+    """Raised when a proposal does not exist or the user may not change it."""
+
+
+class VersionNotFoundError(NotFoundError):
+    """Raised when a workflow has no version with the requested number."""
+
+
+class UserNotFoundError(NotFoundError):
+    """Raised when a user does not exist."""
+
+
+class OutboxEventNotFoundError(NotFoundError):
+    """Raised when an outbox event does not exist."""
+
+
+class AccessDeniedError(ValueError):
+    """Raised when the user can see a resource but may not change it (403)."""
+
+
+class ConflictError(ValueError):
+    """Raised when a request conflicts with the current state of a resource (409)."""
+
+
+class InvalidTransitionError(ConflictError):
+    """Raised when a proposal, version or outbox event cannot move to the requested status (409)."""
+
+
+class ProposalNotReadyError(InvalidTransitionError):
+    """Raised when approving a proposal that has not completed (400)."""
+
+
+class GoneError(ValueError):
+    """Raised when a deleted resource can no longer be restored (410)."""
+
+
+class DraftFileVersionConflict(ValueError):
+    """Raised when a draft file changed since the version the writer read (409)."""
+
+    def __init__(self, file_path: str):
+        super().__init__(f"Draft file was changed by someone else: {file_path}")
+        self.file_path = file_path
+
+
+class DeepAgentsUnavailableError(RuntimeError):
+    """Raised when deepagents-runtime cannot start a refinement (503)."""
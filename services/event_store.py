@@ -0,0 +1,105 @@
+"""
+Event store for the history of workflows.
+
+Domain events are appended to agent_events in the transaction of the
+state change they describe. Every aggregate's events carry consecutive
+versions; a unique constraint on (aggregate_id, version) turns two
+concurrent writers into a conflict instead of a duplicate version.
+"""
+
+import json
+import psycopg
+from typing import Dict, Any, List, Optional
+
+from core.database import connect
+from .rows import json_row
+
+
+class EventVersionConflict(ValueError):
+    """Raised when another writer appended to the aggregate first."""
+
+
+class EventStore:
+    """Service for appending and replaying domain events."""
+
+    def __init__(self, database_url: str):
+        self.database_url = database_url
+
+    @staticmethod
+    def append_event(
+        cur,
+        aggregate_id: str,
+        event_type: str,
+        data: Optional[Dict[str, Any]] = None,
+        expected_version: Optional[int] = None,
+        aggregate_type: str = "workflow"
+    ) -> int:
+        """
+        Append an event to an aggregate's history.
+
+        Takes the caller's cursor so the event commits or rolls back together
+        with the change it records. A conflict aborts the caller's transaction.
+
+        Args:
+            cur: Open database cursor
+            aggregate_id: ID of the entity the event belongs to
+            event_type: Domain event name, e.g. workflow.created
+            data: Optional event-specific details
+            expected_version: Version the caller last saw; None appends after the latest event
+            aggregate_type: Type of entity the event belongs to
+
+        Returns:
+            The new event's version
+
+        Raises:
+            EventVersionConflict: If the aggregate moved past expected_version or
+                a concurrent writer took the version
+        """
+        cur.execute(
+            "SELECT COALESCE(MAX(version), 0) AS version FROM agent_events WHERE aggregate_id = %s",
+            (aggregate_id,)
+        )
+        current_version = cur.fetchone()["version"]
+        if expected_version is not None and current_version != expected_version:
+            raise EventVersionConflict(
+                f"Aggregate {aggregate_id} is already at version {current_version}, expected {expected_version}"
+            )
+
+        version = current_version + 1
+        try:
+            cur.execute(
+                """
+                INSERT INTO agent_events (aggregate_type, aggregate_id, version, event_type, data)
+                VALUES (%s, %s, %s, %s, %s)
+                """,
+                (aggregate_type, aggregate_id, version, event_type, json.dumps(data or {}))
+            )
+        except psycopg.errors.UniqueViolation:
+            raise EventVersionConflict(f"Aggregate {aggregate_id} already has an event at version {version}")
+        return version
+
+    def list_events(self, aggregate_id: str, after_version: int = 0, limit: int = 100) -> List[Dict[str, Any]]:
+        """
+        Replay an aggregate's events in version order.
+
+        Args:
+            aggregate_id: ID of the entity
+            after_version: Only return events after this version
+            limit: Maximum number of events to return
+
+        Returns:
+            List of event dictionaries
+        """
+        with connect(self.database_url, row_factory=json_row) as conn:
+            with conn.cursor() as cur:
+                cur.execute(
+                    """
+                    SELECT id, aggregate_type, aggregate_id, version, event_type, data, created_at
+                    FROM agent_events
+                    WHERE aggregate_id = %s AND version > %s
+                    ORDER BY version
+                    LIMIT %s
+                    """,
+                    (aggregate_id, after_version, limit)
+                )
+                return cur.fetchall()
@@ -0,0 +1,70 @@
+"""
+File diffing for specification reviews.
+
+Compares a proposal's generated files with another set of specification
+files (a draft or a published version) so reviewers can see what applying
+the proposal would change.
+"""
+
+import difflib
+from typing import Dict, Any, List
+
+
+def _file_text(file_data: Any) -> str:
+    """Get a file's content as text, matching how files are applied to drafts."""
+    content = file_data.get("content") if isinstance(file_data, dict) else file_data
+    if content is None:
+        return ""
+    if isinstance(content, list):
+        return "\n".join(str(line) for line in content)
+    return content if isinstance(content, str) else str(content)
+
+
+def diff_files(
+    base_files: Dict[str, Any],
+    proposed_files: Dict[str, Any],
+    base_label: str = "base",
+    proposed_label: str = "proposal"
+) -> Dict[str, Any]:
+    """
+    Diff proposed files against base files.
+
+    Only paths present in the proposal are reported: approving a proposal
+    upserts its files and leaves every other file untouched.
+
+    Args:
+        base_files: Dictionary of file paths to file data (or raw content)
+        proposed_files: Dictionary of file paths to file data (or raw content)
+        base_label: Label used for the "from" side of unified diffs
+        proposed_label: Label used for the "to" side of unified diffs
+
+    Returns:
+        Dictionary with per-file entries ({path, status, diff}) and a summary
+        counting added, modified and unchanged files
+    """
+    files: List[Dict[str, Any]] = []
+    summary = {"added": 0, "modified": 0, "unchanged": 0}
+
+    for path in sorted(proposed_files):
+        proposed = _file_text(proposed_files[path])
+        if path not in base_files:
+            status = "added"
+            base = ""
+        else:
+            base = _file_text(base_files[path])
+            status = "unchanged" if base == proposed else "modified"
+
+        diff = None
+        if status != "unchanged":
+            diff = "\n".join(difflib.unified_diff(
+                base.splitlines(),
+                proposed.splitlines(),
+                fromfile=f"{base_label}{path}" if status == "modified" else "/dev/null",
+                tofile=f"{proposed_label}{path}",
+                lineterm=""
+            ))
+
+        summary[status] += 1
+        files.append({"path": path, "status": status, "diff": diff})
+
+    return {"files": files, "summary": summary}
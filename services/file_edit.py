@@ -0,0 +1,44 @@
+"""
+Incremental edits to draft specification files.
+
+The IDE autosaves by sending the edit it just made instead of the whole
+file: either text appended to the end, or a range of lines replaced.
+Ranges are checked against the file's current content so an edit made
+against a stale copy is refused instead of corrupting the file.
+"""
+
+from models.workflow import DraftFileEdit
+
+
+class InvalidFileEdit(ValueError):
+    """Raised when an edit does not fit the file's current content."""
+
+
+def apply_file_edit(content: str, edit: DraftFileEdit) -> str:
+    """
+    Apply an edit to a file's content.
+
+    Args:
+        content: Current file content
+        edit: Edit to apply
+
+    Returns:
+        The edited content
+
+    Raises:
+        InvalidFileEdit: If a range is missing or outside the current content
+    """
+    if edit.op == "append":
+        return content + edit.content
+
+    if edit.start_line is None or edit.end_line is None:
+        raise InvalidFileEdit("replace_range requires start_line and end_line")
+
+    lines = content.split("\n")
+    if not 1 <= edit.start_line <= edit.end_line <= len(lines):
+        raise InvalidFileEdit(
+            f"Line range {edit.start_line}-{edit.end_line} is outside the file's {len(lines)} lines"
+        )
+
+    replacement = edit.content.split("\n") if edit.content else []
+    return "\n".join(lines[:edit.start_line - 1] + replacement + lines[edit.end_line:])
@@ -0,0 +1,96 @@
+"""
+Validation of the files a refinement generated.
+
+Generated files come from the model, so nothing guarantees their shape.
+Each file must be an object whose content is a string or a list of lines,
+at a path inside the workspace: absolute (it starts with "/") and without
+"." or ".." segments that could point outside it. Approval applies the
+files that pass and reports the others by path instead of dropping them.
+"""
+
+from typing import Any, Dict, Tuple
+
+DEFAULT_GENERATED_FILE_TYPE = "markdown"
+
+
+class InvalidGeneratedFiles(ValueError):
+    """Raised when generated files cannot be applied; invalid maps each path to its problem."""
+
+    def __init__(self, invalid: Dict[str, str]):
+        details = ", ".join(f"{path} ({reason})" for path, reason in invalid.items())
+        super().__init__(f"Unparseable generated files: {details}")
+        self.invalid = invalid
+
+
+def check_file_path(file_path: Any) -> str:
+    """
+    Check that a generated file path stays inside the workspace.
+
+    Returns:
+        Why the path is invalid, or an empty string if it is valid
+    """
+    if not isinstance(file_path, str) or not file_path:
+        return "path is empty"
+    if not file_path.startswith("/"):
+        return "path is not absolute"
+    if "\\" in file_path or "\x00" in file_path:
+        return "path contains invalid characters"
+    segments = file_path[1:].split("/")
+    if any(segment in (".", "..") for segment in segments):
+        return "path escapes the workspace"
+    if "" in segments:
+        return "path has an empty segment"
+    return ""
+
+
+def parse_generated_file(file_path: Any, file_data: Any) -> Tuple[Dict[str, str], str]:
+    """
+    Convert one generated file to the content and type stored in a draft.
+
+    Returns:
+        Tuple of (file, problem): the file with string content and type, or
+        an empty dictionary and why the file cannot be applied
+    """
+    problem = check_file_path(file_path)
+    if problem:
+        return {}, problem
+    if not isinstance(file_data, dict):
+        return {}, "file is not an object"
+    if "content" not in file_data:
+        return {}, "content is missing"
+
+    content = file_data["content"]
+    if isinstance(content, list):
+        if not all(isinstance(line, str) for line in content):
+            return {}, "content lines are not all strings"
+        content = "\n".join(content)
+    elif not isinstance(content, str):
+        return {}, "content is not a string or a list of lines"
+
+    file_type = file_data.get("type", DEFAULT_GENERATED_FILE_TYPE)
+    if not isinstance(file_type, str) or not file_type:
+        return {}, "type is not a string"
+
+    return {"content": content, "type": file_type}, ""
+
+
+def split_generated_files(generated_files: Dict[str, Any]) -> Tuple[Dict[str, Dict[str, str]], Dict[str, str]]:
+    """
+    Split generated files into those that can be applied and those that cannot.
+
+    Args:
+        generated_files: Dictionary of file paths to file data
+
+    Returns:
+        Tuple of (files, invalid): applicable files with string content and
+        type, and the paths of the other files mapped to their problem
+    """
+    files: Dict[str, Dict[str, str]] = {}
+    invalid: Dict[str, str] = {}
+    for file_path, file_data in generated_files.items():
+        parsed, problem = parse_generated_file(file_path, file_data)
+        if problem:
+            invalid[str(file_path)] = problem
+        else:
+            files[file_path] = parsed
+    return files, invalid
@@ -6,17 +6,23 @@ workflow refinement lifecycle, from proposal creation to completion.
 """
 
 import asyncio
+import logging
 import os
-from typing import Optional, Dict, Any, Tuple
+from datetime import datetime, timezone
+from typing import Optional, Dict, Any, List, Tuple
 from opentelemetry import trace
 
 from core.metrics import metrics
-from .deepagents_client import DeepAgentsRuntimeClient
+from models.job import build_refinement_job_request
+from .deepagents_client import DEFAULT_DEEPAGENTS_RUNTIME_URL, DeepAgentsRuntimeClient
 from .audit_service import AuditService
+from .cleanup_job_service import CleanupJobService
 from .draft_service import DraftService
+from .errors import DeepAgentsUnavailableError, InvalidTransitionError, ProposalNotFoundError
 from .proposal_service import ProposalService
 
 tracer = trace.get_tracer(__name__)
+logger = logging.getLogger(__name__)
 
 
 class OrchestrationService:
@@ -24,11 +30,12 @@ class OrchestrationService:
     
     def __init__(self, database_url: str):
         self.database_url = database_url
-        deepagents_url = os.getenv("DEEPAGENTS_RUNTIME_URL", "http://deepagents-runtime.intelligence-deepagents.svc.cluster.local:8000")
+        deepagents_url = os.getenv("DEEPAGENTS_RUNTIME_URL", DEFAULT_DEEPAGENTS_RUNTIME_URL)
         
         # Initialize service dependencies
         self.deepagents_client = DeepAgentsRuntimeClient(deepagents_url)
         self.audit_service = AuditService()
+        self.cleanup_job_service = CleanupJobService(database_url)
         self.draft_service = DraftService(database_url)
         self.proposal_service = ProposalService(database_url)
     
@@ -44,17 +51,84 @@ class OrchestrationService:
             Draft ID (UUID string)
             
         Raises:
-            ValueError: If workflow not found, access denied, or locked
+            WorkflowNotFoundError: If workflow not found or access denied
+            ValueError: If the workflow is locked
         """
         return self.draft_service.get_or_create_draft(workflow_id, user_id)
     
+    def discard_draft(self, workflow_id: str, user_id: str) -> int:
+        """
+        Discard a workflow's draft and clean up its in-flight refinements.
+        
+        Args:
+            workflow_id: Workflow ID
+            user_id: User ID (for access validation)
+            
+        Returns:
+            Number of proposals deleted with the draft
+            
+        Raises:
+            WorkflowNotFoundError: If workflow not found or access denied
+            DraftNotFoundError: If no draft exists
+        """
+        with tracer.start_as_current_span("discard_draft") as span:
+            span.set_attribute("workflow_id", workflow_id)
+            
+            result = self.draft_service.discard_draft(workflow_id, user_id)
+            
+            # Clean up deepagents-runtime checkpointer data of the deleted proposals
+            self.cleanup_threads(result["thread_ids"])
+            
+            return len(result["deleted_proposal_ids"])
+    
+    def cleanup_threads(self, thread_ids: List[str]) -> None:
+        """
+        Start deepagents-runtime checkpointer cleanup for finished or abandoned threads.
+        
+        The threads' cleanup jobs were enqueued with the change that made them
+        obsolete; this tries them right away, and the CleanupWorker retries
+        any attempt that fails.
+        
+        Args:
+            thread_ids: Thread IDs whose runtime data is no longer needed
+        """
+        for thread_id in thread_ids:
+            asyncio.create_task(self._cleanup_thread(thread_id))
+    
+    async def cancel_threads(self, thread_ids: List[str]) -> None:
+        """
+        Ask deepagents-runtime to stop the runs of refinements cancelled without a user request.
+        
+        Like for cancel_proposal, stopping is best-effort: results the
+        runtime still streams for the threads are ignored.
+        
+        Args:
+            thread_ids: Thread IDs of the cancelled refinements
+        """
+        for thread_id in thread_ids:
+            await self.deepagents_client.cancel_thread(thread_id)
+    
+    async def _cleanup_thread(self, thread_id: str) -> bool:
+        """Clean up a thread's runtime data and complete its cleanup jobs on success."""
+        if not await self.deepagents_client.cleanup_thread_data(thread_id):
+            logger.warning("Cleanup of thread failed, leaving it to the cleanup worker", extra={"thread_id": thread_id})
+            return False
+        try:
+            self.cleanup_job_service.complete(thread_id)
+        except Exception as e:
+            # The worker will run the job again, which is harmless
+            logger.error("Failed to complete cleanup jobs", extra={"thread_id": thread_id, "error": str(e)})
+        return True
+    
     async def create_refinement_proposal(
         self,
         draft_id: str,
         user_id: str,
         user_prompt: str,
         context_file_path: Optional[str] = None,
-        context_selection: Optional[str] = None
+        context_selection: Optional[str] = None,
+        runtime_config: Optional[Dict[str, Any]] = None,
+        resume: bool = False
     ) -> Tuple[str, str]:
         """
         Create a refinement proposal and initiate deepagents-runtime processing.
@@ -64,81 +138,112 @@ class OrchestrationService:
         2. Calling deepagents-runtime /invoke to get a thread_id
         3. Letting the WebSocket proxy handle streaming and proposal updates
         
+        With resume, the draft's last refinement thread is continued instead
+        of starting a new one, so the agent keeps its checkpointed state; a
+        completed proposal on that thread is superseded by the new one.
+        
         Args:
             draft_id: Draft ID
             user_id: User ID
             user_prompt: User's refinement instructions
             context_file_path: Optional file path for context
             context_selection: Optional text selection for context
+            runtime_config: Optional allowlisted runtime overrides (model, temperature, ...)
+            resume: Whether to resume the draft's last refinement thread
             
         Returns:
             Tuple of (proposal_id, thread_id)
             
         Raises:
-            ValueError: If draft not found or deepagents-runtime unavailable
+            DraftNotFoundError: If draft not found
+            AccessDeniedError: If the user may not change the draft
+            InvalidTransitionError: If resume is set but the draft has no refinement to resume,
+                or a concurrent request resumed it first
+            DeepAgentsUnavailableError: If deepagents-runtime could not start the refinement
         """
-        # Validate draft access
-        draft_info = self.draft_service.validate_draft_access(draft_id, user_id)
-        
-        # Generate proposal ID
-        proposal_id = f"proposal-{int(asyncio.get_event_loop().time() * 1000000)}"
-        
-        # Record metrics for job creation
-        metrics.record_job_created("refinement", "created")
-        
-        # Create initial audit trail
-        audit_trail = self.audit_service.create_initial_audit_trail(
-            user_id, user_prompt, context_file_path, context_selection
-        )
-        
-        # Get current specification from draft (empty for now)
-        current_specification = {}
-        
-        # Prepare payload for deepagents-runtime
-        payload = {
-            "job_id": f"refinement-{proposal_id}",
-            "trace_id": f"trace-{proposal_id}",
-            "agent_definition": current_specification,
-            "input_payload": {
-                "messages": [{"role": "user", "content": user_prompt}],
-                "instructions": user_prompt,
-                "context": context_selection or "",
-                "context_file_path": context_file_path
-            }
-        }
-        
-        try:
-            # Call deepagents-runtime /invoke to get thread_id
-            invoke_result = await self.deepagents_client.invoke_job(payload)
-            thread_id = invoke_result.get("thread_id")
+        with tracer.start_as_current_span("create_refinement_proposal") as span:
+            span.set_attribute("draft_id", draft_id)
+            
+            # Validate draft access
+            draft_info = self.draft_service.validate_draft_access(draft_id, user_id)
+            span.set_attribute("workflow_id", str(draft_info["workflow_id"]))
             
-            if not thread_id:
-                raise ValueError("deepagents-runtime did not return thread_id")
+            resumed = None
+            if resume:
+                resumed = self.proposal_service.get_resumable_proposal(draft_id)
+                span.set_attribute("resumed_thread_id", resumed["thread_id"])
             
-            # Create proposal in database with the thread_id from deepagents-runtime
-            proposal_id = self.proposal_service.create_proposal(
-                draft_id, thread_id, user_id, user_prompt, audit_trail,
-                context_file_path, context_selection
+            # Generate proposal ID
+            proposal_id = f"proposal-{int(asyncio.get_event_loop().time() * 1000000)}"
+            
+            # Create initial audit trail
+            audit_trail = self.audit_service.create_initial_audit_trail(
+                user_id, user_prompt, context_file_path, context_selection
             )
             
-            # According to the spec, we only call /invoke and let the WebSocket proxy
-            # handle streaming when the frontend connects to /api/ws/refinements/{thread_id}
-            # The WebSocket proxy will update the proposal when it receives 'end' events
+            # Get current specification from draft (empty for now)
+            current_specification = {}
             
-            return proposal_id, thread_id
+            # Approval must not overwrite files changed after the refinement started
+            base_file_versions = self.draft_service.get_draft_file_versions(draft_id)
             
-        except Exception as e:
-            # If deepagents-runtime is unavailable, create proposal in failed state
-            thread_id = f"failed-{proposal_id}"
-            proposal_id = self.proposal_service.create_proposal(
-                draft_id, thread_id, user_id, user_prompt, audit_trail,
-                context_file_path, context_selection
-            )
+            if resumed:
+                # Claim the thread before the runtime runs on it, so a concurrent
+                # follow-up is refused with 409 instead of starting a second run
+                proposal_id = self.proposal_service.create_proposal(
+                    draft_id, resumed["thread_id"], user_id, user_prompt, audit_trail,
+                    context_file_path, context_selection, base_file_versions,
+                    supersedes=resumed["id"]
+                )
+                metrics.record_refinement_created()
             
-            # Update to failed status immediately
-            await self._update_proposal_results(proposal_id, "failed", str(e), {})
+            # Prepare payload for deepagents-runtime
+            payload = build_refinement_job_request(
+                proposal_id, user_prompt, current_specification,
+                context_file_path, context_selection, runtime_config,
+                thread_id=resumed["thread_id"] if resumed else None
+            ).model_dump()
             
-            raise ValueError(f"deepagents-runtime unavailable: {str(e)}")
+            try:
+                # Call deepagents-runtime /invoke to get thread_id
+                invoke_result = await self.deepagents_client.invoke_job(payload)
+                thread_id = invoke_result.get("thread_id")
+                
+                if not thread_id:
+                    raise ValueError("deepagents-runtime did not return thread_id")
+                
+                if not resumed:
+                    # Create proposal in database with the thread_id from deepagents-runtime
+                    proposal_id = self.proposal_service.create_proposal(
+                        draft_id, thread_id, user_id, user_prompt, audit_trail,
+                        context_file_path, context_selection, base_file_versions
+                    )
+                    metrics.record_refinement_created()
+                span.set_attributes({"proposal_id": proposal_id, "thread_id": thread_id})
+                
+                # According to the spec, we only call /invoke and let the WebSocket proxy
+                # handle streaming when the frontend connects to /api/ws/refinements/{thread_id}
+                # The WebSocket proxy will update the proposal when it receives 'end' events
+                
+                return proposal_id, thread_id
+                
+            except InvalidTransitionError:
+                # The runtime handed back a thread another refinement is running on
+                raise
+            except Exception as e:
+                # If deepagents-runtime is unavailable, create proposal in failed state
+                if not resumed:
+                    thread_id = f"failed-{proposal_id}"
+                    proposal_id = self.proposal_service.create_proposal(
+                        draft_id, thread_id, user_id, user_prompt, audit_trail,
+                        context_file_path, context_selection, base_file_versions
+                    )
+                    metrics.record_refinement_created()
+                
+                # Update to failed status immediately
+                await self._update_proposal_results(proposal_id, "failed", str(e), {})
+                
+                raise DeepAgentsUnavailableError(f"deepagents-runtime unavailable: {str(e)}") from e
     
     # Remove the old async processing method since WebSocket proxy handles it
     # async def _process_refinement_async(...) - REMOVED
@@ -149,83 +254,99 @@ class OrchestrationService:
         status: str,
         result: Optional[Any] = None,
         generated_files: Optional[Dict[str, Any]] = None
-    ):
-        """Update proposal with processing results and audit trail."""
-        # Get current proposal for audit trail
-        current_proposal = self.proposal_service.get_proposal(proposal_id)
-        if not current_proposal:
-            return
+    ) -> bool:
+        """
+        Update proposal with processing results and audit trail.
+        
+        Results for a proposal that is gone or no longer in flight, e.g.
+        because it was resolved or cancelled meanwhile, are ignored.
         
-        # Update audit trail
-        audit_trail_json = self.audit_service.add_processing_event(
-            current_proposal.get("ai_generated_content"),
-            status, result, generated_files
-        )
+        Returns:
+            True if the proposal was updated
+        """
+        try:
+            proposal = self.proposal_service.update_proposal_results(
+                proposal_id, status, result, generated_files
+            )
+        except (ProposalNotFoundError, InvalidTransitionError) as e:
+            logger.info(
+                "Ignoring refinement result",
+                extra={"proposal_id": proposal_id, "status": status, "reason": str(e)}
+            )
+            return False
         
-        # Update proposal in database
-        self.proposal_service.update_proposal_results(
-            proposal_id, status, audit_trail_json, generated_files
-        )
+        self._record_refinement_finished(proposal, status)
+        return True
+    
+    @staticmethod
+    def _record_refinement_finished(proposal: Dict[str, Any], status: str) -> None:
+        """Record the job metrics of a refinement that reached a final status."""
+        duration = (datetime.now(timezone.utc) - proposal["created_at"]).total_seconds()
+        if status == "completed":
+            metrics.record_refinement_completed(duration)
+        elif status == "failed":
+            metrics.record_refinement_failed(duration)
     
     def can_access_proposal(self, proposal_id: str, user_id: str) -> bool:
         """Check if user can access the specified proposal."""
         return self.proposal_service.can_access_proposal(proposal_id, user_id)
     
-    def get_proposal(self, proposal_id: str) -> Optional[Dict[str, Any]]:
-        """Get proposal details."""
-        return self.proposal_service.get_proposal(proposal_id)
+    def get_proposal(self, proposal_id: str, include_files: bool = True) -> Optional[Dict[str, Any]]:
+        """Get proposal details, including the failure reason of failed proposals."""
+        proposal = self.proposal_service.get_proposal(proposal_id, include_files)
+        if proposal:
+            proposal["error"] = self.audit_service.get_error(proposal.get("ai_generated_content"))
+        return proposal
+    
+    def get_proposal_status(self, proposal_id: str) -> Optional[Dict[str, Any]]:
+        """Get a proposal's status and streaming progress, for polling clients."""
+        return self.proposal_service.get_proposal_status(proposal_id)
     
     def get_proposal_by_thread_id(self, thread_id: str) -> Optional[Dict[str, Any]]:
         """Get proposal by thread ID (for WebSocket processing)."""
         return self.proposal_service.get_proposal_by_thread_id(thread_id)
     
-    def approve_proposal(self, proposal_id: str, user_id: str) -> None:
+    def approve_proposal(self, proposal_id: str, user_id: str) -> Dict[str, Any]:
         """
         Approve a proposal and apply changes to draft with row-level locking.
         
+        The files are applied and the proposal resolved in one transaction
+        that holds the proposal's row lock, so a concurrent rejection cannot
+        leave a rejected proposal with its files applied.
+        
+        Generated files that are malformed or outside the workspace are
+        skipped; the others are still applied. Files that changed after the
+        refinement started make the whole approval fail instead of being
+        overwritten.
+        
         Args:
             proposal_id: Proposal ID
             user_id: User ID (for access validation)
             
+        Returns:
+            Dictionary with the applied file paths (applied_files) and the
+            skipped file paths mapped to why they were skipped (skipped_files)
+            
         Raises:
-            ValueError: If proposal not found, access denied, or not ready for approval
+            ProposalNotFoundError: If proposal not found or access denied
+            ProposalNotReadyError: If the proposal has not completed
+            DraftFileVersionConflict: If a generated file's draft file changed since the refinement started
+            EventVersionConflict: If a concurrent change to the workflow recorded its event first
         """
-        # Get proposal with locking and access validation
-        proposal = self.proposal_service.get_proposal_with_access_check(
-            proposal_id, user_id, for_update=True
-        )
-        
-        if proposal["status"] != "completed":
-            raise ValueError("Proposal is not ready for approval")
-        
-        # Apply generated files to draft
-        files_applied = 0
-        if proposal["generated_files"]:
-            # generated_files is already a dictionary from JSONB field
-            generated_files = proposal["generated_files"]
-            if isinstance(generated_files, str):
-                # Handle case where it might still be a JSON string
-                import json
-                generated_files = json.loads(generated_files)
-            files_applied = self.draft_service.apply_files_to_draft(
-                proposal["draft_id"], generated_files
-            )
-        
-        # Update audit trail for approval
-        audit_trail_json = self.audit_service.add_approval_event(
-            proposal.get("ai_generated_content"), user_id, files_applied
-        )
-        
-        # Update proposal status to resolved with approved resolution
-        self.proposal_service.resolve_proposal(
-            proposal_id, "approved", user_id, audit_trail_json
-        )
-        
-        # Clean up deepagents-runtime checkpointer data
-        if proposal["thread_id"]:
-            asyncio.create_task(
-                self.deepagents_client.cleanup_thread_data(proposal["thread_id"])
-            )
+        with tracer.start_as_current_span("approve_proposal") as span:
+            span.set_attribute("proposal_id", proposal_id)
+            
+            result = self.proposal_service.approve_proposal(proposal_id, user_id)
+            span.set_attributes({
+                "files_applied": len(result["applied_files"]),
+                "files_skipped": len(result["skipped_files"])
+            })
+            
+            # Clean up deepagents-runtime checkpointer data unless a later refinement resumed the thread
+            if result["cleanup_enqueued"]:
+                self.cleanup_threads([result["thread_id"]])
+            
+            return {"applied_files": result["applied_files"], "skipped_files": result["skipped_files"]}
     
     def reject_proposal(self, proposal_id: str, user_id: str) -> None:
         """
@@ -236,30 +357,38 @@ class OrchestrationService:
             user_id: User ID (for access validation)
             
         Raises:
-            ValueError: If proposal not found or access denied
+            ProposalNotFoundError: If proposal not found or access denied
+            InvalidTransitionError: If the proposal is still running or already resolved
+            EventVersionConflict: If a concurrent change to the workflow recorded its event first
         """
-        # Get proposal with access validation
-        proposal = self.proposal_service.get_proposal_with_access_check(
-            proposal_id, user_id
-        )
-        
-        # Update audit trail for rejection
-        audit_trail_json = self.audit_service.add_rejection_event(
-            proposal.get("ai_generated_content"), user_id
-        )
-        
-        # Update proposal status to resolved with rejected resolution
-        self.proposal_service.resolve_proposal(
-            proposal_id, "rejected", user_id, audit_trail_json
-        )
-        
-        # Clean up deepagents-runtime checkpointer data
-        if proposal["thread_id"]:
-            asyncio.create_task(
-                self.deepagents_client.cleanup_thread_data(proposal["thread_id"])
+        with tracer.start_as_current_span("reject_proposal") as span:
+            span.set_attribute("proposal_id", proposal_id)
+            
+            # Get proposal with access validation
+            proposal = self.proposal_service.get_proposal_with_access_check(
+                proposal_id, user_id
+            )
+            
+            # Update audit trail for rejection
+            audit_trail_json = self.audit_service.add_rejection_event(
+                proposal.get("ai_generated_content"), user_id
+            )
+            
+            # Update proposal status to resolved with rejected resolution
+            cleanup_enqueued = self.proposal_service.resolve_proposal(
+                proposal_id, "rejected", user_id, audit_trail_json
             )
+            
+            # Clean up deepagents-runtime checkpointer data unless a later refinement resumed the thread
+            if cleanup_enqueued:
+                self.cleanup_threads([proposal["thread_id"]])
     
-    async def update_proposal_files_from_stream(self, thread_id: str, files: Dict[str, Any]) -> None:
+    async def update_proposal_files_from_stream(
+        self,
+        thread_id: str,
+        files: Dict[str, Any],
+        summary: Optional[str] = None
+    ) -> None:
         """
         Update proposal with files from WebSocket streaming using thread_id.
         
@@ -269,14 +398,17 @@ class OrchestrationService:
         Args:
             thread_id: Thread ID from WebSocket stream
             files: Files dictionary from streaming events
+            summary: Optional result summary recorded in the audit trail
+                (e.g. that the refinement proposed no changes)
         """
         # Find proposal by thread_id
         proposal = self.get_proposal_by_thread_id(thread_id)
         if not proposal:
-            raise ValueError(f"No proposal found for thread_id: {thread_id}")
+            raise ProposalNotFoundError(f"No proposal found for thread_id: {thread_id}")
         
-        # Update the proposal with files
-        await self._update_proposal_results(proposal["id"], "completed", None, files)
+        # Update the proposal with files; a proposal that already finished keeps its state,
+        # so a replayed end event cannot reopen a resolved or cancelled proposal
+        await self._update_proposal_results(proposal["id"], "completed", summary, files)
     
     async def update_proposal_status_from_stream(self, thread_id: str, status: str, error_message: str = None) -> None:
         """
@@ -293,11 +425,73 @@ class OrchestrationService:
         # Find proposal by thread_id
         proposal = self.get_proposal_by_thread_id(thread_id)
         if not proposal:
-            raise ValueError(f"No proposal found for thread_id: {thread_id}")
+            raise ProposalNotFoundError(f"No proposal found for thread_id: {thread_id}")
         
-        # Update the proposal status
+        # Update the proposal status, unless it already finished
         await self._update_proposal_results(proposal["id"], status, error_message, {})
 
+    async def update_proposal_progress_from_stream(self, thread_id: str, progress: Dict[str, Any]) -> None:
+        """
+        Record the progress of a running refinement from its stream.
+        
+        This method is called from the stream proxy as on_state_update events
+        arrive, so clients polling the proposal's status see progress.
+        
+        Args:
+            thread_id: Thread ID from the stream
+            progress: current_step, progress_percent and files_count of the latest state
+        """
+        self.proposal_service.update_proposal_progress(thread_id, progress)
+    
+    async def cancel_refinement_from_stream(self, thread_id: str, reason: str) -> None:
+        """
+        Cancel a thread's proposal and its upstream run.
+        
+        This method is called from the WebSocket proxy when the client goes
+        away before the refinement finished, so the runtime stops working on
+        a result nobody is waiting for. Proposals that already left the
+        pending and processing states are left untouched, and so is their run.
+        
+        Args:
+            thread_id: Thread ID from WebSocket stream
+            reason: Why the refinement was cancelled (e.g., "client_disconnected")
+        """
+        proposal = self.proposal_service.cancel_thread_proposal(thread_id, reason)
+        if not proposal:
+            return
+        
+        await self.deepagents_client.cancel_thread(thread_id)
+    
+    async def cancel_proposal(self, proposal_id: str, user_id: str) -> Optional[str]:
+        """
+        Cancel an in-flight refinement at the user's request.
+        
+        The proposal is moved to the cancelled state first, then the runtime
+        is asked to stop the thread. Stopping is best-effort: results the
+        runtime still streams for the thread are ignored.
+        
+        Args:
+            proposal_id: Proposal ID
+            user_id: User ID (for access validation)
+            
+        Returns:
+            Thread ID of the cancelled refinement, if it had one
+            
+        Raises:
+            ProposalNotFoundError: If proposal not found or access denied
+            InvalidTransitionError: If the proposal already finished
+        """
+        with tracer.start_as_current_span("cancel_proposal") as span:
+            span.set_attribute("proposal_id", proposal_id)
+            
+            proposal = self.proposal_service.cancel_proposal(proposal_id, user_id)
+            
+            thread_id = proposal["thread_id"]
+            if thread_id:
+                await self.deepagents_client.cancel_thread(thread_id)
+            
+            return thread_id
+    
     async def update_proposal_files(self, proposal_id: str, files: Dict[str, Any]) -> None:
         """
         Update proposal with files from WebSocket streaming.
@@ -0,0 +1,467 @@
+"""
+Outbox service for reliable delivery of domain events.
+
+This module handles outbox event bookkeeping: recording events in the
+transaction of the state change they describe, recording delivery
+failures, moving events that exhaust their retries to the dead-letter
+state, and requeueing dead-lettered events for another attempt. The
+OutboxPoller delivers deliverable events and reports backlog metrics.
+"""
+
+import asyncio
+import json
+import logging
+import os
+import httpx
+from psycopg.rows import dict_row
+from datetime import datetime
+from typing import Dict, Any, List, Optional, Callable, Awaitable
+
+from core.database import connect
+from core.metrics import metrics
+from models.events import (
+    OUTBOX_STATUS_PENDING,
+    OUTBOX_STATUS_PUBLISHED,
+    OUTBOX_STATUS_FAILED,
+    OUTBOX_STATUS_DEAD_LETTER,
+)
+from .errors import InvalidTransitionError, OutboxEventNotFoundError
+
+logger = logging.getLogger(__name__)
+
+DEFAULT_OUTBOX_MAX_RETRIES = 5
+
+# Seconds a claimed event is left to its poller before others may deliver it
+DEFAULT_OUTBOX_CLAIM_TIMEOUT_SECONDS = 600
+
+PublishFn = Callable[[Dict[str, Any]], Awaitable[None]]
+
+
+class OutboxService:
+    """Service for managing transactional outbox events."""
+
+    def __init__(
+        self,
+        database_url: str,
+        max_retries: Optional[int] = None,
+        claim_timeout_seconds: Optional[float] = None
+    ):
+        self.database_url = database_url
+        if max_retries is None:
+            max_retries = int(os.getenv("OUTBOX_MAX_RETRIES", str(DEFAULT_OUTBOX_MAX_RETRIES)))
+        if claim_timeout_seconds is None:
+            claim_timeout_seconds = float(
+                os.getenv("OUTBOX_CLAIM_TIMEOUT_SECONDS", str(DEFAULT_OUTBOX_CLAIM_TIMEOUT_SECONDS))
+            )
+        self.max_retries = max_retries
+        self.claim_timeout_seconds = claim_timeout_seconds
+
+    @staticmethod
+    def record_event(
+        cur,
+        aggregate_type: str,
+        aggregate_id: str,
+        event_type: str,
+        payload: Optional[Dict[str, Any]] = None
+    ) -> None:
+        """
+        Add a PENDING event to the outbox.
+
+        Takes the caller's cursor so the event commits or rolls back together
+        with the state change it announces.
+
+        Args:
+            cur: Open database cursor
+            aggregate_type: Type of entity the event belongs to (workflow, proposal, version)
+            aggregate_id: ID of the entity the event belongs to
+            event_type: Domain event name, e.g. proposal.approved
+            payload: Optional event-specific details
+        """
+        cur.execute(
+            """
+            INSERT INTO outbox_events (aggregate_type, aggregate_id, event_type, payload)
+            VALUES (%s, %s, %s, %s)
+            """,
+            (aggregate_type, aggregate_id, event_type, json.dumps(payload or {}))
+        )
+
+    def get_event(self, event_id: str) -> Optional[Dict[str, Any]]:
+        """
+        Get an outbox event.
+
+        Args:
+            event_id: Outbox event ID
+
+        Returns:
+            Event dictionary or None if not found
+        """
+        with connect(self.database_url, row_factory=dict_row) as conn:
+            with conn.cursor() as cur:
+                cur.execute(
+                    """
+                    SELECT id, aggregate_type, aggregate_id, event_type, payload, status,
+                           retry_count, last_error, created_at, published_at, dead_lettered_at
+                    FROM outbox_events
+                    WHERE id = %s
+                    """,
+                    (event_id,)
+                )
+                result = cur.fetchone()
+                if result:
+                    return self._to_event_dict(result)
+                return None
+
+    def record_failure(self, event_id: str, error_message: str) -> str:
+        """
+        Record a failed delivery attempt for an event.
+
+        The event stays retryable (FAILED) until its retry count reaches the
+        configured maximum, at which point it is moved to DEAD_LETTER and the
+        publisher stops picking it up.
+
+        Args:
+            event_id: Outbox event ID
+            error_message: Error from the delivery attempt
+
+        Returns:
+            The event's new status
+
+        Raises:
+            OutboxEventNotFoundError: If event not found
+        """
+        with connect(self.database_url, row_factory=dict_row) as conn:
+            with conn.cursor() as cur:
+                status = self._record_failure(cur, event_id, error_message)
+                conn.commit()
+
+                if not status:
+                    raise OutboxEventNotFoundError("Outbox event not found")
+
+                return status
+
+    def get_backlog_stats(self) -> Dict[str, Any]:
+        """
+        Get the size and lag of the pending outbox backlog.
+
+        Returns:
+            Dictionary with pending_count and oldest_pending_age_seconds
+        """
+        with connect(self.database_url, row_factory=dict_row) as conn:
+            with conn.cursor() as cur:
+                cur.execute(
+                    """
+                    SELECT COUNT(*) AS pending_count,
+                           COALESCE(EXTRACT(EPOCH FROM (NOW() - MIN(created_at))), 0)
+                               AS oldest_pending_age_seconds
+                    FROM outbox_events
+                    WHERE status = %s
+                    """,
+                    (OUTBOX_STATUS_PENDING,)
+                )
+                result = cur.fetchone()
+                return {
+                    "pending_count": result["pending_count"],
+                    "oldest_pending_age_seconds": float(result["oldest_pending_age_seconds"])
+                }
+
+    async def deliver_batch(self, publish_fn: PublishFn, batch_size: int = 50) -> int:
+        """
+        Publish a batch of deliverable (PENDING or FAILED) events.
+
+        Events are claimed with FOR UPDATE SKIP LOCKED and marked with
+        claimed_until in a short transaction, so several orchestrator
+        replicas can run pollers without delivering the same event twice.
+        Delivery happens after that transaction committed, so a slow
+        publisher holds no connection or row lock; each outcome is recorded
+        in a transaction of its own. Events of a poller that died mid-batch
+        become deliverable again once their claim expires.
+
+        Args:
+            publish_fn: Async callable that delivers one event, raising on failure
+            batch_size: Maximum number of events to claim
+
+        Returns:
+            Number of events published successfully
+        """
+        published = 0
+
+        for event in self._claim_batch(batch_size):
+            try:
+                await publish_fn(event)
+            except Exception as e:
+                with connect(self.database_url, row_factory=dict_row) as conn:
+                    with conn.cursor() as cur:
+                        status = self._record_failure(cur, event["id"], str(e))
+                        conn.commit()
+                logger.warning(
+                    "Outbox event delivery failed",
+                    extra={
+                        "event_id": str(event["id"]),
+                        "event_type": event["event_type"],
+                        "status": status,
+                        "error": str(e),
+                    }
+                )
+                continue
+
+            with connect(self.database_url) as conn:
+                with conn.cursor() as cur:
+                    cur.execute(
+                        """
+                        UPDATE outbox_events
+                        SET status = %s, published_at = %s, claimed_until = NULL
+                        WHERE id = %s
+                        """,
+                        (OUTBOX_STATUS_PUBLISHED, datetime.utcnow(), event["id"])
+                    )
+                    conn.commit()
+            published += 1
+
+        return published
+
+    def _claim_batch(self, batch_size: int) -> List[Dict[str, Any]]:
+        """Claim up to batch_size unclaimed deliverable events, oldest first."""
+        with connect(self.database_url, row_factory=dict_row) as conn:
+            with conn.transaction():
+                with conn.cursor() as cur:
+                    cur.execute(
+                        """
+                        UPDATE outbox_events
+                        SET claimed_until = NOW() + make_interval(secs => %s)
+                        WHERE id IN (
+                            SELECT id FROM outbox_events
+                            WHERE status IN (%s, %s)
+                              AND (claimed_until IS NULL OR claimed_until <= NOW())
+                            ORDER BY created_at
+                            LIMIT %s
+                            FOR UPDATE SKIP LOCKED
+                        )
+                        RETURNING id, aggregate_type, aggregate_id, event_type, payload, status,
+                                  retry_count, last_error, created_at, published_at, dead_lettered_at
+                        """,
+                        (self.claim_timeout_seconds, OUTBOX_STATUS_PENDING, OUTBOX_STATUS_FAILED, batch_size)
+                    )
+                    events = [self._to_event_dict(row) for row in cur.fetchall()]
+        # RETURNING has no order; deliver in the order the events were recorded
+        return sorted(events, key=lambda event: event["created_at"])
+
+    def list_dead_letters(self, limit: int = 50, offset: int = 0) -> List[Dict[str, Any]]:
+        """
+        List dead-lettered events, most recently dead-lettered first.
+
+        Args:
+            limit: Maximum number of events to return
+            offset: Number of events to skip
+
+        Returns:
+            List of event dictionaries
+        """
+        with connect(self.database_url, row_factory=dict_row) as conn:
+            with conn.cursor() as cur:
+                cur.execute(
+                    """
+                    SELECT id, aggregate_type, aggregate_id, event_type, payload, status,
+                           retry_count, last_error, created_at, published_at, dead_lettered_at
+                    FROM outbox_events
+                    WHERE status = %s
+                    ORDER BY dead_lettered_at DESC
+                    LIMIT %s OFFSET %s
+                    """,
+                    (OUTBOX_STATUS_DEAD_LETTER, limit, offset)
+                )
+                return [self._to_event_dict(row) for row in cur.fetchall()]
+
+    def requeue_dead_letter(self, event_id: str) -> Dict[str, Any]:
+        """
+        Move a dead-lettered event back to PENDING with a fresh retry budget.
+
+        Args:
+            event_id: Outbox event ID
+
+        Returns:
+            The requeued event dictionary
+
+        Raises:
+            OutboxEventNotFoundError: If event not found
+            InvalidTransitionError: If the event is not dead-lettered
+        """
+        with connect(self.database_url, row_factory=dict_row) as conn:
+            with conn.transaction():
+                with conn.cursor() as cur:
+                    cur.execute(
+                        "SELECT status FROM outbox_events WHERE id = %s FOR UPDATE",
+                        (event_id,)
+                    )
+                    event = cur.fetchone()
+
+                    if not event:
+                        raise OutboxEventNotFoundError("Outbox event not found")
+
+                    if event["status"] != OUTBOX_STATUS_DEAD_LETTER:
+                        raise InvalidTransitionError("Outbox event is not dead-lettered")
+
+                    return self._reset_to_pending(cur, event_id)
+
+    def redeliver_event(self, event_id: str) -> Dict[str, Any]:
+        """
+        Reset an undelivered event to PENDING with a fresh retry budget.
+
+        Unlike requeue_dead_letter this also accepts events that are still
+        retrying, so operators can re-drive them right after an outage.
+
+        Args:
+            event_id: Outbox event ID
+
+        Returns:
+            The reset event dictionary
+
+        Raises:
+            OutboxEventNotFoundError: If event not found
+            InvalidTransitionError: If the event is already published
+        """
+        with connect(self.database_url, row_factory=dict_row) as conn:
+            with conn.transaction():
+                with conn.cursor() as cur:
+                    cur.execute(
+                        "SELECT status FROM outbox_events WHERE id = %s FOR UPDATE",
+                        (event_id,)
+                    )
+                    event = cur.fetchone()
+
+                    if not event:
+                        raise OutboxEventNotFoundError("Outbox event not found")
+
+                    if event["status"] == OUTBOX_STATUS_PUBLISHED:
+                        raise InvalidTransitionError("Outbox event is already published")
+
+                    return self._reset_to_pending(cur, event_id)
+
+    def _reset_to_pending(self, cur, event_id: str) -> Dict[str, Any]:
+        """Move a locked event back to PENDING with its retry count cleared."""
+        cur.execute(
+            """
+            UPDATE outbox_events
+            SET status = %s, retry_count = 0, dead_lettered_at = NULL, claimed_until = NULL
+            WHERE id = %s
+            RETURNING id, aggregate_type, aggregate_id, event_type, payload, status,
+                      retry_count, last_error, created_at, published_at, dead_lettered_at
+            """,
+            (OUTBOX_STATUS_PENDING, event_id)
+        )
+        return self._to_event_dict(cur.fetchone())
+
+    def _record_failure(self, cur, event_id: str, error_message: str) -> Optional[str]:
+        """Increment an event's retry count, dead-lettering it past the threshold."""
+        cur.execute(
+            """
+            UPDATE outbox_events
+            SET retry_count = retry_count + 1,
+                last_error = %s,
+                status = CASE WHEN retry_count + 1 >= %s THEN %s ELSE %s END,
+                dead_lettered_at = CASE WHEN retry_count + 1 >= %s THEN %s ELSE NULL END,
+                claimed_until = NULL
+            WHERE id = %s
+            RETURNING status
+            """,
+            (
+                error_message,
+                self.max_retries, OUTBOX_STATUS_DEAD_LETTER, OUTBOX_STATUS_FAILED,
+                self.max_retries, datetime.utcnow(),
+                event_id
+            )
+        )
+        result = cur.fetchone()
+        return result["status"] if result else None
+
+    @staticmethod
+    def _to_event_dict(row: Dict[str, Any]) -> Dict[str, Any]:
+        """Convert an outbox row to a JSON-serializable dictionary."""
+        event = dict(row)
+        for key, value in event.items():
+            if hasattr(value, 'hex'):
+                event[key] = str(value)
+        return event
+
+
+async def log_publish(event: Dict[str, Any]) -> None:
+    """Default publisher that only logs the event."""
+    logger.info(
+        "Outbox event",
+        extra={
+            "event_id": event["id"],
+            "event_type": event["event_type"],
+            "aggregate_type": event["aggregate_type"],
+            "aggregate_id": event["aggregate_id"],
+        }
+    )
+
+
+def webhook_publisher(url: str, timeout_seconds: float = 10.0) -> PublishFn:
+    """Build a publisher that POSTs each event as JSON to url, failing on non-2xx responses."""
+    async def publish(event: Dict[str, Any]) -> None:
+        async with httpx.AsyncClient(timeout=timeout_seconds) as client:
+            response = await client.post(
+                url,
+                content=json.dumps(event, default=str),
+                headers={"Content-Type": "application/json"}
+            )
+            response.raise_for_status()
+
+    return publish
+
+
+def publisher_from_env() -> PublishFn:
+    """Publish to OUTBOX_WEBHOOK_URL when set, otherwise only log events."""
+    url = os.getenv("OUTBOX_WEBHOOK_URL")
+    if url:
+        return webhook_publisher(url)
+    return log_publish
+
+
+class OutboxPoller:
+    """Background loop that publishes outbox events and reports backlog metrics."""
+
+    def __init__(
+        self,
+        outbox_service: OutboxService,
+        publish_fn: PublishFn = log_publish,
+        interval_seconds: Optional[float] = None,
+        batch_size: int = 50
+    ):
+        self.outbox_service = outbox_service
+        self.publish_fn = publish_fn
+        if interval_seconds is None:
+            interval_seconds = float(os.getenv("OUTBOX_POLL_INTERVAL_SECONDS", "5"))
+        self.interval_seconds = interval_seconds
+        self.batch_size = batch_size
+        self._stopped = asyncio.Event()
+
+    def record_backlog_metrics(self) -> Dict[str, Any]:
+        """Measure the pending backlog and publish it as gauges."""
+        stats = self.outbox_service.get_backlog_stats()
+        metrics.record_outbox_backlog(
+            stats["pending_count"], stats["oldest_pending_age_seconds"]
+        )
+        return stats
+
+    async def run_once(self) -> int:
+        """Record backlog metrics, then deliver one batch of events."""
+        self.record_backlog_metrics()
+        return await self.outbox_service.deliver_batch(self.publish_fn, self.batch_size)
+
+    async def run(self) -> None:
+        """Poll until stop() is called."""
+        while not self._stopped.is_set():
+            try:
+                await self.run_once()
+            except Exception as e:
+                logger.error("Outbox poller iteration failed", extra={"error": str(e)})
+
+            try:
+                await asyncio.wait_for(self._stopped.wait(), timeout=self.interval_seconds)
+            except asyncio.TimeoutError:
+                pass
+
+    def stop(self) -> None:
+        """Signal the poll loop to exit."""
+        self._stopped.set()
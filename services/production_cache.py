@@ -0,0 +1,64 @@
+"""
+Process-wide cache of each workflow's production version id.
+
+The /production endpoint resolves workflows.production_version_id on every
+request. Entries are invalidated by deploys in this process; the TTL bounds
+staleness for deploys served by other replicas. Writers that hold the
+workflow row lock (deploy itself) must keep reading the database.
+"""
+
+import os
+import threading
+import time
+from typing import Callable, Dict, Optional, Tuple
+
+DEFAULT_PRODUCTION_CACHE_TTL_SECONDS = 30
+
+
+class ProductionVersionCache:
+    """Per-workflow production version id cache with invalidation."""
+    
+    def __init__(self, ttl_seconds: Optional[float] = None, clock: Callable[[], float] = time.monotonic):
+        if ttl_seconds is None:
+            ttl_seconds = float(os.getenv(
+                "PRODUCTION_CACHE_TTL_SECONDS", str(DEFAULT_PRODUCTION_CACHE_TTL_SECONDS)
+            ))
+        self.ttl_seconds = ttl_seconds
+        self._clock = clock
+        self._lock = threading.Lock()
+        self._entries: Dict[str, Tuple[Optional[str], float]] = {}
+        # Bumped on every invalidation so a load racing with a deploy can't store the old id
+        self._generations: Dict[str, int] = {}
+    
+    def get_or_load(self, workflow_id: str, loader: Callable[[], Optional[str]]) -> Optional[str]:
+        """
+        Get the cached production version id, loading it on a miss.
+        
+        Args:
+            workflow_id: Workflow ID
+            loader: Reads the current production version id from the database
+            
+        Returns:
+            Production version id, or None if nothing is deployed
+        """
+        with self._lock:
+            entry = self._entries.get(workflow_id)
+            if entry and self._clock() < entry[1]:
+                return entry[0]
+            generation = self._generations.get(workflow_id, 0)
+        
+        version_id = loader()
+        
+        with self._lock:
+            if self._generations.get(workflow_id, 0) == generation:
+                self._entries[workflow_id] = (version_id, self._clock() + self.ttl_seconds)
+        return version_id
+    
+    def invalidate(self, workflow_id: str) -> None:
+        """Drop a workflow's cached id; call after the change is committed."""
+        with self._lock:
+            self._entries.pop(workflow_id, None)
+            self._generations[workflow_id] = self._generations.get(workflow_id, 0) + 1
+
+
+production_version_cache = ProductionVersionCache()
@@ -0,0 +1,66 @@
+"""
+Proposal reconciler for refinements that finished without a listener.
+
+The WebSocket proxy persists a refinement's outcome when it sees the
+stream end. If no client ever connects, the proposal would stay in
+processing forever; the ProposalReconciler periodically asks
+deepagents-runtime for the state of such threads and finalizes them.
+"""
+
+import asyncio
+import logging
+import os
+from typing import Optional
+
+from .proposal_service import ProposalService, StateFetchFn
+
+logger = logging.getLogger(__name__)
+
+
+class ProposalReconciler:
+    """Background loop that finalizes stale processing proposals."""
+
+    def __init__(
+        self,
+        proposal_service: ProposalService,
+        fetch_state: StateFetchFn,
+        interval_seconds: Optional[float] = None,
+        grace_period_seconds: Optional[float] = None,
+        batch_size: int = 20
+    ):
+        self.proposal_service = proposal_service
+        self.fetch_state = fetch_state
+        if interval_seconds is None:
+            interval_seconds = float(os.getenv("PROPOSAL_RECONCILE_INTERVAL_SECONDS", "60"))
+        if grace_period_seconds is None:
+            grace_period_seconds = float(os.getenv("PROPOSAL_RECONCILE_GRACE_SECONDS", "300"))
+        self.interval_seconds = interval_seconds
+        self.grace_period_seconds = grace_period_seconds
+        self.batch_size = batch_size
+        self._stopped = asyncio.Event()
+
+    async def run_once(self) -> int:
+        """Reconcile one batch of stale proposals."""
+        finalized = await self.proposal_service.reconcile_stale_proposals(
+            self.fetch_state, self.grace_period_seconds, self.batch_size
+        )
+        if finalized:
+            logger.info("Reconciled stale processing proposals", extra={"proposals": finalized})
+        return finalized
+
+    async def run(self) -> None:
+        """Poll until stop() is called."""
+        while not self._stopped.is_set():
+            try:
+                await self.run_once()
+            except Exception as e:
+                logger.error("Proposal reconciler iteration failed", extra={"error": str(e)})
+
+            try:
+                await asyncio.wait_for(self._stopped.wait(), timeout=self.interval_seconds)
+            except asyncio.TimeoutError:
+                pass
+
+    def stop(self) -> None:
+        """Signal the poll loop to exit."""
+        self._stopped.set()
@@ -0,0 +1,89 @@
+"""
+Retention job that purges old terminal proposals.
+
+Approved, rejected, failed and otherwise finished proposals are kept for
+PROPOSAL_RETENTION_DAYS after they ended; the ProposalRetentionJob then
+deletes them together with their access rows and thread snapshots. Every
+replica runs the job, but the purge takes an advisory lock, so only one of
+them purges at a time. A retention of 0 days, the default, keeps proposals
+forever: purging deletes each proposal's own audit trail, so it has to be
+opted into.
+"""
+
+import asyncio
+import logging
+import os
+from datetime import datetime, timedelta, timezone
+from typing import Callable, Optional
+
+from .proposal_service import ProposalService
+
+logger = logging.getLogger(__name__)
+
+DEFAULT_PROPOSAL_RETENTION_DAYS = 0
+
+
+def utc_now() -> datetime:
+    return datetime.now(timezone.utc)
+
+
+class ProposalRetentionJob:
+    """Background loop that purges terminal proposals past their retention."""
+
+    def __init__(
+        self,
+        proposal_service: ProposalService,
+        retention_days: Optional[float] = None,
+        interval_seconds: Optional[float] = None,
+        batch_size: int = 100,
+        clock: Callable[[], datetime] = utc_now
+    ):
+        self.proposal_service = proposal_service
+        if retention_days is None:
+            retention_days = float(os.getenv("PROPOSAL_RETENTION_DAYS", str(DEFAULT_PROPOSAL_RETENTION_DAYS)))
+        if interval_seconds is None:
+            interval_seconds = float(os.getenv("PROPOSAL_RETENTION_INTERVAL_SECONDS", "3600"))
+        self.retention_days = retention_days
+        self.interval_seconds = interval_seconds
+        self.batch_size = batch_size
+        self._clock = clock
+        self._stopped = asyncio.Event()
+
+    async def run_once(self) -> int:
+        """Purge expired proposals batch by batch; a retention of 0 purges nothing."""
+        if self.retention_days <= 0:
+            return 0
+
+        cutoff = self._clock() - timedelta(days=self.retention_days)
+        purged = 0
+        while not self._stopped.is_set():
+            deleted = await asyncio.to_thread(
+                self.proposal_service.purge_expired_proposals, cutoff, self.batch_size
+            )
+            # None means another replica holds the purge lock
+            if not deleted:
+                break
+            purged += deleted
+            if deleted < self.batch_size:
+                break
+
+        if purged:
+            logger.info("Purged expired proposals", extra={"proposals": purged, "retention_days": self.retention_days})
+        return purged
+
+    async def run(self) -> None:
+        """Poll until stop() is called."""
+        while not self._stopped.is_set():
+            try:
+                await self.run_once()
+            except Exception as e:
+                logger.error("Proposal retention iteration failed", extra={"error": str(e)})
+
+            try:
+                await asyncio.wait_for(self._stopped.wait(), timeout=self.interval_seconds)
+            except asyncio.TimeoutError:
+                pass
+
+    def stop(self) -> None:
+        """Signal the poll loop to exit."""
+        self._stopped.set()
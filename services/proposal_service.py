@@ -7,10 +7,77 @@ including creation, retrieval, access control, and status updates.
 
 import uuid
 import json
-import psycopg
+import logging
+from psycopg import errors
 from psycopg.rows import dict_row
 from datetime import datetime
-from typing import Dict, Any, Optional, Tuple
+from typing import Dict, Any, List, Optional, Tuple, Callable, Awaitable
+
+from core.database import connect
+from models.workflow import ProposalFilter
+from .audit_service import AuditService
+from .cleanup_job_service import CleanupJobService
+from .draft_service import DraftService
+from .errors import InvalidTransitionError, ProposalNotFoundError, ProposalNotReadyError
+from .event_store import EventStore
+from .generated_files import split_generated_files
+from .outbox_service import OutboxService
+from .refinement_progress import summarize_progress
+from .rows import json_row
+from .workflow_access import ACCESS_TYPE_SQL, WRITE_ACCESS_SQL
+
+logger = logging.getLogger(__name__)
+
+StateFetchFn = Callable[[str], Awaitable[Dict[str, Any]]]
+
+# Values accepted by the proposal list status filter
+PROPOSAL_LIST_STATUSES = ("pending", "processing", "completed", "failed", "resolved", "approved", "rejected", "cancelled")
+
+# Orderings accepted by the proposal list; a leading "-" sorts descending
+PROPOSAL_LIST_SORTS = {
+    "created_at": "p.created_at ASC, p.id ASC",
+    "-created_at": "p.created_at DESC, p.id DESC",
+    "completed_at": "p.completed_at ASC NULLS LAST, p.id ASC",
+    "-completed_at": "p.completed_at DESC NULLS LAST, p.id DESC",
+}
+DEFAULT_PROPOSAL_LIST_SORT = "-created_at"
+
+# Statuses reported by the workflow stats breakdown; resolved proposals count by resolution
+PROPOSAL_STATS_STATUSES = ("pending", "processing", "completed", "approved", "rejected", "failed", "cancelled")
+
+# Statuses of proposals that retention may purge once they are old enough
+PROPOSAL_RETENTION_STATUSES = ("approved", "rejected", "resolved", "failed", "superseded", "cancelled")
+
+# Advisory lock held while purging, so only one replica purges at a time
+PROPOSAL_RETENTION_LOCK_ID = 7_301_001
+
+# Status changes a proposal may go through; statuses without any are terminal
+PROPOSAL_TRANSITIONS = {
+    "pending": ("processing", "completed", "failed", "cancelled"),
+    "processing": ("completed", "failed", "cancelled"),
+    "completed": ("resolved", "superseded"),
+    "failed": ("resolved",),
+    "resolved": (),
+    "approved": (),
+    "rejected": (),
+    "superseded": (),
+    "cancelled": (),
+}
+
+
+def validate_proposal_transition(current_status: str, new_status: str) -> None:
+    """
+    Check that a proposal may move from current_status to new_status.
+    
+    Raises:
+        InvalidTransitionError: If current_status is terminal or the change is not allowed
+    """
+    allowed = PROPOSAL_TRANSITIONS.get(current_status, ())
+    if new_status in allowed:
+        return
+    if not allowed:
+        raise InvalidTransitionError(f"Proposal is already {current_status}")
+    raise InvalidTransitionError(f"Proposal cannot move from {current_status} to {new_status}")
 
 
 class ProposalService:
@@ -27,7 +94,9 @@ class ProposalService:
         user_prompt: str,
         audit_trail: Dict[str, Any],
         context_file_path: Optional[str] = None,
-        context_selection: Optional[str] = None
+        context_selection: Optional[str] = None,
+        base_file_versions: Optional[Dict[str, int]] = None,
+        supersedes: Optional[str] = None
     ) -> str:
         """
         Create a new refinement proposal.
@@ -40,31 +109,49 @@ class ProposalService:
             audit_trail: Initial audit trail
             context_file_path: Optional file path for context
             context_selection: Optional text selection for context
+            base_file_versions: Optional draft file versions the refinement started from;
+                approval refuses to overwrite files that changed since
+            supersedes: Optional ID of the proposal whose thread this one resumes;
+                if it is still completed it becomes superseded
             
         Returns:
             Proposal ID
+            
+        Raises:
+            InvalidTransitionError: If the resumed proposal is no longer the draft's
+                latest, or another refinement is running on the thread
         """
         proposal_id = str(uuid.uuid4())
         now = datetime.utcnow()
         
-        with psycopg.connect(self.database_url, row_factory=dict_row) as conn:
+        with connect(self.database_url, row_factory=dict_row) as conn:
             with conn.cursor() as cur:
+                if supersedes:
+                    self._lock_resumed_proposal(cur, draft_id, supersedes)
+                
                 # Create proposal record
-                cur.execute(
-                    """
-                    INSERT INTO proposals (
-                        id, draft_id, thread_id, user_prompt, context_file_path, 
-                        context_selection, status, created_by_user_id, created_at,
-                        ai_generated_content
-                    )
-                    VALUES (%s, %s, %s, %s, %s, %s, %s, %s, %s, %s)
-                    """,
-                    (
-                        proposal_id, draft_id, thread_id, user_prompt,
-                        context_file_path, context_selection, "processing",
-                        user_id, now, json.dumps(audit_trail)
+                try:
+                    cur.execute(
+                        """
+                        INSERT INTO proposals (
+                            id, draft_id, workflow_id, thread_id, user_prompt, context_file_path, 
+                            context_selection, status, created_by_user_id, created_at,
+                            ai_generated_content, base_file_versions
+                        )
+                        VALUES (%s, %s, (SELECT workflow_id FROM drafts WHERE id = %s), %s, %s, %s, %s, %s, %s, %s, %s, %s)
+                        RETURNING workflow_id
+                        """,
+                        (
+                            proposal_id, draft_id, draft_id, thread_id, user_prompt,
+                            context_file_path, context_selection, "processing",
+                            user_id, now, json.dumps(audit_trail),
+                            json.dumps(base_file_versions) if base_file_versions is not None else None
+                        )
                     )
-                )
+                except errors.UniqueViolation:
+                    # idx_proposals_active_thread_id: another refinement is running on the thread
+                    raise InvalidTransitionError("A refinement is still running on this thread")
+                workflow_id = cur.fetchone()["workflow_id"]
                 
                 # Create proposal access record for user
                 cur.execute(
@@ -75,46 +162,184 @@ class ProposalService:
                     (proposal_id, user_id, now)
                 )
                 
+                if supersedes:
+                    cur.execute(
+                        "UPDATE proposals SET status = 'superseded' WHERE id = %s AND status = 'completed'",
+                        (supersedes,)
+                    )
+                
+                AuditService.record_workflow_event(
+                    cur, workflow_id, user_id, "proposal_created", {"proposal_id": proposal_id}
+                )
+                
                 conn.commit()
         
         return proposal_id
     
-    def get_proposal(self, proposal_id: str) -> Optional[Dict[str, Any]]:
+    @staticmethod
+    def _lock_resumed_proposal(cur, draft_id: str, proposal_id: str) -> None:
+        """
+        Lock the proposal a follow-up resumes and check it is still the draft's latest.
+        
+        Two follow-ups resuming the same refinement serialize on the lock; the
+        second one then sees the first one's proposal and is refused.
+        
+        Raises:
+            InvalidTransitionError: If the proposal was resumed or is running meanwhile
+        """
+        cur.execute("SELECT id FROM proposals WHERE id = %s FOR UPDATE", (proposal_id,))
+        # A new statement, so it sees whatever the previous lock holder committed
+        cur.execute(
+            """
+            SELECT id, status FROM proposals
+            WHERE draft_id = %s
+            ORDER BY created_at DESC
+            LIMIT 1
+            """,
+            (draft_id,)
+        )
+        latest = cur.fetchone()
+        if not latest or str(latest["id"]) != proposal_id or latest["status"] not in ("completed", "failed"):
+            raise InvalidTransitionError("The draft's last refinement was resumed by another request")
+    
+    def get_resumable_proposal(self, draft_id: str) -> Dict[str, Any]:
+        """
+        Get the draft's latest proposal for a follow-up refinement to resume.
+        
+        Only a completed or failed refinement that reached deepagents-runtime
+        can be resumed: running threads are still busy, and resolved ones
+        had their runtime data cleaned up.
+        
+        Args:
+            draft_id: Draft ID
+            
+        Returns:
+            Dictionary with the proposal's id, status and thread_id
+            
+        Raises:
+            InvalidTransitionError: If the draft has no refinement that can be resumed
+        """
+        with connect(self.database_url, row_factory=dict_row) as conn:
+            with conn.cursor() as cur:
+                cur.execute(
+                    """
+                    SELECT id, status, thread_id
+                    FROM proposals
+                    WHERE draft_id = %s
+                    ORDER BY created_at DESC
+                    LIMIT 1
+                    """,
+                    (draft_id,)
+                )
+                proposal = cur.fetchone()
+        
+        if not proposal:
+            raise InvalidTransitionError("No refinement to resume on this draft")
+        if proposal["status"] in ("pending", "processing"):
+            raise InvalidTransitionError("A refinement is still running on this draft")
+        thread_id = proposal["thread_id"]
+        if proposal["status"] not in ("completed", "failed") or not thread_id or thread_id.startswith("failed-"):
+            raise InvalidTransitionError("The draft's last refinement cannot be resumed")
+        return {"id": str(proposal["id"]), "status": proposal["status"], "thread_id": thread_id}
+    
+    def get_proposal(self, proposal_id: str, include_files: bool = True) -> Optional[Dict[str, Any]]:
         """
         Get proposal details.
         
         Args:
             proposal_id: Proposal ID
+            include_files: Whether to load the generated_files blob, which can be large
             
         Returns:
             Proposal dictionary or None if not found
         """
-        with psycopg.connect(self.database_url, row_factory=dict_row) as conn:
+        files_column = "generated_files," if include_files else ""
+        with connect(self.database_url, row_factory=json_row) as conn:
             with conn.cursor() as cur:
                 cur.execute(
-                    """
-                    SELECT id, draft_id, thread_id, user_prompt, context_file_path,
-                           context_selection, status, ai_generated_content, generated_files,
+                    f"""
+                    SELECT id, draft_id, workflow_id, thread_id, user_prompt, context_file_path,
+                           context_selection, status, ai_generated_content, {files_column}
                            created_at, completed_at, created_by_user_id, resolved_by_user_id, resolved_at, resolution
                     FROM proposals
                     WHERE id = %s
                     """,
                     (proposal_id,)
                 )
-                result = cur.fetchone()
-                if result:
-                    result = dict(result)
-                    # Convert UUID objects to strings
-                    for key, value in result.items():
-                        if hasattr(value, 'hex'):
-                            result[key] = str(value)
-                    return result
-                return None
+                return cur.fetchone()
+    
+    def get_proposal_status(self, proposal_id: str) -> Optional[Dict[str, Any]]:
+        """
+        Get a proposal's progress without its files, for clients that poll.
+        
+        Progress is what the stream proxy last recorded with
+        update_proposal_progress.
+        
+        Args:
+            proposal_id: Proposal ID
+            
+        Returns:
+            Dictionary with status, files_count, updated_at and, when known,
+            progress_percent and current_step; None if not found
+        """
+        with connect(self.database_url, row_factory=dict_row) as conn:
+            with conn.cursor() as cur:
+                cur.execute(
+                    """
+                    SELECT status, generated_files, current_step, progress_percent,
+                           progress_files_count AS files_count,
+                           GREATEST(created_at, completed_at, resolved_at, progress_updated_at) AS updated_at
+                    FROM proposals
+                    WHERE id = %s
+                    """,
+                    (proposal_id,)
+                )
+                row = cur.fetchone()
+                if not row:
+                    return None
+                
+                status = summarize_progress(row["status"], row, row["generated_files"])
+                status["updated_at"] = row["updated_at"].isoformat()
+                return status
+    
+    def update_proposal_progress(self, thread_id: str, progress: Dict[str, Any]) -> bool:
+        """
+        Record a running refinement's streaming progress on its proposal.
+        
+        Values the latest state did not report keep their previous value.
+        Proposals that are no longer in flight are left untouched.
+        
+        Args:
+            thread_id: Thread ID from deepagents-runtime
+            progress: current_step, progress_percent and files_count, as
+                returned by refinement_progress.extract_progress
+            
+        Returns:
+            True if a proposal was updated
+        """
+        with connect(self.database_url, row_factory=dict_row) as conn:
+            with conn.cursor() as cur:
+                cur.execute(
+                    """
+                    UPDATE proposals
+                    SET current_step = COALESCE(%s, current_step),
+                        progress_percent = COALESCE(%s, progress_percent),
+                        progress_files_count = COALESCE(%s, progress_files_count),
+                        progress_updated_at = NOW()
+                    WHERE thread_id = %s AND status IN ('pending', 'processing')
+                    """,
+                    (progress["current_step"], progress["progress_percent"], progress["files_count"], thread_id)
+                )
+                conn.commit()
+                return cur.rowcount > 0
     
     def can_access_proposal(self, proposal_id: str, user_id: str) -> bool:
         """
         Check if user can access the specified proposal.
         
+        Access follows the user's current access to the proposal's workflow,
+        so it moves with ownership transfers and ends when a share is revoked.
+        
         Args:
             proposal_id: Proposal ID
             user_id: User ID
@@ -122,91 +347,272 @@ class ProposalService:
         Returns:
             True if user can access proposal, False otherwise
         """
-        with psycopg.connect(self.database_url, row_factory=dict_row) as conn:
+        with connect(self.database_url, row_factory=dict_row) as conn:
             with conn.cursor() as cur:
                 cur.execute(
-                    "SELECT COUNT(*) as count FROM proposal_access WHERE proposal_id = %s AND user_id = %s",
-                    (proposal_id, user_id)
+                    f"""
+                    SELECT 1
+                    FROM proposals p
+                    JOIN workflows w ON w.id = p.workflow_id
+                    WHERE p.id = %s AND w.deleted_at IS NULL AND ({ACCESS_TYPE_SQL}) IS NOT NULL
+                    """,
+                    (proposal_id, user_id, user_id)
+                )
+                return cur.fetchone() is not None
+    
+    def get_proposal_workflow_id(self, proposal_id: str) -> Optional[str]:
+        """
+        Get the ID of the workflow a proposal refines.
+        
+        Args:
+            proposal_id: Proposal ID
+            
+        Returns:
+            Workflow ID, or None if the proposal is not found
+        """
+        with connect(self.database_url, row_factory=dict_row) as conn:
+            with conn.cursor() as cur:
+                cur.execute(
+                    "SELECT workflow_id FROM proposals WHERE id = %s",
+                    (proposal_id,)
                 )
                 result = cur.fetchone()
-                return result["count"] > 0
+                return str(result["workflow_id"]) if result and result["workflow_id"] else None
+    
+    def list_proposals(
+        self,
+        workflow_id: str,
+        user_id: str,
+        filters: ProposalFilter,
+        limit: int,
+        offset: int = 0,
+        sort: str = DEFAULT_PROPOSAL_LIST_SORT
+    ) -> Tuple[List[Dict[str, Any]], int]:
+        """
+        List a workflow's proposals the user can access, one page at a time.
+        
+        Args:
+            workflow_id: Workflow ID
+            user_id: User ID (must currently have access to the workflow)
+            filters: Proposal filters; status "approved" and "rejected" match
+                resolved proposals with that resolution
+            limit: Maximum number of proposals to return
+            offset: Number of matching proposals to skip
+            sort: One of PROPOSAL_LIST_SORTS
+            
+        Returns:
+            Tuple of the page of proposal summaries and the total number matching
+            
+        Raises:
+            ValueError: If the status filter or sort is not a known value
+        """
+        if filters.status is not None and filters.status not in PROPOSAL_LIST_STATUSES:
+            raise ValueError(f"Invalid status filter: {filters.status}")
+        if sort not in PROPOSAL_LIST_SORTS:
+            raise ValueError(f"Invalid sort: {sort}")
+        
+        # Only placeholders are added to the clause; every value travels as a parameter
+        conditions = ["p.workflow_id = %s", f"({ACCESS_TYPE_SQL}) IS NOT NULL"]
+        params: List[Any] = [workflow_id, user_id, user_id]
+        if filters.status in ("approved", "rejected"):
+            conditions.append("p.status = 'resolved' AND p.resolution = %s")
+            params.append(filters.status)
+        elif filters.status is not None:
+            conditions.append("p.status = %s")
+            params.append(filters.status)
+        if filters.draft_id is not None:
+            conditions.append("p.draft_id = %s")
+            params.append(filters.draft_id)
+        if filters.context_file_path is not None:
+            conditions.append("p.context_file_path = %s")
+            params.append(filters.context_file_path)
+        if filters.created_after is not None:
+            conditions.append("p.created_at > %s")
+            params.append(filters.created_after)
+        if filters.created_before is not None:
+            conditions.append("p.created_at < %s")
+            params.append(filters.created_before)
+        where = " AND ".join(conditions)
+        
+        with connect(self.database_url, row_factory=json_row) as conn:
+            with conn.cursor() as cur:
+                cur.execute(
+                    f"""
+                    SELECT COUNT(*) AS total
+                    FROM proposals p
+                    JOIN workflows w ON w.id = p.workflow_id
+                    WHERE {where}
+                    """,
+                    params
+                )
+                total = cur.fetchone()["total"]
+                
+                cur.execute(
+                    f"""
+                    SELECT p.id, p.draft_id, p.status, p.resolution, p.user_prompt, p.context_file_path,
+                           p.created_at, p.completed_at, p.resolved_at
+                    FROM proposals p
+                    JOIN workflows w ON w.id = p.workflow_id
+                    WHERE {where}
+                    ORDER BY {PROPOSAL_LIST_SORTS[sort]}
+                    LIMIT %s OFFSET %s
+                    """,
+                    params + [limit, offset]
+                )
+                return cur.fetchall(), total
+    
+    def count_draft_proposals_by_status(self, workflow_id: str) -> Dict[str, int]:
+        """
+        Count the proposals of a workflow's draft by status.
+        
+        Resolved proposals are counted as approved or rejected by their
+        resolution; superseded proposals are not reported.
+        
+        Args:
+            workflow_id: Workflow ID
+            
+        Returns:
+            Dictionary of every stats status to its count, zero when absent
+        """
+        with connect(self.database_url, row_factory=dict_row) as conn:
+            with conn.cursor() as cur:
+                cur.execute(
+                    """
+                    SELECT CASE WHEN p.status = 'resolved' THEN p.resolution ELSE p.status END AS status,
+                           COUNT(*) AS count
+                    FROM proposals p
+                    JOIN drafts d ON d.id = p.draft_id
+                    WHERE d.workflow_id = %s
+                    GROUP BY 1
+                    """,
+                    (workflow_id,)
+                )
+                counts = {row["status"]: row["count"] for row in cur.fetchall()}
+        return {status: counts.get(status, 0) for status in PROPOSAL_STATS_STATUSES}
     
     def update_proposal_results(
         self,
         proposal_id: str,
         status: str,
-        audit_trail_json: str,
+        result: Optional[Any] = None,
         generated_files: Optional[Dict[str, Any]] = None
-    ) -> None:
+    ) -> Dict[str, Any]:
         """
         Update proposal with processing results.
         
+        The proposal row is locked while the change is validated against
+        PROPOSAL_TRANSITIONS, so a replayed end event or a late stream
+        failure cannot reopen a proposal that already finished, was resolved
+        or was cancelled.
+        
         Args:
             proposal_id: Proposal ID
-            status: New status
-            audit_trail_json: Updated audit trail as JSON string
+            status: New status (completed, failed)
+            result: Processing result recorded in the audit trail, e.g. the error message
             generated_files: Generated files dictionary
+        
+        Returns:
+            Dictionary with the proposal's created_at
+        
+        Raises:
+            ProposalNotFoundError: If the proposal does not exist
+            InvalidTransitionError: If the proposal can no longer move to status
         """
-        with psycopg.connect(self.database_url, row_factory=dict_row) as conn:
-            with conn.cursor() as cur:
-                cur.execute(
-                    """
-                    UPDATE proposals 
-                    SET status = %s, ai_generated_content = %s, generated_files = %s, completed_at = %s
-                    WHERE id = %s
-                    """,
-                    (
-                        status,
-                        audit_trail_json,
-                        json.dumps(generated_files) if generated_files else None,
-                        datetime.utcnow() if status in ["completed", "failed"] else None,
-                        proposal_id
+        with connect(self.database_url, row_factory=dict_row) as conn:
+            with conn.transaction():
+                with conn.cursor() as cur:
+                    cur.execute(
+                        "SELECT status, ai_generated_content, created_at FROM proposals WHERE id = %s FOR UPDATE",
+                        (proposal_id,)
                     )
-                )
-                conn.commit()
+                    proposal = cur.fetchone()
+                    if not proposal:
+                        raise ProposalNotFoundError("Proposal not found")
+                    validate_proposal_transition(proposal["status"], status)
+                    
+                    audit_trail_json = AuditService.add_processing_event(
+                        json.dumps(proposal["ai_generated_content"]), status, result, generated_files
+                    )
+                    cur.execute(
+                        """
+                        UPDATE proposals
+                        SET status = %s, ai_generated_content = %s, generated_files = %s, completed_at = %s
+                        WHERE id = %s
+                        """,
+                        (
+                            status,
+                            audit_trail_json,
+                            json.dumps(generated_files) if generated_files else None,
+                            datetime.utcnow(),
+                            proposal_id
+                        )
+                    )
+        
+        return {"created_at": proposal["created_at"]}
     
     def get_proposal_with_access_check(
         self,
         proposal_id: str,
-        user_id: str,
-        for_update: bool = False
+        user_id: str
     ) -> Dict[str, Any]:
         """
-        Get proposal with access validation and optional row locking.
+        Get proposal with access validation.
+        
+        Used before rejecting, so the user must currently own or edit the
+        proposal's workflow. Nothing stays locked once this returns; callers
+        that need the row locked use _select_proposal_with_access_check in
+        their own transaction.
         
         Args:
             proposal_id: Proposal ID
             user_id: User ID
-            for_update: Whether to lock the row for update
             
         Returns:
             Proposal dictionary with additional workflow info
             
         Raises:
-            ValueError: If proposal not found or access denied
+            ProposalNotFoundError: If proposal not found or access denied
         """
-        with psycopg.connect(self.database_url, row_factory=dict_row) as conn:
+        with connect(self.database_url, row_factory=dict_row) as conn:
             with conn.cursor() as cur:
-                lock_clause = "FOR UPDATE" if for_update else ""
-                
-                cur.execute(
-                    f"""
-                    SELECT p.id, p.draft_id, p.status, p.generated_files, p.thread_id, 
-                           p.ai_generated_content, p.resolution, d.workflow_id
-                    FROM proposals p
-                    JOIN proposal_access pa ON p.id = pa.proposal_id
-                    JOIN drafts d ON p.draft_id = d.id
-                    WHERE p.id = %s AND pa.user_id = %s
-                    {lock_clause}
-                    """,
-                    (proposal_id, user_id)
-                )
-                proposal = cur.fetchone()
-                
-                if not proposal:
-                    raise ValueError("Proposal not found")
-                
-                return dict(proposal)
+                return self._select_proposal_with_access_check(cur, proposal_id, user_id)
+    
+    @staticmethod
+    def _select_proposal_with_access_check(
+        cur,
+        proposal_id: str,
+        user_id: str,
+        for_update: bool = False
+    ) -> Dict[str, Any]:
+        """
+        Get proposal with access validation using the caller's cursor.
+        
+        With for_update, the proposal and draft rows stay locked until the
+        caller's transaction ends.
+        
+        Raises:
+            ProposalNotFoundError: If proposal not found or access denied
+        """
+        lock_clause = "FOR UPDATE OF p, d" if for_update else ""
+        
+        cur.execute(
+            f"""
+            SELECT p.id, p.draft_id, p.status, p.generated_files, p.thread_id, 
+                   p.ai_generated_content, p.resolution, p.base_file_versions, d.workflow_id
+            FROM proposals p
+            JOIN drafts d ON p.draft_id = d.id
+            JOIN workflows w ON d.workflow_id = w.id
+            WHERE p.id = %s AND w.deleted_at IS NULL AND {WRITE_ACCESS_SQL}
+            {lock_clause}
+            """,
+            (proposal_id, user_id, user_id)
+        )
+        proposal = cur.fetchone()
+        
+        if not proposal:
+            raise ProposalNotFoundError("Proposal not found")
+        
+        return dict(proposal)
     
     def update_proposal_status(
         self,
@@ -224,7 +630,7 @@ class ProposalService:
             user_id: User ID who resolved the proposal
             audit_trail_json: Updated audit trail as JSON string
         """
-        with psycopg.connect(self.database_url, row_factory=dict_row) as conn:
+        with connect(self.database_url, row_factory=dict_row) as conn:
             with conn.cursor() as cur:
                 cur.execute(
                     """
@@ -242,42 +648,291 @@ class ProposalService:
         resolution: str,
         user_id: str,
         audit_trail_json: str
-    ) -> None:
+    ) -> bool:
         """
         Resolve a proposal with approved or rejected outcome.
         
+        A cleanup job for the proposal's runtime thread, a proposal.approved
+        or proposal.rejected outbox event, the matching workflow history
+        event and the audit log entry are recorded in the same transaction. A thread that a later
+        refinement resumed is left for that refinement to clean up.
+        
         Args:
             proposal_id: Proposal ID
             resolution: Resolution outcome (approved, rejected)
             user_id: User ID who resolved the proposal
             audit_trail_json: Updated audit trail as JSON string
+            
+        Returns:
+            True if a cleanup job was enqueued for the proposal's runtime thread
+            
+        Raises:
+            ProposalNotFoundError: If the proposal does not exist
+            InvalidTransitionError: If the proposal is still running or already resolved
+            EventVersionConflict: If a concurrent change to the workflow recorded its event first
         """
-        with psycopg.connect(self.database_url, row_factory=dict_row) as conn:
-            with conn.cursor() as cur:
-                cur.execute(
-                    """
-                    UPDATE proposals 
-                    SET status = %s, resolution = %s, resolved_by_user_id = %s, resolved_at = %s, ai_generated_content = %s
-                    WHERE id = %s
-                    """,
-                    ("resolved", resolution, user_id, datetime.utcnow(), audit_trail_json, proposal_id)
-                )
-                conn.commit()
+        with connect(self.database_url, row_factory=dict_row) as conn:
+            with conn.transaction():
+                with conn.cursor() as cur:
+                    # Locked so a concurrent approval, rejection or cancellation cannot resolve it twice
+                    cur.execute("SELECT status FROM proposals WHERE id = %s FOR UPDATE", (proposal_id,))
+                    current = cur.fetchone()
+                    if not current:
+                        raise ProposalNotFoundError("Proposal not found")
+                    
+                    return self._record_resolution(
+                        cur, proposal_id, current["status"], resolution, user_id, audit_trail_json
+                    )
+    
+    def approve_proposal(self, proposal_id: str, user_id: str) -> Dict[str, Any]:
+        """
+        Apply a completed proposal's generated files to its draft and resolve it as approved.
+        
+        The proposal and draft rows stay locked from the status check until
+        the files are written and the proposal is resolved, all in one
+        transaction, so a concurrent rejection or cancellation either waits
+        for the approval or wins before any file is written.
+        
+        Generated files that are malformed or outside the workspace are
+        skipped; the others are still applied. Files that changed after the
+        refinement started make the whole approval fail instead of being
+        overwritten.
+        
+        Args:
+            proposal_id: Proposal ID
+            user_id: User ID (must currently own or edit the proposal's workflow)
+            
+        Returns:
+            Dictionary with the applied file paths (applied_files), the skipped
+            file paths mapped to why they were skipped (skipped_files), the
+            proposal's thread_id and whether a cleanup job was enqueued for
+            that thread (cleanup_enqueued)
+            
+        Raises:
+            ProposalNotFoundError: If proposal not found or access denied
+            ProposalNotReadyError: If the proposal has not completed
+            DraftFileVersionConflict: If a generated file's draft file changed since the refinement started
+            EventVersionConflict: If a concurrent change to the workflow recorded its event first
+        """
+        with connect(self.database_url, row_factory=dict_row) as conn:
+            with conn.transaction():
+                with conn.cursor() as cur:
+                    proposal = self._select_proposal_with_access_check(cur, proposal_id, user_id, for_update=True)
+                    
+                    if proposal["status"] != "completed":
+                        raise ProposalNotReadyError("Proposal is not ready for approval")
+                    
+                    files, skipped = split_generated_files(proposal["generated_files"] or {})
+                    if skipped:
+                        logger.warning(
+                            "Skipping unparseable files of proposal",
+                            extra={"proposal_id": proposal_id, "skipped_files": skipped}
+                        )
+                    expected_versions = None
+                    if proposal["base_file_versions"] is not None:
+                        # Files missing when the refinement started must still be missing
+                        expected_versions = {path: proposal["base_file_versions"].get(path, 0) for path in files}
+                    files_applied = DraftService.apply_files(cur, proposal["draft_id"], files, expected_versions)
+                    
+                    audit_trail_json = AuditService.add_approval_event(
+                        json.dumps(proposal["ai_generated_content"]), user_id, files_applied
+                    )
+                    cleanup_enqueued = self._record_resolution(
+                        cur, proposal_id, proposal["status"], "approved", user_id, audit_trail_json
+                    )
+        
+        return {
+            "applied_files": list(files),
+            "skipped_files": skipped,
+            "thread_id": proposal["thread_id"],
+            "cleanup_enqueued": cleanup_enqueued,
+        }
+    
+    @staticmethod
+    def _record_resolution(
+        cur,
+        proposal_id: str,
+        current_status: str,
+        resolution: str,
+        user_id: str,
+        audit_trail_json: str
+    ) -> bool:
+        """
+        Resolve a proposal the caller locked FOR UPDATE, using the caller's cursor.
+        
+        Returns:
+            True if a cleanup job was enqueued for the proposal's runtime thread
+            
+        Raises:
+            InvalidTransitionError: If the proposal is still running or already resolved
+            EventVersionConflict: If a concurrent change to the workflow recorded its event first
+        """
+        validate_proposal_transition(current_status, "resolved")
+        
+        cur.execute(
+            """
+            UPDATE proposals p
+            SET status = %s, resolution = %s, resolved_by_user_id = %s, resolved_at = %s, ai_generated_content = %s
+            WHERE id = %s
+            RETURNING p.thread_id, p.workflow_id, EXISTS (
+                SELECT 1 FROM proposals later
+                WHERE later.thread_id = p.thread_id AND later.created_at > p.created_at
+            ) AS thread_resumed
+            """,
+            ("resolved", resolution, user_id, datetime.utcnow(), audit_trail_json, proposal_id)
+        )
+        proposal = cur.fetchone()
+        cleanup_enqueued = False
+        if proposal["thread_id"] and not proposal["thread_resumed"]:
+            CleanupJobService.enqueue(cur, [proposal["thread_id"]])
+            cleanup_enqueued = True
+        OutboxService.record_event(
+            cur, "proposal", proposal_id, f"proposal.{resolution}",
+            {"workflow_id": str(proposal["workflow_id"]), "resolved_by_user_id": user_id}
+        )
+        EventStore.append_event(
+            cur, str(proposal["workflow_id"]), f"proposal.{resolution}",
+            {"proposal_id": proposal_id, "resolved_by_user_id": user_id}
+        )
+        AuditService.record_workflow_event(
+            cur, proposal["workflow_id"], user_id, f"proposal_{resolution}",
+            {"proposal_id": proposal_id}
+        )
+        return cleanup_enqueued
+    
+    def cancel_proposal(self, proposal_id: str, user_id: str) -> Dict[str, Any]:
+        """
+        Move an in-flight proposal to the terminal cancelled state.
+        
+        The proposal row is locked while its status is validated, so a
+        concurrent stream result cannot complete it in between.
+        
+        Args:
+            proposal_id: Proposal ID
+            user_id: User cancelling the proposal; needs write access to the workflow
+            
+        Returns:
+            Dictionary with the proposal's id and thread_id
+            
+        Raises:
+            ProposalNotFoundError: If proposal not found or access denied
+            InvalidTransitionError: If the proposal is no longer pending or processing
+        """
+        with connect(self.database_url, row_factory=json_row) as conn:
+            with conn.transaction():
+                with conn.cursor() as cur:
+                    cur.execute(
+                        f"""
+                        SELECT p.id, p.workflow_id, p.status, p.thread_id, p.ai_generated_content
+                        FROM proposals p
+                        JOIN workflows w ON w.id = p.workflow_id
+                        WHERE p.id = %s AND w.deleted_at IS NULL AND {WRITE_ACCESS_SQL}
+                        FOR UPDATE OF p
+                        """,
+                        (proposal_id, user_id, user_id)
+                    )
+                    proposal = cur.fetchone()
+                    if not proposal:
+                        raise ProposalNotFoundError("Proposal not found")
+                    
+                    self.cancel_locked_proposal(cur, proposal, user_id)
+        
+        return {"id": proposal["id"], "thread_id": proposal["thread_id"]}
+    
+    def cancel_thread_proposal(self, thread_id: str, reason: str) -> Optional[Dict[str, Any]]:
+        """
+        Cancel the in-flight proposal of a thread whose stream was abandoned.
+        
+        Like cancel_proposal, the thread's latest proposal is locked while its
+        status is validated, so a user cancellation or a completion that gets
+        there first wins. The cancellation is recorded for the user who
+        started the refinement.
+        
+        Args:
+            thread_id: Thread ID from deepagents-runtime
+            reason: Why the refinement was cancelled (e.g., "client_disconnected")
+            
+        Returns:
+            Dictionary with the proposal's id and thread_id, or None if the
+            thread has no proposal that is still pending or processing
+        """
+        with connect(self.database_url, row_factory=json_row) as conn:
+            with conn.transaction():
+                with conn.cursor() as cur:
+                    cur.execute(
+                        """
+                        SELECT id, workflow_id, status, thread_id, ai_generated_content, created_by_user_id
+                        FROM proposals
+                        WHERE thread_id = %s
+                        ORDER BY created_at DESC
+                        LIMIT 1
+                        FOR UPDATE
+                        """,
+                        (thread_id,)
+                    )
+                    proposal = cur.fetchone()
+                    if not proposal:
+                        return None
+                    
+                    try:
+                        self.cancel_locked_proposal(cur, proposal, proposal["created_by_user_id"], reason)
+                    except InvalidTransitionError:
+                        return None
+        
+        return {"id": proposal["id"], "thread_id": proposal["thread_id"]}
+    
+    @staticmethod
+    def cancel_locked_proposal(
+        cur,
+        proposal: Dict[str, Any],
+        user_id: str,
+        reason: Optional[str] = None
+    ) -> None:
+        """
+        Move a proposal the caller locked FOR UPDATE to cancelled, using the caller's cursor.
+        
+        Raises:
+            InvalidTransitionError: If the proposal is no longer pending or processing
+        """
+        validate_proposal_transition(proposal["status"], "cancelled")
+        
+        audit_trail_json = AuditService.add_cancellation_event(
+            proposal["ai_generated_content"], user_id, reason
+        )
+        cur.execute(
+            """
+            UPDATE proposals
+            SET status = 'cancelled', ai_generated_content = %s, completed_at = %s
+            WHERE id = %s
+            """,
+            (audit_trail_json, datetime.utcnow(), proposal["id"])
+        )
+        details = {"proposal_id": proposal["id"]}
+        if reason:
+            details["reason"] = reason
+        AuditService.record_workflow_event(cur, proposal["workflow_id"], user_id, "proposal_cancelled", details)
     
     def get_proposal_by_thread_id(self, thread_id: str) -> Optional[Dict[str, Any]]:
         """
         Get proposal by thread ID (for WebSocket processing).
         
+        A resumed thread belongs to several proposals; the latest one is returned.
+        
         Args:
             thread_id: Thread ID from deepagents-runtime
             
         Returns:
             Proposal dictionary or None if not found
         """
-        with psycopg.connect(self.database_url, row_factory=dict_row) as conn:
+        with connect(self.database_url, row_factory=dict_row) as conn:
             with conn.cursor() as cur:
                 cur.execute(
-                    "SELECT id, draft_id, status FROM proposals WHERE thread_id = %s",
+                    """
+                    SELECT id, draft_id, status FROM proposals
+                    WHERE thread_id = %s
+                    ORDER BY created_at DESC
+                    LIMIT 1
+                    """,
                     (thread_id,)
                 )
                 result = cur.fetchone()
@@ -288,4 +943,156 @@ class ProposalService:
                         if hasattr(value, 'hex'):
                             result[key] = str(value)
                     return result
-                return None
\ No newline at end of file
+                return None
+    
+    async def reconcile_stale_proposals(
+        self,
+        fetch_state: StateFetchFn,
+        grace_period_seconds: float,
+        batch_size: int = 20
+    ) -> int:
+        """
+        Finalize processing proposals whose runtime thread already finished.
+        
+        Proposals are normally finalized by the WebSocket proxy, which never
+        runs if no client connects. The runtime is asked for the state of each
+        proposal still processing after the grace period without holding a
+        transaction; a proposal whose thread finished is then locked and
+        finalized only if it is still processing, so a stream or another
+        replica that finalized it in the meantime wins.
+        
+        Args:
+            fetch_state: Async callable returning the runtime state for a thread_id
+            grace_period_seconds: Minimum proposal age before it is reconciled
+            batch_size: Maximum number of proposals to check
+            
+        Returns:
+            Number of proposals finalized
+        """
+        finalized = 0
+        
+        with connect(self.database_url, row_factory=dict_row) as conn:
+            with conn.cursor() as cur:
+                cur.execute(
+                    """
+                    SELECT id, thread_id
+                    FROM proposals
+                    WHERE status = 'processing'
+                      AND created_at < NOW() - make_interval(secs => %s)
+                    ORDER BY created_at
+                    LIMIT %s
+                    """,
+                    (grace_period_seconds, batch_size)
+                )
+                candidates = cur.fetchall()
+        
+        for candidate in candidates:
+            try:
+                state = await fetch_state(candidate["thread_id"])
+            except Exception as e:
+                logger.warning(
+                    "Could not fetch state for thread",
+                    extra={"thread_id": candidate["thread_id"], "error": str(e)}
+                )
+                continue
+            
+            status = state.get("status")
+            if status == "completed":
+                result = None
+                generated_files = state.get("generated_files") or state.get("files") or {}
+            elif status == "failed":
+                result = state.get("error", "Job failed without error details")
+                generated_files = {}
+            else:
+                continue
+            
+            with connect(self.database_url, row_factory=dict_row) as conn:
+                with conn.transaction():
+                    with conn.cursor() as cur:
+                        cur.execute(
+                            """
+                            SELECT ai_generated_content FROM proposals
+                            WHERE id = %s AND status = 'processing'
+                            FOR UPDATE SKIP LOCKED
+                            """,
+                            (candidate["id"],)
+                        )
+                        proposal = cur.fetchone()
+                        if not proposal:
+                            continue
+                        
+                        audit_trail_json = AuditService.add_processing_event(
+                            json.dumps(proposal["ai_generated_content"]), status, result, generated_files
+                        )
+                        cur.execute(
+                            """
+                            UPDATE proposals
+                            SET status = %s, ai_generated_content = %s, generated_files = %s, completed_at = %s
+                            WHERE id = %s
+                            """,
+                            (
+                                status,
+                                audit_trail_json,
+                                json.dumps(generated_files) if generated_files else None,
+                                datetime.utcnow(),
+                                candidate["id"]
+                            )
+                        )
+                        finalized += 1
+        
+        return finalized
+    
+    def purge_expired_proposals(self, cutoff: datetime, batch_size: int = 100) -> Optional[int]:
+        """
+        Delete terminal proposals that ended before cutoff.
+        
+        A proposal's age is taken from when it was resolved, or else when it
+        finished. Its access rows are deleted with it, and so are the state
+        snapshots of its runtime thread once no other proposal resumed it. The purge holds a transaction-scoped
+        advisory lock, so replicas running the retention job concurrently do
+        not contend for the same rows.
+        
+        Args:
+            cutoff: Proposals that ended before this moment are purged
+            batch_size: Maximum number of proposals to delete
+            
+        Returns:
+            Number of proposals deleted, or None if another replica is purging
+        """
+        with connect(self.database_url, row_factory=dict_row) as conn:
+            with conn.transaction():
+                with conn.cursor() as cur:
+                    cur.execute("SELECT pg_try_advisory_xact_lock(%s) AS locked", (PROPOSAL_RETENTION_LOCK_ID,))
+                    if not cur.fetchone()["locked"]:
+                        return None
+                    
+                    cur.execute(
+                        """
+                        SELECT id, thread_id
+                        FROM proposals
+                        WHERE status = ANY(%s)
+                          AND COALESCE(resolved_at, completed_at, created_at) < %s
+                        ORDER BY COALESCE(resolved_at, completed_at, created_at)
+                        LIMIT %s
+                        """,
+                        (list(PROPOSAL_RETENTION_STATUSES), cutoff, batch_size)
+                    )
+                    proposals = cur.fetchall()
+                    if not proposals:
+                        return 0
+                    
+                    proposal_ids = [proposal["id"] for proposal in proposals]
+                    thread_ids = [proposal["thread_id"] for proposal in proposals if proposal["thread_id"]]
+                    cur.execute("DELETE FROM proposal_access WHERE proposal_id = ANY(%s)", (proposal_ids,))
+                    cur.execute("DELETE FROM proposals WHERE id = ANY(%s)", (proposal_ids,))
+                    deleted = cur.rowcount
+                    if thread_ids:
+                        cur.execute(
+                            """
+                            DELETE FROM thread_snapshots s
+                            WHERE s.thread_id = ANY(%s)
+                              AND NOT EXISTS (SELECT 1 FROM proposals p WHERE p.thread_id = s.thread_id)
+                            """,
+                            (thread_ids,)
+                        )
+                    return deleted
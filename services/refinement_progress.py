@@ -0,0 +1,106 @@
+"""
+Progress summaries of refinements for clients that poll instead of streaming.
+
+The stream proxy extracts the step, percentage and file count from each
+on_state_update and persists them on the proposal, so polling needs no
+connection to deepagents-runtime.
+"""
+
+from typing import Any, Dict, Optional
+
+# Statuses of refinements that are still running
+IN_FLIGHT_STATUSES = ("pending", "processing")
+
+# Statuses of refinements that produced their result
+FINISHED_STATUSES = ("completed", "approved", "rejected", "resolved", "superseded")
+
+# State keys naming the step the agent is on ("Analyzing", "Generating", ...), in order of preference
+STEP_KEYS = ("current_step", "step")
+
+# State keys carrying a completion percentage, in order of preference
+PROGRESS_KEYS = ("progress_percent", "progress")
+
+# Where states carry the generated files, in order of preference; the runtime
+# has sent them at the top level and nested under its graph state or values
+FILES_PATHS = (("files",), ("state", "files"), ("values", "files"), ("generated_files",))
+
+
+def current_step(state: Optional[Dict[str, Any]]) -> Optional[str]:
+    """Name of the step a state snapshot reports, or None if it names none."""
+    for key in STEP_KEYS:
+        step = (state or {}).get(key)
+        if isinstance(step, str) and step:
+            return step
+    return None
+
+
+def state_files(state: Optional[Dict[str, Any]]) -> Optional[Dict[str, Any]]:
+    """Files a state snapshot carries under any of FILES_PATHS, or None if it carries none."""
+    for path in FILES_PATHS:
+        value: Any = state
+        for key in path:
+            value = value.get(key) if isinstance(value, dict) else None
+        if isinstance(value, dict):
+            return value
+    return None
+
+
+def progress_percent(state: Optional[Dict[str, Any]]) -> Optional[int]:
+    """Completion percentage a state snapshot reports, clamped to 0-100, or None if it reports none."""
+    for key in PROGRESS_KEYS:
+        progress = (state or {}).get(key)
+        # bool is an int, but never a percentage
+        if isinstance(progress, (int, float)) and not isinstance(progress, bool):
+            return max(0, min(100, round(progress)))
+    return None
+
+
+def extract_progress(state: Optional[Dict[str, Any]]) -> Dict[str, Any]:
+    """
+    Extract the progress an on_state_update state reports.
+
+    Returns:
+        Dictionary with current_step, progress_percent and files_count, each
+        None when the state does not report it
+    """
+    files = state_files(state)
+    return {
+        "current_step": current_step(state),
+        "progress_percent": progress_percent(state),
+        "files_count": len(files) if files is not None else None
+    }
+
+
+def summarize_progress(
+    status: str,
+    progress: Dict[str, Any],
+    generated_files: Optional[Dict[str, Any]]
+) -> Dict[str, Any]:
+    """
+    Summarize a proposal's progress for a polling client.
+
+    Args:
+        status: Proposal status
+        progress: Progress persisted while the refinement streamed, as
+            returned by extract_progress
+        generated_files: Files stored on the proposal once the refinement ended
+
+    Returns:
+        Dictionary with the status and files_count, plus progress_percent and
+        current_step when they are known
+    """
+    if generated_files is not None:
+        files_count = len(generated_files)
+    else:
+        files_count = progress.get("files_count") or 0
+    summary: Dict[str, Any] = {"status": status, "files_count": files_count}
+
+    if status in IN_FLIGHT_STATUSES:
+        if progress.get("current_step"):
+            summary["current_step"] = progress["current_step"]
+        if progress.get("progress_percent") is not None:
+            summary["progress_percent"] = progress["progress_percent"]
+    elif status in FINISHED_STATUSES:
+        summary["progress_percent"] = 100
+
+    return summary
@@ -0,0 +1,25 @@
+"""
+Row factories for psycopg cursors.
+
+Services return rows as plain dictionaries that FastAPI can serialize
+directly. json_row builds them by column name like dict_row and converts
+UUID columns to strings, replacing the per-query conversion loops.
+"""
+
+import uuid
+from typing import Any, Dict, Sequence
+
+from psycopg.rows import RowMaker, dict_row
+
+
+def json_row(cursor) -> RowMaker[Dict[str, Any]]:
+    """Row factory producing dictionaries keyed by column name, with UUIDs as strings."""
+    make_dict = dict_row(cursor)
+    
+    def make_row(values: Sequence[Any]) -> Dict[str, Any]:
+        return {
+            key: str(value) if isinstance(value, uuid.UUID) else value
+            for key, value in make_dict(values).items()
+        }
+    
+    return make_row
@@ -0,0 +1,153 @@
+"""
+Thread snapshot service for refinement state history.
+
+This module persists the on_state_update snapshots streamed from
+deepagents-runtime so a refinement's evolution can be replayed to a
+reconnecting client or inspected after the fact.
+"""
+
+import os
+import json
+from psycopg.rows import dict_row
+from typing import Dict, Any, List, Optional
+
+from core.database import connect
+
+DEFAULT_THREAD_SNAPSHOT_LIMIT = 5
+
+
+class ThreadSnapshotService:
+    """Service for storing and retrieving per-thread state snapshots."""
+    
+    def __init__(self, database_url: str, snapshot_limit: Optional[int] = None):
+        self.database_url = database_url
+        if snapshot_limit is None:
+            snapshot_limit = int(os.getenv("THREAD_SNAPSHOT_LIMIT", str(DEFAULT_THREAD_SNAPSHOT_LIMIT)))
+        self.snapshot_limit = snapshot_limit
+    
+    def save_snapshot(self, thread_id: str, state: Dict[str, Any]) -> int:
+        """
+        Append a state snapshot for a thread, dropping all but its newest snapshot_limit.
+        
+        Pruning on every insert keeps a long or never-finishing refinement
+        from growing the table. The new snapshot always stays, so sequences
+        keep increasing even with a limit of 0. Saves for the same thread
+        are serialized so concurrent ones never pick the same sequence.
+        
+        Args:
+            thread_id: Thread ID from deepagents-runtime
+            state: Event data of the on_state_update event
+            
+        Returns:
+            Sequence number assigned to the snapshot
+        """
+        with connect(self.database_url, row_factory=dict_row) as conn:
+            with conn.cursor() as cur:
+                # Held until commit, so the next save sees this snapshot's sequence
+                cur.execute("SELECT pg_advisory_xact_lock(hashtext(%s))", (thread_id,))
+                cur.execute(
+                    """
+                    INSERT INTO thread_snapshots (thread_id, sequence, state)
+                    SELECT %s, COALESCE(MAX(sequence), 0) + 1, %s
+                    FROM thread_snapshots
+                    WHERE thread_id = %s
+                    RETURNING sequence
+                    """,
+                    (thread_id, json.dumps(state), thread_id)
+                )
+                sequence = cur.fetchone()["sequence"]
+                cur.execute(
+                    "DELETE FROM thread_snapshots WHERE thread_id = %s AND sequence <= %s",
+                    (thread_id, sequence - max(self.snapshot_limit, 1))
+                )
+                conn.commit()
+                return sequence
+    
+    def get_snapshot(self, thread_id: str, sequence: int) -> Optional[Dict[str, Any]]:
+        """
+        Get a snapshot by sequence number.
+        
+        Args:
+            thread_id: Thread ID from deepagents-runtime
+            sequence: Snapshot sequence number
+            
+        Returns:
+            Snapshot dictionary or None if not found
+        """
+        with connect(self.database_url, row_factory=dict_row) as conn:
+            with conn.cursor() as cur:
+                cur.execute(
+                    """
+                    SELECT thread_id, sequence, state, created_at
+                    FROM thread_snapshots
+                    WHERE thread_id = %s AND sequence = %s
+                    """,
+                    (thread_id, sequence)
+                )
+                result = cur.fetchone()
+                return dict(result) if result else None
+    
+    def list_snapshots(
+        self,
+        thread_id: str,
+        after_sequence: int = 0,
+        limit: Optional[int] = None
+    ) -> List[Dict[str, Any]]:
+        """
+        List a thread's snapshots in sequence order.
+        
+        Args:
+            thread_id: Thread ID from deepagents-runtime
+            after_sequence: Only return snapshots with a greater sequence
+            limit: Only return the newest limit snapshots
+            
+        Returns:
+            List of snapshot dictionaries
+        """
+        with connect(self.database_url, row_factory=dict_row) as conn:
+            with conn.cursor() as cur:
+                cur.execute(
+                    """
+                    SELECT * FROM (
+                        SELECT thread_id, sequence, state, created_at
+                        FROM thread_snapshots
+                        WHERE thread_id = %s AND sequence > %s
+                        ORDER BY sequence DESC
+                        LIMIT %s
+                    ) newest
+                    ORDER BY sequence
+                    """,
+                    (thread_id, after_sequence, limit)
+                )
+                return [dict(row) for row in cur.fetchall()]
+    
+    def prune_snapshots(self, thread_id: str) -> int:
+        """
+        Keep only the most recent snapshots for a thread.
+        
+        Called whenever a refinement stream ends, however it ended; the
+        newest snapshot_limit snapshots are retained for inspection.
+        
+        Args:
+            thread_id: Thread ID from deepagents-runtime
+            
+        Returns:
+            Number of snapshots deleted
+        """
+        with connect(self.database_url, row_factory=dict_row) as conn:
+            with conn.cursor() as cur:
+                cur.execute(
+                    """
+                    DELETE FROM thread_snapshots
+                    WHERE thread_id = %s
+                      AND sequence <= (
+                          SELECT COALESCE(MAX(sequence), 0) - %s
+                          FROM thread_snapshots
+                          WHERE thread_id = %s
+                      )
+                    """,
+                    (thread_id, self.snapshot_limit, thread_id)
+                )
+                deleted = cur.rowcount
+                conn.commit()
+                return deleted
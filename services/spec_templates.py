@@ -0,0 +1,75 @@
+"""
+Starter specification templates for new workflows.
+
+Templates are JSON files named <template_id>.json in SPEC_TEMPLATES_DIR
+(the repository's templates/ directory by default). Creating a workflow
+with a template_id seeds its draft with the template's graph as
+/definition.json and a README describing it, so users start from a working
+specification instead of an empty canvas.
+"""
+
+import json
+import os
+import re
+from functools import lru_cache
+from pathlib import Path
+from typing import Any, Dict
+
+from .spec_validator import DEFINITION_FILE_PATH
+
+DEFAULT_SPEC_TEMPLATES_DIR = str(Path(__file__).resolve().parent.parent / "templates")
+
+README_FILE_PATH = "/README.md"
+
+# Template IDs are file names; anything else could escape the templates directory
+TEMPLATE_ID_PATTERN = re.compile(r"^[a-z0-9][a-z0-9_-]{0,63}$")
+
+
+class TemplateNotFoundError(ValueError):
+    """Raised when no template exists for a template ID."""
+
+    def __init__(self, template_id: str):
+        super().__init__(f"Template not found: {template_id}")
+        self.template_id = template_id
+
+
+def get_templates_dir() -> str:
+    """Read SPEC_TEMPLATES_DIR."""
+    return os.getenv("SPEC_TEMPLATES_DIR", DEFAULT_SPEC_TEMPLATES_DIR)
+
+
+def load_template_files(template_id: str) -> Dict[str, Dict[str, Any]]:
+    """
+    Build the draft files of a starter template.
+
+    Args:
+        template_id: Template ID, e.g. single-agent
+
+    Returns:
+        Dictionary of file paths to file data, as applied to drafts
+
+    Raises:
+        TemplateNotFoundError: If the template does not exist
+    """
+    if not TEMPLATE_ID_PATTERN.match(template_id):
+        raise TemplateNotFoundError(template_id)
+    return _load_template_files(get_templates_dir(), template_id)
+
+
+@lru_cache(maxsize=None)
+def _load_template_files(templates_dir: str, template_id: str) -> Dict[str, Dict[str, Any]]:
+    """Read and convert a template file once per directory."""
+    try:
+        with open(os.path.join(templates_dir, f"{template_id}.json"), encoding="utf-8") as f:
+            template = json.load(f)
+    except FileNotFoundError:
+        raise TemplateNotFoundError(template_id)
+
+    readme = f"# {template.get('name', template_id)}\n\n{template.get('description', '')}".rstrip() + "\n"
+    return {
+        DEFINITION_FILE_PATH: {
+            "content": json.dumps(template["definition"]["graph"], indent=2),
+            "type": "json"
+        },
+        README_FILE_PATH: {"content": readme, "type": "markdown"},
+    }
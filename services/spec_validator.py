@@ -0,0 +1,227 @@
+"""
+Specification validation for drafts.
+
+Checks a draft's specification files and reports every problem as a
+structured issue ({code, path, message}) so the IDE can point at the
+exact file, node, or edge. Used by the validate endpoint and before a
+draft is published, where lint_json_files also checks that files declared
+as JSON parse.
+"""
+
+import json
+from typing import Any, Dict, List
+
+from models.validation import ValidationResult
+
+# File holding the workflow graph (nodes and edges)
+DEFINITION_FILE_PATH = "/definition.json"
+
+# Node types that run an agent and need a prompt; templates use AgentNode
+AGENT_NODE_TYPES = ("agent", "AgentNode")
+
+# Issues that leave node references unreliable, so the flow is not checked
+GRAPH_ISSUE_CODES = ("missing_node_id", "duplicate_node_id", "invalid_edge", "dangling_edge")
+
+# Files of this type, or with this extension, must hold valid JSON
+JSON_FILE_TYPE = "json"
+JSON_FILE_EXTENSION = ".json"
+
+# What publishing does with files that fail lint_json_files
+JSON_LINT_MODES = ("off", "warn", "error")
+
+
+class InvalidSpecificationError(ValueError):
+    """Raised when a specification fails validation."""
+
+    def __init__(self, result: ValidationResult):
+        super().__init__("Specification is invalid")
+        self.result = result
+
+
+def _file_content(file_data: Any) -> Any:
+    """Get the content of a file given either as a file dict or raw content."""
+    if isinstance(file_data, dict):
+        return file_data.get("content")
+    return file_data
+
+
+def validate_specification(files: Dict[str, Any]) -> ValidationResult:
+    """
+    Validate a specification's files.
+
+    Args:
+        files: Dictionary of file paths to file data (or raw content)
+
+    Returns:
+        ValidationResult listing all issues found
+    """
+    result = ValidationResult()
+
+    if not files:
+        result.add("empty_specification", "/", "Specification has no files")
+        return result
+
+    for file_path, file_data in sorted(files.items()):
+        content = _file_content(file_data)
+        if not isinstance(content, str) or not content.strip():
+            result.add("empty_file", file_path, "File has no content")
+
+    if DEFINITION_FILE_PATH in files:
+        _validate_definition(_file_content(files[DEFINITION_FILE_PATH]), result)
+
+    return result
+
+
+def lint_json_files(files: Dict[str, Any]) -> ValidationResult:
+    """
+    Check that every file declared as JSON parses.
+
+    A file is declared as JSON by its type or its extension. Empty files
+    and the definition are left to validate_specification, which already
+    reports them.
+
+    Args:
+        files: Dictionary of file paths to file data (or raw content)
+
+    Returns:
+        ValidationResult with an invalid_json issue per file that does not parse
+    """
+    result = ValidationResult()
+    for file_path, file_data in sorted(files.items()):
+        if file_path == DEFINITION_FILE_PATH or not _declares_json(file_path, file_data):
+            continue
+        content = _file_content(file_data)
+        if not isinstance(content, str) or not content.strip():
+            continue
+        try:
+            json.loads(content)
+        except json.JSONDecodeError as e:
+            result.add("invalid_json", file_path, f"File is not valid JSON: {e.msg} (line {e.lineno})")
+    return result
+
+
+def _declares_json(file_path: str, file_data: Any) -> bool:
+    """Whether a file's type or extension says it holds JSON."""
+    if isinstance(file_data, dict) and file_data.get("type") == JSON_FILE_TYPE:
+        return True
+    return file_path.lower().endswith(JSON_FILE_EXTENSION)
+
+
+def _validate_definition(content: Any, result: ValidationResult) -> None:
+    """Validate the nodes and edges of the workflow definition."""
+    if not isinstance(content, str) or not content.strip():
+        return
+
+    try:
+        definition = json.loads(content)
+    except json.JSONDecodeError as e:
+        result.add("invalid_json", DEFINITION_FILE_PATH, f"Definition is not valid JSON: {e.msg}")
+        return
+
+    if not isinstance(definition, dict):
+        result.add("invalid_definition", DEFINITION_FILE_PATH, "Definition must be a JSON object")
+        return
+
+    nodes = definition.get("nodes", [])
+    edge_list = definition.get("edges", [])
+    for key, value in (("nodes", nodes), ("edges", edge_list)):
+        if not isinstance(value, list):
+            result.add("invalid_definition", f"{DEFINITION_FILE_PATH}#/{key}", f"Definition {key} must be a list")
+    if not isinstance(nodes, list) or not isinstance(edge_list, list):
+        return
+
+    issue_count = len(result.issues)
+    node_ids = set()
+    for index, node in enumerate(nodes):
+        node_path = f"{DEFINITION_FILE_PATH}#/nodes/{index}"
+        node_id = node.get("id") if isinstance(node, dict) else None
+        if not node_id:
+            result.add("missing_node_id", node_path, "Node has no id")
+        elif not isinstance(node_id, str):
+            result.add("missing_node_id", node_path, "Node id must be a string")
+        elif node_id in node_ids:
+            result.add("duplicate_node_id", node_path, f"Node id '{node_id}' is used more than once")
+        else:
+            node_ids.add(node_id)
+        if isinstance(node, dict) and node.get("type") in AGENT_NODE_TYPES and not _agent_prompt(node):
+            result.add("missing_agent_prompt", f"{node_path}/data", "Agent node has no prompt")
+
+    edges = []
+    for index, edge in enumerate(edge_list):
+        edge_path = f"{DEFINITION_FILE_PATH}#/edges/{index}"
+        if not isinstance(edge, dict):
+            result.add("invalid_edge", edge_path, "Edge must be an object")
+            continue
+        for end in ("source", "target"):
+            if not isinstance(edge.get(end), str) or edge.get(end) not in node_ids:
+                result.add(
+                    "dangling_edge",
+                    f"{edge_path}/{end}",
+                    f"Edge {end} '{edge.get(end)}' does not reference an existing node"
+                )
+        edges.append(edge)
+
+    # The flow is only meaningful once every node and edge checks out
+    if not any(issue.code in GRAPH_ISSUE_CODES for issue in result.issues[issue_count:]):
+        _validate_flow(definition, nodes, edges, result)
+
+
+def _agent_prompt(node: Dict[str, Any]) -> str:
+    """Get an agent node's prompt; templates call it system_prompt."""
+    data = node.get("data")
+    if not isinstance(data, dict):
+        return ""
+    prompt = data.get("prompt") or data.get("system_prompt")
+    return prompt.strip() if isinstance(prompt, str) else ""
+
+
+def _validate_flow(
+    definition: Dict[str, Any],
+    nodes: List[Dict[str, Any]],
+    edges: List[Dict[str, Any]],
+    result: ValidationResult
+) -> None:
+    """
+    Check the workflow has exactly one entry and that an end node is reachable from it.
+
+    Agent graphs name their entry node with entryPoint and need no end node;
+    otherwise the entry is the single start node and some end node must be
+    reachable from it.
+    """
+    nodes_path = f"{DEFINITION_FILE_PATH}#/nodes"
+    if "entryPoint" in definition:
+        entry_point = definition["entryPoint"]
+        if not isinstance(entry_point, str) or entry_point not in {node["id"] for node in nodes}:
+            result.add(
+                "invalid_entry_point",
+                f"{DEFINITION_FILE_PATH}#/entryPoint",
+                f"Entry point '{definition['entryPoint']}' does not reference an existing node"
+            )
+        return
+
+    starts = [index for index, node in enumerate(nodes) if node.get("type") == "start"]
+    if not starts:
+        result.add("missing_start_node", nodes_path, "Workflow has no start node")
+        return
+    if len(starts) > 1:
+        for index in starts[1:]:
+            result.add("multiple_start_nodes", f"{nodes_path}/{index}", "Workflow has more than one start node")
+        return
+
+    ends = {node["id"] for node in nodes if node.get("type") == "end"}
+    if not ends:
+        result.add("missing_end_node", nodes_path, "Workflow has no end node")
+        return
+
+    successors: Dict[str, List[str]] = {}
+    for edge in edges:
+        successors.setdefault(edge["source"], []).append(edge["target"])
+    reached = {nodes[starts[0]]["id"]}
+    pending = list(reached)
+    while pending:
+        for target in successors.get(pending.pop(), []):
+            if target not in reached:
+                reached.add(target)
+                pending.append(target)
+    if not reached & ends:
+        result.add("unreachable_end_node", nodes_path, "No end node is reachable from the start node")
@@ -0,0 +1,60 @@
+"""
+Refinement stream events, as sent to clients over WebSocket and SSE.
+
+Both transports carry the same StreamEvent JSON, encoded by to_json, so a
+client parses events identically whichever transport it uses: the
+WebSocket proxy sends it as a text frame, the SSE stream as a data line.
+"""
+
+import json
+from dataclasses import dataclass, field
+from typing import Any, Dict, Optional
+
+
+@dataclass
+class StreamEvent:
+    """
+    One event of a refinement stream.
+
+    Events from deepagents-runtime keep their event_type and data; seq is
+    the stored sequence of on_state_update events, and replayed marks
+    state updates re-sent from storage to a reconnecting client.
+    """
+    event_type: str
+    data: Any = field(default_factory=dict)
+    seq: Optional[int] = None
+    replayed: bool = False
+
+    @classmethod
+    def from_message(cls, message: str) -> "StreamEvent":
+        """
+        Parse a deepagents-runtime stream message.
+
+        Raises:
+            ValueError: If the message is not a JSON object with an event_type
+        """
+        event = json.loads(message)
+        if not isinstance(event, dict) or not isinstance(event.get("event_type"), str):
+            raise ValueError("Stream message is not an event object")
+        return cls(event_type=event["event_type"], data=event.get("data", {}))
+
+    @classmethod
+    def error(cls, message: str, reason: Optional[str] = None) -> "StreamEvent":
+        """Error event telling the client why its stream failed or ended early."""
+        data: Dict[str, Any] = {"error": message}
+        if reason:
+            data["reason"] = reason
+        return cls(event_type="error", data=data)
+
+    def to_dict(self) -> Dict[str, Any]:
+        """The event as sent to clients; seq and replayed only appear when set."""
+        event = {"event_type": self.event_type, "data": self.data}
+        if self.seq is not None:
+            event["seq"] = self.seq
+        if self.replayed:
+            event["replayed"] = True
+        return event
+
+    def to_json(self) -> str:
+        """Encode the event compactly; every transport sends exactly these bytes."""
+        return json.dumps(self.to_dict(), separators=(",", ":"), ensure_ascii=False)
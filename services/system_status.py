@@ -0,0 +1,105 @@
+"""
+Aggregated system status for status pages.
+
+Unlike the Kubernetes /health (liveness) and /ready (readiness) probes,
+which only say whether this process is alive and can reach its database
+and whether its circuit breaker is open, the status combines the database, deepagents-runtime
+and its circuit breaker, plus the build version, into one answer. Checks
+are cached for a few seconds so a busy status page cannot load the backends.
+"""
+
+import asyncio
+import os
+import time
+from datetime import datetime, timezone
+from typing import Any, Callable, Dict, Optional
+
+import psycopg
+
+from .deepagents_client import DeepAgentsRuntimeClient
+
+DEFAULT_STATUS_CACHE_SECONDS = 5
+
+
+class SystemStatusService:
+    """Check the system's dependencies and serve the result from a short-lived cache."""
+    
+    def __init__(
+        self,
+        database_url: str,
+        deepagents_client: DeepAgentsRuntimeClient,
+        cache_seconds: Optional[float] = None,
+        clock: Callable[[], float] = time.monotonic
+    ):
+        self.database_url = database_url
+        self.deepagents_client = deepagents_client
+        if cache_seconds is None:
+            cache_seconds = float(os.getenv("SYSTEM_STATUS_CACHE_SECONDS", str(DEFAULT_STATUS_CACHE_SECONDS)))
+        self.cache_seconds = cache_seconds
+        self._clock = clock
+        self._cached: Optional[Dict[str, Any]] = None
+        self._expires_at = 0.0
+        self._lock = asyncio.Lock()
+    
+    async def get_status(self) -> Dict[str, Any]:
+        """
+        Get the aggregated system status.
+        
+        Returns:
+            Dictionary with overall "status" ("ok" or "degraded"), the build
+            "version", per-dependency "checks" and when they ran ("checked_at")
+        """
+        # Concurrent requests on an expired cache share a single round of checks
+        async with self._lock:
+            if self._cached is not None and self._clock() < self._expires_at:
+                return self._cached
+            
+            database_healthy = await asyncio.to_thread(self._check_database)
+            runtime_healthy = await self.deepagents_client.check_health()
+            breaker_state = self.deepagents_client.breaker_state()
+            
+            healthy = database_healthy and runtime_healthy and breaker_state == "closed"
+            self._cached = {
+                "status": "ok" if healthy else "degraded",
+                "version": os.getenv("BUILD_VERSION", "unknown"),
+                "checks": {
+                    "database": {"healthy": database_healthy},
+                    "deepagents_runtime": {"healthy": runtime_healthy, "circuit_breaker": breaker_state},
+                },
+                "checked_at": datetime.now(timezone.utc),
+            }
+            self._expires_at = self._clock() + self.cache_seconds
+            return self._cached
+    
+    async def check_ready(self) -> Dict[str, Any]:
+        """
+        Check whether this instance can serve traffic, for the /ready probe.
+        
+        The database must be reachable and the deepagents-runtime circuit
+        breaker must not be open. The runtime itself is not probed: the
+        breaker already knows whether this instance's calls are failing. An
+        open breaker turns half-open once its reset timeout passes, so the
+        instance takes traffic again to try the runtime. Not cached, so the
+        probe sees a database outage on its next run.
+        
+        Returns:
+            Dictionary with "ready" and per-dependency "checks"
+        """
+        database_healthy = await asyncio.to_thread(self._check_database)
+        breaker_state = self.deepagents_client.breaker_state()
+        return {
+            "ready": database_healthy and breaker_state != "open",
+            "checks": {
+                "database": {"healthy": database_healthy},
+                "deepagents_runtime": {"circuit_breaker": breaker_state},
+            },
+        }
+    
+    def _check_database(self) -> bool:
+        """Run a trivial query against the database."""
+        try:
+            with psycopg.connect(self.database_url, connect_timeout=3) as conn:
+                conn.execute("SELECT 1")
+            return True
+        except Exception:
+            return False
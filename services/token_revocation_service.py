@@ -0,0 +1,87 @@
+"""
+Token revocation service.
+
+JWTs are validated without a database round trip, so a token stays usable
+until it expires. Logging out records the token's jti in a denylist that
+auth consults after signature validation. Rows are only needed until the
+token's own expiry and are pruned after that.
+
+Logging out and changing the password also move the user's token cutoff,
+so every token issued to the user before then is refused as well, including
+ones minted by /refresh. JWT iat has whole-second precision, so the cutoff
+is truncated to the second: a token issued right after it is never refused,
+while one issued earlier in that same second still passes.
+"""
+
+from datetime import datetime, timezone
+from typing import Any, Dict
+
+from core.database import connect
+
+
+class TokenRevocationService:
+    """Service for the revoked token denylist."""
+    
+    def __init__(self, database_url: str):
+        self.database_url = database_url
+    
+    def revoke_token(self, jti: str, expires_at: datetime) -> None:
+        """
+        Revoke a token until its expiry, pruning rows of tokens that have expired.
+        
+        Args:
+            jti: JWT ID claim of the token
+            expires_at: Token expiry; the denylist row is kept until then
+        """
+        with connect(self.database_url) as conn:
+            with conn.cursor() as cur:
+                cur.execute(
+                    """
+                    INSERT INTO revoked_tokens (jti, expires_at)
+                    VALUES (%s, %s)
+                    ON CONFLICT (jti) DO NOTHING
+                    """,
+                    (jti, expires_at)
+                )
+                cur.execute("DELETE FROM revoked_tokens WHERE expires_at < NOW()")
+                conn.commit()
+    
+    def revoke_user_tokens(self, user_id: str) -> None:
+        """
+        Revoke every token issued to a user until now.
+        
+        Args:
+            user_id: User whose tokens are refused from now on
+        """
+        with connect(self.database_url) as conn:
+            with conn.cursor() as cur:
+                self.move_token_cutoff(cur, user_id)
+                conn.commit()
+    
+    @staticmethod
+    def move_token_cutoff(cur, user_id: str) -> None:
+        """
+        Refuse the user's tokens issued before now, within the caller's transaction.
+        
+        Args:
+            cur: Open database cursor
+            user_id: User whose earlier tokens are refused
+        """
+        cutoff = datetime.now(timezone.utc).replace(microsecond=0)
+        cur.execute("UPDATE users SET tokens_valid_after = %s WHERE id = %s", (cutoff, user_id))
+    
+    def is_revoked(self, claims: Dict[str, Any]) -> bool:
+        """Check whether a validated token's jti is on the denylist or it predates its user's cutoff."""
+        with connect(self.database_url) as conn:
+            with conn.cursor() as cur:
+                cur.execute(
+                    """
+                    SELECT EXISTS (SELECT 1 FROM revoked_tokens WHERE jti = %s)
+                        OR EXISTS (
+                            SELECT 1 FROM users
+                            WHERE id = %s AND tokens_valid_after > to_timestamp(%s)
+                        )
+                    """,
+                    (claims.get("jti"), claims["user_id"], claims["iat"])
+                )
+                return cur.fetchone()[0]
@@ -0,0 +1,207 @@
+"""User service for account lookups and credential checks."""
+
+from typing import Optional, Dict, Any
+import bcrypt
+from psycopg import errors
+from psycopg.rows import dict_row
+
+from core.database import connect
+from .errors import UserNotFoundError
+from .token_revocation_service import TokenRevocationService
+
+# Work factor for password hashes, shared with scripts/seed_user.py
+BCRYPT_COST = 12
+
+# Password policy, shared with scripts/seed_user.py
+MIN_PASSWORD_LENGTH = 8
+
+# bcrypt only hashes the first 72 bytes of a password and refuses longer ones
+MAX_PASSWORD_BYTES = 72
+
+
+class WeakPasswordError(ValueError):
+    """Raised when a new password does not meet the password policy."""
+
+
+class IncorrectPasswordError(ValueError):
+    """Raised when the current password given for a password change is wrong."""
+
+
+def validate_password_strength(password: str) -> None:
+    """
+    Enforce the password policy: at least 8 characters, one letter and one number,
+    and no more than 72 bytes once UTF-8 encoded.
+    
+    Raises:
+        WeakPasswordError: If the password is too weak or too long to hash
+    """
+    if len(password) < MIN_PASSWORD_LENGTH:
+        raise WeakPasswordError(f"Password must be at least {MIN_PASSWORD_LENGTH} characters")
+    if len(password.encode("utf-8")) > MAX_PASSWORD_BYTES:
+        raise WeakPasswordError(f"Password must be at most {MAX_PASSWORD_BYTES} bytes")
+    if not any(c.isalpha() for c in password) or not any(c.isdigit() for c in password):
+        raise WeakPasswordError("Password must contain at least one letter and one number")
+
+
+def hash_password(password: str) -> str:
+    """Hash a password with bcrypt at BCRYPT_COST."""
+    return bcrypt.hashpw(password.encode("utf-8"), bcrypt.gensalt(rounds=BCRYPT_COST)).decode("utf-8")
+
+
+class DuplicateEmailError(ValueError):
+    """Raised when an account with the same email (case-insensitively) already exists."""
+    
+    def __init__(self, email: str):
+        super().__init__(f"User with email '{email}' already exists")
+        self.email = email
+
+
+class UserService:
+    """Service for user database operations."""
+    
+    def __init__(self, database_url: str):
+        self.database_url = database_url
+    
+    def get_user(self, user_id: str) -> Optional[Dict[str, Any]]:
+        """Get a user by ID (without the password hash)."""
+        with connect(self.database_url, row_factory=dict_row) as conn:
+            with conn.cursor() as cur:
+                cur.execute(
+                    """
+                    SELECT id, name, email, created_at, updated_at
+                    FROM users
+                    WHERE id = %s
+                    """,
+                    (user_id,)
+                )
+                result = cur.fetchone()
+                if result:
+                    result = dict(result)
+                    result["id"] = str(result["id"])
+                return result
+    
+    def create_user(self, name: str, email: str, password: str) -> Dict[str, Any]:
+        """
+        Create a user with a bcrypt-hashed password.
+        
+        Args:
+            name: Display name
+            email: User email (unique, case-insensitively)
+            password: Plain text password
+            
+        Returns:
+            Created user dictionary (without the password hash)
+            
+        Raises:
+            DuplicateEmailError: If the email is already registered
+        """
+        hashed_password = hash_password(password)
+        
+        try:
+            with connect(self.database_url, row_factory=dict_row) as conn:
+                with conn.cursor() as cur:
+                    cur.execute(
+                        """
+                        INSERT INTO users (name, email, hashed_password)
+                        VALUES (%s, %s, %s)
+                        RETURNING id, name, email, created_at, updated_at
+                        """,
+                        (name, email, hashed_password)
+                    )
+                    user = dict(cur.fetchone())
+                    conn.commit()
+        except errors.UniqueViolation:
+            # SQLSTATE 23505 from either the email column or the LOWER(email) index
+            raise DuplicateEmailError(email)
+        
+        user["id"] = str(user["id"])
+        return user
+    
+    def authenticate(self, email: str, password: str) -> Optional[Dict[str, Any]]:
+        """
+        Verify an email/password pair.
+        
+        Args:
+            email: User email (matched case-insensitively)
+            password: Plain text password
+            
+        Returns:
+            User dictionary (without the password hash) or None if the
+            credentials are invalid
+        """
+        with connect(self.database_url, row_factory=dict_row) as conn:
+            with conn.cursor() as cur:
+                cur.execute(
+                    """
+                    SELECT id, name, email, hashed_password, created_at, updated_at
+                    FROM users
+                    WHERE LOWER(email) = LOWER(%s)
+                    """,
+                    (email,)
+                )
+                user = cur.fetchone()
+        
+        if not user or not self._check_password(password, user["hashed_password"]):
+            return None
+        
+        user = dict(user)
+        del user["hashed_password"]
+        user["id"] = str(user["id"])
+        return user
+    
+    def change_password(self, user_id: str, current_password: str, new_password: str) -> None:
+        """
+        Replace a user's password after verifying the current one.
+        
+        Every token issued to the user before the change is revoked, so other
+        sessions have to log in again with the new password. Blocks on bcrypt
+        for a while, so call it from a worker thread.
+        
+        Args:
+            user_id: User ID
+            current_password: Plain text current password
+            new_password: Plain text new password
+            
+        Raises:
+            UserNotFoundError: If the user is not found
+            IncorrectPasswordError: If the current password is wrong
+            WeakPasswordError: If the new password does not meet the policy
+        """
+        # bcrypt is slow on purpose, so both hashes are computed before the row is locked
+        with connect(self.database_url, row_factory=dict_row) as conn:
+            with conn.cursor() as cur:
+                cur.execute("SELECT hashed_password FROM users WHERE id = %s", (user_id,))
+                user = cur.fetchone()
+        if not user:
+            raise UserNotFoundError("User not found")
+        
+        if not self._check_password(current_password, user["hashed_password"]):
+            raise IncorrectPasswordError("Current password is incorrect")
+        
+        validate_password_strength(new_password)
+        new_hashed_password = hash_password(new_password)
+        
+        with connect(self.database_url, row_factory=dict_row) as conn:
+            with conn.transaction():
+                with conn.cursor() as cur:
+                    # Only replace the hash that was verified; a concurrent change wins
+                    cur.execute(
+                        """
+                        UPDATE users SET hashed_password = %s
+                        WHERE id = %s AND hashed_password = %s
+                        RETURNING id
+                        """,
+                        (new_hashed_password, user_id, user["hashed_password"])
+                    )
+                    if not cur.fetchone():
+                        raise IncorrectPasswordError("Current password is incorrect")
+                    TokenRevocationService.move_token_cutoff(cur, user_id)
+    
+    @staticmethod
+    def _check_password(password: str, hashed_password: str) -> bool:
+        """Compare a plain text password against a bcrypt hash."""
+        try:
+            return bcrypt.checkpw(password.encode("utf-8"), hashed_password.encode("utf-8"))
+        except ValueError:
+            # Stored value is not a bcrypt hash
+            return False
@@ -0,0 +1,29 @@
+"""
+Workflow access levels shared by the workflow and draft services.
+
+The creator of a workflow is always its owner; other users get access
+through rows in workflow_access. The SQL below resolves a user's access
+type for the workflow aliased as "w" and takes the user ID twice.
+"""
+
+# Access types, from most to least privileged
+WORKFLOW_ACCESS_TYPES = ("owner", "editor", "viewer")
+
+# Access types an owner can grant to other users
+SHAREABLE_ACCESS_TYPES = ("editor", "viewer")
+
+# Access types allowed to refine, publish, deploy and discard drafts
+WRITE_ACCESS_TYPES = ("owner", "editor")
+
+ACCESS_TYPE_SQL = """
+    CASE WHEN w.created_by_user_id = %s THEN 'owner'
+    ELSE (SELECT wa.access_type FROM workflow_access wa WHERE wa.workflow_id = w.id AND wa.user_id = %s)
+    END
+"""
+
+WRITE_ACCESS_SQL = f"({ACCESS_TYPE_SQL}) IN ('owner', 'editor')"
+
+
+def can_write(access_type: str) -> bool:
+    """Check whether an access type allows changing the workflow."""
+    return access_type in WRITE_ACCESS_TYPES
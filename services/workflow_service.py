@@ -1,45 +1,199 @@
 """Workflow service for database operations."""
 
+import json
+import os
 import uuid
 from datetime import datetime
-from typing import Optional, List, Dict, Any
-import psycopg
+from typing import Optional, List, Dict, Any, Tuple
+from opentelemetry import trace
 from psycopg.rows import dict_row
 
+from core.database import connect
+from .audit_service import AuditService
+from .cleanup_job_service import CleanupJobService
+from .errors import (
+    AccessDeniedError,
+    ConflictError,
+    GoneError,
+    InvalidTransitionError,
+    NotFoundError,
+    UserNotFoundError,
+    VersionNotFoundError,
+    WorkflowNotFoundError,
+)
+from .event_store import EventStore
+from .outbox_service import OutboxService
+from .proposal_service import ProposalService, validate_proposal_transition
+from .rows import json_row
+from .production_cache import ProductionVersionCache, production_version_cache
+from .spec_validator import JSON_LINT_MODES, InvalidSpecificationError, lint_json_files, validate_specification
+from .workflow_access import ACCESS_TYPE_SQL, SHAREABLE_ACCESS_TYPES, WRITE_ACCESS_SQL
+
+tracer = trace.get_tracer(__name__)
+
+DEFAULT_RESTORE_GRACE_DAYS = 30
+
+# Files declared as JSON that do not parse are reported, but still published
+DEFAULT_PUBLISH_JSON_LINT = "warn"
+
+# Upper bounds on user-supplied workflow fields
+MAX_WORKFLOW_NAME_LENGTH = 200
+MAX_WORKFLOW_DESCRIPTION_LENGTH = 2000
+
+
+class WorkflowValidationError(ValueError):
+    """Raised when workflow fields are out of bounds; fields maps each field to its problem."""
+    
+    def __init__(self, fields: Dict[str, str]):
+        super().__init__("Invalid workflow fields")
+        self.fields = fields
+
+
+def validate_workflow_fields(name: Optional[str], description: Optional[str]) -> None:
+    """
+    Check workflow name and description lengths.
+    
+    Raises:
+        WorkflowValidationError: If any field exceeds its limit
+    """
+    fields = {}
+    if name is not None and len(name) > MAX_WORKFLOW_NAME_LENGTH:
+        fields["name"] = f"must be at most {MAX_WORKFLOW_NAME_LENGTH} characters"
+    if description is not None and len(description) > MAX_WORKFLOW_DESCRIPTION_LENGTH:
+        fields["description"] = f"must be at most {MAX_WORKFLOW_DESCRIPTION_LENGTH} characters"
+    if fields:
+        raise WorkflowValidationError(fields)
+
 
 class WorkflowService:
     """Service for workflow database operations."""
     
-    def __init__(self, database_url: str):
+    def __init__(
+        self,
+        database_url: str,
+        restore_grace_days: Optional[int] = None,
+        production_cache: Optional[ProductionVersionCache] = None,
+        publish_json_lint: Optional[str] = None
+    ):
         self.database_url = database_url
+        self.production_cache = production_cache or production_version_cache
+        if restore_grace_days is None:
+            restore_grace_days = int(os.getenv("WORKFLOW_RESTORE_GRACE_DAYS", str(DEFAULT_RESTORE_GRACE_DAYS)))
+        self.restore_grace_days = restore_grace_days
+        if publish_json_lint is None:
+            publish_json_lint = os.getenv("PUBLISH_JSON_LINT", DEFAULT_PUBLISH_JSON_LINT).lower()
+        if publish_json_lint not in JSON_LINT_MODES:
+            raise ValueError(f"PUBLISH_JSON_LINT must be one of {', '.join(JSON_LINT_MODES)}")
+        self.publish_json_lint = publish_json_lint
     
-    def create_workflow(self, name: str, user_id: str, description: Optional[str] = None) -> dict:
-        """Create a new workflow in the database."""
-        workflow_id = str(uuid.uuid4())
-        now = datetime.utcnow()
+    def create_workflow(
+        self,
+        name: str,
+        user_id: str,
+        description: Optional[str] = None,
+        draft_files: Optional[Dict[str, Dict[str, Any]]] = None
+    ) -> dict:
+        """
+        Create a new workflow in the database.
         
-        with psycopg.connect(self.database_url, row_factory=dict_row) as conn:
+        When draft_files are given (a starter template), the workflow's draft
+        is created with them in the same transaction.
+        """
+        with tracer.start_as_current_span("create_workflow") as span:
+            validate_workflow_fields(name, description)
+            
+            workflow_id = str(uuid.uuid4())
+            span.set_attribute("workflow_id", workflow_id)
+            now = datetime.utcnow()
+            
+            with connect(self.database_url, row_factory=dict_row) as conn:
+                with conn.cursor() as cur:
+                    # Check for workflow locking - prevent creation if user has locked workflows
+                    cur.execute(
+                        "SELECT COUNT(*) as count FROM workflows WHERE created_by_user_id = %s AND is_locked = true AND deleted_at IS NULL",
+                        (user_id,)
+                    )
+                    locked_count = cur.fetchone()["count"]
+                    
+                    if locked_count > 0:
+                        raise ValueError("Cannot create workflow: user has locked workflows")
+                    
+                    cur.execute(
+                        """
+                        INSERT INTO workflows (id, name, description, created_by_user_id, created_at, updated_at)
+                        VALUES (%s, %s, %s, %s, %s, %s)
+                        RETURNING id, name, description, created_by_user_id, created_at, updated_at
+                        """,
+                        (workflow_id, name, description, user_id, now, now)
+                    )
+                    result = cur.fetchone()
+                    cur.execute(
+                        "INSERT INTO workflow_access (workflow_id, user_id, access_type) VALUES (%s, %s, 'owner')",
+                        (workflow_id, user_id)
+                    )
+                    EventStore.append_event(
+                        cur, workflow_id, "workflow.created", {"name": name, "created_by_user_id": user_id}
+                    )
+                    if draft_files:
+                        self._create_seeded_draft(cur, workflow_id, name, user_id, draft_files, now)
+                    conn.commit()
+                    # Convert UUID objects to strings for JSON serialization
+                    if result:
+                        result = dict(result, access_type="owner")
+                        for key, value in result.items():
+                            if hasattr(value, 'hex'):  # UUID objects have a hex attribute
+                                result[key] = str(value)
+                    return result
+    
+    @staticmethod
+    def _create_seeded_draft(
+        cur,
+        workflow_id: str,
+        name: str,
+        user_id: str,
+        draft_files: Dict[str, Dict[str, Any]],
+        now: datetime
+    ) -> None:
+        """Create a new workflow's draft with starter files using the caller's cursor."""
+        draft_id = str(uuid.uuid4())
+        cur.execute(
+            """
+            INSERT INTO drafts (id, workflow_id, name, description, created_by_user_id, created_at, updated_at)
+            VALUES (%s, %s, %s, %s, %s, %s, %s)
+            """,
+            (draft_id, workflow_id, f"Draft for {name}", "Work in progress", user_id, now, now)
+        )
+        for file_path, file_data in draft_files.items():
+            cur.execute(
+                """
+                INSERT INTO draft_specification_files
+                (id, draft_id, file_path, content, file_type, created_at, updated_at)
+                VALUES (%s, %s, %s, %s, %s, %s, %s)
+                """,
+                (str(uuid.uuid4()), draft_id, file_path, file_data["content"], file_data["type"], now, now)
+            )
+    
+    def get_workflow(self, workflow_id: str, user_id: str) -> Optional[dict]:
+        """
+        Get a workflow by ID, ensuring user has access.
+        
+        The result's access_type is the user's access level: owner, editor or viewer.
+        """
+        with connect(self.database_url, row_factory=dict_row) as conn:
             with conn.cursor() as cur:
-                # Check for workflow locking - prevent creation if user has locked workflows
                 cur.execute(
-                    "SELECT COUNT(*) as count FROM workflows WHERE created_by_user_id = %s AND is_locked = true",
-                    (user_id,)
-                )
-                locked_count = cur.fetchone()["count"]
-                
-                if locked_count > 0:
-                    raise ValueError("Cannot create workflow: user has locked workflows")
-                
-                cur.execute(
-                    """
-                    INSERT INTO workflows (id, name, description, created_by_user_id, created_at, updated_at)
-                    VALUES (%s, %s, %s, %s, %s, %s)
-                    RETURNING id, name, description, created_by_user_id, created_at, updated_at
+                    f"""
+                    SELECT * FROM (
+                        SELECT w.id, w.name, w.description, w.created_by_user_id, w.created_at,
+                               w.updated_at, w.is_locked, {ACCESS_TYPE_SQL} AS access_type
+                        FROM workflows w
+                        WHERE w.id = %s AND w.deleted_at IS NULL
+                    ) accessible
+                    WHERE access_type IS NOT NULL
                     """,
-                    (workflow_id, name, description, user_id, now, now)
+                    (user_id, user_id, workflow_id)
                 )
                 result = cur.fetchone()
-                conn.commit()
                 # Convert UUID objects to strings for JSON serialization
                 if result:
                     result = dict(result)
@@ -48,99 +202,279 @@ class WorkflowService:
                             result[key] = str(value)
                 return result
     
-    def get_workflow(self, workflow_id: str, user_id: str) -> Optional[dict]:
-        """Get a workflow by ID, ensuring user has access."""
-        with psycopg.connect(self.database_url, row_factory=dict_row) as conn:
+    def workflow_exists(self, workflow_id: str) -> bool:
+        """Check if a live workflow exists (regardless of user access)."""
+        with connect(self.database_url, row_factory=dict_row) as conn:
+            with conn.cursor() as cur:
+                cur.execute(
+                    "SELECT 1 FROM workflows WHERE id = %s AND deleted_at IS NULL",
+                    (workflow_id,)
+                )
+                return cur.fetchone() is not None
+    
+    def has_specification(self, workflow_id: str) -> bool:
+        """Check if a workflow has a spec to refine: draft files or a production version."""
+        with connect(self.database_url, row_factory=dict_row) as conn:
             with conn.cursor() as cur:
                 cur.execute(
                     """
-                    SELECT id, name, description, created_by_user_id, created_at, updated_at, is_locked
-                    FROM workflows
-                    WHERE id = %s AND created_by_user_id = %s
+                    SELECT w.production_version_id IS NOT NULL OR EXISTS (
+                        SELECT 1 FROM drafts d
+                        JOIN draft_specification_files f ON f.draft_id = d.id
+                        WHERE d.workflow_id = w.id
+                    ) AS has_specification
+                    FROM workflows w
+                    WHERE w.id = %s
                     """,
-                    (workflow_id, user_id)
+                    (workflow_id,)
                 )
                 result = cur.fetchone()
-                # Convert UUID objects to strings for JSON serialization
-                if result:
-                    result = dict(result)
-                    for key, value in result.items():
-                        if hasattr(value, 'hex'):  # UUID objects have a hex attribute
-                            result[key] = str(value)
-                return result
+                return bool(result and result["has_specification"])
     
-    def workflow_exists(self, workflow_id: str) -> bool:
-        """Check if a workflow exists (regardless of user access)."""
-        with psycopg.connect(self.database_url, row_factory=dict_row) as conn:
+    def get_versions(self, workflow_id: str, expand_publisher: bool = False) -> List[Dict[str, Any]]:
+        """
+        Get all versions for a workflow.
+        
+        With expand_publisher, each version also carries a publisher object
+        with the id, name and email of the user who published it.
+        """
+        publisher_columns = ""
+        publisher_join = ""
+        if expand_publisher:
+            publisher_columns = ", json_build_object('id', u.id, 'name', u.name, 'email', u.email) AS publisher"
+            publisher_join = "JOIN users u ON u.id = v.published_by_user_id"
+        with connect(self.database_url, row_factory=json_row) as conn:
             with conn.cursor() as cur:
                 cur.execute(
-                    "SELECT 1 FROM workflows WHERE id = %s",
+                    f"""
+                    SELECT v.id, v.version_number, v.status, v.created_at{publisher_columns}
+                    FROM versions v
+                    JOIN workflows w ON v.workflow_id = w.id
+                    {publisher_join}
+                    WHERE v.workflow_id = %s AND w.deleted_at IS NULL
+                    ORDER BY v.version_number DESC
+                    """,
                     (workflow_id,)
                 )
-                return cur.fetchone() is not None
+                return cur.fetchall()
     
-    def get_versions(self, workflow_id: str) -> List[Dict[str, Any]]:
-        """Get all versions for a workflow."""
-        with psycopg.connect(self.database_url, row_factory=dict_row) as conn:
+    def list_audit_log(self, workflow_id: str, limit: int = 100, offset: int = 0) -> Tuple[List[Dict[str, Any]], int]:
+        """
+        List the workflow's audit log as one chronological feed, oldest first.
+        
+        Merges the workflow-level audit trail (proposal lifecycle, deployments,
+        sharing, draft discards, ...) with the workflow's published versions.
+        Proposal entries are recorded when the action happens, so they outlive
+        proposals purged by retention or deleted with a discarded draft. Every
+        entry has the time it occurred, the action, the acting user (id, name
+        and email) and action-specific details.
+        
+        Args:
+            workflow_id: Workflow ID
+            limit: Maximum number of entries to return
+            offset: Number of entries to skip
+            
+        Returns:
+            Tuple of (entries, total number of entries)
+        """
+        feed_sql = """
+            WITH feed AS (
+                SELECT e.created_at AS occurred_at, e.user_id AS actor_id, e.action,
+                       e.details, 0 AS source, e.sequence AS position
+                FROM workflow_audit_events e
+                WHERE e.workflow_id = %(workflow_id)s
+                UNION ALL
+                SELECT v.created_at, v.published_by_user_id, 'version_published',
+                       jsonb_build_object('version_number', v.version_number), 1, v.version_number
+                FROM versions v
+                WHERE v.workflow_id = %(workflow_id)s
+            )
+        """
+        with connect(self.database_url, row_factory=json_row) as conn:
             with conn.cursor() as cur:
                 cur.execute(
-                    """
-                    SELECT id, version_number, status, created_at
-                    FROM versions
-                    WHERE workflow_id = %s
-                    ORDER BY version_number DESC
+                    f"{feed_sql} SELECT COUNT(*) AS total FROM feed",
+                    {"workflow_id": workflow_id}
+                )
+                total = cur.fetchone()["total"]
+                
+                cur.execute(
+                    f"""
+                    {feed_sql}
+                    SELECT f.occurred_at, f.action,
+                           CASE WHEN u.id IS NULL THEN NULL
+                                ELSE json_build_object('id', u.id, 'name', u.name, 'email', u.email)
+                           END AS actor,
+                           f.details
+                    FROM feed f
+                    LEFT JOIN users u ON u.id = f.actor_id
+                    ORDER BY f.occurred_at, f.source, f.position
+                    LIMIT %(limit)s OFFSET %(offset)s
                     """,
-                    (workflow_id,)
+                    {"workflow_id": workflow_id, "limit": limit, "offset": offset}
                 )
-                results = cur.fetchall()
-                versions = []
-                for result in results:
-                    version = dict(result)
-                    for key, value in version.items():
-                        if hasattr(value, 'hex'):
-                            version[key] = str(value)
-                    versions.append(version)
-                return versions
+                return cur.fetchall(), total
     
     def get_version(self, workflow_id: str, version_number: int) -> Optional[Dict[str, Any]]:
-        """Get a specific version of a workflow."""
-        with psycopg.connect(self.database_url, row_factory=dict_row) as conn:
+        """Get a specific version of a workflow together with its specification files."""
+        return self._fetch_version(
+            "workflow_id = %s AND version_number = %s", (workflow_id, version_number)
+        )
+    
+    def get_latest_version(self, workflow_id: str) -> Optional[Dict[str, Any]]:
+        """
+        Get the highest-numbered version of a workflow together with its specification files.
+        
+        This is the most recent publish, whether or not it is deployed.
+        """
+        return self._fetch_version(
+            """
+            id = (
+                SELECT id FROM versions WHERE workflow_id = %s
+                ORDER BY version_number DESC LIMIT 1
+            )
+            """,
+            (workflow_id,)
+        )
+    
+    def get_version_files(
+        self,
+        workflow_id: str,
+        version_number: int,
+        include_contents: bool = True
+    ) -> Optional[Dict[str, Dict[str, Any]]]:
+        """
+        Get a version's specification files keyed by path.
+        
+        Every file has its type and size in bytes; contents are only read
+        when include_contents is set, so large specs can be browsed cheaply.
+        
+        Args:
+            workflow_id: Workflow ID
+            version_number: Version number
+            include_contents: Whether to include each file's content
+            
+        Returns:
+            Dictionary of file paths to file data, or None if the version does not exist
+        """
+        content_column = ", f.content" if include_contents else ""
+        with connect(self.database_url, row_factory=dict_row) as conn:
             with conn.cursor() as cur:
                 cur.execute(
-                    """
-                    SELECT id, version_number, status, specification, created_at
-                    FROM versions
-                    WHERE workflow_id = %s AND version_number = %s
+                    f"""
+                    SELECT f.file_path, f.file_type, OCTET_LENGTH(f.content) AS size{content_column}
+                    FROM versions v
+                    LEFT JOIN specification_files f ON f.version_id = v.id
+                    WHERE v.workflow_id = %s AND v.version_number = %s
+                    ORDER BY f.file_path
                     """,
                     (workflow_id, version_number)
                 )
+                rows = cur.fetchall()
+        if not rows:
+            return None
+        
+        files = {}
+        for row in rows:
+            # A version without files still yields its row from the outer join
+            if row["file_path"] is None:
+                continue
+            files[row["file_path"]] = {"type": row["file_type"], "size": row["size"]}
+            if include_contents:
+                files[row["file_path"]]["content"] = row["content"]
+        return files
+    
+    def get_production_version(self, workflow_id: str) -> Optional[Dict[str, Any]]:
+        """Get the deployed version of a workflow together with its specification files."""
+        version_id = self.production_cache.get_or_load(
+            workflow_id, lambda: self._load_production_version_id(workflow_id)
+        )
+        if not version_id:
+            return None
+        return self._fetch_version("id = %s", (version_id,))
+    
+    def _load_production_version_id(self, workflow_id: str) -> Optional[str]:
+        """Read a workflow's production version pointer from the database."""
+        with connect(self.database_url, row_factory=dict_row) as conn:
+            with conn.cursor() as cur:
+                cur.execute(
+                    "SELECT production_version_id FROM workflows WHERE id = %s",
+                    (workflow_id,)
+                )
                 result = cur.fetchone()
-                if result:
-                    version = dict(result)
-                    for key, value in version.items():
-                        if hasattr(value, 'hex'):
-                            version[key] = str(value)
-                    return version
-                return None
+                if not result or not result["production_version_id"]:
+                    return None
+                return str(result["production_version_id"])
+    
+    def _fetch_version(self, condition: str, params: tuple) -> Optional[Dict[str, Any]]:
+        """Load the version matching a fixed WHERE condition, with its files keyed by path."""
+        with connect(self.database_url, row_factory=dict_row) as conn:
+            with conn.cursor() as cur:
+                cur.execute(
+                    f"""
+                    SELECT id, version_number, status, published_by_user_id, created_at, deployed_at
+                    FROM versions
+                    WHERE {condition}
+                    """,
+                    params
+                )
+                result = cur.fetchone()
+                if not result:
+                    return None
+                
+                version = dict(result)
+                for key, value in version.items():
+                    if hasattr(value, 'hex'):
+                        version[key] = str(value)
+                
+                cur.execute(
+                    """
+                    SELECT file_path, content, file_type
+                    FROM specification_files
+                    WHERE version_id = %s
+                    ORDER BY file_path
+                    """,
+                    (version["id"],)
+                )
+                version["files"] = {
+                    row["file_path"]: {"content": row["content"], "type": row["file_type"]}
+                    for row in cur.fetchall()
+                }
+                return version
     
     def publish_draft(self, workflow_id: str, user_id: str) -> Dict[str, Any]:
-        """Publish draft as a new version with row-level locking."""
-        with psycopg.connect(self.database_url, row_factory=dict_row) as conn:
+        """
+        Publish draft as a new version with row-level locking.
+        
+        Files declared as JSON are linted according to publish_json_lint:
+        with "warn" the ones that do not parse are returned as warnings, with
+        "error" they make the specification invalid, and "off" skips the lint.
+        
+        Returns:
+            Dictionary with the new version's id and version_number, and the
+            lint issues of the published files as warnings
+            
+        Raises:
+            WorkflowNotFoundError: If the workflow is not found or not writable
+            InvalidSpecificationError: If the specification is invalid
+            ValueError: If the workflow is locked or has no draft
+        """
+        with connect(self.database_url, row_factory=dict_row) as conn:
             with conn.transaction():
                 with conn.cursor() as cur:
                     # Lock the workflow to prevent concurrent modifications
                     cur.execute(
-                        """
-                        SELECT id, is_locked FROM workflows 
-                        WHERE id = %s AND created_by_user_id = %s 
+                        f"""
+                        SELECT w.id, w.is_locked FROM workflows w
+                        WHERE w.id = %s AND w.deleted_at IS NULL AND {WRITE_ACCESS_SQL}
                         FOR UPDATE
                         """,
-                        (workflow_id, user_id)
+                        (workflow_id, user_id, user_id)
                     )
                     workflow = cur.fetchone()
                     
                     if not workflow:
-                        raise ValueError("Workflow not found or access denied")
+                        raise WorkflowNotFoundError("Workflow not found or access denied")
                     
                     if workflow["is_locked"]:
                         raise ValueError("Workflow is locked by another operation")
@@ -155,6 +489,26 @@ class WorkflowService:
                     if not draft:
                         raise ValueError("No draft found to publish")
                     
+                    # Refuse to publish a structurally invalid specification
+                    cur.execute(
+                        "SELECT file_path, content, file_type FROM draft_specification_files WHERE draft_id = %s",
+                        (draft["id"],)
+                    )
+                    files = {
+                        row["file_path"]: {"content": row["content"], "type": row["file_type"]}
+                        for row in cur.fetchall()
+                    }
+                    validation = validate_specification(files)
+                    warnings = []
+                    if self.publish_json_lint != "off":
+                        lint = lint_json_files(files)
+                        if self.publish_json_lint == "error":
+                            validation.issues.extend(lint.issues)
+                        else:
+                            warnings = lint.issues
+                    if not validation.valid:
+                        raise InvalidSpecificationError(validation)
+                    
                     # Get next version number
                     cur.execute(
                         """
@@ -172,11 +526,11 @@ class WorkflowService:
                     cur.execute(
                         """
                         INSERT INTO versions 
-                        (id, workflow_id, version_number, status, created_at)
-                        VALUES (%s, %s, %s, %s, %s)
+                        (id, workflow_id, version_number, status, published_by_user_id, created_at)
+                        VALUES (%s, %s, %s, %s, %s, %s)
                         RETURNING id, version_number
                         """,
-                        (version_id, workflow_id, next_version, "published", now)
+                        (version_id, workflow_id, next_version, "published", user_id, now)
                     )
                     version = cur.fetchone()
                     
@@ -193,78 +547,466 @@ class WorkflowService:
                     # Delete draft after successful publish
                     cur.execute("DELETE FROM drafts WHERE id = %s", (draft["id"],))
                     
+                    OutboxService.record_event(
+                        cur, "version", version_id, "version.published",
+                        {
+                            "workflow_id": workflow_id,
+                            "version_number": version["version_number"],
+                            "published_by_user_id": user_id
+                        }
+                    )
+                    EventStore.append_event(
+                        cur, workflow_id, "draft.published",
+                        {
+                            "version_id": version_id,
+                            "version_number": version["version_number"],
+                            "published_by_user_id": user_id
+                        }
+                    )
+                    
                     return {
                         "id": str(version["id"]),
-                        "version_number": version["version_number"]
+                        "version_number": version["version_number"],
+                        "warnings": warnings
                     }
     
-    def discard_draft(self, workflow_id: str, user_id: str) -> None:
-        """Discard the current draft with row-level locking."""
-        with psycopg.connect(self.database_url, row_factory=dict_row) as conn:
+    def deploy_version(self, workflow_id: str, version_number: int, user_id: str) -> Dict[str, Any]:
+        """
+        Deploy a published version by pointing the workflow's production version at it.
+        
+        The previously deployed version, if any, is demoted back to published.
+        
+        Raises:
+            WorkflowNotFoundError: If the workflow is not found or not writable
+            VersionNotFoundError: If the version is not found
+            InvalidTransitionError: If the version is already in production
+            ValueError: If the version is not published
+        """
+        with connect(self.database_url, row_factory=dict_row) as conn:
             with conn.transaction():
                 with conn.cursor() as cur:
-                    # Lock the workflow
+                    # Lock the workflow so concurrent deploys are serialized
                     cur.execute(
-                        """
-                        SELECT id FROM workflows 
-                        WHERE id = %s AND created_by_user_id = %s 
+                        f"""
+                        SELECT w.id, w.production_version_id FROM workflows w
+                        WHERE w.id = %s AND w.deleted_at IS NULL AND {WRITE_ACCESS_SQL}
                         FOR UPDATE
                         """,
-                        (workflow_id, user_id)
+                        (workflow_id, user_id, user_id)
                     )
                     workflow = cur.fetchone()
                     
                     if not workflow:
-                        raise ValueError("Workflow not found or access denied")
+                        raise WorkflowNotFoundError("Workflow not found or access denied")
                     
-                    # Delete draft
-                    cur.execute(
-                        "DELETE FROM drafts WHERE workflow_id = %s",
-                        (workflow_id,)
-                    )
-                    
-                    if cur.rowcount == 0:
-                        raise ValueError("No draft found to discard")
-    
-    def deploy_version(self, workflow_id: str, version_number: int, user_id: str) -> Dict[str, Any]:
-        """Deploy a version to production."""
-        with psycopg.connect(self.database_url, row_factory=dict_row) as conn:
-            with conn.transaction():
-                with conn.cursor() as cur:
-                    # Validate workflow access and version exists
                     cur.execute(
                         """
-                        SELECT v.id, v.status FROM versions v
-                        JOIN workflows w ON v.workflow_id = w.id
-                        WHERE w.id = %s AND w.created_by_user_id = %s AND v.version_number = %s
+                        SELECT id, status FROM versions
+                        WHERE workflow_id = %s AND version_number = %s
                         FOR UPDATE
                         """,
-                        (workflow_id, user_id, version_number)
+                        (workflow_id, version_number)
                     )
                     version = cur.fetchone()
                     
                     if not version:
-                        raise ValueError("Version not found or access denied")
+                        raise VersionNotFoundError("Version not found")
+                    
+                    if version["id"] == workflow["production_version_id"]:
+                        raise InvalidTransitionError("Version is already the production version")
                     
                     if version["status"] != "published":
                         raise ValueError("Only published versions can be deployed")
                     
-                    # Create deployment record
-                    deployment_id = str(uuid.uuid4())
                     now = datetime.utcnow()
                     
+                    # Demote the previously deployed version
+                    cur.execute(
+                        "UPDATE versions SET status = 'published' WHERE workflow_id = %s AND status = 'deployed'",
+                        (workflow_id,)
+                    )
+                    cur.execute(
+                        "UPDATE versions SET status = 'deployed', deployed_at = %s WHERE id = %s",
+                        (now, version["id"])
+                    )
+                    cur.execute(
+                        "UPDATE workflows SET production_version_id = %s WHERE id = %s",
+                        (version["id"], workflow_id)
+                    )
+                    
+                    # Record deployment history
+                    deployment_id = str(uuid.uuid4())
                     cur.execute(
                         """
                         INSERT INTO workflow_deployments 
-                        (id, version_id, status, deployed_at, created_at)
+                        (id, workflow_id, version_id, deployed_by_user_id, deployed_at)
                         VALUES (%s, %s, %s, %s, %s)
-                        RETURNING id, status
                         """,
-                        (deployment_id, version["id"], "deploying", now, now)
+                        (deployment_id, workflow_id, version["id"], user_id, now)
+                    )
+                    
+                    AuditService.record_workflow_event(
+                        cur, workflow_id, user_id, "version_deployed",
+                        {
+                            "version_number": version_number,
+                            "previous_version_id": str(workflow["production_version_id"])
+                            if workflow["production_version_id"] else None
+                        }
+                    )
+                    OutboxService.record_event(
+                        cur, "version", str(version["id"]), "version.deployed",
+                        {
+                            "workflow_id": workflow_id,
+                            "version_number": version_number,
+                            "deployment_id": deployment_id,
+                            "deployed_by_user_id": user_id
+                        }
+                    )
+                    EventStore.append_event(
+                        cur, workflow_id, "version.deployed",
+                        {
+                            "version_id": str(version["id"]),
+                            "version_number": version_number,
+                            "deployed_by_user_id": user_id
+                        }
+                    )
+                    
+                    deployment = {
+                        "id": deployment_id,
+                        "version_id": str(version["id"]),
+                        "version_number": version_number,
+                        "status": "deployed",
+                        "deployed_at": now
+                    }
+        
+        # Invalidate only once the new pointer is committed
+        self.production_cache.invalidate(workflow_id)
+        return deployment
+    
+    def delete_workflow(self, workflow_id: str, user_id: str) -> Dict[str, Any]:
+        """
+        Soft-delete a workflow, discarding its draft and closing its open proposals.
+        
+        Refinements still running are cancelled and completed proposals are
+        rejected, both through the proposal state machine. The workflow row,
+        its versions and deployment history are kept so the workflow can be
+        restored within the grace period.
+        
+        Args:
+            workflow_id: Workflow ID
+            user_id: User ID (must own the workflow)
+            
+        Returns:
+            Dictionary with deleted_at, the thread IDs of the cancelled
+            refinements (cancelled_thread_ids), which the runtime should stop,
+            and the thread IDs of all closed proposals (thread_ids), whose
+            runtime data should be cleaned up
+            
+        Raises:
+            WorkflowNotFoundError: If the workflow is not found or already deleted
+            AccessDeniedError: If the user does not own the workflow
+        """
+        with connect(self.database_url, row_factory=dict_row) as conn:
+            with conn.transaction():
+                with conn.cursor() as cur:
+                    workflow = self._lock_workflow_for_owner(cur, workflow_id, user_id)
+                    if workflow["deleted_at"] is not None:
+                        raise WorkflowNotFoundError("Workflow not found")
+                    
+                    now = datetime.utcnow()
+                    cur.execute(
+                        "UPDATE workflows SET deleted_at = %s, updated_at = %s WHERE id = %s",
+                        (now, now, workflow_id)
+                    )
+                    
+                    # Close proposals that have not been resolved yet
+                    cur.execute(
+                        """
+                        SELECT p.id, p.status, p.thread_id, p.ai_generated_content
+                        FROM proposals p
+                        JOIN drafts d ON p.draft_id = d.id
+                        WHERE d.workflow_id = %s AND p.status IN ('pending', 'processing', 'completed')
+                        FOR UPDATE OF p
+                        """,
+                        (workflow_id,)
+                    )
+                    open_proposals = cur.fetchall()
+                    cancelled = []
+                    rejected = []
+                    for proposal in open_proposals:
+                        if proposal["status"] != "completed":
+                            ProposalService.cancel_locked_proposal(
+                                cur,
+                                {
+                                    "id": str(proposal["id"]),
+                                    "workflow_id": workflow_id,
+                                    "status": proposal["status"],
+                                    "ai_generated_content": proposal["ai_generated_content"]
+                                },
+                                user_id,
+                                "workflow_deleted"
+                            )
+                            cancelled.append(proposal)
+                            continue
+                        
+                        validate_proposal_transition(proposal["status"], "resolved")
+                        audit_trail = proposal["ai_generated_content"]
+                        if isinstance(audit_trail, dict):
+                            audit_trail = json.dumps(audit_trail)
+                        cur.execute(
+                            """
+                            UPDATE proposals
+                            SET status = 'resolved', resolution = 'rejected', resolved_by_user_id = %s,
+                                resolved_at = %s, ai_generated_content = %s
+                            WHERE id = %s
+                            """,
+                            (user_id, now, AuditService.add_rejection_event(audit_trail, user_id), proposal["id"])
+                        )
+                        AuditService.record_workflow_event(
+                            cur, workflow_id, user_id, "proposal_rejected", {"proposal_id": str(proposal["id"])}
+                        )
+                        rejected.append(proposal)
+                    
+                    # Discard the open draft; resolved proposals survive with draft_id cleared
+                    cur.execute(
+                        "DELETE FROM draft_specification_files WHERE draft_id IN (SELECT id FROM drafts WHERE workflow_id = %s)",
+                        (workflow_id,)
+                    )
+                    cur.execute("DELETE FROM drafts WHERE workflow_id = %s", (workflow_id,))
+                    
+                    thread_ids = [p["thread_id"] for p in open_proposals if p["thread_id"]]
+                    CleanupJobService.enqueue(cur, thread_ids)
+                    
+                    AuditService.record_workflow_event(
+                        cur, workflow_id, user_id, "workflow_deleted",
+                        {"rejected_proposals": len(rejected), "cancelled_proposals": len(cancelled)}
                     )
-                    deployment = cur.fetchone()
                     
                     return {
-                        "id": str(deployment["id"]),
-                        "status": deployment["status"]
+                        "deleted_at": now,
+                        "cancelled_thread_ids": [p["thread_id"] for p in cancelled if p["thread_id"]],
+                        "thread_ids": thread_ids
                     }
+    
+    def restore_workflow(self, workflow_id: str, user_id: str) -> Dict[str, Any]:
+        """
+        Restore a soft-deleted workflow within the restore grace period.
+        
+        Args:
+            workflow_id: Workflow ID
+            user_id: User ID (must own the workflow)
+            
+        Returns:
+            The restored workflow
+            
+        Raises:
+            WorkflowNotFoundError: If the workflow is not found or not deleted
+            AccessDeniedError: If the user does not own the workflow
+            GoneError: If the restore grace period has expired
+        """
+        with connect(self.database_url, row_factory=dict_row) as conn:
+            with conn.transaction():
+                with conn.cursor() as cur:
+                    workflow = self._lock_workflow_for_owner(cur, workflow_id, user_id)
+                    if workflow["deleted_at"] is None:
+                        raise WorkflowNotFoundError("Deleted workflow not found")
+                    
+                    cur.execute(
+                        "SELECT deleted_at < NOW() - make_interval(days => %s) AS expired FROM workflows WHERE id = %s",
+                        (self.restore_grace_days, workflow_id)
+                    )
+                    if cur.fetchone()["expired"]:
+                        raise GoneError("Restore grace period has expired")
+                    
+                    cur.execute(
+                        """
+                        UPDATE workflows SET deleted_at = NULL, updated_at = %s WHERE id = %s
+                        RETURNING id, name, description, created_by_user_id, created_at, updated_at, is_locked
+                        """,
+                        (datetime.utcnow(), workflow_id)
+                    )
+                    result = dict(cur.fetchone())
+                    
+                    AuditService.record_workflow_event(cur, workflow_id, user_id, "workflow_restored")
+                    
+                    for key, value in result.items():
+                        if hasattr(value, 'hex'):
+                            result[key] = str(value)
+                    return result
+    
+    def share_workflow(
+        self,
+        workflow_id: str,
+        owner_id: str,
+        email: str,
+        access_type: str
+    ) -> Dict[str, Any]:
+        """
+        Grant another user access to a workflow, replacing any earlier grant.
+        
+        Args:
+            workflow_id: Workflow ID
+            owner_id: User ID (must own the workflow)
+            email: Email of the user to share with (matched case-insensitively)
+            access_type: "editor" or "viewer"
+            
+        Returns:
+            Dictionary with the grantee's user_id and email and the access_type
+            
+        Raises:
+            WorkflowNotFoundError: If the workflow is not found
+            UserNotFoundError: If no user has the email
+            AccessDeniedError: If the caller does not own the workflow
+            ValueError: If the access type is invalid or the grantee is the owner
+        """
+        if access_type not in SHAREABLE_ACCESS_TYPES:
+            raise ValueError(f"Invalid access type: {access_type}")
+        
+        with connect(self.database_url, row_factory=dict_row) as conn:
+            with conn.transaction():
+                with conn.cursor() as cur:
+                    workflow = self._lock_workflow_for_owner(cur, workflow_id, owner_id)
+                    if workflow["deleted_at"] is not None:
+                        raise WorkflowNotFoundError("Workflow not found")
+                    
+                    cur.execute("SELECT id, email FROM users WHERE LOWER(email) = LOWER(%s)", (email,))
+                    grantee = cur.fetchone()
+                    if not grantee:
+                        raise UserNotFoundError("User not found")
+                    
+                    grantee_id = str(grantee["id"])
+                    if grantee_id == owner_id:
+                        raise ValueError("Cannot change the owner's access")
+                    
+                    cur.execute(
+                        """
+                        INSERT INTO workflow_access (workflow_id, user_id, access_type, granted_by_user_id)
+                        VALUES (%s, %s, %s, %s)
+                        ON CONFLICT (workflow_id, user_id)
+                        DO UPDATE SET access_type = EXCLUDED.access_type,
+                                      granted_by_user_id = EXCLUDED.granted_by_user_id,
+                                      granted_at = NOW()
+                        """,
+                        (workflow_id, grantee_id, access_type, owner_id)
+                    )
+                    
+                    AuditService.record_workflow_event(
+                        cur, workflow_id, owner_id, "workflow_shared",
+                        {"user_id": grantee_id, "access_type": access_type}
+                    )
+                    
+                    return {"user_id": grantee_id, "email": grantee["email"], "access_type": access_type}
+    
+    def revoke_workflow_access(self, workflow_id: str, owner_id: str, user_id: str) -> None:
+        """
+        Revoke a user's shared access to a workflow.
+        
+        Args:
+            workflow_id: Workflow ID
+            owner_id: User ID (must own the workflow)
+            user_id: User whose access is revoked
+            
+        Raises:
+            WorkflowNotFoundError: If the workflow is not found
+            NotFoundError: If the user has no access grant
+            AccessDeniedError: If the caller does not own the workflow
+            ValueError: If user_id is the owner
+        """
+        with connect(self.database_url, row_factory=dict_row) as conn:
+            with conn.transaction():
+                with conn.cursor() as cur:
+                    workflow = self._lock_workflow_for_owner(cur, workflow_id, owner_id)
+                    if workflow["deleted_at"] is not None:
+                        raise WorkflowNotFoundError("Workflow not found")
+                    
+                    if user_id == str(workflow["created_by_user_id"]):
+                        raise ValueError("Cannot revoke the owner's access")
+                    
+                    cur.execute(
+                        """
+                        DELETE FROM workflow_access
+                        WHERE workflow_id = %s AND user_id = %s AND access_type <> 'owner'
+                        """,
+                        (workflow_id, user_id)
+                    )
+                    if cur.rowcount == 0:
+                        raise NotFoundError("Access grant not found")
+                    
+                    AuditService.record_workflow_event(
+                        cur, workflow_id, owner_id, "workflow_unshared", {"user_id": user_id}
+                    )
+    
+    def transfer_ownership(self, workflow_id: str, owner_id: str, new_owner_id: str) -> Dict[str, Any]:
+        """
+        Make another user the owner of a workflow.
+        
+        The previous owner keeps no access; the new owner's earlier share, if
+        any, is replaced by ownership. Proposal access follows automatically
+        because it is checked against current workflow access.
+        
+        Args:
+            workflow_id: Workflow ID
+            owner_id: User ID (must own the workflow)
+            new_owner_id: User ID of the new owner
+            
+        Returns:
+            Dictionary with previous_owner_id and new_owner_id
+            
+        Raises:
+            WorkflowNotFoundError: If the workflow is not found
+            UserNotFoundError: If the new owner is not found
+            AccessDeniedError: If the caller does not own the workflow
+            ConflictError: If the new owner already owns the workflow
+        """
+        with connect(self.database_url, row_factory=dict_row) as conn:
+            with conn.transaction():
+                with conn.cursor() as cur:
+                    workflow = self._lock_workflow_for_owner(cur, workflow_id, owner_id)
+                    if workflow["deleted_at"] is not None:
+                        raise WorkflowNotFoundError("Workflow not found")
+                    
+                    if new_owner_id == owner_id:
+                        raise ConflictError("User already owns the workflow")
+                    
+                    cur.execute("SELECT 1 FROM users WHERE id = %s", (new_owner_id,))
+                    if not cur.fetchone():
+                        raise UserNotFoundError("User not found")
+                    
+                    cur.execute(
+                        "UPDATE workflows SET created_by_user_id = %s, updated_at = %s WHERE id = %s",
+                        (new_owner_id, datetime.utcnow(), workflow_id)
+                    )
+                    cur.execute(
+                        "DELETE FROM workflow_access WHERE workflow_id = %s AND user_id IN (%s, %s)",
+                        (workflow_id, owner_id, new_owner_id)
+                    )
+                    cur.execute(
+                        """
+                        INSERT INTO workflow_access (workflow_id, user_id, access_type, granted_by_user_id)
+                        VALUES (%s, %s, 'owner', %s)
+                        """,
+                        (workflow_id, new_owner_id, owner_id)
+                    )
+                    
+                    AuditService.record_workflow_event(
+                        cur, workflow_id, owner_id, "ownership_transferred",
+                        {"previous_owner_id": owner_id, "new_owner_id": new_owner_id}
+                    )
+                    
+                    return {"previous_owner_id": owner_id, "new_owner_id": new_owner_id}
+    
+    def _lock_workflow_for_owner(self, cur, workflow_id: str, user_id: str) -> Dict[str, Any]:
+        """Lock a workflow row, including soft-deleted ones, and check ownership."""
+        cur.execute(
+            "SELECT id, created_by_user_id, deleted_at FROM workflows WHERE id = %s FOR UPDATE",
+            (workflow_id,)
+        )
+        workflow = cur.fetchone()
+        
+        if not workflow:
+            raise WorkflowNotFoundError("Workflow not found")
+        
+        if str(workflow["created_by_user_id"]) != user_id:
+            raise AccessDeniedError("Access denied to workflow")
+        
+        return workflow
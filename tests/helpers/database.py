@@ -134,6 +134,60 @@ class TestDatabase:
             # Convert UUID to string for consistent test comparisons
             return str(result["id"])
     
+    def create_test_version(
+        self,
+        workflow_id: str,
+        user_id: str,
+        version_number: int,
+        files: Dict[str, str]
+    ) -> str:
+        """
+        Create a published version with specification files and return version ID.
+        
+        Args:
+            workflow_id: Workflow ID
+            user_id: User ID who published the version
+            version_number: Version number
+            files: Dictionary of file_path -> content
+            
+        Returns:
+            Version ID (UUID string)
+        """
+        conn = self.connect()
+        with conn.cursor() as cur:
+            cur.execute(
+                """
+                INSERT INTO versions (workflow_id, version_number, status, published_by_user_id)
+                VALUES (%s, %s, %s, %s)
+                RETURNING id
+                """,
+                (workflow_id, version_number, "published", user_id)
+            )
+            version_id = cur.fetchone()["id"]
+            for file_path, content in files.items():
+                cur.execute(
+                    """
+                    INSERT INTO specification_files (version_id, file_path, content)
+                    VALUES (%s, %s, %s)
+                    """,
+                    (version_id, file_path, content)
+                )
+            conn.commit()
+            return str(version_id)
+    
+    def set_proposal_status(self, proposal_id: str, status: str) -> None:
+        """
+        Force a proposal into a status, bypassing the transition checks.
+        
+        Args:
+            proposal_id: Proposal ID
+            status: New status (e.g. completed, so the proposal can be resolved)
+        """
+        conn = self.connect()
+        with conn.cursor() as cur:
+            cur.execute("UPDATE proposals SET status = %s WHERE id = %s", (status, proposal_id))
+            conn.commit()
+    
     def get_workflow_count(self) -> int:
         """Get total number of workflows."""
         conn = self.connect()
@@ -9,11 +9,16 @@ import os
 from pathlib import Path
 
 # Import test helpers
+from core.auth import JWTManager
 from tests.helpers.database import TestDatabase
 from tests.integration.cluster_config import setup_in_cluster_environment
 from tests.mock.deepagents_mock import create_mock_server
 
 
+# Tokens minted by tests and validated by the app must share a signing secret
+os.environ.setdefault("JWT_SECRET", "integration-test-jwt-secret")
+
+
 @pytest.fixture(scope="session")
 def cluster_config():
     """Setup in-cluster environment configuration."""
@@ -34,6 +39,12 @@ def test_db():
     db.close()
 
 
+@pytest.fixture(scope="session")
+def jwt_manager():
+    """Provide a JWT manager using the same secret as the application."""
+    return JWTManager(os.environ["JWT_SECRET"])
+
+
 @pytest_asyncio.fixture(scope="function")
 async def test_client(app):
     """
@@ -11,20 +11,16 @@ from typing import Dict, Any
 
 
 @pytest.fixture
-async def test_user_token() -> tuple[str, str]:
+async def test_user_token(jwt_manager) -> tuple[str, str]:
     """
     Create authenticated test user following production authentication pattern.
     
     Returns:
         Tuple of (user_id, jwt_token)
-        
-    Note: For testing, we pass user_id as the token directly.
-    JWT generation will be replaced with SDK MockAuth in future implementation.
     """
     # Create test user with proper UUID format
     user_id = str(uuid.uuid4())
-    # For testing: pass user_id as token (will be extracted by get_current_user_id)
-    token = user_id
+    token = await jwt_manager.generate_token(user_id, f"test-{user_id}@example.com", [], 24 * 3600)
     
     return user_id, token
 
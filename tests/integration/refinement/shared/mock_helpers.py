@@ -77,6 +77,9 @@ class DeepAgentsMockServer:
         app = web.Application()
         app.router.add_post('/invoke', self._handle_invoke)
         app.router.add_get('/state/{thread_id}', self._handle_state)
+        app.router.add_get('/capabilities', self._handle_capabilities)
+        app.router.add_get('/health', self._handle_health)
+        app.router.add_post('/cancel/{thread_id}', self._handle_cancel)
         
         runner = web.AppRunner(app)
         await runner.setup()
@@ -116,6 +119,33 @@ class DeepAgentsMockServer:
             return web.json_response(self.thread_states[thread_id])
         return web.json_response({"error": "Not found"}, status=404)
     
+    async def _handle_capabilities(self, request):
+        """Handle GET /capabilities requests."""
+        return web.json_response({
+            "agents": [
+                {
+                    "type": "builder",
+                    "version": "1.0.0",
+                    "config_schema": {
+                        "type": "object",
+                        "properties": {"temperature": {"type": "number"}, "model": {"type": "string"}}
+                    }
+                }
+            ]
+        })
+    
+    async def _handle_health(self, request):
+        """Handle GET /health requests."""
+        return web.json_response({"status": "healthy"})
+    
+    async def _handle_cancel(self, request):
+        """Handle POST /cancel/{thread_id} requests."""
+        thread_id = request.match_info['thread_id']
+        if thread_id in self.thread_states:
+            self.thread_states[thread_id]["status"] = "cancelled"
+            return web.json_response({"thread_id": thread_id, "status": "cancelled"})
+        return web.json_response({"error": "Not found"}, status=404)
+    
     async def _handle_websocket(self, websocket):
         """Handle WebSocket connections using websockets library."""
         path = websocket.request.path
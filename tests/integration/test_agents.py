@@ -0,0 +1,40 @@
+"""
+Agent capability integration tests.
+"""
+
+import time
+
+import pytest
+from httpx import AsyncClient
+
+
+@pytest.mark.asyncio
+async def test_capabilities_proxied_from_runtime(
+    test_client: AsyncClient,
+    test_db,
+    jwt_manager,
+    mock_deepagents_server
+):
+    """Test the capabilities endpoint returns the agent types reported by the runtime."""
+    user_email = f"capabilities-{int(time.time() * 1000000)}@example.com"
+    user_id = test_db.create_test_user(user_email, "hashed-password")
+    token = await jwt_manager.generate_token(user_id, user_email, [], 24 * 3600)
+    
+    response = await test_client.get(
+        "/api/agents/capabilities",
+        headers={"Authorization": f"Bearer {token}"}
+    )
+    
+    assert response.status_code == 200
+    capabilities = response.json()
+    assert capabilities["available"] is True
+    assert [agent["type"] for agent in capabilities["agents"]] == ["builder"]
+    assert "temperature" in capabilities["agents"][0]["config_schema"]["properties"]
+
+
+@pytest.mark.asyncio
+async def test_capabilities_require_authentication(test_client: AsyncClient):
+    """Test the capabilities endpoint is protected."""
+    response = await test_client.get("/api/agents/capabilities")
+    
+    assert response.status_code == 401
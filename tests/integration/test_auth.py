@@ -5,8 +5,16 @@ These tests verify that the service correctly handles missing authorization
 and allows public endpoints without authentication.
 """
 
+import time
+from datetime import datetime, timezone
+
+import uuid
+
+import jwt
 import pytest
+from fastapi.testclient import TestClient
 from httpx import AsyncClient
+from starlette.websockets import WebSocketDisconnect
 
 
 @pytest.mark.asyncio
@@ -27,3 +35,294 @@ async def test_public_endpoints_no_auth_required(test_client: AsyncClient):
     assert response.status_code == 200
     data = response.json()
     assert data["status"] == "healthy"
+
+
+def test_token_issuance_requires_uuid_user_id(jwt_manager):
+    """Test tokens can only be minted for UUID user IDs."""
+    with pytest.raises(ValueError):
+        jwt_manager.create_token("test-user-1", "test@example.com", [], 3600)
+
+
+@pytest.mark.asyncio
+async def test_non_uuid_user_id_is_rejected(test_client: AsyncClient, jwt_manager):
+    """Test a token carrying a non-UUID user ID is rejected before reaching the DB."""
+    now = int(time.time())
+    forged = jwt.encode(
+        {"user_id": "test-user-1", "iss": jwt_manager.issuer, "iat": now, "exp": now + 3600},
+        jwt_manager.secret_key,
+        algorithm=jwt_manager.algorithm
+    )
+    
+    response = await test_client.post(
+        "/api/workflows",
+        json={"name": "Non-UUID Owner"},
+        headers={"Authorization": f"Bearer {forged}"}
+    )
+    
+    assert response.status_code == 401
+    assert response.json()["detail"] == "Invalid user ID"
+
+
+@pytest.mark.asyncio
+async def test_uuid_user_id_round_trips_to_database(test_client: AsyncClient, test_db, jwt_manager):
+    """Test a UUID user ID authenticates and owns the workflows it creates."""
+    user_email = f"test-uuid-policy-{int(time.time() * 1000000)}@example.com"
+    user_id = test_db.create_test_user(user_email, "hashed-password")
+    token = await jwt_manager.generate_token(user_id.upper(), user_email, [], 3600)
+    
+    response = await test_client.post(
+        "/api/workflows",
+        json={"name": "UUID Owner"},
+        headers={"Authorization": f"Bearer {token}"}
+    )
+    
+    assert response.status_code == 201
+    assert response.json()["created_by_user_id"] == user_id
+
+
+@pytest.mark.asyncio
+async def test_login_returns_user_and_expiry(test_client: AsyncClient, test_db):
+    """Test login returns the populated user object and token expiry."""
+    user_email = f"test-login-{int(time.time() * 1000000)}@example.com"
+    user_id = test_db.create_test_user(user_email, test_db.hash_password("correct-horse-1"))
+    
+    response = await test_client.post(
+        "/api/auth/login",
+        json={"email": user_email, "password": "correct-horse-1"}
+    )
+    
+    assert response.status_code == 200
+    data = response.json()
+    assert data["token"]
+    assert data["user_id"] == user_id
+    assert data["user"].pop("created_at") is not None
+    assert data["user"] == {
+        "id": user_id,
+        "name": "Test User",
+        "email": user_email,
+        "roles": []
+    }
+    expires_at = datetime.fromisoformat(data["expires_at"].replace("Z", "+00:00"))
+    assert expires_at > datetime.now(timezone.utc)
+    
+    response = await test_client.post(
+        "/api/auth/login",
+        json={"email": user_email, "password": "wrong-password-1"}
+    )
+    assert response.status_code == 401
+
+
+@pytest.mark.asyncio
+async def test_ws_token_rejected_by_rest_but_accepted_by_ws(test_client: AsyncClient, jwt_manager, app):
+    """Test a WS-scoped token only authenticates WebSocket connections."""
+    user_id = str(uuid.uuid4())
+    token = await jwt_manager.generate_token(user_id, "ws@example.com", [], 3600)
+    
+    response = await test_client.post(
+        "/api/auth/ws-token",
+        headers={"Authorization": f"Bearer {token}"}
+    )
+    assert response.status_code == 200
+    ws_token = response.json()["token"]
+    
+    response = await test_client.get(
+        "/api/protected",
+        headers={"Authorization": f"Bearer {ws_token}"}
+    )
+    assert response.status_code == 401
+    
+    # The WS route authenticates the token and moves on to the thread ownership check
+    with TestClient(app) as client:
+        with client.websocket_connect(f"/api/ws/refinements/{uuid.uuid4()}?token={ws_token}") as websocket:
+            with pytest.raises(WebSocketDisconnect) as exc_info:
+                websocket.receive_json()
+    assert exc_info.value.reason == "Access denied to thread"
+
+
+@pytest.mark.asyncio
+async def test_unauthorized_body_is_consistent_across_rest_and_ws(test_client: AsyncClient, app):
+    """Test REST routes and the WS handshake refuse missing or bad tokens with the same 401 body."""
+    from starlette.testclient import WebSocketDenialResponse
+    
+    response = await test_client.get("/api/protected")
+    assert response.status_code == 401
+    assert response.json() == {"detail": "Authorization header required", "code": 401}
+    
+    response = await test_client.get("/api/protected", headers={"Authorization": "Bearer not-a-jwt"})
+    assert response.status_code == 401
+    rest_invalid = response.json()
+    assert rest_invalid["code"] == 401
+    
+    with TestClient(app) as client:
+        with pytest.raises(WebSocketDenialResponse) as exc_info:
+            with client.websocket_connect(f"/api/ws/refinements/{uuid.uuid4()}"):
+                pass
+        assert exc_info.value.status_code == 401
+        assert exc_info.value.json() == {"detail": "Authorization header required", "code": 401}
+        
+        with pytest.raises(WebSocketDenialResponse) as exc_info:
+            with client.websocket_connect(f"/api/ws/refinements/{uuid.uuid4()}?token=not-a-jwt"):
+                pass
+        assert exc_info.value.status_code == 401
+        assert exc_info.value.json() == rest_invalid
+
+
+def issue_earlier_token(jwt_manager, user_id: str, seconds_ago: int = 10) -> str:
+    """Sign a token for user_id as if it had been issued seconds_ago."""
+    issued_at = int(time.time()) - seconds_ago
+    return jwt.encode(
+        {
+            "user_id": user_id,
+            "jti": str(uuid.uuid4()),
+            "iss": jwt_manager.issuer,
+            "iat": issued_at,
+            "exp": issued_at + 3600,
+        },
+        jwt_manager.secret_key,
+        algorithm=jwt_manager.algorithm
+    )
+
+
+@pytest.mark.asyncio
+async def test_logout_revokes_the_token(test_client: AsyncClient, test_db, jwt_manager, app):
+    """Test logging out refuses the token and every earlier token of the user, but not later logins."""
+    from starlette.testclient import WebSocketDenialResponse
+    
+    user_email = f"logout-{int(time.time() * 1000000)}@example.com"
+    user_id = test_db.create_test_user(user_email, "hashed-password")
+    earlier_token = issue_earlier_token(jwt_manager, user_id)
+    token = await jwt_manager.generate_token(user_id, user_email, [], 3600)
+    
+    response = await test_client.post(
+        "/api/auth/logout",
+        headers={"Authorization": f"Bearer {token}"}
+    )
+    assert response.status_code == 200
+    
+    response = await test_client.get(
+        "/api/protected",
+        headers={"Authorization": f"Bearer {token}"}
+    )
+    assert response.status_code == 401
+    assert response.json() == {"detail": "Token has been revoked", "code": 401}
+    
+    with TestClient(app) as client:
+        with pytest.raises(WebSocketDenialResponse) as exc_info:
+            with client.websocket_connect(f"/api/ws/refinements/{uuid.uuid4()}?token={token}"):
+                pass
+        assert exc_info.value.status_code == 401
+    
+    response = await test_client.get(
+        "/api/protected",
+        headers={"Authorization": f"Bearer {earlier_token}"}
+    )
+    assert response.status_code == 401
+    assert response.json()["detail"] == "Token has been revoked"
+    
+    later_token = await jwt_manager.generate_token(user_id, user_email, [], 3600)
+    response = await test_client.get(
+        "/api/protected",
+        headers={"Authorization": f"Bearer {later_token}"}
+    )
+    assert response.status_code == 200
+
+
+@pytest.mark.asyncio
+async def test_refresh_extends_a_valid_token(test_client: AsyncClient, jwt_manager):
+    """Test refreshing returns a new valid token that expires later, and refuses expired ones."""
+    user_id = str(uuid.uuid4())
+    token, expires_at = jwt_manager.create_token(user_id, "refresh@example.com", [], 60)
+    
+    response = await test_client.post(
+        "/api/auth/refresh",
+        headers={"Authorization": f"Bearer {token}"}
+    )
+    
+    assert response.status_code == 200
+    data = response.json()
+    refreshed_expires_at = datetime.fromisoformat(data["expires_at"].replace("Z", "+00:00"))
+    assert refreshed_expires_at > expires_at
+    claims = jwt_manager.validate_token(data["token"])
+    assert claims["user_id"] == user_id
+    assert claims["username"] == "refresh@example.com"
+    
+    expired_token, _ = jwt_manager.create_token(user_id, "refresh@example.com", [], -10)
+    response = await test_client.post(
+        "/api/auth/refresh",
+        headers={"Authorization": f"Bearer {expired_token}"}
+    )
+    assert response.status_code == 401
+    assert response.json()["detail"] == "Token has expired"
+
+
+@pytest.mark.asyncio
+async def test_me_returns_current_profile(test_client: AsyncClient, test_db, jwt_manager):
+    """Test /auth/me resolves the token's user to their stored profile, or 404 once deleted."""
+    user_email = f"test-me-{int(time.time() * 1000000)}@example.com"
+    user_id = test_db.create_test_user(user_email, "hashed-password")
+    token = await jwt_manager.generate_token(user_id, user_email, [], 3600)
+    
+    response = await test_client.get("/api/auth/me", headers={"Authorization": f"Bearer {token}"})
+    
+    assert response.status_code == 200
+    profile = response.json()
+    assert profile["id"] == user_id
+    assert profile["name"] == "Test User"
+    assert profile["email"] == user_email
+    assert profile["created_at"] is not None
+    
+    conn = test_db.connect()
+    with conn.cursor() as cur:
+        cur.execute("DELETE FROM users WHERE id = %s", (user_id,))
+        conn.commit()
+    
+    response = await test_client.get("/api/auth/me", headers={"Authorization": f"Bearer {token}"})
+    assert response.status_code == 404
+
+
+@pytest.mark.asyncio
+async def test_change_password(test_client: AsyncClient, test_db, jwt_manager):
+    """Test the password changes only with the right current password and a strong new one, revoking earlier tokens."""
+    user_email = f"test-password-{int(time.time() * 1000000)}@example.com"
+    user_id = test_db.create_test_user(user_email, test_db.hash_password("correct-horse-1"))
+    token = await jwt_manager.generate_token(user_id, user_email, [], 3600)
+    headers = {"Authorization": f"Bearer {token}"}
+    
+    response = await test_client.post(
+        "/api/auth/password",
+        json={"current_password": "wrong-password-1", "new_password": "battery-staple-2"},
+        headers=headers
+    )
+    assert response.status_code == 401
+    
+    for weak_password in ["short1", "no-digits-here", "long-password-1" * 5]:
+        response = await test_client.post(
+            "/api/auth/password",
+            json={"current_password": "correct-horse-1", "new_password": weak_password},
+            headers=headers
+        )
+        assert response.status_code == 400
+    
+    response = await test_client.post(
+        "/api/auth/password",
+        json={"current_password": "correct-horse-1", "new_password": "battery-staple-2"},
+        headers=headers
+    )
+    assert response.status_code == 200
+    
+    response = await test_client.post(
+        "/api/auth/login",
+        json={"email": user_email, "password": "battery-staple-2"}
+    )
+    assert response.status_code == 200
+    response = await test_client.post(
+        "/api/auth/login",
+        json={"email": user_email, "password": "correct-horse-1"}
+    )
+    assert response.status_code == 401
+    
+    response = await test_client.get(
+        "/api/auth/me",
+        headers={"Authorization": f"Bearer {issue_earlier_token(jwt_manager, user_id)}"}
+    )
+    assert response.status_code == 401
@@ -0,0 +1,136 @@
+"""
+Cleanup job integration tests.
+
+Tests enqueueing, backoff and dead-lettering of deepagents-runtime
+cleanup jobs against the real database.
+"""
+
+import uuid
+import pytest
+
+from api.dependencies import get_database_url, get_orchestration_service
+from services.cleanup_job_service import CleanupJobService
+
+
+def enqueue_cleanup_job(test_db) -> str:
+    """Enqueue a cleanup job for a fresh thread and return the thread ID."""
+    thread_id = f"test-thread-{uuid.uuid4()}"
+    conn = test_db.connect()
+    with conn.cursor() as cur:
+        CleanupJobService.enqueue(cur, [thread_id])
+        conn.commit()
+    return thread_id
+
+
+def get_cleanup_job(test_db, thread_id: str):
+    """Get the cleanup job of a thread."""
+    conn = test_db.connect()
+    with conn.cursor() as cur:
+        cur.execute(
+            """
+            SELECT status, attempts, last_error, next_attempt_at > NOW() AS backing_off
+            FROM cleanup_jobs WHERE thread_id = %s
+            """,
+            (thread_id,)
+        )
+        return cur.fetchone()
+
+
+def failing_for(thread_id: str, calls: list):
+    """Cleanup callable that fails for thread_id and succeeds for every other thread."""
+    async def cleanup(candidate: str):
+        if candidate == thread_id:
+            calls.append(candidate)
+            raise Exception("runtime unavailable")
+    return cleanup
+
+
+@pytest.mark.asyncio
+async def test_failed_cleanup_backs_off_and_is_dead_lettered(test_db):
+    """A failing job waits out its backoff and is dead-lettered once attempts are exhausted."""
+    thread_id = enqueue_cleanup_job(test_db)
+    calls = []
+
+    backing_off = CleanupJobService(get_database_url(), max_attempts=3, retry_base_seconds=60)
+    await backing_off.process_batch(failing_for(thread_id, calls), batch_size=500)
+    job = get_cleanup_job(test_db, thread_id)
+    assert (job["status"], job["attempts"], job["backing_off"]) == ("PENDING", 1, True)
+    assert job["last_error"] == "runtime unavailable"
+
+    # Not due yet, so the next batch skips it
+    await backing_off.process_batch(failing_for(thread_id, calls), batch_size=500)
+    assert calls == [thread_id]
+
+    conn = test_db.connect()
+    with conn.cursor() as cur:
+        cur.execute("UPDATE cleanup_jobs SET next_attempt_at = NOW() WHERE thread_id = %s", (thread_id,))
+        conn.commit()
+    impatient = CleanupJobService(get_database_url(), max_attempts=2, retry_base_seconds=0)
+    await impatient.process_batch(failing_for(thread_id, calls), batch_size=500)
+
+    job = get_cleanup_job(test_db, thread_id)
+    assert (job["status"], job["attempts"]) == ("DEAD_LETTER", 2)
+
+
+@pytest.mark.asyncio
+async def test_successful_cleanup_completes_job(test_db):
+    """A job whose cleanup succeeds is marked done and not run again."""
+    thread_id = enqueue_cleanup_job(test_db)
+    cleaned = []
+
+    async def cleanup(candidate: str):
+        cleaned.append(candidate)
+
+    cleanup_job_service = CleanupJobService(get_database_url())
+    await cleanup_job_service.process_batch(cleanup, batch_size=500)
+    await cleanup_job_service.process_batch(cleanup, batch_size=500)
+
+    assert cleaned.count(thread_id) == 1
+    assert get_cleanup_job(test_db, thread_id)["status"] == "DONE"
+
+
+@pytest.mark.asyncio
+async def test_runtime_is_called_outside_the_claiming_transaction(test_db):
+    """The cleanup call runs without the job's row lock, and another worker skips the claimed job meanwhile."""
+    thread_id = enqueue_cleanup_job(test_db)
+    cleaned_by_second_worker = []
+    cleanup_job_service = CleanupJobService(get_database_url())
+
+    async def record_cleanup(candidate: str):
+        cleaned_by_second_worker.append(candidate)
+
+    async def cleanup(candidate: str):
+        if candidate != thread_id:
+            return
+        conn = test_db.connect()
+        with conn.cursor() as cur:
+            # Raises LockNotAvailable, failing the cleanup, if the claim still held the row
+            cur.execute("SELECT id FROM cleanup_jobs WHERE thread_id = %s FOR UPDATE NOWAIT", (thread_id,))
+            conn.commit()
+        await cleanup_job_service.process_batch(record_cleanup, batch_size=500)
+
+    await cleanup_job_service.process_batch(cleanup, batch_size=500)
+
+    assert thread_id not in cleaned_by_second_worker
+    job = get_cleanup_job(test_db, thread_id)
+    assert (job["status"], job["attempts"]) == ("DONE", 0)
+
+
+@pytest.mark.asyncio
+async def test_resolving_proposal_enqueues_cleanup(test_db):
+    """Resolving a proposal enqueues its thread's cleanup in the same transaction."""
+    user_id = test_db.create_test_user(f"cleanup-{uuid.uuid4()}@example.com", "hashed-password")
+    workflow_id = test_db.create_test_workflow(user_id, "Cleanup Workflow", "For testing cleanup jobs")
+
+    orchestration_service = get_orchestration_service()
+    draft_id = await orchestration_service.get_or_create_draft(workflow_id, user_id)
+    thread_id = f"test-thread-{uuid.uuid4()}"
+    proposal_id = orchestration_service.proposal_service.create_proposal(
+        draft_id, thread_id, user_id, "Clean up after me", {}
+    )
+    test_db.set_proposal_status(proposal_id, "completed")
+
+    orchestration_service.proposal_service.resolve_proposal(proposal_id, "rejected", user_id, "{}")
+
+    job = get_cleanup_job(test_db, thread_id)
+    assert (job["status"], job["attempts"]) == ("PENDING", 0)
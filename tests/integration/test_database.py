@@ -0,0 +1,37 @@
+"""
+Database connection integration tests.
+
+Tests that pooled connections enforce the statement timeout.
+"""
+
+import time
+
+import psycopg
+import pytest
+
+from api.dependencies import get_database_url
+from core.database import close_pools, connect
+
+
+@pytest.fixture
+def short_statement_timeout(monkeypatch):
+    """Recreate the pools with a one-second statement timeout, and with the default afterwards."""
+    close_pools()
+    monkeypatch.setenv("DB_STATEMENT_TIMEOUT", "1")
+    yield
+    close_pools()
+
+
+def test_slow_query_is_cancelled_at_statement_timeout(short_statement_timeout):
+    """A query running past DB_STATEMENT_TIMEOUT is cancelled by the server at the deadline."""
+    started = time.monotonic()
+    with pytest.raises(psycopg.errors.QueryCanceled):
+        with connect(get_database_url()) as conn:
+            conn.execute("SELECT pg_sleep(10)")
+    elapsed = time.monotonic() - started
+
+    assert 1 <= elapsed < 5
+
+    # The connection is still usable after the cancelled statement rolled back
+    with connect(get_database_url()) as conn:
+        assert conn.execute("SELECT 1").fetchone() == (1,)
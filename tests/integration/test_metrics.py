@@ -0,0 +1,56 @@
+"""
+Prometheus metrics integration tests.
+"""
+
+import time
+import pytest
+from httpx import AsyncClient
+from prometheus_client import REGISTRY
+
+from api.dependencies import get_orchestration_service
+
+
+def sample(name: str, labels=None) -> float:
+    """Current value of a metric sample, 0 if it was never recorded."""
+    return REGISTRY.get_sample_value(name, labels or {}) or 0.0
+
+
+@pytest.mark.asyncio
+async def test_refinement_job_counters_are_recorded(
+    test_client: AsyncClient,
+    test_db,
+    jwt_manager,
+    mock_deepagents_server
+):
+    """Test refinement jobs are counted when created and once the proxy finalizes them."""
+    user_email = f"metrics-{int(time.time() * 1000000)}@example.com"
+    user_id = test_db.create_test_user(user_email, "hashed-password")
+    token = await jwt_manager.generate_token(user_id, user_email, [], 24 * 3600)
+    workflow_id = test_db.create_test_workflow(user_id, "Metrics Workflow", "For testing metrics")
+    created_before = sample("ide_orchestrator_refinement_jobs_created_total")
+    failed_before = sample("ide_orchestrator_refinement_jobs_failed_total")
+
+    response = await test_client.post(
+        f"/api/workflows/{workflow_id}/refinements",
+        json={"instructions": "Add a reviewer agent"},
+        headers={"Authorization": f"Bearer {token}"}
+    )
+    assert response.status_code == 202
+    thread_id = response.json()["thread_id"]
+
+    # The WebSocket proxy finalizes the proposal when the stream fails
+    await get_orchestration_service().update_proposal_status_from_stream(thread_id, "failed", "stream error")
+
+    assert sample("ide_orchestrator_refinement_jobs_created_total") == created_before + 1
+    assert sample("ide_orchestrator_refinement_jobs_failed_total") == failed_before + 1
+    assert sample(
+        "agent_builder_jobs_created_total", {"job_type": "refinement", "status": "created"}
+    ) >= 1
+
+
+@pytest.mark.asyncio
+async def test_metrics_are_not_served_by_the_api(test_client: AsyncClient):
+    """Test metrics are only exposed on the METRICS_PORT server, not on the public API."""
+    response = await test_client.get("/metrics")
+
+    assert response.status_code == 404
@@ -0,0 +1,210 @@
+"""
+Outbox integration tests.
+
+Tests dead-lettering and requeueing of outbox events against the real database.
+"""
+
+import json
+import uuid
+import pytest
+from httpx import AsyncClient
+
+from api.dependencies import get_database_url, get_orchestration_service
+from services.outbox_service import OutboxService
+from services.workflow_service import WorkflowService
+
+
+def get_outbox_events(test_db, aggregate_id: str):
+    """Get the outbox events recorded for an aggregate, oldest first."""
+    conn = test_db.connect()
+    with conn.cursor() as cur:
+        cur.execute(
+            """
+            SELECT aggregate_type, event_type, payload, status
+            FROM outbox_events WHERE aggregate_id = %s
+            ORDER BY created_at
+            """,
+            (aggregate_id,)
+        )
+        return cur.fetchall()
+
+
+def insert_outbox_event(test_db, event_type: str = "proposal.approved") -> str:
+    """Insert a pending outbox event and return its ID."""
+    conn = test_db.connect()
+    with conn.cursor() as cur:
+        cur.execute(
+            """
+            INSERT INTO outbox_events (aggregate_type, aggregate_id, event_type, payload)
+            VALUES (%s, %s, %s, %s)
+            RETURNING id
+            """,
+            ("proposal", str(uuid.uuid4()), event_type, json.dumps({"source": "test"}))
+        )
+        result = cur.fetchone()
+        conn.commit()
+        return str(result["id"])
+
+
+def test_event_failing_past_threshold_is_dead_lettered(test_db):
+    """An event that exhausts its retries lands in dead-letter and can be requeued."""
+    outbox_service = OutboxService(get_database_url(), max_retries=3)
+    event_id = insert_outbox_event(test_db)
+
+    assert outbox_service.record_failure(event_id, "webhook timeout") == "FAILED"
+    assert outbox_service.record_failure(event_id, "webhook timeout") == "FAILED"
+    assert outbox_service.record_failure(event_id, "webhook returned 503") == "DEAD_LETTER"
+
+    event = outbox_service.get_event(event_id)
+    assert event["status"] == "DEAD_LETTER"
+    assert event["retry_count"] == 3
+    assert event["last_error"] == "webhook returned 503"
+    assert event["dead_lettered_at"] is not None
+
+    dead_letter_ids = [e["id"] for e in outbox_service.list_dead_letters(limit=500)]
+    assert event_id in dead_letter_ids
+
+    requeued = outbox_service.requeue_dead_letter(event_id)
+    assert requeued["status"] == "PENDING"
+    assert requeued["retry_count"] == 0
+    assert requeued["dead_lettered_at"] is None
+
+    with pytest.raises(ValueError, match="not dead-lettered"):
+        outbox_service.requeue_dead_letter(event_id)
+
+
+@pytest.mark.asyncio
+async def test_dead_letter_endpoints_require_admin(
+    test_client: AsyncClient, test_db, jwt_manager, monkeypatch
+):
+    """Dead-letter endpoints are admin-only and requeue via the API."""
+    admin_id = str(uuid.uuid4())
+    admin_token = await jwt_manager.generate_token(admin_id, "admin@example.com", ["admin"], 3600)
+    user_token = await jwt_manager.generate_token(str(uuid.uuid4()), "user@example.com", [], 3600)
+    monkeypatch.setenv("ADMIN_USER_IDS", admin_id)
+    monkeypatch.setenv("OUTBOX_MAX_RETRIES", "1")
+
+    event_id = insert_outbox_event(test_db)
+    OutboxService(get_database_url()).record_failure(event_id, "unreachable")
+
+    response = await test_client.get(
+        "/api/admin/outbox/dead-letters",
+        headers={"Authorization": f"Bearer {user_token}"}
+    )
+    assert response.status_code == 403
+
+    response = await test_client.get(
+        "/api/admin/outbox/dead-letters?limit=500",
+        headers={"Authorization": f"Bearer {admin_token}"}
+    )
+    assert response.status_code == 200
+    assert event_id in [e["id"] for e in response.json()["events"]]
+
+    response = await test_client.post(
+        f"/api/admin/outbox/dead-letters/{event_id}/requeue",
+        headers={"Authorization": f"Bearer {admin_token}"}
+    )
+    assert response.status_code == 200
+    assert response.json()["status"] == "PENDING"
+
+
+@pytest.mark.asyncio
+async def test_redeliver_failed_event(test_client: AsyncClient, test_db, jwt_manager, monkeypatch):
+    """Redelivering a failed event makes it pending again; published events are refused."""
+    admin_id = str(uuid.uuid4())
+    admin_token = await jwt_manager.generate_token(admin_id, "admin@example.com", ["admin"], 3600)
+    monkeypatch.setenv("ADMIN_USER_IDS", admin_id)
+    headers = {"Authorization": f"Bearer {admin_token}"}
+
+    outbox_service = OutboxService(get_database_url(), max_retries=5)
+    event_id = insert_outbox_event(test_db)
+    outbox_service.record_failure(event_id, "webhook timeout")
+    outbox_service.record_failure(event_id, "webhook timeout")
+
+    response = await test_client.post(f"/api/admin/outbox/{event_id}/redeliver", headers=headers)
+    assert response.status_code == 200
+    assert response.json()["status"] == "PENDING"
+    assert outbox_service.get_event(event_id)["retry_count"] == 0
+
+    conn = test_db.connect()
+    with conn.cursor() as cur:
+        cur.execute("UPDATE outbox_events SET status = 'PUBLISHED', published_at = NOW() WHERE id = %s", (event_id,))
+        conn.commit()
+
+    response = await test_client.post(f"/api/admin/outbox/{event_id}/redeliver", headers=headers)
+    assert response.status_code == 409
+
+    response = await test_client.post(f"/api/admin/outbox/{uuid.uuid4()}/redeliver", headers=headers)
+    assert response.status_code == 404
+
+
+@pytest.mark.asyncio
+async def test_events_are_published_outside_the_claiming_transaction(test_db):
+    """The publisher runs without the event's row lock, and another poller skips the claimed event meanwhile."""
+    outbox_service = OutboxService(get_database_url())
+    event_id = insert_outbox_event(test_db)
+    delivered_by_second_poller = []
+
+    async def record_delivery(event):
+        delivered_by_second_poller.append(event["id"])
+
+    async def publish(event):
+        if event["id"] != event_id:
+            return
+        conn = test_db.connect()
+        with conn.cursor() as cur:
+            # Raises LockNotAvailable, failing the delivery, if the claim still held the row
+            cur.execute("SELECT id FROM outbox_events WHERE id = %s FOR UPDATE NOWAIT", (event_id,))
+            conn.commit()
+        await outbox_service.deliver_batch(record_delivery, batch_size=500)
+
+    await outbox_service.deliver_batch(publish, batch_size=500)
+
+    assert event_id not in delivered_by_second_poller
+    event = outbox_service.get_event(event_id)
+    assert (event["status"], event["retry_count"]) == ("PUBLISHED", 0)
+
+
+def test_backlog_gauge_reflects_pending_events(test_db):
+    """With N more pending events the backlog gauge grows by N."""
+    from prometheus_client import REGISTRY
+    from services.outbox_service import OutboxPoller
+
+    poller = OutboxPoller(OutboxService(get_database_url()))
+    before = poller.record_backlog_metrics()["pending_count"]
+
+    for _ in range(3):
+        insert_outbox_event(test_db, "workflow.created")
+
+    stats = poller.record_backlog_metrics()
+    assert stats["pending_count"] == before + 3
+    assert REGISTRY.get_sample_value("ide_orchestrator_outbox_pending_events") == before + 3
+    assert REGISTRY.get_sample_value("ide_orchestrator_outbox_oldest_pending_age_seconds") >= 0
+
+
+@pytest.mark.asyncio
+async def test_state_changes_record_outbox_events(test_db):
+    """Resolving a proposal and deploying a version each record a pending outbox event."""
+    user_id = test_db.create_test_user(f"outbox-{uuid.uuid4()}@example.com", "hashed-password")
+    workflow_id = test_db.create_test_workflow(user_id, "Outbox Workflow", "For testing outbox events")
+
+    orchestration_service = get_orchestration_service()
+    draft_id = await orchestration_service.get_or_create_draft(workflow_id, user_id)
+    proposal_id = orchestration_service.proposal_service.create_proposal(
+        draft_id, f"test-thread-{uuid.uuid4()}", user_id, "Announce me", {}
+    )
+    test_db.set_proposal_status(proposal_id, "completed")
+    orchestration_service.proposal_service.resolve_proposal(proposal_id, "approved", user_id, "{}")
+
+    events = get_outbox_events(test_db, proposal_id)
+    assert [(e["aggregate_type"], e["event_type"], e["status"]) for e in events] == [
+        ("proposal", "proposal.approved", "PENDING")
+    ]
+    assert events[0]["payload"] == {"workflow_id": workflow_id, "resolved_by_user_id": user_id}
+
+    version_id = test_db.create_test_version(workflow_id, user_id, 1, {"/plan.md": "# Plan"})
+    WorkflowService(get_database_url()).deploy_version(workflow_id, 1, user_id)
+
+    events = get_outbox_events(test_db, version_id)
+    assert [e["event_type"] for e in events] == ["version.deployed"]
+    assert events[0]["payload"]["version_number"] == 1
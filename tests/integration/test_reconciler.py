@@ -0,0 +1,91 @@
+"""
+Proposal reconciler integration tests.
+
+Tests that processing proposals nobody streamed are finalized from runtime state.
+"""
+
+import time
+import uuid
+
+import pytest
+
+from api.dependencies import get_orchestration_service
+from services.proposal_reconciler import ProposalReconciler
+
+
+async def create_processing_proposal(test_db, age_seconds: int) -> tuple[str, str]:
+    """Create a processing proposal backdated by age_seconds and return (proposal_id, thread_id)."""
+    user_email = f"reconcile-{int(time.time() * 1000000)}@example.com"
+    user_id = test_db.create_test_user(user_email, "hashed-password")
+    workflow_id = test_db.create_test_workflow(user_id, "Reconciled Workflow", "For reconciliation")
+    
+    orchestration_service = get_orchestration_service()
+    draft_id = await orchestration_service.get_or_create_draft(workflow_id, user_id)
+    thread_id = f"test-thread-{uuid.uuid4()}"
+    proposal_id = orchestration_service.proposal_service.create_proposal(
+        draft_id, thread_id, user_id, "Add logging", {}
+    )
+    
+    conn = test_db.connect()
+    with conn.cursor() as cur:
+        cur.execute(
+            "UPDATE proposals SET created_at = NOW() - make_interval(secs => %s) WHERE id = %s",
+            (age_seconds, proposal_id)
+        )
+        conn.commit()
+    
+    return proposal_id, thread_id
+
+
+@pytest.mark.asyncio
+async def test_reconciler_finalizes_completed_thread(test_db):
+    """A stale processing proposal whose thread completed upstream is marked completed."""
+    proposal_id, thread_id = await create_processing_proposal(test_db, age_seconds=600)
+    fresh_proposal_id, fresh_thread_id = await create_processing_proposal(test_db, age_seconds=0)
+    generated_files = {"/THE_SPEC/plan.md": {"content": "# Plan", "type": "markdown"}}
+    fetched = []
+    
+    async def fetch_state(requested_thread_id):
+        fetched.append(requested_thread_id)
+        return {"status": "completed", "generated_files": generated_files}
+    
+    orchestration_service = get_orchestration_service()
+    reconciler = ProposalReconciler(
+        orchestration_service.proposal_service, fetch_state, grace_period_seconds=300, batch_size=500
+    )
+    await reconciler.run_once()
+    
+    assert thread_id in fetched
+    assert fresh_thread_id not in fetched
+    
+    proposal = orchestration_service.get_proposal(proposal_id)
+    assert proposal["status"] == "completed"
+    assert proposal["generated_files"] == generated_files
+    assert proposal["completed_at"] is not None
+    assert orchestration_service.get_proposal(fresh_proposal_id)["status"] == "processing"
+
+
+@pytest.mark.asyncio
+async def test_reconciler_fetches_state_unlocked_and_keeps_concurrent_results(test_db):
+    """The runtime is asked without the proposal locked, and a result recorded meanwhile is not overwritten."""
+    proposal_id, thread_id = await create_processing_proposal(test_db, age_seconds=600)
+    
+    async def fetch_state(requested_thread_id):
+        if requested_thread_id == thread_id:
+            conn = test_db.connect()
+            with conn.cursor() as cur:
+                # Raises LockNotAvailable if the reconciler still held the row, as a stream finalizes it
+                cur.execute("SELECT id FROM proposals WHERE id = %s FOR UPDATE NOWAIT", (proposal_id,))
+                cur.execute("UPDATE proposals SET status = 'failed' WHERE id = %s", (proposal_id,))
+                conn.commit()
+        return {"status": "completed", "generated_files": {"/plan.md": {"content": "# Late"}}}
+    
+    orchestration_service = get_orchestration_service()
+    reconciler = ProposalReconciler(
+        orchestration_service.proposal_service, fetch_state, grace_period_seconds=300, batch_size=500
+    )
+    await reconciler.run_once()
+    
+    proposal = orchestration_service.get_proposal(proposal_id)
+    assert proposal["status"] == "failed"
+    assert not proposal["generated_files"]
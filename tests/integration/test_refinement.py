@@ -9,9 +9,14 @@ import pytest
 from httpx import AsyncClient
 import time
 import json
+import uuid
 import asyncio
 from websockets import connect as ws_connect
 
+from api.dependencies import get_orchestration_service
+from services.errors import InvalidTransitionError
+from services.refinement_progress import extract_progress
+
 
 @pytest.mark.asyncio
 async def test_complete_refinement_workflow(
@@ -190,6 +195,257 @@ async def test_proposal_rejection(test_client: AsyncClient, test_db, jwt_manager
     assert response.status_code == 404
 
 
+@pytest.mark.asyncio
+@pytest.mark.parametrize("prefix", ["/api/refinements", "/api/proposals"])
+@pytest.mark.parametrize("action, resolution", [("approve", "approved"), ("reject", "rejected")])
+async def test_resolve_proposal_on_both_routes(
+    test_client: AsyncClient, test_db, jwt_manager, prefix, action, resolution
+):
+    """Test approve and reject work under both the refinements and proposals paths."""
+    user_email = f"resolve-routes-{int(time.time() * 1000000)}@example.com"
+    user_id = test_db.create_test_user(user_email, "hashed-password")
+    token = await jwt_manager.generate_token(user_id, user_email, [], 24 * 3600)
+    workflow_id = test_db.create_test_workflow(user_id, "Resolve Workflow", "For testing both routes")
+    
+    orchestration_service = get_orchestration_service()
+    draft_id = await orchestration_service.get_or_create_draft(workflow_id, user_id)
+    proposal_id = orchestration_service.proposal_service.create_proposal(
+        draft_id, f"test-thread-{uuid.uuid4()}", user_id, "Add a plan", {}
+    )
+    await orchestration_service.update_proposal_files(proposal_id, {"/plan.md": {"content": "# Plan"}})
+    
+    response = await test_client.post(
+        f"{prefix}/{proposal_id}/{action}",
+        headers={"Authorization": f"Bearer {token}"}
+    )
+    
+    assert response.status_code == 200
+    assert response.json()["proposal_id"] == proposal_id
+    proposal = orchestration_service.get_proposal(proposal_id)
+    assert proposal["status"] == "resolved"
+    assert proposal["resolution"] == resolution
+
+
+@pytest.mark.asyncio
+async def test_rejecting_an_approved_proposal_conflicts(test_client: AsyncClient, test_db, jwt_manager):
+    """Test a proposal that was already approved cannot be rejected afterwards."""
+    user_email = f"reject-approved-{int(time.time() * 1000000)}@example.com"
+    user_id = test_db.create_test_user(user_email, "hashed-password")
+    token = await jwt_manager.generate_token(user_id, user_email, [], 24 * 3600)
+    headers = {"Authorization": f"Bearer {token}"}
+    workflow_id = test_db.create_test_workflow(user_id, "Approved Workflow", "For testing late rejections")
+    
+    orchestration_service = get_orchestration_service()
+    draft_id = await orchestration_service.get_or_create_draft(workflow_id, user_id)
+    proposal_id = orchestration_service.proposal_service.create_proposal(
+        draft_id, f"test-thread-{uuid.uuid4()}", user_id, "Add a plan", {}
+    )
+    await orchestration_service.update_proposal_files(proposal_id, {"/plan.md": {"content": "# Plan"}})
+    
+    response = await test_client.post(f"/api/proposals/{proposal_id}/approve", headers=headers)
+    assert response.status_code == 200
+    
+    response = await test_client.post(f"/api/proposals/{proposal_id}/reject", headers=headers)
+    
+    assert response.status_code == 409
+    proposal = orchestration_service.get_proposal(proposal_id)
+    assert proposal["resolution"] == "approved"
+
+
+@pytest.mark.asyncio
+async def test_replayed_end_event_leaves_resolved_proposal_unchanged(test_client: AsyncClient, test_db, jwt_manager):
+    """Test an end event streamed after a proposal was approved does not reopen it."""
+    user_email = f"replayed-end-{int(time.time() * 1000000)}@example.com"
+    user_id = test_db.create_test_user(user_email, "hashed-password")
+    token = await jwt_manager.generate_token(user_id, user_email, [], 24 * 3600)
+    headers = {"Authorization": f"Bearer {token}"}
+    workflow_id = test_db.create_test_workflow(user_id, "Replayed Workflow", "For testing replayed end events")
+    
+    orchestration_service = get_orchestration_service()
+    draft_id = await orchestration_service.get_or_create_draft(workflow_id, user_id)
+    thread_id = f"test-thread-{uuid.uuid4()}"
+    proposal_id = orchestration_service.proposal_service.create_proposal(
+        draft_id, thread_id, user_id, "Add a plan", {}
+    )
+    await orchestration_service.update_proposal_files(proposal_id, {"/plan.md": {"content": "# Plan"}})
+    response = await test_client.post(f"/api/proposals/{proposal_id}/approve", headers=headers)
+    assert response.status_code == 200
+    resolved = orchestration_service.get_proposal(proposal_id)
+    
+    # A client reconnecting to the thread gets the end event again
+    await orchestration_service.update_proposal_files_from_stream(thread_id, {"/other.md": {"content": "# Other"}})
+    
+    proposal = orchestration_service.get_proposal(proposal_id)
+    assert proposal["status"] == "resolved"
+    assert proposal["generated_files"] == resolved["generated_files"]
+    assert proposal["completed_at"] == resolved["completed_at"]
+    response = await test_client.post(f"/api/proposals/{proposal_id}/approve", headers=headers)
+    assert response.status_code == 400
+
+
+@pytest.mark.asyncio
+async def test_a_refinement_can_only_be_resumed_once(test_db):
+    """Test a second follow-up resuming the same refinement, or its running thread, is refused."""
+    user_id = test_db.create_test_user(f"resume-once-{uuid.uuid4()}@example.com", "hashed-password")
+    workflow_id = test_db.create_test_workflow(user_id, "Resumed Workflow", "For testing concurrent resumes")
+    thread_id = f"test-thread-{uuid.uuid4()}"
+    
+    orchestration_service = get_orchestration_service()
+    proposal_service = orchestration_service.proposal_service
+    draft_id = await orchestration_service.get_or_create_draft(workflow_id, user_id)
+    first_id = proposal_service.create_proposal(draft_id, thread_id, user_id, "Add a plan", {})
+    test_db.set_proposal_status(first_id, "completed")
+    
+    proposal_service.create_proposal(draft_id, thread_id, user_id, "Also add retries", {}, supersedes=first_id)
+    
+    with pytest.raises(InvalidTransitionError):
+        proposal_service.create_proposal(draft_id, thread_id, user_id, "Also add logging", {}, supersedes=first_id)
+    with pytest.raises(InvalidTransitionError):
+        proposal_service.create_proposal(draft_id, thread_id, user_id, "Also add logging", {})
+
+@pytest.mark.asyncio
+@pytest.mark.parametrize("method, path", [
+    ("get", "/api/proposals/{id}"),
+    ("get", "/api/proposals/{id}/compare/1"),
+    ("post", "/api/proposals/{id}/approve"),
+    ("post", "/api/proposals/{id}/reject"),
+    ("post", "/api/proposals/{id}/cancel"),
+    ("post", "/api/refinements/{id}/approve"),
+    ("post", "/api/refinements/{id}/reject"),
+])
+async def test_proposal_routes_share_proposal_id_handling(
+    test_client: AsyncClient, test_db, jwt_manager, mock_deepagents_server, method, path
+):
+    """Test every proposal route accepts any UUID spelling and answers malformed IDs with 404."""
+    user_email = f"proposal-id-{int(time.time() * 1000000)}@example.com"
+    user_id = test_db.create_test_user(user_email, "hashed-password")
+    token = await jwt_manager.generate_token(user_id, user_email, [], 24 * 3600)
+    headers = {"Authorization": f"Bearer {token}"}
+    workflow_id = test_db.create_test_workflow(user_id, "Proposal ID Workflow", "For testing proposal routes")
+    test_db.create_test_version(workflow_id, user_id, 1, {"/plan.md": "# Plan"})
+    
+    orchestration_service = get_orchestration_service()
+    draft_id = await orchestration_service.get_or_create_draft(workflow_id, user_id)
+    proposal_id = orchestration_service.proposal_service.create_proposal(
+        draft_id, f"test-thread-{uuid.uuid4()}", user_id, "Add a plan", {}
+    )
+    if not path.endswith("/cancel"):
+        await orchestration_service.update_proposal_files(proposal_id, {"/plan.md": {"content": "# Plan 2"}})
+    
+    response = await test_client.request(method, path.format(id="not-a-uuid"), headers=headers)
+    assert response.status_code == 404
+    assert response.json()["detail"] == "Proposal not found"
+    
+    response = await test_client.request(method, path.format(id=proposal_id.upper()), headers=headers)
+    assert response.status_code == 200
+    if "proposal_id" in response.json():
+        assert response.json()["proposal_id"] == proposal_id
+
+
+@pytest.mark.asyncio
+async def test_approve_reports_skipped_generated_files(test_client: AsyncClient, test_db, jwt_manager):
+    """Test approval applies well-formed files and answers 207 listing the malformed ones."""
+    user_email = f"skipped-files-{int(time.time() * 1000000)}@example.com"
+    user_id = test_db.create_test_user(user_email, "hashed-password")
+    token = await jwt_manager.generate_token(user_id, user_email, [], 24 * 3600)
+    workflow_id = test_db.create_test_workflow(user_id, "Skipped Files Workflow", "Receives malformed output")
+    
+    orchestration_service = get_orchestration_service()
+    draft_id = await orchestration_service.get_or_create_draft(workflow_id, user_id)
+    proposal_id = orchestration_service.proposal_service.create_proposal(
+        draft_id, f"test-thread-{uuid.uuid4()}", user_id, "Add a plan", {}
+    )
+    await orchestration_service.update_proposal_files(proposal_id, {
+        "/plan.md": {"content": ["# Plan", "Step one"]},
+        "/notes.md": "not an object",
+        "/../escape.md": {"content": "# Outside"},
+    })
+    
+    response = await test_client.post(
+        f"/api/proposals/{proposal_id}/approve",
+        headers={"Authorization": f"Bearer {token}"}
+    )
+    
+    assert response.status_code == 207
+    data = response.json()
+    assert data["applied_files"] == ["/plan.md"]
+    assert data["skipped_files"] == [
+        {"path": "/notes.md", "reason": "file is not an object"},
+        {"path": "/../escape.md", "reason": "path escapes the workspace"},
+    ]
+    files = orchestration_service.draft_service.get_draft_files(draft_id)
+    assert list(files) == ["/plan.md"]
+    assert files["/plan.md"]["content"] == "# Plan\nStep one"
+    assert orchestration_service.get_proposal(proposal_id)["resolution"] == "approved"
+
+
+@pytest.mark.asyncio
+async def test_approving_refinements_from_the_same_draft_cannot_lose_updates(
+    test_client: AsyncClient, test_db, jwt_manager
+):
+    """Test the second of two refinements started from the same files is refused once the first is approved."""
+    user_email = f"lost-update-{int(time.time() * 1000000)}@example.com"
+    user_id = test_db.create_test_user(user_email, "hashed-password")
+    token = await jwt_manager.generate_token(user_id, user_email, [], 24 * 3600)
+    headers = {"Authorization": f"Bearer {token}"}
+    workflow_id = test_db.create_test_workflow(user_id, "Lost Update Workflow", "Refined twice at once")
+    
+    orchestration_service = get_orchestration_service()
+    draft_id = await orchestration_service.get_or_create_draft(workflow_id, user_id)
+    orchestration_service.draft_service.apply_files_to_draft(draft_id, {"/plan.md": {"content": "# Plan"}})
+    base_file_versions = orchestration_service.draft_service.get_draft_file_versions(draft_id)
+    
+    proposal_ids = []
+    for content in ("# Plan A", "# Plan B"):
+        proposal_id = orchestration_service.proposal_service.create_proposal(
+            draft_id, f"test-thread-{uuid.uuid4()}", user_id, "Rewrite the plan", {},
+            base_file_versions=base_file_versions
+        )
+        await orchestration_service.update_proposal_files(proposal_id, {"/plan.md": {"content": content}})
+        proposal_ids.append(proposal_id)
+    
+    response = await test_client.post(f"/api/proposals/{proposal_ids[0]}/approve", headers=headers)
+    assert response.status_code == 200
+    
+    response = await test_client.post(f"/api/proposals/{proposal_ids[1]}/approve", headers=headers)
+    assert response.status_code == 409
+    assert "/plan.md" in response.json()["detail"]
+    
+    files = orchestration_service.draft_service.get_draft_files(draft_id)
+    assert files["/plan.md"]["content"] == "# Plan A"
+    assert files["/plan.md"]["version"] == 2
+    assert orchestration_service.get_proposal(proposal_ids[1])["status"] == "completed"
+
+
+@pytest.mark.asyncio
+async def test_concurrent_approve_and_reject_keep_files_and_resolution_consistent(test_db):
+    """Test the files of a proposal reach the draft exactly when its approval wins over a concurrent rejection."""
+    user_id = test_db.create_test_user(f"approve-reject-{uuid.uuid4()}@example.com", "hashed-password")
+    workflow_id = test_db.create_test_workflow(user_id, "Raced Workflow", "Approved and rejected at once")
+    
+    orchestration_service = get_orchestration_service()
+    proposal_service = orchestration_service.proposal_service
+    draft_id = await orchestration_service.get_or_create_draft(workflow_id, user_id)
+    proposal_id = proposal_service.create_proposal(draft_id, f"test-thread-{uuid.uuid4()}", user_id, "Add a plan", {})
+    await orchestration_service.update_proposal_files(proposal_id, {"/plan.md": {"content": "# Plan"}})
+    
+    approval, rejection = await asyncio.gather(
+        asyncio.to_thread(proposal_service.approve_proposal, proposal_id, user_id),
+        asyncio.to_thread(proposal_service.resolve_proposal, proposal_id, "rejected", user_id, "{}"),
+        return_exceptions=True
+    )
+    
+    resolution = orchestration_service.get_proposal(proposal_id)["resolution"]
+    files = orchestration_service.draft_service.get_draft_files(draft_id)
+    if resolution == "approved":
+        assert isinstance(rejection, InvalidTransitionError)
+        assert files["/plan.md"]["content"] == "# Plan"
+    else:
+        assert resolution == "rejected"
+        assert isinstance(approval, InvalidTransitionError)
+        assert "/plan.md" not in files
+
+
 @pytest.mark.asyncio
 async def test_refinement_validation(test_client: AsyncClient, test_db, jwt_manager):
     """Test refinement request validation."""
@@ -216,6 +472,16 @@ async def test_refinement_validation(test_client: AsyncClient, test_db, jwt_mana
     
     assert response.status_code == 400
     
+    # Test refinement with a runtime config key outside the allowlist
+    response = await test_client.post(
+        f"/api/workflows/{workflow_id}/refinements",
+        json={"instructions": "Valid instructions", "runtime_config": {"api_key": "secret"}},
+        headers={"Authorization": f"Bearer {token}"}
+    )
+    
+    assert response.status_code == 400
+    assert "api_key" in response.json()["detail"]
+    
     # Test refinement on non-existent workflow
     valid_data = {
         "instructions": "Valid instructions",
@@ -233,4 +499,361 @@ async def test_refinement_validation(test_client: AsyncClient, test_db, jwt_mana
     assert response.status_code == 404
 
 
+@pytest.mark.asyncio
+async def test_refining_workflow_without_spec_is_blocked(
+    test_client: AsyncClient,
+    test_db,
+    jwt_manager,
+    mock_deepagents_server,
+    monkeypatch
+):
+    """Test REFINEMENT_REQUIRES_SPEC blocks refinements until the workflow has a spec."""
+    monkeypatch.setenv("REFINEMENT_REQUIRES_SPEC", "true")
+    user_email = f"nospec-{int(time.time() * 1000000)}@example.com"
+    user_id = test_db.create_test_user(user_email, "hashed-password")
+    token = await jwt_manager.generate_token(user_id, user_email, [], 24 * 3600)
+    headers = {"Authorization": f"Bearer {token}"}
+    workflow_id = test_db.create_test_workflow(user_id, "Empty Workflow", "Has no spec yet")
+    
+    response = await test_client.post(
+        f"/api/workflows/{workflow_id}/refinements",
+        json={"instructions": "Improve the workflow"},
+        headers=headers
+    )
+    assert response.status_code == 409
+    assert "no specification" in response.json()["detail"]
+    
+    conn = test_db.connect()
+    with conn.cursor() as cur:
+        cur.execute(
+            "SELECT COUNT(*) AS count FROM drafts WHERE workflow_id = %s", (workflow_id,)
+        )
+        assert cur.fetchone()["count"] == 0
+        conn.commit()
+    
+    test_db.create_test_version(workflow_id, user_id, 1, {"/plan.md": "# Plan"})
+    response = await test_client.post(
+        f"/api/workflows/{workflow_id}/deploy", json={"version_number": 1}, headers=headers
+    )
+    assert response.status_code == 200
+    
+    response = await test_client.post(
+        f"/api/workflows/{workflow_id}/refinements",
+        json={"instructions": "Improve the workflow"},
+        headers=headers
+    )
+    assert response.status_code == 202
+
+
+@pytest.mark.asyncio
+async def test_failed_proposal_returns_error(test_client: AsyncClient, test_db, jwt_manager):
+    """Test a failed proposal exposes its failure reason."""
+    user_email = f"failed-proposal-{int(time.time() * 1000000)}@example.com"
+    user_id = test_db.create_test_user(user_email, "hashed-password")
+    token = await jwt_manager.generate_token(user_id, user_email, [], 24 * 3600)
+    workflow_id = test_db.create_test_workflow(user_id, "Failed Proposal Workflow", "For testing errors")
+    
+    orchestration_service = get_orchestration_service()
+    draft_id = await orchestration_service.get_or_create_draft(workflow_id, user_id)
+    thread_id = f"test-thread-{uuid.uuid4()}"
+    proposal_id = orchestration_service.proposal_service.create_proposal(
+        draft_id, thread_id, user_id, "Add retries", {}
+    )
+    await orchestration_service.update_proposal_status_from_stream(
+        thread_id, "failed", "Refinement produced too many events"
+    )
+    
+    response = await test_client.get(
+        f"/api/proposals/{proposal_id}",
+        headers={"Authorization": f"Bearer {token}"}
+    )
+    
+    assert response.status_code == 200
+    proposal = response.json()
+    assert proposal["status"] == "failed"
+    assert proposal["error"] == "Refinement produced too many events"
+
+
+@pytest.mark.asyncio
+async def test_cancel_in_flight_proposal(test_client: AsyncClient, test_db, jwt_manager, mock_deepagents_server):
+    """Test an in-flight proposal can be cancelled once and ignores later stream results."""
+    suffix = int(time.time() * 1000000)
+    owner_email = f"cancel-owner-{suffix}@example.com"
+    owner_id = test_db.create_test_user(owner_email, "hashed-password")
+    viewer_email = f"cancel-viewer-{suffix}@example.com"
+    viewer_id = test_db.create_test_user(viewer_email, "hashed-password")
+    headers = {"Authorization": f"Bearer {await jwt_manager.generate_token(owner_id, owner_email, [], 24 * 3600)}"}
+    viewer_headers = {"Authorization": f"Bearer {await jwt_manager.generate_token(viewer_id, viewer_email, [], 24 * 3600)}"}
+    workflow_id = test_db.create_test_workflow(owner_id, "Cancel Workflow", "For testing cancellation")
+    
+    response = await test_client.post(
+        f"/api/workflows/{workflow_id}/share", json={"email": viewer_email, "access_type": "viewer"}, headers=headers
+    )
+    assert response.status_code == 200
+    
+    orchestration_service = get_orchestration_service()
+    draft_id = await orchestration_service.get_or_create_draft(workflow_id, owner_id)
+    thread_id = f"test-thread-{uuid.uuid4()}"
+    proposal_id = orchestration_service.proposal_service.create_proposal(
+        draft_id, thread_id, owner_id, "Take too long", {}
+    )
+    
+    response = await test_client.post(f"/api/proposals/{proposal_id}/cancel", headers=viewer_headers)
+    assert response.status_code == 404
+    
+    response = await test_client.post(f"/api/proposals/{proposal_id}/cancel", headers=headers)
+    assert response.status_code == 200
+    assert response.json()["status"] == "cancelled"
+    
+    response = await test_client.post(f"/api/proposals/{proposal_id}/cancel", headers=headers)
+    assert response.status_code == 409
+    
+    # The runtime finishing anyway must not revive the proposal
+    await orchestration_service.update_proposal_files_from_stream(thread_id, {"/late.md": {"content": "late"}})
+    response = await test_client.get(f"/api/proposals/{proposal_id}", headers=headers)
+    assert response.json()["status"] == "cancelled"
+    
+    response = await test_client.get(f"/api/workflows/{workflow_id}/proposals?status=cancelled", headers=headers)
+    assert [p["id"] for p in response.json()["proposals"]] == [proposal_id]
+
+
+@pytest.mark.asyncio
+async def test_abandoned_stream_cancels_only_in_flight_proposals(test_db, mock_deepagents_server):
+    """Test a disconnected client cancels a processing proposal but leaves a completed one alone."""
+    user_email = f"abandoned-{int(time.time() * 1000000)}@example.com"
+    user_id = test_db.create_test_user(user_email, "hashed-password")
+    workflow_id = test_db.create_test_workflow(user_id, "Abandoned Workflow", "For testing stream cancellation")
+    
+    orchestration_service = get_orchestration_service()
+    draft_id = await orchestration_service.get_or_create_draft(workflow_id, user_id)
+    thread_id = f"test-thread-{uuid.uuid4()}"
+    proposal_id = orchestration_service.proposal_service.create_proposal(
+        draft_id, thread_id, user_id, "Take too long", {}
+    )
+    
+    await orchestration_service.cancel_refinement_from_stream(thread_id, "client_disconnected")
+    
+    proposal = orchestration_service.get_proposal(proposal_id)
+    assert proposal["status"] == "cancelled"
+    assert proposal["ai_generated_content"]["cancelled"]["reason"] == "client_disconnected"
+    assert proposal["error"] is None
+    
+    finished_thread_id = f"test-thread-{uuid.uuid4()}"
+    finished_id = orchestration_service.proposal_service.create_proposal(
+        draft_id, finished_thread_id, user_id, "Finish quickly", {}
+    )
+    await orchestration_service.update_proposal_files(finished_id, {"/plan.md": {"content": "# Plan"}})
+    
+    await orchestration_service.cancel_refinement_from_stream(finished_thread_id, "client_disconnected")
+    
+    assert orchestration_service.get_proposal(finished_id)["status"] == "completed"
+
 
+@pytest.mark.asyncio
+async def test_completed_proposal_cannot_be_cancelled(test_client: AsyncClient, test_db, jwt_manager):
+    """Test cancelling a proposal that already finished is a conflict."""
+    user_email = f"cancel-done-{int(time.time() * 1000000)}@example.com"
+    user_id = test_db.create_test_user(user_email, "hashed-password")
+    token = await jwt_manager.generate_token(user_id, user_email, [], 24 * 3600)
+    workflow_id = test_db.create_test_workflow(user_id, "Finished Workflow", "For testing cancellation")
+    
+    orchestration_service = get_orchestration_service()
+    draft_id = await orchestration_service.get_or_create_draft(workflow_id, user_id)
+    proposal_id = orchestration_service.proposal_service.create_proposal(
+        draft_id, f"test-thread-{uuid.uuid4()}", user_id, "Finish quickly", {}
+    )
+    await orchestration_service.update_proposal_files(proposal_id, {"/plan.md": {"content": "# Plan"}})
+    
+    response = await test_client.post(
+        f"/api/proposals/{proposal_id}/cancel",
+        headers={"Authorization": f"Bearer {token}"}
+    )
+    
+    assert response.status_code == 409
+    assert response.json()["detail"] == "Proposal cannot move from completed to cancelled"
+
+
+@pytest.mark.asyncio
+async def test_get_proposal_without_files(test_client: AsyncClient, test_db, jwt_manager):
+    """Test ?files=false returns proposal metadata without the generated files."""
+    user_email = f"no-files-{int(time.time() * 1000000)}@example.com"
+    user_id = test_db.create_test_user(user_email, "hashed-password")
+    token = await jwt_manager.generate_token(user_id, user_email, [], 24 * 3600)
+    headers = {"Authorization": f"Bearer {token}"}
+    workflow_id = test_db.create_test_workflow(user_id, "Large Proposal Workflow", "For testing metadata-only reads")
+    
+    orchestration_service = get_orchestration_service()
+    draft_id = await orchestration_service.get_or_create_draft(workflow_id, user_id)
+    proposal_id = orchestration_service.proposal_service.create_proposal(
+        draft_id, f"test-thread-{uuid.uuid4()}", user_id, "Generate a lot", {}
+    )
+    await orchestration_service.update_proposal_files(proposal_id, {
+        "/plan.md": {"content": "# Plan\n" + "Step\n" * 1000, "type": "markdown"}
+    })
+    
+    response = await test_client.get(f"/api/proposals/{proposal_id}?files=false", headers=headers)
+    assert response.status_code == 200
+    proposal = response.json()
+    assert proposal["status"] == "completed"
+    assert "generated_files" not in proposal
+    
+    response = await test_client.get(f"/api/proposals/{proposal_id}", headers=headers)
+    assert "/plan.md" in response.json()["generated_files"]
+
+
+
+@pytest.mark.asyncio
+async def test_poll_proposal_status(test_client: AsyncClient, test_db, jwt_manager):
+    """Test polling reports the latest recorded progress and honors If-None-Match."""
+    user_email = f"poll-status-{int(time.time() * 1000000)}@example.com"
+    user_id = test_db.create_test_user(user_email, "hashed-password")
+    token = await jwt_manager.generate_token(user_id, user_email, [], 24 * 3600)
+    headers = {"Authorization": f"Bearer {token}"}
+    workflow_id = test_db.create_test_workflow(user_id, "Polled Workflow", "Refined without streaming")
+    
+    orchestration_service = get_orchestration_service()
+    draft_id = await orchestration_service.get_or_create_draft(workflow_id, user_id)
+    thread_id = f"test-thread-{uuid.uuid4()}"
+    proposal_id = orchestration_service.proposal_service.create_proposal(
+        draft_id, thread_id, user_id, "Add a reviewer agent", {}
+    )
+    proposal_service = orchestration_service.proposal_service
+    proposal_service.update_proposal_progress(thread_id, extract_progress({"current_step": "Analyzing", "files": {}}))
+    # A state without files keeps the count recorded before
+    proposal_service.update_proposal_progress(thread_id, extract_progress({"current_step": "Planning"}))
+    proposal_service.update_proposal_progress(thread_id, extract_progress({
+        "current_step": "Generating", "progress_percent": 60, "files": {"/plan.md": {"content": "# Plan"}}
+    }))
+    url = f"/api/proposals/{proposal_id}/status"
+    
+    response = await test_client.get(url, headers=headers)
+    assert response.status_code == 200
+    status = response.json()
+    assert status["status"] == "processing"
+    assert status["current_step"] == "Generating"
+    assert status["progress_percent"] == 60
+    assert status["files_count"] == 1
+    assert "updated_at" in status
+    etag = response.headers["etag"]
+    
+    response = await test_client.get(url, headers={**headers, "If-None-Match": etag})
+    assert response.status_code == 304
+    
+    await orchestration_service.update_proposal_files(proposal_id, {
+        "/plan.md": {"content": "# Plan", "type": "markdown"},
+        "/THE_CAST/Reviewer.md": {"content": "# Reviewer", "type": "markdown"}
+    })
+    
+    response = await test_client.get(url, headers={**headers, "If-None-Match": etag})
+    assert response.status_code == 200
+    assert response.headers["etag"] != etag
+    status = response.json()
+    assert status["status"] == "completed"
+    assert status["progress_percent"] == 100
+    assert status["files_count"] == 2
+    assert "current_step" not in status
+    
+    assert not proposal_service.update_proposal_progress(thread_id, extract_progress({"current_step": "Late"}))
+
+def test_websocket_rejects_malformed_thread_id(app):
+    """Test a malformed thread id is refused with 400 before authentication."""
+    from fastapi.testclient import TestClient
+    from starlette.testclient import WebSocketDenialResponse
+    
+    with TestClient(app) as client:
+        with pytest.raises(WebSocketDenialResponse) as exc_info:
+            with client.websocket_connect("/api/ws/refinements/bad%20thread%27--?token=unused"):
+                pass
+    
+    assert exc_info.value.status_code == 400
+    assert exc_info.value.json()["detail"] == "Invalid thread_id"
+
+
+@pytest.mark.asyncio
+async def test_compare_proposal_with_version(test_client: AsyncClient, test_db, jwt_manager):
+    """Test a proposal's generated files are diffed against a published version."""
+    user_email = f"compare-{int(time.time() * 1000000)}@example.com"
+    user_id = test_db.create_test_user(user_email, "hashed-password")
+    token = await jwt_manager.generate_token(user_id, user_email, [], 24 * 3600)
+    headers = {"Authorization": f"Bearer {token}"}
+    workflow_id = test_db.create_test_workflow(user_id, "Compare Workflow", "For testing compare")
+    test_db.create_test_version(workflow_id, user_id, 1, {"/plan.md": "# Plan\nStep one", "/README.md": "Readme"})
+    
+    orchestration_service = get_orchestration_service()
+    draft_id = await orchestration_service.get_or_create_draft(workflow_id, user_id)
+    proposal_id = orchestration_service.proposal_service.create_proposal(
+        draft_id, f"test-thread-{uuid.uuid4()}", user_id, "Add a second step", {}
+    )
+    await orchestration_service.update_proposal_files(proposal_id, {
+        "/plan.md": {"content": "# Plan\nStep one\nStep two", "type": "markdown"},
+        "/README.md": {"content": "Readme", "type": "markdown"},
+        "/notes.md": {"content": "New notes", "type": "markdown"}
+    })
+    
+    response = await test_client.get(f"/api/proposals/{proposal_id}/compare/1", headers=headers)
+    
+    assert response.status_code == 200
+    comparison = response.json()
+    assert comparison["version_number"] == 1
+    assert comparison["summary"] == {"added": 1, "modified": 1, "unchanged": 1}
+    files = {entry["path"]: entry for entry in comparison["files"]}
+    assert files["/notes.md"]["status"] == "added"
+    assert files["/README.md"]["diff"] is None
+    assert "+Step two" in files["/plan.md"]["diff"]
+    
+    response = await test_client.get(f"/api/proposals/{proposal_id}/compare/2", headers=headers)
+    assert response.status_code == 404
+    
+    for version_number in ["latest", "²"]:
+        response = await test_client.get(f"/api/proposals/{proposal_id}/compare/{version_number}", headers=headers)
+        assert response.status_code == 400
+
+
+@pytest.mark.asyncio
+async def test_transferred_workflow_proposals_follow_new_owner(test_client: AsyncClient, test_db, jwt_manager):
+    """Test proposal access moves with workflow ownership instead of staying with the proposal's creator."""
+    suffix = int(time.time() * 1000000)
+    old_owner_email = f"transfer-old-{suffix}@example.com"
+    old_owner_id = test_db.create_test_user(old_owner_email, "hashed-password")
+    new_owner_email = f"transfer-new-{suffix}@example.com"
+    new_owner_id = test_db.create_test_user(new_owner_email, "hashed-password")
+    old_headers = {"Authorization": f"Bearer {await jwt_manager.generate_token(old_owner_id, old_owner_email, [], 24 * 3600)}"}
+    new_headers = {"Authorization": f"Bearer {await jwt_manager.generate_token(new_owner_id, new_owner_email, [], 24 * 3600)}"}
+    workflow_id = test_db.create_test_workflow(old_owner_id, "Transferred Workflow", "Changes hands")
+    
+    orchestration_service = get_orchestration_service()
+    draft_id = await orchestration_service.get_or_create_draft(workflow_id, old_owner_id)
+    proposal_id = orchestration_service.proposal_service.create_proposal(
+        draft_id, f"test-thread-{uuid.uuid4()}", old_owner_id, "Before the transfer", {}
+    )
+    
+    response = await test_client.get(f"/api/proposals/{proposal_id}", headers=new_headers)
+    assert response.status_code == 403
+    
+    response = await test_client.post(
+        f"/api/workflows/{workflow_id}/transfer", json={"user_id": str(uuid.uuid4())}, headers=old_headers
+    )
+    assert response.status_code == 404
+    
+    response = await test_client.post(
+        f"/api/workflows/{workflow_id}/transfer", json={"user_id": new_owner_id}, headers=old_headers
+    )
+    assert response.status_code == 200
+    assert response.json()["new_owner_id"] == new_owner_id
+    
+    response = await test_client.get(f"/api/proposals/{proposal_id}", headers=new_headers)
+    assert response.status_code == 200
+    assert orchestration_service.can_access_proposal(proposal_id, new_owner_id)
+    response = await test_client.get(f"/api/workflows/{workflow_id}/proposals", headers=new_headers)
+    assert [p["id"] for p in response.json()["proposals"]] == [proposal_id]
+    
+    response = await test_client.get(f"/api/proposals/{proposal_id}", headers=old_headers)
+    assert response.status_code == 403
+    assert not orchestration_service.can_access_proposal(proposal_id, old_owner_id)
+    response = await test_client.get(f"/api/workflows/{workflow_id}", headers=old_headers)
+    assert response.status_code == 404
+    
+    response = await test_client.post(
+        f"/api/workflows/{workflow_id}/transfer", json={"user_id": old_owner_id}, headers=old_headers
+    )
+    assert response.status_code == 403
@@ -0,0 +1,73 @@
+"""
+Proposal retention integration tests.
+
+Tests that expired terminal proposals are purged with their access rows and snapshots.
+"""
+
+import time
+import uuid
+
+import pytest
+
+from api.dependencies import get_database_url, get_orchestration_service
+from services.proposal_retention import ProposalRetentionJob
+from services.snapshot_service import ThreadSnapshotService
+
+
+async def create_ended_proposal(test_db, status: str, age_days: int) -> tuple[str, str]:
+    """Create a proposal with status that ended age_days ago and return (proposal_id, thread_id)."""
+    user_email = f"retention-{int(time.time() * 1000000)}@example.com"
+    user_id = test_db.create_test_user(user_email, "hashed-password")
+    workflow_id = test_db.create_test_workflow(user_id, "Retention Workflow", "For retention")
+
+    orchestration_service = get_orchestration_service()
+    draft_id = await orchestration_service.get_or_create_draft(workflow_id, user_id)
+    thread_id = f"test-thread-{uuid.uuid4()}"
+    proposal_id = orchestration_service.proposal_service.create_proposal(
+        draft_id, thread_id, user_id, "Add logging", {}
+    )
+    ThreadSnapshotService(get_database_url()).save_snapshot(thread_id, {"files": {}})
+
+    conn = test_db.connect()
+    with conn.cursor() as cur:
+        cur.execute(
+            """
+            UPDATE proposals
+            SET status = %s, completed_at = NOW() - make_interval(days => %s)
+            WHERE id = %s
+            """,
+            (status, age_days, proposal_id)
+        )
+        conn.commit()
+
+    return proposal_id, thread_id
+
+
+def count_rows(test_db, proposal_id: str, thread_id: str) -> tuple[int, int, int]:
+    """Count the proposal's row, access rows and thread snapshots."""
+    conn = test_db.connect()
+    with conn.cursor() as cur:
+        cur.execute("SELECT COUNT(*) AS count FROM proposals WHERE id = %s", (proposal_id,))
+        proposals = cur.fetchone()["count"]
+        cur.execute("SELECT COUNT(*) AS count FROM proposal_access WHERE proposal_id = %s", (proposal_id,))
+        access = cur.fetchone()["count"]
+        cur.execute("SELECT COUNT(*) AS count FROM thread_snapshots WHERE thread_id = %s", (thread_id,))
+        snapshots = cur.fetchone()["count"]
+    return proposals, access, snapshots
+
+
+@pytest.mark.asyncio
+async def test_retention_purges_expired_terminal_proposals(test_db):
+    """Old failed proposals go with their access rows and snapshots; recent and running ones stay."""
+    expired = await create_ended_proposal(test_db, "failed", age_days=40)
+    recent = await create_ended_proposal(test_db, "failed", age_days=5)
+    running = await create_ended_proposal(test_db, "processing", age_days=40)
+
+    job = ProposalRetentionJob(
+        get_orchestration_service().proposal_service, retention_days=30, batch_size=500
+    )
+    assert await job.run_once() >= 1
+
+    assert count_rows(test_db, *expired) == (0, 0, 0)
+    assert count_rows(test_db, *recent) == (1, 1, 1)
+    assert count_rows(test_db, *running) == (1, 1, 1)
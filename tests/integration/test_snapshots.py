@@ -0,0 +1,80 @@
+"""
+Thread snapshot integration tests.
+
+Tests storage, retrieval, and pruning of on_state_update snapshots.
+"""
+
+import uuid
+from concurrent.futures import ThreadPoolExecutor
+
+from api.dependencies import get_database_url
+from services.snapshot_service import ThreadSnapshotService
+
+
+def test_snapshots_are_stored_and_retrievable_by_sequence():
+    """Snapshots get increasing sequences and can be fetched individually."""
+    snapshot_service = ThreadSnapshotService(get_database_url(), snapshot_limit=5)
+    thread_id = f"test-thread-{uuid.uuid4()}"
+
+    sequences = [
+        snapshot_service.save_snapshot(thread_id, {"messages": f"step {i}", "files": {}})
+        for i in range(1, 4)
+    ]
+    assert sequences == [1, 2, 3]
+
+    snapshot = snapshot_service.get_snapshot(thread_id, 2)
+    assert snapshot["sequence"] == 2
+    assert snapshot["state"]["messages"] == "step 2"
+
+    assert snapshot_service.get_snapshot(thread_id, 4) is None
+    assert [s["sequence"] for s in snapshot_service.list_snapshots(thread_id, after_sequence=1)] == [2, 3]
+
+
+def test_concurrent_saves_get_distinct_sequences():
+    """Saves racing on one thread each get their own sequence instead of failing."""
+    snapshot_service = ThreadSnapshotService(get_database_url(), snapshot_limit=20)
+    thread_id = f"test-thread-{uuid.uuid4()}"
+
+    with ThreadPoolExecutor(max_workers=10) as executor:
+        sequences = list(executor.map(
+            lambda i: snapshot_service.save_snapshot(thread_id, {"messages": f"step {i}"}),
+            range(10)
+        ))
+
+    assert sorted(sequences) == list(range(1, 11))
+    assert [s["sequence"] for s in snapshot_service.list_snapshots(thread_id)] == list(range(1, 11))
+
+
+def test_saving_keeps_most_recent_snapshots():
+    """Each save drops all but the newest snapshot_limit snapshots of the thread."""
+    snapshot_service = ThreadSnapshotService(get_database_url(), snapshot_limit=2)
+    thread_id = f"test-thread-{uuid.uuid4()}"
+
+    sequences = [snapshot_service.save_snapshot(thread_id, {"messages": f"step {i}"}) for i in range(1, 6)]
+
+    assert sequences == [1, 2, 3, 4, 5]
+    assert [s["sequence"] for s in snapshot_service.list_snapshots(thread_id)] == [4, 5]
+
+
+def test_prune_keeps_most_recent_snapshots():
+    """Pruning when a stream ends retains only the newest snapshot_limit snapshots."""
+    thread_id = f"test-thread-{uuid.uuid4()}"
+    for i in range(1, 6):
+        ThreadSnapshotService(get_database_url(), snapshot_limit=5).save_snapshot(thread_id, {"messages": f"step {i}"})
+
+    snapshot_service = ThreadSnapshotService(get_database_url(), snapshot_limit=2)
+
+    assert snapshot_service.prune_snapshots(thread_id) == 3
+    assert [s["sequence"] for s in snapshot_service.list_snapshots(thread_id)] == [4, 5]
+
+
+def test_list_snapshots_limit_returns_newest_in_order():
+    """A limit keeps the newest snapshots after the given sequence, oldest first."""
+    snapshot_service = ThreadSnapshotService(get_database_url(), snapshot_limit=5)
+    thread_id = f"test-thread-{uuid.uuid4()}"
+
+    for i in range(1, 6):
+        snapshot_service.save_snapshot(thread_id, {"messages": f"step {i}"})
+
+    assert [s["sequence"] for s in snapshot_service.list_snapshots(thread_id, limit=2)] == [4, 5]
+    assert [s["sequence"] for s in snapshot_service.list_snapshots(thread_id, after_sequence=4, limit=2)] == [5]
@@ -0,0 +1,26 @@
+"""
+System status integration tests.
+"""
+
+import pytest
+from httpx import AsyncClient
+
+
+@pytest.mark.asyncio
+async def test_status_aggregates_dependencies(test_client: AsyncClient, mock_deepagents_server, monkeypatch):
+    """Test /status reports the database, runtime, circuit breaker and build version without auth."""
+    monkeypatch.setenv("BUILD_VERSION", "1.2.3-test")
+    
+    response = await test_client.get("/status")
+    
+    assert response.status_code == 200
+    status = response.json()
+    assert status["status"] == "ok"
+    assert status["version"] == "1.2.3-test"
+    assert status["checks"]["database"] == {"healthy": True}
+    assert status["checks"]["deepagents_runtime"] == {"healthy": True, "circuit_breaker": "closed"}
+    assert "checked_at" in status
+    
+    # Served from the cache within the cache window
+    response = await test_client.get("/status")
+    assert response.json()["checked_at"] == status["checked_at"]
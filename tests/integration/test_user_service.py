@@ -0,0 +1,27 @@
+"""
+User service integration tests.
+"""
+
+import time
+
+import pytest
+
+from api.dependencies import get_user_service
+from services.user_service import DuplicateEmailError
+
+
+def test_duplicate_email_raises_typed_error(test_db):
+    """Test a second account with the same email, in any case, is refused with DuplicateEmailError."""
+    user_service = get_user_service()
+    email = f"duplicate-{int(time.time() * 1000000)}@example.com"
+    
+    user = user_service.create_user("First User", email, "password123")
+    assert user["email"] == email
+    assert user_service.authenticate(email, "password123")["id"] == user["id"]
+    
+    with pytest.raises(DuplicateEmailError) as exc_info:
+        user_service.create_user("Second User", email, "password456")
+    assert exc_info.value.email == email
+    
+    with pytest.raises(DuplicateEmailError):
+        user_service.create_user("Third User", email.upper(), "password789")
@@ -4,11 +4,19 @@ Workflow lifecycle integration tests.
 Tests complete workflow CRUD operations with real infrastructure.
 """
 
+import json
 import pytest
 from httpx import AsyncClient
 import time
+import uuid
 import asyncio
 
+from api.dependencies import get_database_url, get_orchestration_service, get_workflow_service
+from services.audit_service import AuditService
+from services.deepagents_client import DeepAgentsRuntimeClient
+from services.errors import GoneError
+from services.workflow_service import WorkflowService
+
 
 @pytest.mark.asyncio
 async def test_complete_workflow_lifecycle(test_client: AsyncClient, test_db, jwt_manager):
@@ -229,3 +237,1184 @@ async def test_workflow_concurrency(test_db):
     # Verify all IDs are unique
     unique_ids = set(workflow_ids)
     assert len(unique_ids) == 10
+
+
+def test_get_version_returns_requested_version_with_files(test_db):
+    """Test the service returns the requested version and only its files."""
+    user_email = f"version-{int(time.time() * 1000000)}@example.com"
+    user_id = test_db.create_test_user(user_email, "hashed-password")
+    workflow_id = test_db.create_test_workflow(user_id, "Versioned Workflow", "Has two versions")
+    test_db.create_test_version(workflow_id, user_id, 1, {"/plan.md": "# Plan v1"})
+    version_id = test_db.create_test_version(
+        workflow_id, user_id, 2, {"/plan.md": "# Plan v2", "/definition.json": "{}"}
+    )
+    
+    version = get_workflow_service().get_version(workflow_id, 2)
+    
+    assert version["id"] == version_id
+    assert version["version_number"] == 2
+    assert version["status"] == "published"
+    assert version["published_by_user_id"] == user_id
+    assert version["created_at"] is not None
+    assert version["files"] == {
+        "/definition.json": {"content": "{}", "type": "markdown"},
+        "/plan.md": {"content": "# Plan v2", "type": "markdown"}
+    }
+    assert get_workflow_service().get_version(workflow_id, 3) is None
+
+
+@pytest.mark.asyncio
+async def test_get_version_files_with_and_without_contents(test_client: AsyncClient, test_db, jwt_manager):
+    """Test ?contents=false lists the version's file tree without contents and the default includes them."""
+    user_email = f"version-files-{int(time.time() * 1000000)}@example.com"
+    user_id = test_db.create_test_user(user_email, "hashed-password")
+    token = await jwt_manager.generate_token(user_id, user_email, [], 24 * 3600)
+    headers = {"Authorization": f"Bearer {token}"}
+    workflow_id = test_db.create_test_workflow(user_id, "Browsed Workflow", "Has a large spec")
+    test_db.create_test_version(workflow_id, user_id, 1, {"/plan.md": "# Plan", "/definition.json": "{}"})
+    
+    response = await test_client.get(
+        f"/api/workflows/{workflow_id}/versions/1/files", params={"contents": "false"}, headers=headers
+    )
+    
+    assert response.status_code == 200
+    assert response.json() == {
+        "version_number": 1,
+        "files": {
+            "/definition.json": {"type": "markdown", "size": 2},
+            "/plan.md": {"type": "markdown", "size": 6}
+        }
+    }
+    
+    response = await test_client.get(f"/api/workflows/{workflow_id}/versions/1/files", headers=headers)
+    assert response.status_code == 200
+    assert response.json()["files"]["/plan.md"] == {"type": "markdown", "size": 6, "content": "# Plan"}
+    assert response.json()["files"]["/definition.json"]["content"] == "{}"
+    
+    response = await test_client.get(f"/api/workflows/{workflow_id}/versions/2/files", headers=headers)
+    assert response.status_code == 404
+
+@pytest.mark.asyncio
+async def test_get_latest_version_ignores_deployment(test_client: AsyncClient, test_db, jwt_manager):
+    """Test /versions/latest returns the most recent publish, even when an older one is deployed."""
+    user_email = f"latest-{int(time.time() * 1000000)}@example.com"
+    user_id = test_db.create_test_user(user_email, "hashed-password")
+    token = await jwt_manager.generate_token(user_id, user_email, [], 24 * 3600)
+    headers = {"Authorization": f"Bearer {token}"}
+    workflow_id = test_db.create_test_workflow(user_id, "Latest Workflow", "Publishes twice")
+    
+    response = await test_client.get(f"/api/workflows/{workflow_id}/versions/latest", headers=headers)
+    assert response.status_code == 404
+    
+    test_db.create_test_version(workflow_id, user_id, 1, {"/plan.md": "# Plan v1"})
+    response = await test_client.post(
+        f"/api/workflows/{workflow_id}/deploy", json={"version_number": 1}, headers=headers
+    )
+    assert response.status_code == 200
+    version_id = test_db.create_test_version(workflow_id, user_id, 2, {"/plan.md": "# Plan v2"})
+    
+    response = await test_client.get(f"/api/workflows/{workflow_id}/versions/latest", headers=headers)
+    
+    assert response.status_code == 200
+    assert response.json()["id"] == version_id
+    assert response.json()["version_number"] == 2
+    assert response.json()["files"]["/plan.md"]["content"] == "# Plan v2"
+
+@pytest.mark.asyncio
+async def test_get_version_rejects_invalid_version_number(test_client: AsyncClient, test_db, jwt_manager):
+    """Test non-positive or non-numeric version numbers, including Unicode digits, return 400."""
+    user_email = f"version-invalid-{int(time.time() * 1000000)}@example.com"
+    user_id = test_db.create_test_user(user_email, "hashed-password")
+    token = await jwt_manager.generate_token(user_id, user_email, [], 24 * 3600)
+    workflow_id = test_db.create_test_workflow(user_id, "Versioned Workflow", "No versions")
+    
+    for version_number in ["0", "abc", "²"]:
+        response = await test_client.get(
+            f"/api/workflows/{workflow_id}/versions/{version_number}",
+            headers={"Authorization": f"Bearer {token}"}
+        )
+        assert response.status_code == 400
+        
+        response = await test_client.get(
+            f"/api/workflows/{workflow_id}/versions/{version_number}/files",
+            headers={"Authorization": f"Bearer {token}"}
+        )
+        assert response.status_code == 400
+    
+    response = await test_client.get(
+        f"/api/workflows/{workflow_id}/versions/1",
+        headers={"Authorization": f"Bearer {token}"}
+    )
+    assert response.status_code == 404
+
+
+@pytest.mark.asyncio
+async def test_discard_draft_deletes_in_flight_proposals_only(test_client: AsyncClient, test_db, jwt_manager):
+    """Test discarding a draft removes processing proposals but keeps approved ones."""
+    user_email = f"discard-{int(time.time() * 1000000)}@example.com"
+    user_id = test_db.create_test_user(user_email, "hashed-password")
+    token = await jwt_manager.generate_token(user_id, user_email, [], 24 * 3600)
+    workflow_id = test_db.create_test_workflow(user_id, "Discarded Workflow", "Draft gets discarded")
+    
+    orchestration_service = get_orchestration_service()
+    proposal_service = orchestration_service.proposal_service
+    draft_id = await orchestration_service.get_or_create_draft(workflow_id, user_id)
+    processing_id = proposal_service.create_proposal(
+        draft_id, f"test-thread-{uuid.uuid4()}", user_id, "Still running", {}
+    )
+    approved_id = proposal_service.create_proposal(
+        draft_id, f"test-thread-{uuid.uuid4()}", user_id, "Already approved", {}
+    )
+    test_db.set_proposal_status(approved_id, "completed")
+    proposal_service.resolve_proposal(approved_id, "approved", user_id, "{}")
+    
+    response = await test_client.delete(
+        f"/api/workflows/{workflow_id}/draft",
+        headers={"Authorization": f"Bearer {token}"}
+    )
+    
+    assert response.status_code == 200
+    assert response.json()["deleted_proposals"] == 1
+    assert proposal_service.get_proposal(processing_id) is None
+    approved = proposal_service.get_proposal(approved_id)
+    assert approved["resolution"] == "approved"
+    assert approved["draft_id"] is None
+    
+    conn = test_db.connect()
+    with conn.cursor() as cur:
+        cur.execute(
+            "SELECT user_id, details FROM workflow_audit_events WHERE workflow_id = %s AND action = %s",
+            (workflow_id, "draft_discarded")
+        )
+        audit_event = cur.fetchone()
+    assert str(audit_event["user_id"]) == user_id
+    assert audit_event["details"]["deleted_proposals"] == 1
+    
+    response = await test_client.delete(
+        f"/api/workflows/{workflow_id}/draft",
+        headers={"Authorization": f"Bearer {token}"}
+    )
+    assert response.status_code == 404
+
+
+@pytest.mark.asyncio
+async def test_audit_log_lists_approvals_and_deployments_in_order(test_client: AsyncClient, test_db, jwt_manager):
+    """Test the workflow audit log merges proposal approvals and deployments chronologically, with their actor."""
+    user_email = f"audit-log-{int(time.time() * 1000000)}@example.com"
+    user_id = test_db.create_test_user(user_email, "hashed-password")
+    token = await jwt_manager.generate_token(user_id, user_email, [], 24 * 3600)
+    headers = {"Authorization": f"Bearer {token}"}
+    workflow_id = test_db.create_test_workflow(user_id, "Audited Workflow", "Gets refined and deployed")
+    
+    orchestration_service = get_orchestration_service()
+    draft_id = await orchestration_service.get_or_create_draft(workflow_id, user_id)
+    proposal_id = orchestration_service.proposal_service.create_proposal(
+        draft_id, f"test-thread-{uuid.uuid4()}", user_id, "Add a reviewer", {}
+    )
+    test_db.set_proposal_status(proposal_id, "completed")
+    orchestration_service.proposal_service.resolve_proposal(proposal_id, "approved", user_id, "{}")
+    test_db.create_test_version(workflow_id, user_id, 1, {"/plan.md": "# v1"})
+    response = await test_client.post(
+        f"/api/workflows/{workflow_id}/deploy", json={"version_number": 1}, headers=headers
+    )
+    assert response.status_code == 200
+    
+    response = await test_client.get(f"/api/workflows/{workflow_id}/audit", headers=headers)
+    
+    assert response.status_code == 200
+    body = response.json()
+    assert body["total"] == 4
+    assert [entry["action"] for entry in body["entries"]] == [
+        "proposal_created", "proposal_approved", "version_published", "version_deployed"
+    ]
+    assert body["entries"][1]["details"] == {"proposal_id": proposal_id}
+    assert body["entries"][3]["details"]["version_number"] == 1
+    assert {entry["actor"]["email"] for entry in body["entries"]} == {user_email}
+    
+    response = await test_client.get(f"/api/workflows/{workflow_id}/audit?limit=2&offset=2", headers=headers)
+    assert [entry["action"] for entry in response.json()["entries"]] == ["version_published", "version_deployed"]
+
+
+@pytest.mark.asyncio
+async def test_audit_log_keeps_entries_of_purged_proposals(test_client: AsyncClient, test_db, jwt_manager):
+    """Test proposal entries stay in the audit log after the proposal rows are deleted."""
+    user_email = f"audit-purge-{int(time.time() * 1000000)}@example.com"
+    user_id = test_db.create_test_user(user_email, "hashed-password")
+    token = await jwt_manager.generate_token(user_id, user_email, [], 24 * 3600)
+    headers = {"Authorization": f"Bearer {token}"}
+    workflow_id = test_db.create_test_workflow(user_id, "Purged Workflow", "Loses its proposals")
+    
+    orchestration_service = get_orchestration_service()
+    draft_id = await orchestration_service.get_or_create_draft(workflow_id, user_id)
+    approved_id = orchestration_service.proposal_service.create_proposal(
+        draft_id, f"test-thread-{uuid.uuid4()}", user_id, "Add a reviewer", {}
+    )
+    test_db.set_proposal_status(approved_id, "completed")
+    orchestration_service.proposal_service.resolve_proposal(approved_id, "approved", user_id, "{}")
+    cancelled_id = orchestration_service.proposal_service.create_proposal(
+        draft_id, f"test-thread-{uuid.uuid4()}", user_id, "Add a tester", {}
+    )
+    orchestration_service.proposal_service.cancel_proposal(cancelled_id, user_id)
+    
+    conn = test_db.connect()
+    with conn.cursor() as cur:
+        cur.execute("DELETE FROM proposal_access WHERE proposal_id IN (%s, %s)", (approved_id, cancelled_id))
+        cur.execute("DELETE FROM proposals WHERE id IN (%s, %s)", (approved_id, cancelled_id))
+        conn.commit()
+    
+    response = await test_client.get(f"/api/workflows/{workflow_id}/audit", headers=headers)
+    
+    assert response.status_code == 200
+    entries = response.json()["entries"]
+    assert [(entry["action"], entry["details"]["proposal_id"]) for entry in entries] == [
+        ("proposal_created", approved_id),
+        ("proposal_approved", approved_id),
+        ("proposal_created", cancelled_id),
+        ("proposal_cancelled", cancelled_id),
+    ]
+
+
+@pytest.mark.asyncio
+async def test_deploy_version_moves_production_pointer(test_client: AsyncClient, test_db, jwt_manager):
+    """Test deploying sets the production version and demotes the previous one."""
+    user_email = f"deploy-{int(time.time() * 1000000)}@example.com"
+    user_id = test_db.create_test_user(user_email, "hashed-password")
+    token = await jwt_manager.generate_token(user_id, user_email, [], 24 * 3600)
+    headers = {"Authorization": f"Bearer {token}"}
+    workflow_id = test_db.create_test_workflow(user_id, "Deployed Workflow", "Gets deployed")
+    version_1_id = test_db.create_test_version(workflow_id, user_id, 1, {"/plan.md": "# v1"})
+    version_2_id = test_db.create_test_version(workflow_id, user_id, 2, {"/plan.md": "# v2"})
+    
+    def version_state():
+        conn = test_db.connect()
+        with conn.cursor() as cur:
+            cur.execute("SELECT production_version_id FROM workflows WHERE id = %s", (workflow_id,))
+            production_version_id = str(cur.fetchone()["production_version_id"])
+            cur.execute(
+                "SELECT version_number, status, deployed_at FROM versions WHERE workflow_id = %s",
+                (workflow_id,)
+            )
+            versions = {row["version_number"]: row for row in cur.fetchall()}
+            conn.commit()
+        return production_version_id, versions
+    
+    response = await test_client.post(
+        f"/api/workflows/{workflow_id}/deploy", json={"version_number": 1}, headers=headers
+    )
+    assert response.status_code == 200
+    assert response.json()["status"] == "deployed"
+    production_version_id, versions = version_state()
+    assert production_version_id == version_1_id
+    assert versions[1]["status"] == "deployed"
+    assert versions[1]["deployed_at"] is not None
+    
+    response = await test_client.post(
+        f"/api/workflows/{workflow_id}/deploy", json={"version_number": 1}, headers=headers
+    )
+    assert response.status_code == 409
+    
+    response = await test_client.post(
+        f"/api/workflows/{workflow_id}/deploy", json={"version_number": 2}, headers=headers
+    )
+    assert response.status_code == 200
+    production_version_id, versions = version_state()
+    assert production_version_id == version_2_id
+    assert versions[1]["status"] == "published"
+    assert versions[2]["status"] == "deployed"
+    
+    response = await test_client.post(
+        f"/api/workflows/{workflow_id}/deploy", json={"version_number": 9}, headers=headers
+    )
+    assert response.status_code == 404
+
+
+@pytest.mark.asyncio
+async def test_get_production_version(test_client: AsyncClient, test_db, jwt_manager):
+    """Test the production shortcut returns the deployed version, or 404 before any deploy."""
+    user_email = f"production-{int(time.time() * 1000000)}@example.com"
+    user_id = test_db.create_test_user(user_email, "hashed-password")
+    token = await jwt_manager.generate_token(user_id, user_email, [], 24 * 3600)
+    headers = {"Authorization": f"Bearer {token}"}
+    workflow_id = test_db.create_test_workflow(user_id, "Production Workflow", "Gets deployed")
+    test_db.create_test_version(workflow_id, user_id, 1, {"/plan.md": "# v1"})
+    test_db.create_test_version(workflow_id, user_id, 2, {"/plan.md": "# v2"})
+    
+    response = await test_client.get(f"/api/workflows/{workflow_id}/production", headers=headers)
+    assert response.status_code == 404
+    
+    response = await test_client.post(
+        f"/api/workflows/{workflow_id}/deploy", json={"version_number": 1}, headers=headers
+    )
+    assert response.status_code == 200
+    
+    response = await test_client.get(f"/api/workflows/{workflow_id}/production", headers=headers)
+    assert response.status_code == 200
+    production = response.json()
+    assert production["version_number"] == 1
+    assert production["status"] == "deployed"
+    assert production["files"] == {"/plan.md": {"content": "# v1", "type": "markdown"}}
+
+
+@pytest.mark.asyncio
+async def test_delete_and_restore_workflow(test_client: AsyncClient, test_db, jwt_manager, monkeypatch):
+    """Test soft-deleting hides the workflow, closes open proposals, and can be undone."""
+    user_email = f"delete-{int(time.time() * 1000000)}@example.com"
+    user_id = test_db.create_test_user(user_email, "hashed-password")
+    token = await jwt_manager.generate_token(user_id, user_email, [], 24 * 3600)
+    headers = {"Authorization": f"Bearer {token}"}
+    other_email = f"delete-other-{int(time.time() * 1000000)}@example.com"
+    other_id = test_db.create_test_user(other_email, "hashed-password")
+    other_token = await jwt_manager.generate_token(other_id, other_email, [], 24 * 3600)
+    workflow_id = test_db.create_test_workflow(user_id, "Deleted Workflow", "Gets deleted")
+    test_db.create_test_version(workflow_id, user_id, 1, {"/plan.md": "# v1"})
+    
+    orchestration_service = get_orchestration_service()
+    proposal_service = orchestration_service.proposal_service
+    draft_id = await orchestration_service.get_or_create_draft(workflow_id, user_id)
+    running_thread_id = f"test-thread-{uuid.uuid4()}"
+    running_id = proposal_service.create_proposal(draft_id, running_thread_id, user_id, "Still running", {})
+    completed_id = proposal_service.create_proposal(
+        draft_id, f"test-thread-{uuid.uuid4()}", user_id, "Already done", {}
+    )
+    await orchestration_service.update_proposal_files(completed_id, {"/plan.md": {"content": "# Plan"}})
+    cancelled_threads = []
+    
+    async def cancel_thread(client, thread_id):
+        cancelled_threads.append(thread_id)
+        return True
+    
+    monkeypatch.setattr(DeepAgentsRuntimeClient, "cancel_thread", cancel_thread)
+    
+    response = await test_client.delete(
+        f"/api/workflows/{workflow_id}", headers={"Authorization": f"Bearer {other_token}"}
+    )
+    assert response.status_code == 403
+    
+    response = await test_client.delete(f"/api/workflows/{workflow_id}", headers=headers)
+    assert response.status_code == 200
+    
+    assert proposal_service.get_proposal(running_id)["status"] == "cancelled"
+    assert cancelled_threads == [running_thread_id]
+    proposal = proposal_service.get_proposal(completed_id)
+    assert proposal["status"] == "resolved"
+    assert proposal["resolution"] == "rejected"
+    assert orchestration_service.draft_service.get_draft_by_workflow(workflow_id) is None
+    
+    # The cancelled run finishing anyway does not reopen its proposal
+    await orchestration_service.update_proposal_files_from_stream(running_thread_id, {"/late.md": {"content": "late"}})
+    assert proposal_service.get_proposal(running_id)["status"] == "cancelled"
+    
+    response = await test_client.get(f"/api/workflows/{workflow_id}", headers=headers)
+    assert response.status_code == 404
+    response = await test_client.get(f"/api/workflows/{workflow_id}/versions", headers=headers)
+    assert response.status_code == 404
+    assert get_workflow_service().get_versions(workflow_id) == []
+    
+    response = await test_client.delete(f"/api/workflows/{workflow_id}", headers=headers)
+    assert response.status_code == 404
+    
+    response = await test_client.post(f"/api/workflows/{workflow_id}/restore", headers=headers)
+    assert response.status_code == 200
+    assert response.json()["id"] == workflow_id
+    
+    response = await test_client.get(f"/api/workflows/{workflow_id}/versions", headers=headers)
+    assert response.status_code == 200
+    assert [v["version_number"] for v in response.json()["versions"]] == [1]
+    
+    response = await test_client.post(f"/api/workflows/{workflow_id}/restore", headers=headers)
+    assert response.status_code == 404
+
+
+def test_restore_rejected_after_grace_period(test_db):
+    """Test a workflow deleted longer ago than the grace period cannot be restored."""
+    user_id = test_db.create_test_user(f"restore-expired-{int(time.time() * 1000000)}@example.com", "hashed-password")
+    workflow_id = test_db.create_test_workflow(user_id, "Expired Workflow", "Deleted long ago")
+    
+    conn = test_db.connect()
+    with conn.cursor() as cur:
+        cur.execute(
+            "UPDATE workflows SET deleted_at = NOW() - INTERVAL '31 days' WHERE id = %s",
+            (workflow_id,)
+        )
+        conn.commit()
+    
+    workflow_service = WorkflowService(get_database_url(), restore_grace_days=30)
+    with pytest.raises(GoneError, match="expired"):
+        workflow_service.restore_workflow(workflow_id, user_id)
+
+
+@pytest.mark.asyncio
+async def test_get_draft_returns_files_without_creating_one(test_client: AsyncClient, test_db, jwt_manager):
+    """Test the draft endpoint returns the working copy, or 404 before any refinement."""
+    user_email = f"get-draft-{int(time.time() * 1000000)}@example.com"
+    user_id = test_db.create_test_user(user_email, "hashed-password")
+    token = await jwt_manager.generate_token(user_id, user_email, [], 24 * 3600)
+    headers = {"Authorization": f"Bearer {token}"}
+    workflow_id = test_db.create_test_workflow(user_id, "Draft Workflow", "Has a working copy")
+    
+    response = await test_client.get(f"/api/workflows/{workflow_id}/draft", headers=headers)
+    assert response.status_code == 404
+    
+    orchestration_service = get_orchestration_service()
+    assert orchestration_service.draft_service.get_draft_by_workflow(workflow_id) is None
+    draft_id = await orchestration_service.get_or_create_draft(workflow_id, user_id)
+    orchestration_service.draft_service.apply_files_to_draft(
+        draft_id, {"/plan.md": {"content": "# Plan", "type": "markdown"}}
+    )
+    
+    response = await test_client.get(f"/api/workflows/{workflow_id}/draft", headers=headers)
+    
+    assert response.status_code == 200
+    draft = response.json()
+    assert draft["id"] == draft_id
+    assert draft["status"] == "in_progress"
+    assert draft["updated_at"] is not None
+    assert draft["files"]["/plan.md"]["content"] == "# Plan"
+    assert draft["files"]["/plan.md"]["type"] == "markdown"
+
+
+@pytest.mark.asyncio
+async def test_apply_files_to_draft_stores_content_verbatim(test_db):
+    """Test line arrays are joined with newlines and string content is stored unchanged."""
+    user_id = test_db.create_test_user(f"apply-files-{int(time.time() * 1000000)}@example.com", "hashed-password")
+    workflow_id = test_db.create_test_workflow(user_id, "Applied Workflow", "Receives generated files")
+    
+    orchestration_service = get_orchestration_service()
+    draft_id = await orchestration_service.get_or_create_draft(workflow_id, user_id)
+    files_applied = orchestration_service.draft_service.apply_files_to_draft(
+        draft_id,
+        {
+            "/lines.md": {"content": ["line1", "line2"], "type": "markdown"},
+            "/text.md": {"content": "line1\nline2\n", "type": "markdown"},
+        }
+    )
+    
+    assert files_applied == 2
+    files = orchestration_service.draft_service.get_draft_files(draft_id)
+    assert files["/lines.md"]["content"] == "line1\nline2"
+    assert files["/text.md"]["content"] == "line1\nline2\n"
+
+
+@pytest.mark.asyncio
+async def test_edit_draft_file_replaces_only_targeted_lines(test_client: AsyncClient, test_db, jwt_manager):
+    """Test autosave edits patch part of a draft file and refuse ranges past its end."""
+    user_email = f"autosave-{int(time.time() * 1000000)}@example.com"
+    user_id = test_db.create_test_user(user_email, "hashed-password")
+    token = await jwt_manager.generate_token(user_id, user_email, [], 24 * 3600)
+    headers = {"Authorization": f"Bearer {token}"}
+    workflow_id = test_db.create_test_workflow(user_id, "Autosave Workflow", "Edited in the IDE")
+    
+    orchestration_service = get_orchestration_service()
+    draft_id = await orchestration_service.get_or_create_draft(workflow_id, user_id)
+    orchestration_service.draft_service.apply_files_to_draft(
+        draft_id, {"/plan.md": {"content": "# Plan\nStep one\nStep two\nStep three", "type": "markdown"}}
+    )
+    
+    response = await test_client.patch(
+        f"/api/workflows/{workflow_id}/draft/files/plan.md",
+        json={"op": "replace_range", "start_line": 2, "end_line": 3, "content": "Step 1\nStep 1.5\nStep 2"},
+        headers=headers
+    )
+    assert response.status_code == 200
+    assert response.json()["content"] == "# Plan\nStep 1\nStep 1.5\nStep 2\nStep three"
+    
+    response = await test_client.patch(
+        f"/api/workflows/{workflow_id}/draft/files/plan.md",
+        json={"op": "append", "content": "\nStep four"},
+        headers=headers
+    )
+    assert response.status_code == 200
+    
+    response = await test_client.patch(
+        f"/api/workflows/{workflow_id}/draft/files/plan.md",
+        json={"op": "replace_range", "start_line": 6, "end_line": 7, "content": "Too far"},
+        headers=headers
+    )
+    assert response.status_code == 422
+    
+    response = await test_client.patch(
+        f"/api/workflows/{workflow_id}/draft/files/missing.md",
+        json={"op": "append", "content": "Nothing to append to"},
+        headers=headers
+    )
+    assert response.status_code == 404
+    
+    files = orchestration_service.draft_service.get_draft_files(draft_id)
+    assert files["/plan.md"]["content"] == "# Plan\nStep 1\nStep 1.5\nStep 2\nStep three\nStep four"
+
+
+@pytest.mark.asyncio
+async def test_edit_draft_file_refuses_stale_version(test_client: AsyncClient, test_db, jwt_manager):
+    """Test draft files carry a version and edits made against an older version get 409."""
+    user_email = f"draft-version-{int(time.time() * 1000000)}@example.com"
+    user_id = test_db.create_test_user(user_email, "hashed-password")
+    token = await jwt_manager.generate_token(user_id, user_email, [], 24 * 3600)
+    headers = {"Authorization": f"Bearer {token}"}
+    workflow_id = test_db.create_test_workflow(user_id, "Versioned Workflow", "Edited from two tabs")
+    
+    orchestration_service = get_orchestration_service()
+    draft_id = await orchestration_service.get_or_create_draft(workflow_id, user_id)
+    orchestration_service.draft_service.apply_files_to_draft(
+        draft_id, {"/plan.md": {"content": "# Plan", "type": "markdown"}}
+    )
+    
+    response = await test_client.get(f"/api/workflows/{workflow_id}/draft", headers=headers)
+    assert response.json()["files"]["/plan.md"]["version"] == 1
+    
+    response = await test_client.patch(
+        f"/api/workflows/{workflow_id}/draft/files/plan.md",
+        json={"op": "append", "content": "\nFirst tab", "expected_version": 1},
+        headers=headers
+    )
+    assert response.status_code == 200
+    assert response.json()["version"] == 2
+    
+    response = await test_client.patch(
+        f"/api/workflows/{workflow_id}/draft/files/plan.md",
+        json={"op": "append", "content": "\nSecond tab", "expected_version": 1},
+        headers=headers
+    )
+    assert response.status_code == 409
+    
+    files = orchestration_service.draft_service.get_draft_files(draft_id)
+    assert files["/plan.md"]["content"] == "# Plan\nFirst tab"
+    assert files["/plan.md"]["version"] == 2
+
+
+@pytest.mark.asyncio
+async def test_write_and_delete_draft_files_by_hand(test_client: AsyncClient, test_db, jwt_manager):
+    """Test hand edits create, replace and remove draft files under optimistic locking."""
+    user_email = f"hand-edit-{int(time.time() * 1000000)}@example.com"
+    user_id = test_db.create_test_user(user_email, "hashed-password")
+    token = await jwt_manager.generate_token(user_id, user_email, [], 24 * 3600)
+    headers = {"Authorization": f"Bearer {token}"}
+    workflow_id = test_db.create_test_workflow(user_id, "Hand Edited Workflow", "No refinement yet")
+    url = f"/api/workflows/{workflow_id}/draft/files/THE_SPEC/plan.md"
+    
+    response = await test_client.put(url, json={"content": "# Plan", "expected_version": 0}, headers=headers)
+    assert response.status_code == 200
+    assert response.json()["file_path"] == "/THE_SPEC/plan.md"
+    assert response.json()["version"] == 1
+    
+    response = await test_client.put(url, json={"content": "# Other plan", "expected_version": 0}, headers=headers)
+    assert response.status_code == 409
+    
+    response = await test_client.put(url, json={"content": "# Plan v2", "expected_version": 1}, headers=headers)
+    assert response.status_code == 200
+    assert response.json()["version"] == 2
+    
+    response = await test_client.get(f"/api/workflows/{workflow_id}/draft", headers=headers)
+    assert response.json()["files"]["/THE_SPEC/plan.md"]["content"] == "# Plan v2"
+    
+    response = await test_client.delete(f"{url}?expected_version=1", headers=headers)
+    assert response.status_code == 409
+    
+    response = await test_client.delete(f"{url}?expected_version=2", headers=headers)
+    assert response.status_code == 200
+    assert response.json()["version"] == 2
+    
+    response = await test_client.delete(url, headers=headers)
+    assert response.status_code == 404
+    
+    orchestration_service = get_orchestration_service()
+    draft = orchestration_service.draft_service.get_draft_by_workflow(workflow_id)
+    assert orchestration_service.draft_service.get_draft_files(draft["id"]) == {}
+
+
+@pytest.mark.asyncio
+async def test_reset_draft_restores_production_files(test_client: AsyncClient, test_db, jwt_manager):
+    """Test resetting the draft replaces its edits with the production version's files."""
+    user_email = f"reset-draft-{int(time.time() * 1000000)}@example.com"
+    user_id = test_db.create_test_user(user_email, "hashed-password")
+    token = await jwt_manager.generate_token(user_id, user_email, [], 24 * 3600)
+    headers = {"Authorization": f"Bearer {token}"}
+    workflow_id = test_db.create_test_workflow(user_id, "Reset Workflow", "Has a production version")
+    url = f"/api/workflows/{workflow_id}/draft/reset"
+    
+    test_db.create_test_version(workflow_id, user_id, 1, {"/plan.md": "# Plan v1", "/notes.md": "# Notes"})
+    response = await test_client.post(
+        f"/api/workflows/{workflow_id}/deploy", json={"version_number": 1}, headers=headers
+    )
+    assert response.status_code == 200
+    
+    files_url = f"/api/workflows/{workflow_id}/draft/files"
+    response = await test_client.put(f"{files_url}/plan.md", json={"content": "# Edited plan"}, headers=headers)
+    assert response.status_code == 200
+    response = await test_client.put(f"{files_url}/extra.md", json={"content": "# Extra"}, headers=headers)
+    assert response.status_code == 200
+    
+    response = await test_client.post(url, json={}, headers=headers)
+    assert response.status_code == 400
+    
+    response = await test_client.post(url, json={"confirm": True}, headers=headers)
+    assert response.status_code == 200
+    assert response.json()["version_number"] == 1
+    assert response.json()["files"] == ["/notes.md", "/plan.md"]
+    
+    response = await test_client.get(f"/api/workflows/{workflow_id}/draft", headers=headers)
+    files = response.json()["files"]
+    assert sorted(files) == ["/notes.md", "/plan.md"]
+    assert files["/plan.md"]["content"] == "# Plan v1"
+    assert files["/plan.md"]["version"] == 2
+    assert files["/notes.md"]["content"] == "# Notes"
+
+
+@pytest.mark.asyncio
+async def test_list_proposals_filters_by_status(test_client: AsyncClient, test_db, jwt_manager):
+    """Test a workflow's proposals are listed newest first and survive publishing the draft."""
+    user_email = f"list-proposals-{int(time.time() * 1000000)}@example.com"
+    user_id = test_db.create_test_user(user_email, "hashed-password")
+    token = await jwt_manager.generate_token(user_id, user_email, [], 24 * 3600)
+    headers = {"Authorization": f"Bearer {token}"}
+    workflow_id = test_db.create_test_workflow(user_id, "History Workflow", "Has proposals")
+    
+    orchestration_service = get_orchestration_service()
+    proposal_service = orchestration_service.proposal_service
+    draft_id = await orchestration_service.get_or_create_draft(workflow_id, user_id)
+    approved_id = proposal_service.create_proposal(
+        draft_id, f"test-thread-{uuid.uuid4()}", user_id, "First change", {}
+    )
+    test_db.set_proposal_status(approved_id, "completed")
+    proposal_service.resolve_proposal(approved_id, "approved", user_id, "{}")
+    processing_id = proposal_service.create_proposal(
+        draft_id, f"test-thread-{uuid.uuid4()}", user_id, "Second change", {}
+    )
+    
+    response = await test_client.get(f"/api/workflows/{workflow_id}/proposals", headers=headers)
+    assert response.status_code == 200
+    proposals = response.json()["proposals"]
+    assert [p["id"] for p in proposals] == [processing_id, approved_id]
+    assert set(proposals[0]) >= {"id", "status", "user_prompt", "created_at", "completed_at", "resolved_at"}
+    
+    response = await test_client.get(
+        f"/api/workflows/{workflow_id}/proposals", params={"status": "approved"}, headers=headers
+    )
+    assert [p["id"] for p in response.json()["proposals"]] == [approved_id]
+    
+    response = await test_client.get(
+        f"/api/workflows/{workflow_id}/proposals", params={"status": "processing"}, headers=headers
+    )
+    assert [p["id"] for p in response.json()["proposals"]] == [processing_id]
+    
+    response = await test_client.get(
+        f"/api/workflows/{workflow_id}/proposals", params={"status": "bogus"}, headers=headers
+    )
+    assert response.status_code == 400
+    
+    # Approved proposals stay listed once their draft is gone
+    await test_client.delete(f"/api/workflows/{workflow_id}/draft", headers=headers)
+    response = await test_client.get(f"/api/workflows/{workflow_id}/proposals", headers=headers)
+    assert [p["id"] for p in response.json()["proposals"]] == [approved_id]
+
+
+@pytest.mark.asyncio
+async def test_list_proposals_filters_by_file(test_client: AsyncClient, test_db, jwt_manager):
+    """Test ?file= only lists proposals scoped to that file path."""
+    user_email = f"file-proposals-{int(time.time() * 1000000)}@example.com"
+    user_id = test_db.create_test_user(user_email, "hashed-password")
+    token = await jwt_manager.generate_token(user_id, user_email, [], 24 * 3600)
+    headers = {"Authorization": f"Bearer {token}"}
+    workflow_id = test_db.create_test_workflow(user_id, "File Workflow", "Has file-scoped proposals")
+    
+    orchestration_service = get_orchestration_service()
+    proposal_service = orchestration_service.proposal_service
+    draft_id = await orchestration_service.get_or_create_draft(workflow_id, user_id)
+    plan_id = proposal_service.create_proposal(
+        draft_id, f"test-thread-{uuid.uuid4()}", user_id, "Tighten the plan", {}, context_file_path="/plan.md"
+    )
+    proposal_service.create_proposal(
+        draft_id, f"test-thread-{uuid.uuid4()}", user_id, "Rename a tool", {}, context_file_path="/tools.md"
+    )
+    proposal_service.create_proposal(
+        draft_id, f"test-thread-{uuid.uuid4()}", user_id, "Whole workflow", {}
+    )
+    
+    response = await test_client.get(
+        f"/api/workflows/{workflow_id}/proposals", params={"file": "/plan.md"}, headers=headers
+    )
+    assert response.status_code == 200
+    proposals = response.json()["proposals"]
+    assert [p["id"] for p in proposals] == [plan_id]
+    assert proposals[0]["context_file_path"] == "/plan.md"
+    
+    response = await test_client.get(
+        f"/api/workflows/{workflow_id}/proposals", params={"file": "/missing.md"}, headers=headers
+    )
+    assert response.json()["proposals"] == []
+
+
+
+@pytest.mark.asyncio
+async def test_list_proposals_pages_sorts_and_filters_by_time(test_client: AsyncClient, test_db, jwt_manager):
+    """Test proposal listing reports the total, pages with limit/offset, sorts and filters by creation time."""
+    user_email = f"page-proposals-{int(time.time() * 1000000)}@example.com"
+    user_id = test_db.create_test_user(user_email, "hashed-password")
+    token = await jwt_manager.generate_token(user_id, user_email, [], 24 * 3600)
+    headers = {"Authorization": f"Bearer {token}"}
+    workflow_id = test_db.create_test_workflow(user_id, "Paged Workflow", "Has many proposals")
+    
+    orchestration_service = get_orchestration_service()
+    proposal_service = orchestration_service.proposal_service
+    draft_id = await orchestration_service.get_or_create_draft(workflow_id, user_id)
+    first_id, second_id, third_id = [
+        proposal_service.create_proposal(draft_id, f"test-thread-{uuid.uuid4()}", user_id, prompt, {})
+        for prompt in ("First", "Second", "Third")
+    ]
+    await orchestration_service.update_proposal_files(third_id, {"/plan.md": {"content": "# Third"}})
+    await orchestration_service.update_proposal_files(first_id, {"/plan.md": {"content": "# First"}})
+    url = f"/api/workflows/{workflow_id}/proposals"
+    
+    response = await test_client.get(url, params={"limit": 2}, headers=headers)
+    assert response.status_code == 200
+    assert response.json()["total"] == 3
+    assert [p["id"] for p in response.json()["proposals"]] == [third_id, second_id]
+    
+    response = await test_client.get(url, params={"limit": 2, "offset": 2}, headers=headers)
+    assert response.json()["total"] == 3
+    assert [p["id"] for p in response.json()["proposals"]] == [first_id]
+    
+    response = await test_client.get(url, params={"sort": "completed_at"}, headers=headers)
+    assert [p["id"] for p in response.json()["proposals"]] == [third_id, first_id, second_id]
+    
+    first_created_at = response.json()["proposals"][1]["created_at"]
+    response = await test_client.get(
+        url, params={"sort": "created_at", "created_after": first_created_at, "draft_id": draft_id}, headers=headers
+    )
+    assert response.json()["total"] == 2
+    assert [p["id"] for p in response.json()["proposals"]] == [second_id, third_id]
+    
+    response = await test_client.get(url, params={"sort": "created_at; DROP TABLE proposals"}, headers=headers)
+    assert response.status_code == 400
+
+@pytest.mark.asyncio
+async def test_workflow_stats_count_proposals_by_status(test_client: AsyncClient, test_db, jwt_manager):
+    """Test the stats endpoint counts the draft's proposals per status, resolved ones by resolution."""
+    user_email = f"stats-{int(time.time() * 1000000)}@example.com"
+    user_id = test_db.create_test_user(user_email, "hashed-password")
+    token = await jwt_manager.generate_token(user_id, user_email, [], 24 * 3600)
+    headers = {"Authorization": f"Bearer {token}"}
+    workflow_id = test_db.create_test_workflow(user_id, "Stats Workflow", "Has proposals in every state")
+    
+    orchestration_service = get_orchestration_service()
+    proposal_service = orchestration_service.proposal_service
+    draft_id = await orchestration_service.get_or_create_draft(workflow_id, user_id)
+    proposal_ids = {}
+    for status in ("pending", "processing", "processing", "completed", "failed", "approved", "approved", "rejected"):
+        proposal_id = proposal_service.create_proposal(
+            draft_id, f"test-thread-{uuid.uuid4()}", user_id, f"Make it {status}", {}
+        )
+        proposal_ids.setdefault(status, []).append(proposal_id)
+    
+    conn = test_db.connect()
+    with conn.cursor() as cur:
+        for status in ("pending", "completed", "failed"):
+            cur.execute("UPDATE proposals SET status = %s WHERE id = %s", (status, proposal_ids[status][0]))
+        conn.commit()
+    for resolution in ("approved", "rejected"):
+        for proposal_id in proposal_ids[resolution]:
+            test_db.set_proposal_status(proposal_id, "completed")
+            proposal_service.resolve_proposal(proposal_id, resolution, user_id, "{}")
+    
+    response = await test_client.get(f"/api/workflows/{workflow_id}/stats", headers=headers)
+    
+    assert response.status_code == 200
+    assert response.json()["proposals_by_status"] == {
+        "pending": 1,
+        "processing": 2,
+        "completed": 1,
+        "approved": 2,
+        "rejected": 1,
+        "failed": 1,
+        "cancelled": 0
+    }
+
+@pytest.mark.asyncio
+async def test_workflow_field_lengths_are_bounded(test_client: AsyncClient, test_db, jwt_manager):
+    """Test over-long names and descriptions are refused with 400 and per-field details."""
+    user_email = f"bounded-{int(time.time() * 1000000)}@example.com"
+    user_id = test_db.create_test_user(user_email, "hashed-password")
+    token = await jwt_manager.generate_token(user_id, user_email, [], 24 * 3600)
+    headers = {"Authorization": f"Bearer {token}"}
+    
+    response = await test_client.post("/api/workflows", json={"name": "n" * 201}, headers=headers)
+    
+    assert response.status_code == 400
+    assert set(response.json()["detail"]["fields"]) == {"name"}
+    
+    response = await test_client.post(
+        "/api/workflows", json={"name": "Fine", "description": "d" * 2001}, headers=headers
+    )
+    assert response.status_code == 400
+    assert set(response.json()["detail"]["fields"]) == {"description"}
+    
+    response = await test_client.post(
+        "/api/workflows", json={"name": "n" * 200, "description": "d" * 2000}, headers=headers
+    )
+    assert response.status_code == 201
+
+
+@pytest.mark.asyncio
+async def test_create_workflow_from_starter_template(test_client: AsyncClient, test_db, jwt_manager):
+    """Test a template_id seeds the new workflow's draft with the template's files."""
+    user_email = f"template-{int(time.time() * 1000000)}@example.com"
+    user_id = test_db.create_test_user(user_email, "hashed-password")
+    token = await jwt_manager.generate_token(user_id, user_email, [], 24 * 3600)
+    headers = {"Authorization": f"Bearer {token}"}
+    
+    response = await test_client.post(
+        "/api/workflows", json={"name": "Starter", "template_id": "single-agent"}, headers=headers
+    )
+    
+    assert response.status_code == 201
+    workflow_id = response.json()["id"]
+    response = await test_client.get(f"/api/workflows/{workflow_id}/draft", headers=headers)
+    assert response.status_code == 200
+    files = response.json()["files"]
+    assert set(files) == {"/definition.json", "/README.md"}
+    assert files["/definition.json"]["type"] == "json"
+    assert '"entryPoint": "specialist_1"' in files["/definition.json"]["content"]
+    
+    response = await test_client.post(
+        "/api/workflows", json={"name": "Unknown", "template_id": "no-such-template"}, headers=headers
+    )
+    assert response.status_code == 400
+
+def test_deploy_invalidates_cached_production_version(test_db):
+    """Test a deploy replaces the cached production version id."""
+    user_id = test_db.create_test_user(f"prod-cache-{int(time.time() * 1000000)}@example.com", "hashed-password")
+    workflow_id = test_db.create_test_workflow(user_id, "Cached Workflow", "Production is cached")
+    test_db.create_test_version(workflow_id, user_id, 1, {"/plan.md": "# v1"})
+    version_2_id = test_db.create_test_version(workflow_id, user_id, 2, {"/plan.md": "# v2"})
+    workflow_service = get_workflow_service()
+    
+    workflow_service.deploy_version(workflow_id, 1, user_id)
+    assert workflow_service.get_production_version(workflow_id)["version_number"] == 1
+    
+    workflow_service.deploy_version(workflow_id, 2, user_id)
+    production = workflow_service.get_production_version(workflow_id)
+    assert production["id"] == version_2_id
+    assert production["version_number"] == 2
+
+
+@pytest.mark.asyncio
+async def test_workflow_sharing_roles(test_client: AsyncClient, test_db, jwt_manager):
+    """Test shared editors can write, viewers can only read, and only the owner manages access."""
+    suffix = int(time.time() * 1000000)
+    owner_id = test_db.create_test_user(f"share-owner-{suffix}@example.com", "hashed-password")
+    editor_email = f"share-editor-{suffix}@example.com"
+    editor_id = test_db.create_test_user(editor_email, "hashed-password")
+    viewer_email = f"share-viewer-{suffix}@example.com"
+    viewer_id = test_db.create_test_user(viewer_email, "hashed-password")
+    owner_headers = {"Authorization": f"Bearer {await jwt_manager.generate_token(owner_id, 'owner', [], 24 * 3600)}"}
+    editor_headers = {"Authorization": f"Bearer {await jwt_manager.generate_token(editor_id, editor_email, [], 24 * 3600)}"}
+    viewer_headers = {"Authorization": f"Bearer {await jwt_manager.generate_token(viewer_id, viewer_email, [], 24 * 3600)}"}
+    workflow_id = test_db.create_test_workflow(owner_id, "Shared Workflow", "Has collaborators")
+    test_db.create_test_version(workflow_id, owner_id, 1, {"/plan.md": "# v1"})
+    
+    response = await test_client.get(f"/api/workflows/{workflow_id}", headers=viewer_headers)
+    assert response.status_code == 404
+    
+    response = await test_client.post(
+        f"/api/workflows/{workflow_id}/share",
+        json={"email": editor_email.upper(), "access_type": "editor"},
+        headers=owner_headers
+    )
+    assert response.status_code == 200
+    assert response.json()["user_id"] == editor_id
+    assert response.json()["access_type"] == "editor"
+    response = await test_client.post(
+        f"/api/workflows/{workflow_id}/share",
+        json={"email": viewer_email, "access_type": "viewer"},
+        headers=owner_headers
+    )
+    assert response.status_code == 200
+    
+    response = await test_client.get(f"/api/workflows/{workflow_id}", headers=viewer_headers)
+    assert response.status_code == 200
+    assert response.json()["access_type"] == "viewer"
+    
+    # Viewers are refused writes
+    response = await test_client.post(
+        f"/api/workflows/{workflow_id}/refinements", json={"instructions": "Change it"}, headers=viewer_headers
+    )
+    assert response.status_code == 403
+    response = await test_client.post(f"/api/workflows/{workflow_id}/versions", headers=viewer_headers)
+    assert response.status_code == 403
+    response = await test_client.post(
+        f"/api/workflows/{workflow_id}/deploy", json={"version_number": 1}, headers=viewer_headers
+    )
+    assert response.status_code == 403
+    
+    # Editors can write but cannot manage access
+    response = await test_client.post(
+        f"/api/workflows/{workflow_id}/deploy", json={"version_number": 1}, headers=editor_headers
+    )
+    assert response.status_code == 200
+    response = await test_client.post(
+        f"/api/workflows/{workflow_id}/share",
+        json={"email": viewer_email, "access_type": "editor"},
+        headers=editor_headers
+    )
+    assert response.status_code == 403
+    
+    response = await test_client.post(
+        f"/api/workflows/{workflow_id}/share",
+        json={"email": f"nobody-{suffix}@example.com"},
+        headers=owner_headers
+    )
+    assert response.status_code == 404
+    
+    response = await test_client.delete(f"/api/workflows/{workflow_id}/share/{viewer_id}", headers=owner_headers)
+    assert response.status_code == 200
+    response = await test_client.get(f"/api/workflows/{workflow_id}", headers=viewer_headers)
+    assert response.status_code == 404
+    response = await test_client.delete(f"/api/workflows/{workflow_id}/share/{viewer_id}", headers=owner_headers)
+    assert response.status_code == 404
+
+
+def test_get_versions_rows_match_raw_query(test_db):
+    """Test versions scanned by the json_row factory match the raw rows with UUIDs as strings."""
+    user_id = test_db.create_test_user(f"versions-rows-{int(time.time() * 1000000)}@example.com", "hashed-password")
+    workflow_id = test_db.create_test_workflow(user_id, "Versioned Workflow", "Has versions")
+    version_1_id = test_db.create_test_version(workflow_id, user_id, 1, {"/plan.md": "# v1"})
+    version_2_id = test_db.create_test_version(workflow_id, user_id, 2, {"/plan.md": "# v2"})
+    
+    conn = test_db.connect()
+    with conn.cursor() as cur:
+        cur.execute(
+            "SELECT id, version_number, status, created_at FROM versions WHERE workflow_id = %s ORDER BY version_number DESC",
+            (workflow_id,)
+        )
+        expected = [dict(row, id=str(row["id"])) for row in cur.fetchall()]
+    
+    versions = get_workflow_service().get_versions(workflow_id)
+    
+    assert versions == expected
+    assert [v["id"] for v in versions] == [version_2_id, version_1_id]
+    assert all(isinstance(v["id"], str) and isinstance(v["version_number"], int) for v in versions)
+
+
+@pytest.mark.asyncio
+async def test_versions_expand_publisher(test_client: AsyncClient, test_db, jwt_manager):
+    """Test ?expand=publisher nests the publishing user in each version and the default stays lean."""
+    user_email = f"publisher-{int(time.time() * 1000000)}@example.com"
+    user_id = test_db.create_test_user(user_email, "hashed-password")
+    token = await jwt_manager.generate_token(user_id, user_email, [], 24 * 3600)
+    headers = {"Authorization": f"Bearer {token}"}
+    workflow_id = test_db.create_test_workflow(user_id, "Published Workflow", "Has a publisher")
+    test_db.create_test_version(workflow_id, user_id, 1, {"/plan.md": "# v1"})
+    
+    response = await test_client.get(f"/api/workflows/{workflow_id}/versions", headers=headers)
+    assert response.status_code == 200
+    assert "publisher" not in response.json()["versions"][0]
+    
+    response = await test_client.get(f"/api/workflows/{workflow_id}/versions?expand=publisher", headers=headers)
+    assert response.status_code == 200
+    assert response.json()["versions"][0]["publisher"] == {
+        "id": user_id,
+        "name": "Test User",
+        "email": user_email,
+    }
+    
+    response = await test_client.get(f"/api/workflows/{workflow_id}/versions?expand=files", headers=headers)
+    assert response.status_code == 422
+
+
+@pytest.mark.asyncio
+async def test_publish_refuses_structurally_invalid_definition(test_client: AsyncClient, test_db, jwt_manager):
+    """Test publishing answers 422 with the issues when the workflow graph cannot run."""
+    user_email = f"invalid-publish-{int(time.time() * 1000000)}@example.com"
+    user_id = test_db.create_test_user(user_email, "hashed-password")
+    token = await jwt_manager.generate_token(user_id, user_email, [], 24 * 3600)
+    headers = {"Authorization": f"Bearer {token}"}
+    workflow_id = test_db.create_test_workflow(user_id, "Invalid Workflow", "Has no start node")
+    definition = {
+        "nodes": [{"id": "agent", "type": "agent", "data": {"prompt": ""}}, {"id": "end", "type": "end"}],
+        "edges": [{"id": "agent-to-end", "source": "agent", "target": "end"}]
+    }
+    
+    orchestration_service = get_orchestration_service()
+    draft_id = await orchestration_service.get_or_create_draft(workflow_id, user_id)
+    orchestration_service.draft_service.apply_files_to_draft(
+        draft_id, {"/definition.json": {"content": json.dumps(definition), "type": "json"}}
+    )
+    
+    response = await test_client.post(f"/api/workflows/{workflow_id}/versions", headers=headers)
+    
+    assert response.status_code == 422
+    assert [issue["code"] for issue in response.json()["detail"]["issues"]] == [
+        "missing_agent_prompt", "missing_start_node"
+    ]
+    assert get_workflow_service().get_versions(workflow_id) == []
+
+
+@pytest.mark.asyncio
+async def test_publish_flags_json_files_that_do_not_parse(test_client: AsyncClient, test_db, jwt_manager, monkeypatch):
+    """Test an unparseable .json file is listed as a publish warning, or refuses the publish when the lint is an error."""
+    user_email = f"json-lint-{int(time.time() * 1000000)}@example.com"
+    user_id = test_db.create_test_user(user_email, "hashed-password")
+    token = await jwt_manager.generate_token(user_id, user_email, [], 24 * 3600)
+    headers = {"Authorization": f"Bearer {token}"}
+    definition = {
+        "nodes": [{"id": "start", "type": "start"}, {"id": "end", "type": "end"}],
+        "edges": [{"id": "start-to-end", "source": "start", "target": "end"}]
+    }
+    files = {
+        "/definition.json": {"content": json.dumps(definition), "type": "json"},
+        "/config/tools.json": {"content": '{"tools": [', "type": "json"}
+    }
+    
+    orchestration_service = get_orchestration_service()
+    workflow_id = test_db.create_test_workflow(user_id, "Strict Workflow", "Has a broken JSON file")
+    draft_id = await orchestration_service.get_or_create_draft(workflow_id, user_id)
+    orchestration_service.draft_service.apply_files_to_draft(draft_id, files)
+    
+    monkeypatch.setenv("PUBLISH_JSON_LINT", "error")
+    response = await test_client.post(f"/api/workflows/{workflow_id}/versions", headers=headers)
+    
+    assert response.status_code == 422
+    assert [(issue["code"], issue["path"]) for issue in response.json()["detail"]["issues"]] == [
+        ("invalid_json", "/config/tools.json")
+    ]
+    assert get_workflow_service().get_versions(workflow_id) == []
+    
+    monkeypatch.setenv("PUBLISH_JSON_LINT", "warn")
+    response = await test_client.post(f"/api/workflows/{workflow_id}/versions", headers=headers)
+    
+    assert response.status_code == 201
+    assert [(issue["code"], issue["path"]) for issue in response.json()["warnings"]] == [
+        ("invalid_json", "/config/tools.json")
+    ]
+
+
+@pytest.mark.asyncio
+async def test_transfer_flips_workflow_access(test_client: AsyncClient, test_db, jwt_manager):
+    """Test a transfer hands every permission to the new owner and is recorded in the audit trail."""
+    suffix = int(time.time() * 1000000)
+    old_owner_email = f"flip-old-{suffix}@example.com"
+    old_owner_id = test_db.create_test_user(old_owner_email, "hashed-password")
+    new_owner_email = f"flip-new-{suffix}@example.com"
+    new_owner_id = test_db.create_test_user(new_owner_email, "hashed-password")
+    old_headers = {"Authorization": f"Bearer {await jwt_manager.generate_token(old_owner_id, old_owner_email, [], 24 * 3600)}"}
+    new_headers = {"Authorization": f"Bearer {await jwt_manager.generate_token(new_owner_id, new_owner_email, [], 24 * 3600)}"}
+    workflow_id = test_db.create_test_workflow(old_owner_id, "Flipped Workflow", "Changes hands")
+    test_db.create_test_version(workflow_id, old_owner_id, 1, {"/plan.md": "# v1"})
+    
+    response = await test_client.post(
+        f"/api/workflows/{workflow_id}/transfer", json={"user_id": old_owner_id}, headers=old_headers
+    )
+    assert response.status_code == 409
+    
+    response = await test_client.post(
+        f"/api/workflows/{workflow_id}/transfer", json={"user_id": new_owner_id}, headers=old_headers
+    )
+    assert response.status_code == 200
+    
+    response = await test_client.get(f"/api/workflows/{workflow_id}", headers=new_headers)
+    assert response.status_code == 200
+    assert response.json()["created_by_user_id"] == new_owner_id
+    assert response.json()["access_type"] == "owner"
+    response = await test_client.post(
+        f"/api/workflows/{workflow_id}/deploy", json={"version_number": 1}, headers=new_headers
+    )
+    assert response.status_code == 200
+    
+    response = await test_client.get(f"/api/workflows/{workflow_id}/versions", headers=old_headers)
+    assert response.status_code == 404
+    
+    # The previous owner only gets back in as a collaborator
+    response = await test_client.post(
+        f"/api/workflows/{workflow_id}/share",
+        json={"email": old_owner_email, "access_type": "viewer"},
+        headers=new_headers
+    )
+    assert response.status_code == 200
+    response = await test_client.get(f"/api/workflows/{workflow_id}/versions", headers=old_headers)
+    assert response.status_code == 200
+    response = await test_client.post(
+        f"/api/workflows/{workflow_id}/deploy", json={"version_number": 1}, headers=old_headers
+    )
+    assert response.status_code == 403
+    
+    conn = test_db.connect()
+    with conn.cursor() as cur:
+        cur.execute(
+            "SELECT user_id, details FROM workflow_audit_events WHERE workflow_id = %s AND action = %s",
+            (workflow_id, "ownership_transferred")
+        )
+        audit_event = cur.fetchone()
+    assert str(audit_event["user_id"]) == old_owner_id
+    assert audit_event["details"] == {"previous_owner_id": old_owner_id, "new_owner_id": new_owner_id}
+
+
+@pytest.mark.asyncio
+async def test_workflow_event_history(test_client: AsyncClient, test_db, jwt_manager):
+    """Test lifecycle transitions are replayed in version order and stale writers conflict."""
+    from services.event_store import EventStore, EventVersionConflict
+    
+    user_email = f"events-{int(time.time() * 1000000)}@example.com"
+    user_id = test_db.create_test_user(user_email, "hashed-password")
+    token = await jwt_manager.generate_token(user_id, user_email, [], 24 * 3600)
+    headers = {"Authorization": f"Bearer {token}"}
+    
+    response = await test_client.post("/api/workflows", json={"name": "Evented Workflow"}, headers=headers)
+    workflow_id = response.json()["id"]
+    test_db.create_test_version(workflow_id, user_id, 1, {"/plan.md": "# v1"})
+    response = await test_client.post(
+        f"/api/workflows/{workflow_id}/deploy", json={"version_number": 1}, headers=headers
+    )
+    assert response.status_code == 200
+    
+    response = await test_client.get(f"/api/workflows/{workflow_id}/events", headers=headers)
+    assert response.status_code == 200
+    events = response.json()["events"]
+    assert [(e["version"], e["event_type"]) for e in events] == [(1, "workflow.created"), (2, "version.deployed")]
+    assert events[1]["data"]["version_number"] == 1
+    
+    response = await test_client.get(f"/api/workflows/{workflow_id}/events?after_version=1", headers=headers)
+    assert [e["version"] for e in response.json()["events"]] == [2]
+    
+    # A writer that last saw version 1 loses against the deploy
+    conn = test_db.connect()
+    with pytest.raises(EventVersionConflict):
+        with conn.cursor() as cur:
+            EventStore.append_event(cur, workflow_id, "workflow.renamed", {}, expected_version=1)
+    conn.rollback()
+    
+    other_email = f"events-other-{int(time.time() * 1000000)}@example.com"
+    other_id = test_db.create_test_user(other_email, "hashed-password")
+    other_token = await jwt_manager.generate_token(other_id, other_email, [], 24 * 3600)
+    response = await test_client.get(
+        f"/api/workflows/{workflow_id}/events", headers={"Authorization": f"Bearer {other_token}"}
+    )
+    assert response.status_code == 404
+
+
+def test_audit_events_keep_insertion_order(test_db):
+    """Test audit events recorded in one transaction are listed in the order they happened."""
+    user_id = test_db.create_test_user(f"audit-order-{uuid.uuid4()}@example.com", "hashed-password")
+    workflow_id = test_db.create_test_workflow(user_id, "Audited Workflow", "Busy audit trail")
+    actions = [f"action_{i}" for i in range(5)]
+    
+    # NOW() would give every event of the transaction the same timestamp
+    conn = test_db.connect()
+    with conn.cursor() as cur:
+        for action in actions:
+            AuditService.record_workflow_event(cur, workflow_id, user_id, action)
+        conn.commit()
+    
+    with conn.cursor() as cur:
+        cur.execute(
+            """
+            SELECT action, sequence, created_at FROM workflow_audit_events
+            WHERE workflow_id = %s ORDER BY sequence
+            """,
+            (workflow_id,)
+        )
+        events = cur.fetchall()
+        conn.commit()
+    
+    assert [event["action"] for event in events] == actions
+    timestamps = [event["created_at"] for event in events]
+    assert timestamps == sorted(timestamps)
+    assert len(set(event["sequence"] for event in events)) == len(actions)
@@ -0,0 +1,71 @@
+"""
+Tests for the cached agent capabilities lookup.
+"""
+
+import pytest
+
+from services.agent_capabilities import AgentCapabilitiesService
+
+CAPABILITIES = {"agents": [{"type": "builder", "version": "1.0.0", "config_schema": {}}]}
+
+
+class FakeClock:
+    """Manually advanced monotonic clock."""
+
+    def __init__(self):
+        self.now = 0.0
+
+    def __call__(self) -> float:
+        return self.now
+
+
+class FakeRuntimeClient:
+    """Runtime client returning queued capabilities responses (or raising queued errors)."""
+
+    def __init__(self, responses):
+        self.responses = list(responses)
+        self.calls = 0
+
+    async def get_capabilities(self):
+        self.calls += 1
+        response = self.responses.pop(0)
+        if isinstance(response, Exception):
+            raise response
+        return response
+
+
+@pytest.mark.asyncio
+async def test_capabilities_are_cached_until_expiry():
+    """Repeated lookups within the cache window don't hit the runtime."""
+    clock = FakeClock()
+    client = FakeRuntimeClient([CAPABILITIES, {"agents": []}])
+    service = AgentCapabilitiesService(client, cache_seconds=60, clock=clock)
+
+    assert await service.get_capabilities() == {"agents": CAPABILITIES["agents"], "available": True}
+    clock.now = 59
+    assert (await service.get_capabilities())["agents"] == CAPABILITIES["agents"]
+    assert client.calls == 1
+
+    clock.now = 61
+    assert (await service.get_capabilities())["agents"] == []
+    assert client.calls == 2
+
+
+@pytest.mark.asyncio
+async def test_missing_endpoint_and_errors_fall_back():
+    """An absent endpoint or runtime failure yields an unavailable answer, or the stale cache."""
+    clock = FakeClock()
+    client = FakeRuntimeClient([None, Exception("connection refused"), CAPABILITIES, Exception("boom")])
+    service = AgentCapabilitiesService(client, cache_seconds=10, clock=clock)
+
+    assert await service.get_capabilities() == {"agents": [], "available": False}
+
+    clock.now = 11
+    assert await service.get_capabilities() == {"agents": [], "available": False}
+
+    assert (await service.get_capabilities())["available"] is True
+
+    clock.now = 30
+    stale = await service.get_capabilities()
+    assert stale == {"agents": CAPABILITIES["agents"], "available": True}
+    assert client.calls == 4
@@ -0,0 +1,127 @@
+"""
+Tests for database pool settings, the statement timeout and the startup connection retry.
+"""
+
+import asyncio
+import time
+
+import psycopg
+import pytest
+
+from core import database
+from core.database import (
+    DatabaseUnavailableError,
+    connect_with_retry,
+    get_connection_kwargs,
+    get_pool_settings,
+    get_pool_stats,
+)
+
+
+def refuse_connections(monkeypatch):
+    """Make every connection attempt fail; returns the attempts seen."""
+    attempts = []
+
+    def connect(*args, **kwargs):
+        attempts.append(kwargs)
+        raise psycopg.OperationalError("connection refused")
+
+    monkeypatch.setattr(psycopg, "connect", connect)
+    return attempts
+
+
+@pytest.mark.asyncio
+async def test_connect_retries_until_database_is_up(monkeypatch):
+    """Failed attempts are retried until a connection is made."""
+    monkeypatch.setattr(database, "DB_CONNECT_BASE_DELAY_SECONDS", 0.01)
+    connection = object()
+    attempts = []
+
+    def connect(*args, **kwargs):
+        attempts.append(kwargs)
+        if len(attempts) < 3:
+            raise psycopg.OperationalError("connection refused")
+        return connection
+
+    monkeypatch.setattr(psycopg, "connect", connect)
+
+    assert await connect_with_retry("postgresql://unused", 5) is connection
+    assert len(attempts) == 3
+
+
+@pytest.mark.asyncio
+async def test_connect_gives_up_after_timeout(monkeypatch):
+    """An unreachable database raises a clear error once the timeout has passed."""
+    monkeypatch.setattr(database, "DB_CONNECT_BASE_DELAY_SECONDS", 0.01)
+    attempts = refuse_connections(monkeypatch)
+
+    with pytest.raises(DatabaseUnavailableError, match="Database unreachable"):
+        await connect_with_retry("postgresql://unused", 0.1)
+
+    assert len(attempts) > 1
+
+
+@pytest.mark.asyncio
+async def test_connect_returns_promptly_when_cancelled(monkeypatch):
+    """Cancelling startup stops the retry loop instead of waiting out the backoff."""
+    monkeypatch.setattr(database, "DB_CONNECT_BASE_DELAY_SECONDS", 30)
+    attempts = refuse_connections(monkeypatch)
+    task = asyncio.create_task(connect_with_retry("postgresql://unused", 600))
+    while not attempts:
+        await asyncio.sleep(0.01)
+
+    started = time.monotonic()
+    task.cancel()
+    with pytest.raises(asyncio.CancelledError):
+        await task
+
+    assert time.monotonic() - started < 1
+    assert len(attempts) == 1
+
+
+class FakePool:
+    """Pool reporting fixed psycopg_pool statistics."""
+
+    def __init__(self, pool_size, pool_available):
+        self.stats = {"pool_size": pool_size, "pool_available": pool_available, "requests_num": 7}
+
+    def get_stats(self):
+        return self.stats
+
+
+def test_pool_settings_read_from_environment(monkeypatch):
+    """DB_POOL_* variables size the pool, with defaults for the unset ones."""
+    monkeypatch.setenv("DB_POOL_MAX_CONNS", "25")
+    monkeypatch.setenv("DB_POOL_MAX_CONN_IDLE_TIME", "30")
+    monkeypatch.delenv("DB_POOL_MIN_CONNS", raising=False)
+    monkeypatch.delenv("DB_POOL_MAX_CONN_LIFETIME", raising=False)
+
+    assert get_pool_settings() == {
+        "min_size": database.DEFAULT_DB_POOL_MIN_CONNS,
+        "max_size": 25,
+        "max_lifetime": database.DEFAULT_DB_POOL_MAX_CONN_LIFETIME_SECONDS,
+        "max_idle": 30,
+    }
+
+    monkeypatch.setenv("DB_POOL_MIN_CONNS", "30")
+    with pytest.raises(ValueError, match="DB_POOL_MIN_CONNS"):
+        get_pool_settings()
+
+
+def test_statement_timeout_becomes_a_connection_option(monkeypatch):
+    """DB_STATEMENT_TIMEOUT is passed to PostgreSQL in milliseconds, and 0 turns it off."""
+    monkeypatch.delenv("DB_STATEMENT_TIMEOUT", raising=False)
+    assert get_connection_kwargs() == {"options": "-c statement_timeout=30000"}
+
+    monkeypatch.setenv("DB_STATEMENT_TIMEOUT", "2.5")
+    assert get_connection_kwargs() == {"options": "-c statement_timeout=2500"}
+
+    monkeypatch.setenv("DB_STATEMENT_TIMEOUT", "0")
+    assert get_connection_kwargs() == {}
+
+
+def test_pool_stats_add_up_all_pools(monkeypatch):
+    """Acquired connections are the pools' open connections that are not idle."""
+    monkeypatch.setattr(database, "_pools", {"a": FakePool(5, 2), "b": FakePool(3, 3)})
+
+    assert get_pool_stats() == {"acquired": 3, "idle": 5, "total": 8}
@@ -0,0 +1,262 @@
+"""
+Tests for the deepagents-runtime HTTP client.
+
+Requests are served by an httpx mock transport, so no runtime is needed.
+"""
+
+import asyncio
+import json
+
+import httpx
+import pybreaker
+import pytest
+from prometheus_client import REGISTRY
+
+from core.request_context import reset_request_id, set_request_id
+from services import deepagents_client
+from services.deepagents_client import (
+    CancelEvent,
+    DeepAgentsRuntimeClient,
+    InvalidRuntimeResponse,
+    breaker_listener,
+    deepagents_breaker,
+    get_operation_timeout,
+)
+
+
+@pytest.fixture(autouse=True)
+def closed_breaker():
+    """Start every test with a closed circuit breaker, whatever earlier failures did to it."""
+    deepagents_breaker.close()
+    yield
+    deepagents_breaker.close()
+
+
+def serve_runtime(monkeypatch, status_code, body=None):
+    """Answer every runtime request with the given status code and JSON body; returns the requests seen."""
+    requests = []
+
+    def handle(request):
+        requests.append(request)
+        return httpx.Response(status_code, json=body)
+
+    transport = httpx.MockTransport(handle)
+    async_client = httpx.AsyncClient
+    monkeypatch.setattr(
+        deepagents_client.httpx, "AsyncClient",
+        lambda **kwargs: async_client(transport=transport, **kwargs)
+    )
+    return requests
+
+
+def serve_unreachable_runtime(monkeypatch):
+    """Fail every runtime request with a connection error; returns the requests attempted."""
+    requests = []
+
+    def handle(request):
+        requests.append(request)
+        raise httpx.ConnectError("connection refused", request=request)
+
+    transport = httpx.MockTransport(handle)
+    async_client = httpx.AsyncClient
+    monkeypatch.setattr(
+        deepagents_client.httpx, "AsyncClient",
+        lambda **kwargs: async_client(transport=transport, **kwargs)
+    )
+    return requests
+
+
+def breaker_rejections(endpoint: str) -> float:
+    """Read the breaker rejection counter for an endpoint, treating a missing series as zero."""
+    value = REGISTRY.get_sample_value(
+        "ide_orchestrator_deepagents_circuit_breaker_rejections_total", {"endpoint": endpoint}
+    )
+    return value or 0.0
+
+
+def serve_slow_runtime(monkeypatch, delay, status_code, body=None):
+    """Answer every runtime request after delay seconds."""
+    async def handle(request):
+        await asyncio.sleep(delay)
+        return httpx.Response(status_code, json=body)
+
+    transport = httpx.MockTransport(handle)
+    async_client = httpx.AsyncClient
+    monkeypatch.setattr(
+        deepagents_client.httpx, "AsyncClient",
+        lambda **kwargs: async_client(transport=transport, **kwargs)
+    )
+
+
+@pytest.mark.asyncio
+async def test_accepted_invoke_returns_thread_id(monkeypatch):
+    """A 202 Accepted response with a thread_id is a successful invoke."""
+    serve_runtime(monkeypatch, 202, {"thread_id": "thread-1"})
+
+    result = await DeepAgentsRuntimeClient("http://runtime").invoke_job({"job_id": "job-1"})
+
+    assert result["thread_id"] == "thread-1"
+
+
+@pytest.mark.asyncio
+@pytest.mark.parametrize("body", [{"thread_id": ""}, {"thread_id": "  "}, {"thread_id": None}, {}])
+async def test_accepted_invoke_without_thread_id_fails(monkeypatch, body):
+    """An accepted job without a usable thread_id is an error instead of an empty thread id."""
+    serve_runtime(monkeypatch, 202, body)
+
+    with pytest.raises(InvalidRuntimeResponse, match="without a thread_id"):
+        await DeepAgentsRuntimeClient("http://runtime").invoke_job({"job_id": "job-1"})
+
+
+@pytest.mark.asyncio
+@pytest.mark.parametrize("status_code", [204, 404])
+async def test_cleanup_thread_succeeds(monkeypatch, status_code):
+    """Deleting a thread succeeds, and a thread the runtime no longer knows counts as cleaned up."""
+    requests = serve_runtime(monkeypatch, status_code)
+    client = DeepAgentsRuntimeClient("http://runtime")
+
+    await client.cleanup_thread("thread-1")
+    assert await client.cleanup_thread_data("thread-1") is True
+
+    assert requests[0].method == "DELETE"
+    assert requests[0].url.path == "/threads/thread-1"
+
+
+@pytest.mark.asyncio
+async def test_cleanup_thread_failure(monkeypatch):
+    """A runtime error raises from cleanup_thread and is reported as False by the best-effort wrapper."""
+    serve_runtime(monkeypatch, 500, {"error": "boom"})
+    client = DeepAgentsRuntimeClient("http://runtime")
+
+    with pytest.raises(Exception, match="Cleanup failed: 500"):
+        await client.cleanup_thread("thread-1")
+    assert await client.cleanup_thread_data("thread-1") is False
+
+
+@pytest.mark.asyncio
+@pytest.mark.parametrize("status_code", [202, 404, 409])
+async def test_cancel_thread_posts_to_runtime(monkeypatch, status_code):
+    """Cancelling posts to the runtime's cancel endpoint; an unknown or finished thread counts as cancelled."""
+    requests = serve_runtime(monkeypatch, status_code)
+
+    assert await DeepAgentsRuntimeClient("http://runtime").cancel_thread("thread-1") is True
+
+    assert [(request.method, str(request.url)) for request in requests] == [
+        ("POST", "http://runtime/cancel/thread-1")
+    ]
+
+
+@pytest.mark.asyncio
+async def test_cancel_thread_reports_runtime_errors(monkeypatch):
+    """A runtime error leaves the thread possibly running, without raising."""
+    serve_runtime(monkeypatch, 500)
+
+    assert await DeepAgentsRuntimeClient("http://runtime").cancel_thread("thread-1") is False
+
+
+def test_cancel_event_message():
+    """The stream cancel event is shaped like the runtime's own events."""
+    message = CancelEvent("thread-1", "client_disconnected").to_message()
+
+    assert json.loads(message) == {
+        "event_type": "cancel",
+        "data": {"thread_id": "thread-1", "reason": "client_disconnected"}
+    }
+
+
+@pytest.mark.asyncio
+async def test_runtime_calls_forward_request_id(monkeypatch):
+    """The ID of the request being handled is sent along with every runtime call."""
+    requests = serve_runtime(monkeypatch, 202, {"thread_id": "thread-1"})
+    client = DeepAgentsRuntimeClient("http://runtime")
+
+    token = set_request_id("req-1")
+    try:
+        await client.invoke_job({"job_id": "job-1"})
+        await client.check_health()
+    finally:
+        reset_request_id(token)
+    await client.cancel_thread("thread-1")
+
+    assert [request.headers.get("X-Request-ID") for request in requests] == ["req-1", "req-1", None]
+
+
+@pytest.mark.asyncio
+async def test_slow_invoke_times_out(monkeypatch):
+    """An invoke the runtime takes longer than DEEPAGENTS_INVOKE_TIMEOUT to answer fails."""
+    monkeypatch.setenv("DEEPAGENTS_INVOKE_TIMEOUT", "0.05")
+    serve_slow_runtime(monkeypatch, 1, 202, {"thread_id": "thread-1"})
+
+    with pytest.raises(Exception, match="no answer within 0.05s"):
+        await DeepAgentsRuntimeClient("http://runtime").invoke_job({"job_id": "job-1"})
+
+
+@pytest.mark.asyncio
+async def test_operation_timeouts_are_independent(monkeypatch):
+    """A short invoke timeout does not cut off a slower state request."""
+    monkeypatch.setenv("DEEPAGENTS_INVOKE_TIMEOUT", "0.05")
+    serve_slow_runtime(monkeypatch, 0.1, 200, {"status": "running"})
+
+    state = await DeepAgentsRuntimeClient("http://runtime").get_execution_state("thread-1")
+
+    assert state == {"status": "running"}
+
+
+def test_operation_timeout_settings(monkeypatch):
+    """Each operation reads its own variable, falls back to its default, and 0 disables it."""
+    monkeypatch.setenv("DEEPAGENTS_STATE_TIMEOUT", "45")
+    monkeypatch.setenv("DEEPAGENTS_INVOKE_TIMEOUT", "0")
+    monkeypatch.delenv("DEEPAGENTS_HEALTH_TIMEOUT", raising=False)
+
+    assert get_operation_timeout("state") == 45
+    assert get_operation_timeout("invoke") is None
+    assert get_operation_timeout("health") == 3
+
+
+@pytest.mark.asyncio
+async def test_failing_calls_trip_the_breaker(monkeypatch):
+    """fail_max network errors open the breaker; the gauge reports it and further calls are refused."""
+    requests = serve_unreachable_runtime(monkeypatch)
+    client = DeepAgentsRuntimeClient("http://runtime")
+    assert client.breaker_state() == "closed"
+    assert REGISTRY.get_sample_value("ide_orchestrator_deepagents_circuit_breaker_state") == 0
+
+    for _ in range(deepagents_breaker.fail_max):
+        with pytest.raises(Exception, match="Network error cleaning up thread"):
+            await client.cleanup_thread("thread-1")
+
+    assert client.breaker_state() == "open"
+    assert REGISTRY.get_sample_value("ide_orchestrator_deepagents_circuit_breaker_state") == 2
+
+    rejected_before = breaker_rejections("cleanup")
+    with pytest.raises(pybreaker.CircuitBreakerError):
+        await client.cleanup_thread("thread-1")
+    assert breaker_rejections("cleanup") == rejected_before + 1
+    assert len(requests) == deepagents_breaker.fail_max
+
+
+@pytest.mark.asyncio
+async def test_runtime_errors_do_not_trip_the_breaker(monkeypatch):
+    """Malformed answers are excluded from the breaker's failure count."""
+    serve_runtime(monkeypatch, 202, {})
+    client = DeepAgentsRuntimeClient("http://runtime")
+
+    for _ in range(deepagents_breaker.fail_max):
+        with pytest.raises(InvalidRuntimeResponse):
+            await client.invoke_job({"job_id": "job-1"})
+
+    assert client.breaker_state() == "closed"
+
+
+def test_open_breaker_is_half_open_after_reset_timeout(monkeypatch):
+    """Once the reset timeout passes, the next call is a trial and the state reports half-open."""
+    deepagents_breaker.open()
+    client = DeepAgentsRuntimeClient("http://runtime")
+    assert client.breaker_state() == "open"
+
+    monkeypatch.setattr(
+        breaker_listener, "opened_at", breaker_listener.opened_at - deepagents_breaker.reset_timeout
+    )
+
+    assert client.breaker_state() == "half-open"
+    assert REGISTRY.get_sample_value("ide_orchestrator_deepagents_circuit_breaker_state") == 1
@@ -0,0 +1,56 @@
+"""
+Tests for uniform 500 responses and DEBUG_ERRORS.
+"""
+
+from fastapi import FastAPI
+from fastapi.testclient import TestClient
+
+from api.errors import InternalError, handle_internal_error
+
+
+def create_client() -> TestClient:
+    """Build an app with one failing route of each kind."""
+    app = FastAPI()
+    app.add_exception_handler(Exception, handle_internal_error)
+
+    @app.get("/unhandled")
+    async def unhandled():
+        raise RuntimeError("password authentication failed for user postgres")
+
+    @app.get("/handled")
+    async def handled():
+        try:
+            raise KeyError("generated_files")
+        except KeyError as e:
+            raise InternalError("Failed to approve proposal") from e
+
+    return TestClient(app, raise_server_exceptions=False)
+
+
+def test_500s_hide_internal_details_by_default(monkeypatch):
+    """Without DEBUG_ERRORS neither kind of failure reveals the underlying error."""
+    monkeypatch.delenv("DEBUG_ERRORS", raising=False)
+    client = create_client()
+
+    response = client.get("/unhandled")
+    assert response.status_code == 500
+    assert response.json() == {"detail": "Internal server error"}
+
+    response = client.get("/handled")
+    assert response.status_code == 500
+    assert response.json() == {"detail": "Failed to approve proposal"}
+
+
+def test_debug_errors_adds_error_and_traceback(monkeypatch):
+    """With DEBUG_ERRORS the body names the underlying error and carries its traceback."""
+    monkeypatch.setenv("DEBUG_ERRORS", "true")
+    client = create_client()
+
+    body = client.get("/unhandled").json()
+    assert body["detail"] == "Internal server error"
+    assert body["error"] == "RuntimeError: password authentication failed for user postgres"
+    assert any("raise RuntimeError" in line for line in body["traceback"])
+
+    body = client.get("/handled").json()
+    assert body["detail"] == "Failed to approve proposal"
+    assert body["error"] == "KeyError: 'generated_files'"
@@ -0,0 +1,35 @@
+"""
+Tests for specification file diffing.
+"""
+
+from services.file_diff import diff_files
+
+
+def test_diff_reports_only_files_in_the_proposal():
+    """Files missing from the proposal are left out because approval leaves them untouched."""
+    base = {
+        "/plan.md": {"content": "# Plan\nStep one", "type": "markdown"},
+        "/README.md": {"content": "Readme", "type": "markdown"},
+        "/kept.md": {"content": "Not in the proposal", "type": "markdown"}
+    }
+    proposed = {
+        "/plan.md": {"content": ["# Plan", "Step one", "Step two"], "type": "markdown"},
+        "/README.md": "Readme",
+        "/notes.md": {"content": "New notes", "type": "markdown"}
+    }
+
+    result = diff_files(base, proposed, base_label="v1", proposed_label="proposal")
+
+    assert result["summary"] == {"added": 1, "modified": 1, "unchanged": 1}
+    assert [entry["path"] for entry in result["files"]] == ["/README.md", "/notes.md", "/plan.md"]
+    files = {entry["path"]: entry for entry in result["files"]}
+    assert files["/README.md"] == {"path": "/README.md", "status": "unchanged", "diff": None}
+    assert files["/notes.md"]["diff"].startswith("--- /dev/null\n+++ proposal/notes.md")
+    assert files["/plan.md"]["diff"] == (
+        "--- v1/plan.md\n"
+        "+++ proposal/plan.md\n"
+        "@@ -1,2 +1,3 @@\n"
+        " # Plan\n"
+        " Step one\n"
+        "+Step two"
+    )
@@ -0,0 +1,40 @@
+"""
+Tests for incremental draft file edits.
+"""
+
+import pytest
+
+from models.workflow import DraftFileEdit
+from services.file_edit import InvalidFileEdit, apply_file_edit
+
+CONTENT = "# Plan\nStep one\nStep two\nStep three"
+
+
+def test_replace_range_changes_only_targeted_lines():
+    """Lines outside the range are kept and the replacement may change the line count."""
+    edit = DraftFileEdit(op="replace_range", start_line=2, end_line=3, content="Step 1\nStep 1.5\nStep 2")
+
+    assert apply_file_edit(CONTENT, edit) == "# Plan\nStep 1\nStep 1.5\nStep 2\nStep three"
+
+
+def test_replace_range_with_empty_content_deletes_lines():
+    """An empty replacement removes the range."""
+    edit = DraftFileEdit(op="replace_range", start_line=1, end_line=1, content="")
+
+    assert apply_file_edit(CONTENT, edit) == "Step one\nStep two\nStep three"
+
+
+def test_append_adds_to_the_end():
+    """Appended content is added verbatim."""
+    edit = DraftFileEdit(op="append", content="\nStep four")
+
+    assert apply_file_edit(CONTENT, edit) == CONTENT + "\nStep four"
+
+
+@pytest.mark.parametrize("start_line, end_line", [(0, 1), (3, 2), (4, 5), (None, 2)])
+def test_replace_range_outside_content_is_refused(start_line, end_line):
+    """Ranges must be present and lie within the current lines."""
+    edit = DraftFileEdit(op="replace_range", start_line=start_line, end_line=end_line, content="x")
+
+    with pytest.raises(InvalidFileEdit):
+        apply_file_edit(CONTENT, edit)
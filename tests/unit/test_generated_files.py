@@ -0,0 +1,68 @@
+"""
+Tests for validating generated files before they are applied to a draft.
+"""
+
+import pytest
+
+from services.generated_files import InvalidGeneratedFiles, check_file_path, split_generated_files
+
+
+def test_well_formed_files_are_normalized():
+    """Line arrays are joined with newlines and the type defaults to markdown."""
+    files, invalid = split_generated_files({
+        "/plan.md": {"content": ["line1", "line2"]},
+        "/definition.json": {"content": "{}", "type": "json"},
+    })
+
+    assert invalid == {}
+    assert files == {
+        "/plan.md": {"content": "line1\nline2", "type": "markdown"},
+        "/definition.json": {"content": "{}", "type": "json"},
+    }
+
+
+@pytest.mark.parametrize("file_data, reason", [
+    ("# Plan", "file is not an object"),
+    (["# Plan"], "file is not an object"),
+    ({"type": "markdown"}, "content is missing"),
+    ({"content": 42}, "content is not a string or a list of lines"),
+    ({"content": {"text": "# Plan"}}, "content is not a string or a list of lines"),
+    ({"content": ["# Plan", 2]}, "content lines are not all strings"),
+    ({"content": "# Plan", "type": None}, "type is not a string"),
+])
+def test_malformed_files_are_reported(file_data, reason):
+    """Each malformed file is left out and reported by path with the reason."""
+    files, invalid = split_generated_files({"/plan.md": file_data, "/ok.md": {"content": "ok"}})
+
+    assert list(files) == ["/ok.md"]
+    assert invalid == {"/plan.md": reason}
+
+
+@pytest.mark.parametrize("file_path, reason", [
+    ("", "path is empty"),
+    ("plan.md", "path is not absolute"),
+    ("/../etc/passwd", "path escapes the workspace"),
+    ("/THE_SPEC/../../plan.md", "path escapes the workspace"),
+    ("/./plan.md", "path escapes the workspace"),
+    ("/THE_SPEC//plan.md", "path has an empty segment"),
+    ("/THE_SPEC/", "path has an empty segment"),
+    ("/THE_SPEC\\plan.md", "path contains invalid characters"),
+])
+def test_paths_outside_the_workspace_are_rejected(file_path, reason):
+    """Paths must be absolute within the workspace and may not climb out of it."""
+    assert check_file_path(file_path) == reason
+
+
+def test_nested_paths_are_accepted():
+    """Paths into workspace directories are valid."""
+    assert check_file_path("/THE_CAST/GreetingAgent.md") == ""
+
+
+def test_error_lists_every_invalid_path():
+    """The error names each unparseable file and why."""
+    error = InvalidGeneratedFiles({"/a.md": "content is missing", "/../b.md": "path escapes the workspace"})
+
+    assert str(error) == (
+        "Unparseable generated files: /a.md (content is missing), /../b.md (path escapes the workspace)"
+    )
+    assert error.invalid == {"/a.md": "content is missing", "/../b.md": "path escapes the workspace"}
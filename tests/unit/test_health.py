@@ -0,0 +1,92 @@
+"""
+Tests for the liveness and readiness probes.
+"""
+
+import psycopg
+from fastapi import FastAPI
+from fastapi.testclient import TestClient
+
+from api.dependencies import get_system_status_service
+from api.routers import health
+from services.system_status import SystemStatusService
+
+
+class FakeRuntimeClient:
+    """Runtime client that must not be probed by /health or /ready."""
+
+    def __init__(self, breaker_state="closed"):
+        self.state = breaker_state
+
+    async def check_health(self):
+        raise AssertionError("probes must not call deepagents-runtime")
+
+    def breaker_state(self):
+        return self.state
+
+
+def create_app_with_database_down(monkeypatch):
+    """Build an app with the health routers whose database connections all fail."""
+    connects = []
+
+    def connect(*args, **kwargs):
+        connects.append(args)
+        raise psycopg.OperationalError("connection refused")
+
+    monkeypatch.setattr(psycopg, "connect", connect)
+
+    app = FastAPI()
+    app.include_router(health.router)
+    app.include_router(health.health_router)
+    status_service = SystemStatusService("postgresql://unused", FakeRuntimeClient())
+    app.dependency_overrides[get_system_status_service] = lambda: status_service
+    return app, connects
+
+
+def test_health_never_calls_database(monkeypatch):
+    """Liveness answers 200 without touching the database, even while it is down."""
+    app, connects = create_app_with_database_down(monkeypatch)
+    client = TestClient(app)
+
+    for path in ("/health", "/api/health"):
+        response = client.get(path)
+        assert response.status_code == 200
+        assert response.json() == {"status": "healthy"}
+
+    assert connects == []
+
+
+def test_ready_fails_while_database_is_down(monkeypatch):
+    """Readiness checks the database and answers 503 when it is unreachable."""
+    app, connects = create_app_with_database_down(monkeypatch)
+    client = TestClient(app)
+
+    for path in ("/ready", "/api/ready"):
+        response = client.get(path)
+        assert response.status_code == 503
+        assert response.json() == {
+            "status": "not_ready",
+            "checks": {
+                "database": {"healthy": False},
+                "deepagents_runtime": {"circuit_breaker": "closed"},
+            },
+        }
+
+    assert len(connects) == 2
+
+
+def test_ready_fails_while_circuit_breaker_is_open(monkeypatch):
+    """An open breaker takes the instance out of rotation; a half-open one takes traffic to try the runtime."""
+    app = FastAPI()
+    app.include_router(health.health_router)
+    runtime_client = FakeRuntimeClient(breaker_state="open")
+    status_service = SystemStatusService("postgresql://unused", runtime_client)
+    monkeypatch.setattr(status_service, "_check_database", lambda: True)
+    app.dependency_overrides[get_system_status_service] = lambda: status_service
+    client = TestClient(app)
+
+    response = client.get("/ready")
+    assert response.status_code == 503
+    assert response.json()["checks"]["deepagents_runtime"] == {"circuit_breaker": "open"}
+
+    runtime_client.state = "half-open"
+    assert client.get("/ready").status_code == 200
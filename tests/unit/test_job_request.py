@@ -0,0 +1,66 @@
+"""
+Tests for the deepagents-runtime job request schema.
+"""
+
+import pytest
+
+from models.job import build_refinement_job_request, validate_runtime_config
+
+
+def test_refinement_context_is_carried_in_input_payload():
+    """Context belongs to the input payload, never the agent definition."""
+    agent_definition = {"name": "builder", "model": "default"}
+
+    request = build_refinement_job_request(
+        proposal_id="proposal-1",
+        user_prompt="Add error handling",
+        agent_definition=agent_definition,
+        context_file_path="/THE_SPEC/plan.md",
+        context_selection="Basic execution flow."
+    ).model_dump()
+
+    assert request["agent_definition"] == agent_definition
+    assert "context" not in request["agent_definition"]
+    assert request["input_payload"]["context"] == {
+        "file_path": "/THE_SPEC/plan.md",
+        "selection": "Basic execution flow."
+    }
+    assert request["input_payload"]["instructions"] == "Add error handling"
+    assert request["input_payload"]["messages"] == [
+        {"role": "user", "content": "Add error handling"}
+    ]
+
+
+def test_allowed_runtime_config_is_forwarded():
+    """Allowlisted runtime overrides end up in the job config."""
+    runtime_config = validate_runtime_config({"model": "gpt-4o", "temperature": 0.2})
+
+    request = build_refinement_job_request(
+        proposal_id="proposal-1",
+        user_prompt="Add error handling",
+        runtime_config=runtime_config
+    ).model_dump()
+
+    assert request["config"] == {"model": "gpt-4o", "temperature": 0.2}
+    assert "temperature" not in request["agent_definition"]
+
+
+def test_thread_id_selects_the_thread_to_resume():
+    """A resumed refinement names its runtime thread; a new one leaves it to the runtime."""
+    resumed = build_refinement_job_request("proposal-2", "Also add retries", thread_id="thread-1").model_dump()
+    fresh = build_refinement_job_request("proposal-3", "Add logging").model_dump()
+
+    assert resumed["thread_id"] == "thread-1"
+    assert fresh["thread_id"] is None
+
+
+def test_forbidden_runtime_config_key_is_rejected():
+    """Keys outside the allowlist are refused instead of being forwarded."""
+    with pytest.raises(ValueError, match="api_key"):
+        validate_runtime_config({"temperature": 0.2, "api_key": "secret"})
+
+    with pytest.raises(ValueError):
+        validate_runtime_config({"model": {"name": "gpt-4o"}})
+
+    with pytest.raises(ValueError):
+        validate_runtime_config(["temperature"])
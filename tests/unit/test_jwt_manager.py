@@ -0,0 +1,85 @@
+"""
+Tests for JWT signing algorithms and token lifetimes.
+"""
+
+from datetime import timedelta
+
+import pytest
+from cryptography.hazmat.primitives import serialization
+from cryptography.hazmat.primitives.asymmetric import rsa
+
+from core.auth import InvalidTokenError, JWTManager, get_jwt_manager
+
+USER_ID = "00000000-0000-0000-0000-000000000001"
+
+
+@pytest.fixture(scope="module")
+def private_key():
+    """An RSA key small enough to generate quickly."""
+    return rsa.generate_private_key(public_exponent=65537, key_size=2048)
+
+
+def test_rs256_tokens_validate_with_only_the_public_key(private_key):
+    """A token signed with the private key is accepted by a manager holding just the public key."""
+    signer = JWTManager(algorithm="RS256", private_key=private_key, public_key=private_key.public_key())
+    validator = JWTManager(algorithm="RS256", public_key=private_key.public_key())
+
+    token, _ = signer.create_token(USER_ID, "user@example.com", ["admin"], 3600)
+
+    claims = validator.validate_token(token)
+    assert claims["user_id"] == USER_ID
+    assert claims["roles"] == ["admin"]
+    with pytest.raises(ValueError):
+        validator.create_token(USER_ID, "user@example.com", [], 3600)
+
+
+def test_tokens_signed_with_another_algorithm_are_refused(private_key):
+    """An HS256 token cannot pass an RS256 manager, nor the reverse."""
+    rs256 = JWTManager(algorithm="RS256", private_key=private_key, public_key=private_key.public_key())
+    hs256 = JWTManager("unit-test-secret")
+
+    hs256_token, _ = hs256.create_token(USER_ID, "user@example.com", [], 3600)
+    rs256_token, _ = rs256.create_token(USER_ID, "user@example.com", [], 3600)
+
+    with pytest.raises(InvalidTokenError):
+        rs256.validate_token(hs256_token)
+    with pytest.raises(InvalidTokenError):
+        hs256.validate_token(rs256_token)
+
+
+def test_unsupported_or_keyless_configurations_are_refused():
+    """Unknown algorithms and algorithms without their key fail at construction."""
+    with pytest.raises(ValueError):
+        JWTManager("unit-test-secret", algorithm="none")
+    with pytest.raises(ValueError):
+        JWTManager(algorithm="RS256")
+    with pytest.raises(ValueError):
+        JWTManager(algorithm="HS256")
+
+
+def test_manager_is_configured_from_the_environment(private_key, tmp_path, monkeypatch):
+    """JWT_ALGORITHM, the PEM key files and JWT_TOKEN_TTL are read by get_jwt_manager."""
+    private_key_file = tmp_path / "jwt.key"
+    private_key_file.write_bytes(private_key.private_bytes(
+        serialization.Encoding.PEM,
+        serialization.PrivateFormat.PKCS8,
+        serialization.NoEncryption()
+    ))
+    public_key_file = tmp_path / "jwt.pub"
+    public_key_file.write_bytes(private_key.public_key().public_bytes(
+        serialization.Encoding.PEM,
+        serialization.PublicFormat.SubjectPublicKeyInfo
+    ))
+    monkeypatch.setenv("JWT_ALGORITHM", "RS256")
+    monkeypatch.setenv("JWT_PRIVATE_KEY_FILE", str(private_key_file))
+    monkeypatch.setenv("JWT_PUBLIC_KEY_FILE", str(public_key_file))
+    monkeypatch.setenv("JWT_TOKEN_TTL", "900")
+
+    manager = get_jwt_manager()
+    token, expires_at = manager.create_token(USER_ID, "user@example.com", [], manager.token_ttl_seconds)
+
+    assert manager.algorithm == "RS256"
+    assert manager.token_ttl_seconds == 900
+    claims = JWTManager(algorithm="RS256", public_key=private_key.public_key()).validate_token(token)
+    assert timedelta(seconds=claims["exp"] - claims["iat"]) == timedelta(seconds=900)
+    assert expires_at is not None
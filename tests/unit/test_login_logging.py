@@ -0,0 +1,53 @@
+"""
+Tests for the log lines of failed logins.
+"""
+
+import io
+import json
+import logging
+
+import pytest
+from fastapi import HTTPException
+
+from api.routers import auth
+from core.structured_logging import JsonFormatter
+from models.auth import LoginRequest
+
+
+class FakeUserService:
+    """User service that knows no credentials."""
+
+    def authenticate(self, email, password):
+        return None
+
+
+@pytest.fixture
+def log_output():
+    """Capture the auth router's log lines as the JSON formatter writes them."""
+    output = io.StringIO()
+    handler = logging.StreamHandler(output)
+    handler.setFormatter(JsonFormatter())
+    logger = logging.getLogger(auth.__name__)
+    logger.addHandler(handler)
+    try:
+        yield output
+    finally:
+        logger.removeHandler(handler)
+
+
+@pytest.mark.asyncio
+async def test_failed_login_with_hostile_email_logs_one_valid_json_line(log_output):
+    """An email with quotes, a newline and a forged entry is escaped instead of injected."""
+    email = 'eve"@example.com\n{"level": "INFO", "message": "Login succeeded", "email": "admin@example.com"}'
+    # Bypass request validation, which already refuses such addresses, to test the log line itself
+    credentials = LoginRequest.model_construct(email=email, password="wrong-password")
+
+    with pytest.raises(HTTPException):
+        await auth.login(credentials, user_service=FakeUserService())
+
+    lines = log_output.getvalue().splitlines()
+    assert len(lines) == 1
+    entry = json.loads(lines[0])
+    assert entry["message"] == "Login failed: invalid credentials"
+    assert entry["level"] == "WARNING"
+    assert entry["email"] == email
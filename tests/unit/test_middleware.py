@@ -0,0 +1,227 @@
+"""
+Tests for the ASGI middleware.
+"""
+
+from fastapi import FastAPI, HTTPException, Request
+from fastapi.testclient import TestClient
+from prometheus_client import REGISTRY
+from pydantic import BaseModel
+
+from api.errors import handle_internal_error
+from api.middleware import ApiVersionMiddleware, HttpMetricsMiddleware, MaxBodySizeMiddleware, RequestIdMiddleware
+from core.request_context import get_request_id
+
+
+class Item(BaseModel):
+    name: str
+
+
+def create_app() -> FastAPI:
+    """Build a minimal app with a normal endpoint and an upload endpoint."""
+    app = FastAPI()
+    app.add_middleware(
+        MaxBodySizeMiddleware, max_body_size=16, path_limits={"/upload": 64, r"/files/[^/]+/content": 64}
+    )
+
+    @app.post("/echo")
+    async def echo(request: Request):
+        return {"size": len(await request.body())}
+
+    @app.post("/items")
+    async def create_item(item: Item):
+        return {"name": item.name}
+
+    @app.put("/files/{file_id}/content")
+    async def write_file(file_id: str, request: Request):
+        return {"size": len(await request.body())}
+
+    @app.post("/upload")
+    async def upload(request: Request):
+        return {"size": len(await request.body())}
+
+    return app
+
+
+def test_oversized_body_returns_413():
+    """Bodies above the global limit are refused, whether declared or streamed."""
+    client = TestClient(create_app())
+
+    assert client.post("/echo", content=b"x" * 16).json() == {"size": 16}
+
+    response = client.post("/echo", content=b"x" * 17)
+    assert response.status_code == 413
+
+    chunked = client.post("/echo", content=iter([b"x" * 10, b"x" * 10]))
+    assert chunked.status_code == 413
+
+
+def test_upload_endpoint_uses_its_own_limit():
+    """Exempted endpoints accept bodies up to their own larger limit."""
+    client = TestClient(create_app())
+
+    assert client.post("/upload", content=b"x" * 64).json() == {"size": 64}
+    assert client.post("/upload", content=b"x" * 65).status_code == 413
+
+
+def test_streamed_oversized_json_body_returns_413():
+    """A chunked body above the limit is refused with 413 before the route parses it."""
+    client = TestClient(create_app())
+
+    assert client.post("/items", content=iter([b'{"name":', b' "a"}'])).json() == {"name": "a"}
+
+    response = client.post("/items", content=iter([b'{"name": "', b"x" * 20, b'"}']))
+    assert response.status_code == 413
+
+
+def test_path_limits_match_path_patterns():
+    """Limits keyed by a pattern apply to every path it matches."""
+    client = TestClient(create_app())
+
+    assert client.put("/files/abc/content", content=b"x" * 64).json() == {"size": 64}
+    assert client.put("/files/abc/content", content=b"x" * 65).status_code == 413
+
+
+def http_request_count(method: str, route: str, status: str) -> float:
+    """Read the request counter for a label set, treating a missing series as zero."""
+    value = REGISTRY.get_sample_value(
+        "ide_orchestrator_http_requests_total", {"method": method, "route": route, "status": status}
+    )
+    return value or 0.0
+
+
+def test_http_metrics_are_labelled_by_route_template():
+    """Requests to different IDs share one series keyed by the route pattern and status."""
+    app = FastAPI()
+    app.add_middleware(HttpMetricsMiddleware)
+
+    @app.get("/items/{item_id}")
+    async def get_item(item_id: str):
+        if item_id == "missing":
+            raise HTTPException(status_code=404, detail="Item not found")
+        return {"id": item_id}
+
+    client = TestClient(app)
+    ok_before = http_request_count("GET", "/items/{item_id}", "200")
+    missing_before = http_request_count("GET", "/items/{item_id}", "404")
+    unmatched_before = http_request_count("GET", "unmatched", "404")
+
+    client.get("/items/a6f1c3e2")
+    client.get("/items/0b9d4e77")
+    client.get("/items/missing")
+    client.get("/nowhere")
+
+    assert http_request_count("GET", "/items/{item_id}", "200") == ok_before + 2
+    assert http_request_count("GET", "/items/{item_id}", "404") == missing_before + 1
+    assert http_request_count("GET", "unmatched", "404") == unmatched_before + 1
+    assert REGISTRY.get_sample_value(
+        "ide_orchestrator_http_requests_in_flight", {"method": "GET"}
+    ) == 0
+    assert REGISTRY.get_sample_value(
+        "ide_orchestrator_http_request_duration_seconds_count",
+        {"method": "GET", "route": "/items/{item_id}", "status": "200"}
+    ) >= 2
+
+
+def create_request_id_client() -> TestClient:
+    """Build an app echoing the request ID its handlers see, with one failing route."""
+    app = FastAPI()
+    app.add_middleware(RequestIdMiddleware)
+    app.add_exception_handler(Exception, handle_internal_error)
+
+    @app.get("/whoami")
+    async def whoami():
+        return {"request_id": get_request_id()}
+
+    @app.get("/fail")
+    async def fail():
+        raise RuntimeError("boom")
+
+    return TestClient(app, raise_server_exceptions=False)
+
+
+def test_request_id_is_kept_and_returned():
+    """A well-formed X-Request-ID is used for the request and echoed in the response."""
+    client = create_request_id_client()
+
+    response = client.get("/whoami", headers={"X-Request-ID": "gateway-42"})
+
+    assert response.json() == {"request_id": "gateway-42"}
+    assert response.headers["X-Request-ID"] == "gateway-42"
+    assert get_request_id() is None
+
+
+def test_missing_or_malformed_request_id_is_generated():
+    """Requests without a usable X-Request-ID get a fresh one each."""
+    client = create_request_id_client()
+
+    first = client.get("/whoami")
+    second = client.get("/whoami", headers={"X-Request-ID": "bad id\twith spaces"})
+
+    assert first.json()["request_id"] == first.headers["X-Request-ID"]
+    assert second.json()["request_id"] == second.headers["X-Request-ID"]
+    assert first.headers["X-Request-ID"] != second.headers["X-Request-ID"]
+    assert second.headers["X-Request-ID"] != "bad id\twith spaces"
+
+
+def test_500_carries_request_id():
+    """The 500 handler runs outside the middleware but still returns the request ID."""
+    response = create_request_id_client().get("/fail", headers={"X-Request-ID": "req-500"})
+
+    assert response.status_code == 500
+    assert response.headers["X-Request-ID"] == "req-500"
+
+
+def create_versioned_client() -> TestClient:
+    """Build an app with routes under /api behind the version middleware."""
+    app = FastAPI()
+    app.add_middleware(ApiVersionMiddleware)
+
+    @app.get("/api/workflows/{workflow_id}")
+    async def get_workflow(workflow_id: str, request: Request):
+        return {"workflow_id": workflow_id, "api_version": request.scope["state"]["api_version"]}
+
+    return TestClient(app)
+
+
+def test_versioned_and_unversioned_paths_reach_the_same_handler():
+    """/api/v1/... and the /api/... alias are served by the same route."""
+    client = create_versioned_client()
+
+    versioned = client.get("/api/v1/workflows/wf-1")
+    unversioned = client.get("/api/workflows/wf-1")
+
+    assert versioned.status_code == unversioned.status_code == 200
+    assert versioned.json() == unversioned.json() == {"workflow_id": "wf-1", "api_version": "1"}
+    assert versioned.headers["API-Version"] == unversioned.headers["API-Version"] == "1"
+
+
+def test_unsupported_api_versions_are_refused():
+    """An unknown version is a 404 in the path and a 400 in the header."""
+    client = create_versioned_client()
+
+    in_path = client.get("/api/v9/workflows/wf-1")
+    in_header = client.get("/api/workflows/wf-1", headers={"API-Version": "9"})
+    supported = client.get("/api/workflows/wf-1", headers={"API-Version": "1"})
+
+    assert in_path.status_code == 404
+    assert in_path.json()["supported_versions"] == ["1"]
+    assert in_header.status_code == 400
+    assert supported.status_code == 200
+
+
+def test_versioned_requests_are_labelled_by_unversioned_route():
+    """Metrics wrapping the version middleware label /api/v1 requests with the route under /api."""
+    app = FastAPI()
+    app.add_middleware(ApiVersionMiddleware)
+    app.add_middleware(HttpMetricsMiddleware)
+
+    @app.get("/api/workflows/{workflow_id}")
+    async def get_workflow(workflow_id: str):
+        return {"workflow_id": workflow_id}
+
+    before = http_request_count("GET", "/api/workflows/{workflow_id}", "200")
+
+    response = TestClient(app).get("/api/v1/workflows/wf-1")
+
+    assert response.status_code == 200
+    assert http_request_count("GET", "/api/workflows/{workflow_id}", "200") == before + 1
@@ -0,0 +1,88 @@
+"""
+Tests for the optional authentication dependency.
+"""
+
+from typing import Optional
+
+from fastapi import Depends, FastAPI, Request
+from fastapi.testclient import TestClient
+
+from api import dependencies
+from api.dependencies import get_optional_user_id
+from core.auth import JWTManager
+
+SECRET = "unit-test-secret"
+
+
+class FakeRevocationService:
+    """Denylist held in memory instead of the revoked_tokens table."""
+
+    def __init__(self, revoked=()):
+        self.revoked = set(revoked)
+
+    def is_revoked(self, claims):
+        return claims.get("jti") in self.revoked
+
+
+def create_app() -> FastAPI:
+    """Build a minimal app exposing what the optional auth dependency resolved."""
+    app = FastAPI()
+
+    @app.get("/whoami")
+    async def whoami(request: Request, user_id: Optional[str] = Depends(get_optional_user_id)):
+        return {
+            "user_id": user_id,
+            "present_but_invalid": request.state.auth_present_but_invalid
+        }
+
+    return app
+
+
+def test_bad_optional_token_sets_flag(monkeypatch):
+    """A rejected token continues anonymously but is flagged."""
+    monkeypatch.setenv("JWT_SECRET", SECRET)
+    client = TestClient(create_app())
+
+    response = client.get("/whoami", headers={"Authorization": "Bearer not-a-jwt"})
+
+    assert response.status_code == 200
+    assert response.json() == {"user_id": None, "present_but_invalid": True}
+
+
+def test_missing_optional_token_does_not_set_flag(monkeypatch):
+    """No token is plain anonymous access."""
+    monkeypatch.setenv("JWT_SECRET", SECRET)
+    client = TestClient(create_app())
+
+    response = client.get("/whoami")
+
+    assert response.status_code == 200
+    assert response.json() == {"user_id": None, "present_but_invalid": False}
+
+
+def test_valid_optional_token_resolves_user(monkeypatch):
+    """A valid token authenticates the request as usual."""
+    monkeypatch.setenv("JWT_SECRET", SECRET)
+    user_id = "6f1c7a52-3f5e-4d1b-9a0c-2b8e4f6d1a90"
+    token, _ = JWTManager(SECRET).create_token(user_id, "user@example.com", [], 3600)
+    monkeypatch.setattr(dependencies, "get_token_revocation_service", lambda: FakeRevocationService())
+    client = TestClient(create_app())
+
+    response = client.get("/whoami", headers={"Authorization": f"Bearer {token}"})
+
+    assert response.json() == {"user_id": user_id, "present_but_invalid": False}
+
+
+def test_revoked_optional_token_sets_flag(monkeypatch):
+    """A token revoked at logout is treated like any other rejected token."""
+    monkeypatch.setenv("JWT_SECRET", SECRET)
+    manager = JWTManager(SECRET)
+    token, _ = manager.create_token("6f1c7a52-3f5e-4d1b-9a0c-2b8e4f6d1a90", "user@example.com", [], 3600)
+    jti = manager.validate_token(token)["jti"]
+    monkeypatch.setattr(dependencies, "get_token_revocation_service", lambda: FakeRevocationService({jti}))
+    client = TestClient(create_app())
+
+    response = client.get("/whoami", headers={"Authorization": f"Bearer {token}"})
+
+    assert response.status_code == 200
+    assert response.json() == {"user_id": None, "present_but_invalid": True}
@@ -0,0 +1,79 @@
+"""
+Tests for the spans started by the orchestration service.
+
+Spans go to an in-memory exporter, and the proposal service is replaced by
+a fake, so no database is needed.
+"""
+
+import pytest
+from opentelemetry.sdk.trace import TracerProvider
+from opentelemetry.sdk.trace.export import SimpleSpanProcessor
+from opentelemetry.sdk.trace.export.in_memory_span_exporter import InMemorySpanExporter
+
+from services import orchestration_service
+from services.errors import ProposalNotReadyError
+from services.orchestration_service import OrchestrationService
+
+PROPOSAL_ID = "00000000-0000-0000-0000-000000000001"
+
+
+class FakeProposalService:
+    """Proposal service holding a single proposal with the given status."""
+
+    def __init__(self, status):
+        self.status = status
+        self.generated_files = {"/plan.md": {"content": "# Plan", "type": "markdown"}}
+        self.resolutions = []
+
+    def approve_proposal(self, proposal_id, user_id):
+        if self.status != "completed":
+            raise ProposalNotReadyError("Proposal is not ready for approval")
+        self.resolutions.append("approved")
+        return {
+            "applied_files": list(self.generated_files),
+            "skipped_files": {},
+            "thread_id": None,
+            "cleanup_enqueued": False,
+        }
+
+
+@pytest.fixture
+def exporter(monkeypatch):
+    """Export the orchestration service's spans to memory."""
+    exporter = InMemorySpanExporter()
+    provider = TracerProvider()
+    provider.add_span_processor(SimpleSpanProcessor(exporter))
+    monkeypatch.setattr(orchestration_service, "tracer", provider.get_tracer(__name__))
+    return exporter
+
+
+def create_service(status) -> OrchestrationService:
+    """Build an orchestration service backed by fakes."""
+    service = OrchestrationService("postgresql://unused")
+    service.proposal_service = FakeProposalService(status)
+    return service
+
+
+def test_approve_proposal_records_span(exporter):
+    """Approving a proposal produces a span naming the proposal and the files applied."""
+    service = create_service("completed")
+
+    service.approve_proposal(PROPOSAL_ID, "user-1")
+
+    spans = exporter.get_finished_spans()
+    assert [span.name for span in spans] == ["approve_proposal"]
+    assert spans[0].attributes["proposal_id"] == PROPOSAL_ID
+    assert spans[0].attributes["files_applied"] == 1
+    assert service.proposal_service.resolutions == ["approved"]
+
+
+def test_failed_approval_records_error_on_span(exporter):
+    """An approval that fails leaves the error on its span."""
+    service = create_service("processing")
+
+    with pytest.raises(ProposalNotReadyError):
+        service.approve_proposal(PROPOSAL_ID, "user-1")
+
+    span = exporter.get_finished_spans()[0]
+    assert not span.status.is_ok
+    assert span.events[0].name == "exception"
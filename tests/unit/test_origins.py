@@ -0,0 +1,46 @@
+"""
+Tests for the WebSocket origin policy.
+"""
+
+from core.origins import OriginPolicy, parse_allowed_origins
+
+
+def test_exact_origin_match():
+    """Listed origins are allowed, ignoring case and a trailing slash."""
+    policy = OriginPolicy(parse_allowed_origins("https://app.bizmatters.dev, http://localhost:3000"))
+
+    assert policy.is_allowed("https://app.bizmatters.dev")
+    assert policy.is_allowed("HTTPS://App.Bizmatters.dev/")
+    assert policy.is_allowed("http://localhost:3000")
+    assert not policy.is_allowed("http://app.bizmatters.dev")
+    assert not policy.is_allowed("http://localhost:3001")
+
+
+def test_wildcard_subdomain_match():
+    """*.domain entries match any subdomain but not the bare domain or look-alikes."""
+    policy = OriginPolicy(parse_allowed_origins("*.bizmatters.dev,https://*.example.com"))
+
+    assert policy.is_allowed("https://ide.bizmatters.dev")
+    assert policy.is_allowed("http://preview.ide.bizmatters.dev")
+    assert policy.is_allowed("https://app.example.com")
+    assert not policy.is_allowed("http://app.example.com")
+    assert not policy.is_allowed("https://bizmatters.dev")
+    assert not policy.is_allowed("https://evilbizmatters.dev")
+
+
+def test_unknown_origins_are_rejected():
+    """Unlisted and malformed origins are refused; an empty list denies all cross-origin requests."""
+    policy = OriginPolicy(["https://app.bizmatters.dev"])
+
+    assert not policy.is_allowed("https://evil.example")
+    assert not policy.is_allowed("null")
+    assert not OriginPolicy().is_allowed("https://app.bizmatters.dev")
+
+
+def test_same_origin_and_missing_origin_are_allowed():
+    """Same-origin requests and non-browser clients without an Origin header pass any policy."""
+    policy = OriginPolicy()
+
+    assert policy.is_allowed("https://ide.internal:8080", host="ide.internal:8080")
+    assert policy.is_allowed(None)
+    assert not policy.is_allowed("https://ide.internal:8080", host="other.internal")
@@ -0,0 +1,69 @@
+"""
+Tests for the outbox webhook publisher.
+"""
+
+import json
+from datetime import datetime
+
+import httpx
+import pytest
+
+from services import outbox_service
+from services.outbox_service import log_publish, publisher_from_env, webhook_publisher
+
+EVENT = {
+    "id": "event-1",
+    "aggregate_type": "proposal",
+    "aggregate_id": "proposal-1",
+    "event_type": "proposal.approved",
+    "payload": {"workflow_id": "workflow-1"},
+    "created_at": datetime(2025, 1, 1, 12, 0, 0),
+}
+
+
+def serve_webhook(monkeypatch, status_code):
+    """Answer webhook requests with status_code; returns the requests seen."""
+    requests = []
+
+    def handle(request):
+        requests.append(request)
+        return httpx.Response(status_code)
+
+    transport = httpx.MockTransport(handle)
+    async_client = httpx.AsyncClient
+    monkeypatch.setattr(
+        outbox_service.httpx, "AsyncClient",
+        lambda **kwargs: async_client(transport=transport, **kwargs)
+    )
+    return requests
+
+
+@pytest.mark.asyncio
+async def test_webhook_publisher_posts_event(monkeypatch):
+    """Events are POSTed as JSON, with timestamps serialized."""
+    requests = serve_webhook(monkeypatch, 204)
+
+    await webhook_publisher("http://consumer/events")(EVENT)
+
+    assert requests[0].method == "POST"
+    body = json.loads(requests[0].content)
+    assert body["event_type"] == "proposal.approved"
+    assert body["created_at"] == "2025-01-01 12:00:00"
+
+
+@pytest.mark.asyncio
+async def test_webhook_publisher_fails_on_error_status(monkeypatch):
+    """A non-2xx response raises so the poller records a failed delivery."""
+    serve_webhook(monkeypatch, 503)
+
+    with pytest.raises(httpx.HTTPStatusError):
+        await webhook_publisher("http://consumer/events")(EVENT)
+
+
+def test_publisher_from_env(monkeypatch):
+    """Without OUTBOX_WEBHOOK_URL events are only logged."""
+    monkeypatch.delenv("OUTBOX_WEBHOOK_URL", raising=False)
+    assert publisher_from_env() is log_publish
+
+    monkeypatch.setenv("OUTBOX_WEBHOOK_URL", "http://consumer/events")
+    assert publisher_from_env() is not log_publish
@@ -0,0 +1,45 @@
+"""
+Tests for the production version id cache.
+"""
+
+from services.production_cache import ProductionVersionCache
+
+
+def test_cached_id_is_reused_until_invalidated():
+    """Hits skip the loader; invalidation forces the next lookup to reload."""
+    cache = ProductionVersionCache(ttl_seconds=60)
+    loads = []
+
+    def loader():
+        loads.append(1)
+        return f"version-{len(loads)}"
+
+    assert cache.get_or_load("workflow-1", loader) == "version-1"
+    assert cache.get_or_load("workflow-1", loader) == "version-1"
+    assert len(loads) == 1
+
+    cache.invalidate("workflow-1")
+    assert cache.get_or_load("workflow-1", loader) == "version-2"
+
+
+def test_entries_expire_after_ttl():
+    """Deploys on other replicas are picked up once the TTL lapses."""
+    now = [0.0]
+    cache = ProductionVersionCache(ttl_seconds=30, clock=lambda: now[0])
+
+    assert cache.get_or_load("workflow-1", lambda: "version-1") == "version-1"
+    now[0] = 31
+    assert cache.get_or_load("workflow-1", lambda: "version-2") == "version-2"
+
+
+def test_load_racing_with_invalidation_is_not_cached():
+    """A load that read the old pointer before a deploy committed must not be stored."""
+    cache = ProductionVersionCache(ttl_seconds=60)
+
+    def stale_loader():
+        # A deploy commits and invalidates while this load is in flight
+        cache.invalidate("workflow-1")
+        return "old-version"
+
+    assert cache.get_or_load("workflow-1", stale_loader) == "old-version"
+    assert cache.get_or_load("workflow-1", lambda: "new-version") == "new-version"
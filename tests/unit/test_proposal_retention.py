@@ -0,0 +1,100 @@
+"""
+Tests for the proposal retention job.
+"""
+
+from datetime import datetime, timedelta, timezone
+
+import pytest
+
+from services.proposal_retention import ProposalRetentionJob
+
+NOW = datetime(2025, 6, 1, 12, 0, 0, tzinfo=timezone.utc)
+
+
+class FakeProposalService:
+    """Keeps proposals in memory and purges them like ProposalService."""
+
+    def __init__(self, ended_at, locked=False):
+        self.ended_at = dict(ended_at)
+        self.locked = locked
+        self.cutoffs = []
+
+    def purge_expired_proposals(self, cutoff, batch_size=100):
+        self.cutoffs.append(cutoff)
+        if self.locked:
+            return None
+        expired = sorted(p for p, ended in self.ended_at.items() if ended < cutoff)[:batch_size]
+        for proposal_id in expired:
+            del self.ended_at[proposal_id]
+        return len(expired)
+
+
+@pytest.mark.asyncio
+async def test_old_terminal_proposals_are_purged_and_recent_ones_kept():
+    """Proposals that ended before the retention window go; the rest stay."""
+    service = FakeProposalService({
+        "old-1": NOW - timedelta(days=45),
+        "old-2": NOW - timedelta(days=31),
+        "old-3": NOW - timedelta(days=400),
+        "recent-1": NOW - timedelta(days=29),
+        "recent-2": NOW - timedelta(hours=1),
+    })
+    job = ProposalRetentionJob(service, retention_days=30, batch_size=2, clock=lambda: NOW)
+
+    assert await job.run_once() == 3
+    assert set(service.ended_at) == {"recent-1", "recent-2"}
+    assert service.cutoffs[0] == NOW - timedelta(days=30)
+
+
+@pytest.mark.asyncio
+async def test_cutoff_follows_the_clock():
+    """Proposals kept on one run are purged once the clock passes their retention."""
+    now = [NOW]
+    service = FakeProposalService({"proposal-1": NOW - timedelta(days=5)})
+    job = ProposalRetentionJob(service, retention_days=7, clock=lambda: now[0])
+
+    assert await job.run_once() == 0
+    assert "proposal-1" in service.ended_at
+
+    now[0] = NOW + timedelta(days=3)
+    assert await job.run_once() == 1
+    assert service.ended_at == {}
+
+
+@pytest.mark.asyncio
+async def test_zero_retention_keeps_proposals_forever():
+    """A retention of 0 days never asks the service to purge."""
+    service = FakeProposalService({"proposal-1": NOW - timedelta(days=3650)})
+    job = ProposalRetentionJob(service, retention_days=0, clock=lambda: NOW)
+
+    assert await job.run_once() == 0
+    assert service.cutoffs == []
+    assert "proposal-1" in service.ended_at
+
+
+@pytest.mark.asyncio
+async def test_run_stops_when_another_replica_holds_the_lock():
+    """A purge skipped for the advisory lock is not retried until the next run."""
+    service = FakeProposalService({"proposal-1": NOW - timedelta(days=100)}, locked=True)
+    job = ProposalRetentionJob(service, retention_days=30, clock=lambda: NOW)
+
+    assert await job.run_once() == 0
+    assert len(service.cutoffs) == 1
+
+
+def test_retention_settings_come_from_the_environment(monkeypatch):
+    """PROPOSAL_RETENTION_DAYS and the interval are read when not given."""
+    monkeypatch.setenv("PROPOSAL_RETENTION_DAYS", "0")
+    monkeypatch.setenv("PROPOSAL_RETENTION_INTERVAL_SECONDS", "60")
+
+    job = ProposalRetentionJob(FakeProposalService({}))
+
+    assert job.retention_days == 0
+    assert job.interval_seconds == 60
+
+
+def test_retention_is_off_by_default(monkeypatch):
+    """Without PROPOSAL_RETENTION_DAYS no proposal is ever purged."""
+    monkeypatch.delenv("PROPOSAL_RETENTION_DAYS", raising=False)
+
+    assert ProposalRetentionJob(FakeProposalService({})).retention_days == 0
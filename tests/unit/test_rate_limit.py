@@ -0,0 +1,115 @@
+"""
+Tests for the in-memory rate and connection limiters under concurrent use.
+"""
+
+import threading
+
+from core.rate_limit import ConnectionLimiter, FixedWindowRateLimiter
+
+
+def run_concurrently(worker, threads: int = 16):
+    """Start worker(index) on several threads at once and wait for all of them."""
+    barrier = threading.Barrier(threads)
+
+    def run(index):
+        barrier.wait()
+        worker(index)
+
+    pool = [threading.Thread(target=run, args=(index,)) for index in range(threads)]
+    for thread in pool:
+        thread.start()
+    for thread in pool:
+        thread.join()
+
+
+def test_concurrent_requests_never_exceed_limit():
+    """However requests for one key interleave, exactly limit of them are allowed per window."""
+    limiter = FixedWindowRateLimiter(100, 60, clock=lambda: 0.0, shard_count=4)
+    allowed = []
+
+    def worker(_):
+        results = [limiter.allow("10.0.0.1") for _ in range(50)]
+        allowed.append(sum(results))
+
+    run_concurrently(worker)
+
+    assert sum(allowed) == 100
+
+
+def test_idle_keys_are_evicted():
+    """Keys whose window ended are forgotten once their shard is swept."""
+    now = [0.0]
+    limiter = FixedWindowRateLimiter(5, 60, clock=lambda: now[0], shard_count=1)
+    for i in range(100):
+        limiter.allow(f"10.0.0.{i}")
+    assert limiter.tracked_keys() == 100
+
+    now[0] = 60
+    limiter.allow("10.0.1.1")
+
+    assert limiter.tracked_keys() == 1
+
+
+def test_rate_limiter_size_is_bounded():
+    """With every key active, the oldest windows make room instead of the map growing."""
+    now = [0.0]
+    limiter = FixedWindowRateLimiter(5, 60, clock=lambda: now[0], shard_count=4, max_keys=40)
+
+    def worker(index):
+        for i in range(100):
+            now[0] = i * 0.01
+            limiter.allow(f"client-{index}-{i}")
+
+    run_concurrently(worker)
+
+    assert limiter.tracked_keys() <= 40
+
+
+def test_concurrent_acquire_and_release_balance_out():
+    """Interleaved acquires and releases leave no counts and no entries behind."""
+    limiter = ConnectionLimiter(1000, shard_count=4)
+
+    def worker(index):
+        for i in range(200):
+            key = f"user-{(index + i) % 8}"
+            assert limiter.acquire(key)
+            limiter.release(key)
+
+    run_concurrently(worker)
+
+    assert limiter.tracked_keys() == 0
+
+
+def test_concurrent_acquires_respect_limit():
+    """Racing connections of one user are admitted up to the limit and no further."""
+    limiter = ConnectionLimiter(10)
+    admitted = []
+
+    def worker(_):
+        admitted.append(limiter.acquire("user-1"))
+
+    run_concurrently(worker, threads=32)
+
+    assert admitted.count(True) == 10
+    assert limiter.count("user-1") == 10
+
+
+def test_connection_limiter_refuses_new_keys_when_full():
+    """Open connections are never forgotten, so new keys are refused once the bound is reached."""
+    limiter = ConnectionLimiter(2, shard_count=1, max_keys=2)
+
+    assert limiter.acquire("user-1")
+    assert limiter.acquire("user-2")
+    assert not limiter.acquire("user-3")
+    assert limiter.acquire("user-1")
+
+    limiter.release("user-2")
+    assert limiter.acquire("user-3")
+
+
+def test_zero_limit_disables_connection_counting():
+    """A limit of 0 admits everyone without tracking anything."""
+    limiter = ConnectionLimiter(0)
+
+    assert all(limiter.acquire("user-1") for _ in range(100))
+    assert limiter.tracked_keys() == 0
@@ -0,0 +1,120 @@
+"""
+Tests for mapping orchestration errors to HTTP status codes.
+"""
+
+import pytest
+from fastapi import FastAPI
+from fastapi.testclient import TestClient
+
+from api.dependencies import get_current_user_id, get_orchestration_service, get_workflow_service
+from api.errors import handle_internal_error
+from api.routers import refinements
+from services.errors import (
+    DeepAgentsUnavailableError,
+    InvalidTransitionError,
+    ProposalNotFoundError,
+    ProposalNotReadyError,
+)
+from services.event_store import EventVersionConflict
+
+PROPOSAL_ID = "00000000-0000-0000-0000-000000000001"
+
+
+class FailingOrchestrationService:
+    """Orchestration service whose proposal operations all raise the same error."""
+
+    def __init__(self, error):
+        self.error = error
+
+    def approve_proposal(self, proposal_id, user_id):
+        raise self.error
+
+    def reject_proposal(self, proposal_id, user_id):
+        raise self.error
+
+    async def cancel_proposal(self, proposal_id, user_id):
+        raise self.error
+
+    async def get_or_create_draft(self, workflow_id, user_id):
+        return "draft-1"
+
+    async def create_refinement_proposal(self, **kwargs):
+        raise self.error
+
+
+class FakeWorkflowService:
+    """Workflow service granting the user ownership of every workflow."""
+
+    def get_workflow(self, workflow_id, user_id):
+        return {"id": workflow_id, "access_type": "owner"}
+
+
+def create_client(error) -> TestClient:
+    """Build an app with the refinements router backed by a failing orchestration service."""
+    app = FastAPI()
+    app.add_exception_handler(Exception, handle_internal_error)
+    app.include_router(refinements.router)
+    app.dependency_overrides[get_orchestration_service] = lambda: FailingOrchestrationService(error)
+    app.dependency_overrides[get_current_user_id] = lambda: "user-1"
+    return TestClient(app, raise_server_exceptions=False)
+
+
+@pytest.mark.parametrize("error, status_code", [
+    (ProposalNotFoundError("Proposal not found"), 404),
+    (ProposalNotReadyError("Proposal is not ready for approval"), 400),
+    (InvalidTransitionError("Proposal is already resolved"), 409),
+    (EventVersionConflict("Aggregate is already at version 3, expected 2"), 409),
+    (ValueError("unexpected"), 500),
+])
+def test_approve_maps_errors_by_type(error, status_code):
+    """Approval errors are told apart by type, not by their message."""
+    response = create_client(error).post(f"/api/proposals/{PROPOSAL_ID}/approve")
+
+    assert response.status_code == status_code
+
+
+def test_errors_are_mapped_regardless_of_message():
+    """A reworded message keeps its status code."""
+    client = create_client(InvalidTransitionError("Cancelling is no longer possible"))
+
+    assert client.post(f"/api/proposals/{PROPOSAL_ID}/cancel").status_code == 409
+    assert client.post(f"/api/proposals/{PROPOSAL_ID}/reject").status_code == 409
+
+    client = create_client(ProposalNotFoundError("No such proposal"))
+    response = client.post(f"/api/proposals/{PROPOSAL_ID}/reject")
+    assert response.status_code == 404
+    assert response.json()["detail"] == "Proposal not found"
+
+
+def test_runtime_unavailable_is_service_unavailable():
+    """A runtime outage while creating a refinement is a 503, not a bad request."""
+    client = create_client(DeepAgentsUnavailableError("deepagents-runtime unavailable: connection refused"))
+    client.app.dependency_overrides[get_workflow_service] = lambda: FakeWorkflowService()
+
+    response = client.post("/api/workflows/workflow-1/refinements", json={"instructions": "Add a reviewer"})
+
+    assert response.status_code == 503
+
+
+def test_resume_without_a_resumable_refinement_is_a_conflict():
+    """Resuming a draft whose last refinement is still running is a 409."""
+    client = create_client(InvalidTransitionError("A refinement is still running on this draft"))
+    client.app.dependency_overrides[get_workflow_service] = lambda: FakeWorkflowService()
+
+    response = client.post(
+        "/api/workflows/workflow-1/refinements", json={"instructions": "Add a reviewer", "resume": True}
+    )
+
+    assert response.status_code == 409
+
+
+def test_resume_must_be_a_boolean():
+    """A resume flag that is not a boolean is refused before any refinement starts."""
+    client = create_client(AssertionError("refinement must not be created"))
+    client.app.dependency_overrides[get_workflow_service] = lambda: FakeWorkflowService()
+
+    response = client.post(
+        "/api/workflows/workflow-1/refinements", json={"instructions": "Add a reviewer", "resume": "yes"}
+    )
+
+    assert response.status_code == 400
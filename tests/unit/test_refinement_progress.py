@@ -0,0 +1,83 @@
+"""
+Tests for extracting and summarizing refinement progress for polling clients.
+"""
+
+from services.refinement_progress import extract_progress, state_files, summarize_progress
+
+
+def test_progress_is_extracted_from_state():
+    """A state's step, percentage and file count are extracted."""
+    state = {"current_step": "Generating", "progress_percent": 42.4, "files": {"/plan.md": {}, "/a.md": {}}}
+
+    assert extract_progress(state) == {"current_step": "Generating", "progress_percent": 42, "files_count": 2}
+
+
+def test_unreported_progress_is_none():
+    """What a state does not report is None, so earlier values can be kept."""
+    assert extract_progress({"messages": "Thinking"}) == {
+        "current_step": None,
+        "progress_percent": None,
+        "files_count": None,
+    }
+
+
+def test_step_and_progress_fall_back_to_short_keys():
+    """States naming the step and progress with the short keys are understood, and progress is clamped."""
+    progress = extract_progress({"step": "Analyzing", "progress": 130})
+
+    assert progress["current_step"] == "Analyzing"
+    assert progress["progress_percent"] == 100
+
+
+def test_non_numeric_progress_is_ignored():
+    """A progress that is not a number is not reported."""
+    assert extract_progress({"progress_percent": True, "progress": "half"})["progress_percent"] is None
+
+
+def test_files_are_found_under_known_nested_keys():
+    """Files at the top level, under state, under values or as generated_files are all found."""
+    files = {"/plan.md": {"content": "# Plan"}}
+
+    assert state_files({"files": files}) == files
+    assert state_files({"state": {"files": files}}) == files
+    assert state_files({"values": {"files": files}}) == files
+    assert state_files({"generated_files": files}) == files
+    assert state_files({"state": "running", "messages": "Thinking"}) is None
+    assert extract_progress({"state": {"files": files}})["files_count"] == 1
+
+
+def test_in_flight_refinement_reports_recorded_progress():
+    """A running refinement reports the step, progress and file count last recorded."""
+    progress = {"current_step": "Generating", "progress_percent": 42, "files_count": 2}
+
+    assert summarize_progress("processing", progress, None) == {
+        "status": "processing",
+        "files_count": 2,
+        "current_step": "Generating",
+        "progress_percent": 42,
+    }
+
+
+def test_unknown_progress_is_left_out():
+    """Without recorded progress only the status and an empty file count are known."""
+    progress = {"current_step": None, "progress_percent": None, "files_count": None}
+
+    assert summarize_progress("pending", progress, None) == {"status": "pending", "files_count": 0}
+
+
+def test_finished_refinement_counts_stored_files():
+    """Once finished, the proposal's stored files are counted and progress is complete."""
+    progress = {"current_step": "Generating", "progress_percent": 90, "files_count": 1}
+
+    assert summarize_progress("completed", progress, {"/plan.md": {}, "/b.md": {}, "/c.md": {}}) == {
+        "status": "completed",
+        "files_count": 3,
+        "progress_percent": 100,
+    }
+
+
+def test_failed_refinement_reports_no_progress():
+    """A failed refinement reports neither step nor progress."""
+    progress = {"current_step": "Generating", "progress_percent": 90, "files_count": None}
+
+    assert summarize_progress("failed", progress, None) == {"status": "failed", "files_count": 0}
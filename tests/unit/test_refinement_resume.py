@@ -0,0 +1,114 @@
+"""
+Tests for resuming a draft's runtime thread with a follow-up refinement.
+
+The runtime client and the proposal and draft services are replaced by
+fakes, so no database or deepagents-runtime is needed.
+"""
+
+import pytest
+
+from services.errors import InvalidTransitionError
+from services.orchestration_service import OrchestrationService
+
+PRIOR_PROPOSAL_ID = "00000000-0000-0000-0000-000000000001"
+
+
+class FakeDeepAgentsClient:
+    """Runtime client that records invoke payloads and resumes the thread it is given."""
+
+    def __init__(self):
+        self.payloads = []
+
+    async def invoke_job(self, payload):
+        self.payloads.append(payload)
+        return {"thread_id": payload["thread_id"] or "thread-new"}
+
+
+class FakeProposalService:
+    """Proposal service whose draft last ran a refinement with the given status."""
+
+    def __init__(self, prior_status="completed", resumed_concurrently=False):
+        self.prior_status = prior_status
+        self.resumed_concurrently = resumed_concurrently
+        self.created = []
+
+    def get_resumable_proposal(self, draft_id):
+        if self.prior_status == "processing":
+            raise InvalidTransitionError("A refinement is still running on this draft")
+        return {"id": PRIOR_PROPOSAL_ID, "status": self.prior_status, "thread_id": "thread-1"}
+
+    def create_proposal(self, draft_id, thread_id, user_id, user_prompt, audit_trail,
+                        context_file_path=None, context_selection=None,
+                        base_file_versions=None, supersedes=None):
+        if supersedes and self.resumed_concurrently:
+            raise InvalidTransitionError("The draft's last refinement was resumed by another request")
+        self.created.append({"thread_id": thread_id, "supersedes": supersedes})
+        return "proposal-2"
+
+
+class FakeDraftService:
+    """Draft service granting access to every draft."""
+
+    def validate_draft_access(self, draft_id, user_id):
+        return {"workflow_id": "workflow-1"}
+
+    def get_draft_file_versions(self, draft_id):
+        return {}
+
+
+def create_service(prior_status="completed", resumed_concurrently=False) -> OrchestrationService:
+    """Build an orchestration service backed by fakes."""
+    service = OrchestrationService("postgresql://unused")
+    service.deepagents_client = FakeDeepAgentsClient()
+    service.proposal_service = FakeProposalService(prior_status, resumed_concurrently)
+    service.draft_service = FakeDraftService()
+    return service
+
+
+@pytest.mark.asyncio
+async def test_resume_reuses_the_prior_thread_id():
+    """A resumed refinement invokes the runtime with the draft's last thread and supersedes its proposal."""
+    service = create_service()
+
+    proposal_id, thread_id = await service.create_refinement_proposal(
+        "draft-1", "user-1", "Also add retries", resume=True
+    )
+
+    assert service.deepagents_client.payloads[0]["thread_id"] == "thread-1"
+    assert (proposal_id, thread_id) == ("proposal-2", "thread-1")
+    assert service.proposal_service.created == [{"thread_id": "thread-1", "supersedes": PRIOR_PROPOSAL_ID}]
+
+
+@pytest.mark.asyncio
+async def test_without_resume_the_runtime_starts_a_new_thread():
+    """Refinements start a new thread unless resume is asked for."""
+    service = create_service()
+
+    _, thread_id = await service.create_refinement_proposal("draft-1", "user-1", "Add logging")
+
+    assert service.deepagents_client.payloads[0]["thread_id"] is None
+    assert thread_id == "thread-new"
+    assert service.proposal_service.created[0]["supersedes"] is None
+
+
+@pytest.mark.asyncio
+async def test_resume_refuses_a_running_thread():
+    """A thread still running its refinement cannot be resumed, and the runtime is not invoked."""
+    service = create_service("processing")
+
+    with pytest.raises(InvalidTransitionError):
+        await service.create_refinement_proposal("draft-1", "user-1", "Also add retries", resume=True)
+
+    assert service.deepagents_client.payloads == []
+
+
+@pytest.mark.asyncio
+async def test_resume_claims_the_thread_before_invoking_the_runtime():
+    """A follow-up that loses the race to resume is refused without starting a second run or a failed proposal."""
+    service = create_service(resumed_concurrently=True)
+
+    with pytest.raises(InvalidTransitionError):
+        await service.create_refinement_proposal("draft-1", "user-1", "Also add retries", resume=True)
+
+    assert service.deepagents_client.payloads == []
+    assert service.proposal_service.created == []
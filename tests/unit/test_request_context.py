@@ -0,0 +1,28 @@
+"""
+Tests for request ID correlation in logs.
+"""
+
+import logging
+
+from core import request_context
+from core.request_context import NO_REQUEST_ID, reset_request_id, set_request_id
+
+
+def test_log_records_carry_current_request_id():
+    """Records get the ID of the request they are logged in, or a placeholder outside of one."""
+    record_factory = logging.getLogRecordFactory()
+    try:
+        request_context.install_request_id_logging()
+        logger = logging.getLogger("tests.request_context")
+
+        token = set_request_id("req-1")
+        try:
+            inside = logger.makeRecord(logger.name, logging.INFO, __file__, 1, "inside", (), None)
+        finally:
+            reset_request_id(token)
+        outside = logger.makeRecord(logger.name, logging.INFO, __file__, 1, "outside", (), None)
+    finally:
+        logging.setLogRecordFactory(record_factory)
+
+    assert inside.request_id == "req-1"
+    assert outside.request_id == NO_REQUEST_ID
@@ -0,0 +1,197 @@
+"""
+Tests for specification validation.
+"""
+
+import json
+
+from services.spec_validator import lint_json_files, validate_specification
+
+
+def test_multi_error_spec_reports_structured_issues():
+    """Every problem is reported with a code and the path of the offending element."""
+    definition = {
+        "nodes": [
+            {"id": "start", "type": "start"},
+            {"id": "start", "type": "agent"},
+            {"type": "end"}
+        ],
+        "edges": [
+            {"id": "start-to-missing", "source": "start", "target": "missing"}
+        ]
+    }
+
+    result = validate_specification({
+        "/definition.json": {"content": json.dumps(definition), "type": "json"},
+        "/THE_SPEC/plan.md": {"content": "   ", "type": "markdown"}
+    })
+
+    assert not result.valid
+    assert [issue.model_dump() for issue in result.issues] == [
+        {"code": "empty_file", "path": "/THE_SPEC/plan.md", "message": "File has no content"},
+        {
+            "code": "duplicate_node_id",
+            "path": "/definition.json#/nodes/1",
+            "message": "Node id 'start' is used more than once"
+        },
+        {
+            "code": "missing_agent_prompt",
+            "path": "/definition.json#/nodes/1/data",
+            "message": "Agent node has no prompt"
+        },
+        {"code": "missing_node_id", "path": "/definition.json#/nodes/2", "message": "Node has no id"},
+        {
+            "code": "dangling_edge",
+            "path": "/definition.json#/edges/0/target",
+            "message": "Edge target 'missing' does not reference an existing node"
+        }
+    ]
+
+
+def test_valid_spec_has_no_issues():
+    """A well-formed spec validates cleanly."""
+    definition = {
+        "nodes": [{"id": "start", "type": "start"}, {"id": "end", "type": "end"}],
+        "edges": [{"id": "start-to-end", "source": "start", "target": "end"}]
+    }
+
+    result = validate_specification({"/definition.json": json.dumps(definition)})
+
+    assert result.valid
+    assert result.issues == []
+
+
+def validate_definition(definition):
+    """Validate a specification consisting of just a definition."""
+    return validate_specification({"/definition.json": json.dumps(definition)})
+
+
+def test_missing_start_node_is_reported():
+    """A flow without a start node has no entry."""
+    result = validate_definition({
+        "nodes": [{"id": "agent", "type": "agent", "data": {"prompt": "Answer"}}, {"id": "end", "type": "end"}],
+        "edges": [{"id": "agent-to-end", "source": "agent", "target": "end"}]
+    })
+
+    assert [(issue.code, issue.path) for issue in result.issues] == [
+        ("missing_start_node", "/definition.json#/nodes")
+    ]
+
+
+def test_second_start_node_is_reported():
+    """A flow has exactly one start node."""
+    result = validate_definition({
+        "nodes": [{"id": "a", "type": "start"}, {"id": "b", "type": "start"}, {"id": "end", "type": "end"}],
+        "edges": [{"id": "a-to-end", "source": "a", "target": "end"}, {"id": "b-to-end", "source": "b", "target": "end"}]
+    })
+
+    assert [(issue.code, issue.path) for issue in result.issues] == [
+        ("multiple_start_nodes", "/definition.json#/nodes/1")
+    ]
+
+
+def test_unreachable_end_node_is_reported():
+    """Some end node must be reachable by following edges from the start node."""
+    result = validate_definition({
+        "nodes": [
+            {"id": "start", "type": "start"},
+            {"id": "agent", "type": "agent", "data": {"prompt": "Answer"}},
+            {"id": "end", "type": "end"}
+        ],
+        "edges": [
+            {"id": "start-to-agent", "source": "start", "target": "agent"},
+            {"id": "end-to-agent", "source": "end", "target": "agent"}
+        ]
+    })
+
+    assert [issue.code for issue in result.issues] == ["unreachable_end_node"]
+
+
+def test_dangling_edge_skips_flow_checks():
+    """A dangling edge is reported on its own instead of also failing reachability."""
+    result = validate_definition({
+        "nodes": [{"id": "start", "type": "start"}, {"id": "end", "type": "end"}],
+        "edges": [{"id": "start-to-missing", "source": "start", "target": "missing"}]
+    })
+
+    assert [(issue.code, issue.path) for issue in result.issues] == [
+        ("dangling_edge", "/definition.json#/edges/0/target")
+    ]
+
+
+def test_nodes_and_edges_must_be_lists():
+    """Nodes or edges that are not lists are reported instead of crashing the validator."""
+    for definition in ({"nodes": None}, {"nodes": 5}):
+        result = validate_definition(definition)
+
+        assert [(issue.code, issue.path) for issue in result.issues] == [
+            ("invalid_definition", "/definition.json#/nodes")
+        ]
+
+    result = validate_definition({"nodes": [{"id": "start", "type": "start"}], "edges": None})
+
+    assert [(issue.code, issue.path) for issue in result.issues] == [
+        ("invalid_definition", "/definition.json#/edges")
+    ]
+
+
+def test_non_string_node_ids_are_reported():
+    """A node id that is not a string counts as missing, and edges to it dangle."""
+    result = validate_definition({
+        "nodes": [{"id": ["a"], "type": "start"}, {"id": "end", "type": "end"}],
+        "edges": [{"id": "a-to-end", "source": ["a"], "target": "end"}]
+    })
+
+    assert [(issue.code, issue.path) for issue in result.issues] == [
+        ("missing_node_id", "/definition.json#/nodes/0"),
+        ("dangling_edge", "/definition.json#/edges/0/source"),
+    ]
+
+
+def test_agent_graph_with_entry_point_is_valid():
+    """Template graphs name their entry with entryPoint, and agents carry a system_prompt."""
+    result = validate_definition({
+        "nodes": [{"id": "specialist_1", "type": "AgentNode", "data": {"system_prompt": "You are a specialist."}}],
+        "edges": [],
+        "entryPoint": "specialist_1"
+    })
+
+    assert result.valid
+
+
+def test_agent_graph_checks_entry_point_and_prompts():
+    """The entry point must be a node and every agent needs a non-empty prompt."""
+    result = validate_definition({
+        "nodes": [{"id": "specialist_1", "type": "AgentNode", "data": {"system_prompt": "  "}}],
+        "edges": [],
+        "entryPoint": "specialist_2"
+    })
+
+    assert [(issue.code, issue.path) for issue in result.issues] == [
+        ("missing_agent_prompt", "/definition.json#/nodes/0/data"),
+        ("invalid_entry_point", "/definition.json#/entryPoint"),
+    ]
+
+
+def test_declared_json_files_that_do_not_parse_are_flagged():
+    """Files with a .json extension or json type must parse; other files are not linted."""
+    result = lint_json_files({
+        "/config/tools.json": {"content": '{"tools": [', "type": "json"},
+        "/config/settings": {"content": "{'retries': 3}", "type": "json"},
+        "/config/valid.json": '{"retries": 3}',
+        "/THE_SPEC/plan.md": {"content": "{not json", "type": "markdown"}
+    })
+
+    assert [(issue.code, issue.path) for issue in result.issues] == [
+        ("invalid_json", "/config/settings"),
+        ("invalid_json", "/config/tools.json")
+    ]
+
+
+def test_json_lint_leaves_the_definition_and_empty_files_to_validation():
+    """The definition and empty files are already reported by validate_specification."""
+    result = lint_json_files({
+        "/definition.json": {"content": "{", "type": "json"},
+        "/config/empty.json": {"content": "", "type": "json"}
+    })
+
+    assert result.valid
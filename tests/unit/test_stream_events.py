@@ -0,0 +1,36 @@
+"""
+Tests for the refinement stream event encoding.
+"""
+
+import json
+
+import pytest
+
+from services.stream_events import StreamEvent
+
+
+def test_upstream_message_is_normalized():
+    """Only event_type and data are kept from a runtime message, and data defaults to an empty object."""
+    event = StreamEvent.from_message(json.dumps({"event_type": "end", "run_id": "run-1"}))
+
+    assert event.to_dict() == {"event_type": "end", "data": {}}
+
+
+@pytest.mark.parametrize("message", ["[1, 2]", '{"data": {}}', '{"event_type": 7}', "not json"])
+def test_malformed_upstream_messages_are_rejected(message):
+    """Messages that are not event objects raise ValueError."""
+    with pytest.raises(ValueError):
+        StreamEvent.from_message(message)
+
+
+def test_json_is_compact_and_keeps_unicode():
+    """seq and replayed only appear when set, and the encoding is compact UTF-8."""
+    event = StreamEvent("on_state_update", {"messages": "Résumé"}, seq=4, replayed=True)
+
+    assert event.to_json() == (
+        '{"event_type":"on_state_update","data":{"messages":"Résumé"},"seq":4,"replayed":true}'
+    )
+    assert StreamEvent.error("Refinement timed out", "idle_timeout").to_dict() == {
+        "event_type": "error",
+        "data": {"error": "Refinement timed out", "reason": "idle_timeout"},
+    }
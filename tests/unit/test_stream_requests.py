@@ -0,0 +1,59 @@
+"""
+Tests for refusing malformed streaming requests before any lookups are made.
+"""
+
+import pytest
+from fastapi import FastAPI
+from fastapi.testclient import TestClient
+
+from api.dependencies import get_stream_user_id
+from api.routers import refinements, websockets
+from api.routers.refinements import accepts_event_stream
+
+
+def create_client(monkeypatch) -> TestClient:
+    """Build an app with the streaming routes whose authentication and thread lookups must not run."""
+    def unexpected_authentication():
+        raise AssertionError("request authenticated although it should have been refused")
+
+    async def unexpected_lookup(user_id, thread_id):
+        raise AssertionError("thread looked up although the request should have been refused")
+
+    monkeypatch.setattr(websockets, "can_access_thread", unexpected_lookup)
+    app = FastAPI()
+    app.include_router(refinements.router)
+    app.include_router(websockets.router)
+    app.dependency_overrides[get_stream_user_id] = unexpected_authentication
+    return TestClient(app)
+
+
+def test_sse_route_refuses_non_streaming_accept(monkeypatch):
+    """A client asking for JSON from the event stream gets 406 without being authenticated."""
+    response = create_client(monkeypatch).get(
+        "/api/refinements/thread-1/events", headers={"Accept": "application/json"}
+    )
+
+    assert response.status_code == 406
+
+
+def test_plain_request_to_websocket_route_is_bad_request(monkeypatch):
+    """A plain HTTP request to the WebSocket stream gets 400 rather than 404."""
+    response = create_client(monkeypatch).get("/api/ws/refinements/thread-1")
+
+    assert response.status_code == 400
+    assert response.json()["detail"] == "WebSocket upgrade required"
+
+
+@pytest.mark.parametrize("accept, accepted", [
+    (None, True),
+    ("text/event-stream", True),
+    ("*/*", True),
+    ("application/json, text/*;q=0.5", True),
+    ("TEXT/EVENT-STREAM; charset=utf-8", True),
+    ("application/json", False),
+    ("text/event-stream;q=0, application/json", False),
+    ("*/*; q=0.0", False),
+])
+def test_accept_header_matching(accept, accepted):
+    """Only Accept headers admitting text/event-stream with a non-zero quality are streamable."""
+    assert accepts_event_stream(accept) is accepted
@@ -0,0 +1,60 @@
+"""
+Tests for structured JSON logging.
+"""
+
+import json
+import logging
+import sys
+
+from core.request_context import install_request_id_logging, reset_request_id, set_request_id
+from core.structured_logging import JsonFormatter
+
+
+def format_record(message, extra=None, exc_info=None):
+    """Format a record logged with extra through the JSON formatter."""
+    logger = logging.getLogger("tests.structured_logging")
+    record = logger.makeRecord(logger.name, logging.WARNING, __file__, 1, message, (), exc_info, extra=extra)
+    return JsonFormatter().format(record)
+
+
+def test_values_with_quotes_and_newlines_stay_one_json_line():
+    """An email with a quote and a forged line cannot break or inject log lines."""
+    email = 'eve"@example.com\n{"level": "INFO", "message": "Login succeeded"}'
+
+    line = format_record("Login failed: invalid credentials", {"email": email})
+
+    assert "\n" not in line
+    entry = json.loads(line)
+    assert entry["message"] == "Login failed: invalid credentials"
+    assert entry["email"] == email
+    assert entry["level"] == "WARNING"
+    assert entry["logger"] == "tests.structured_logging"
+
+
+def test_request_id_and_exception_are_fields():
+    """Records carry the current request ID and the formatted exception."""
+    record_factory = logging.getLogRecordFactory()
+    token = set_request_id("req-1")
+    try:
+        install_request_id_logging()
+        try:
+            raise RuntimeError("boom")
+        except RuntimeError:
+            line = format_record("Proposal update failed", {"thread_id": "thread-1"}, sys.exc_info())
+    finally:
+        reset_request_id(token)
+        logging.setLogRecordFactory(record_factory)
+
+    entry = json.loads(line)
+    assert entry["request_id"] == "req-1"
+    assert entry["thread_id"] == "thread-1"
+    assert "RuntimeError: boom" in entry["exception"]
+
+
+def test_extra_fields_cannot_overwrite_core_fields():
+    """An extra named like a core field keeps the record's own level and message."""
+    entry = json.loads(format_record("Login failed", {"level": "INFO", "time": "forged", "logger": "forged"}))
+
+    assert entry["level"] == "WARNING"
+    assert entry["logger"] == "tests.structured_logging"
+    assert entry["time"] != "forged"
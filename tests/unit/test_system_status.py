@@ -0,0 +1,60 @@
+"""
+Tests for the system status aggregator and its rate limiter.
+"""
+
+import pytest
+
+from core.rate_limit import FixedWindowRateLimiter
+from services.system_status import SystemStatusService
+
+
+class FakeRuntimeClient:
+    """Runtime client with a switchable health answer that counts probes."""
+
+    def __init__(self, healthy=True):
+        self.healthy = healthy
+        self.probes = 0
+
+    async def check_health(self):
+        self.probes += 1
+        return self.healthy
+
+    def breaker_state(self):
+        return "closed"
+
+
+@pytest.mark.asyncio
+async def test_status_is_cached_and_reports_degraded(monkeypatch):
+    """Checks run once per cache window and an unhealthy dependency degrades the status."""
+    now = [0.0]
+    client = FakeRuntimeClient(healthy=False)
+    service = SystemStatusService("postgresql://unused", client, cache_seconds=5, clock=lambda: now[0])
+    monkeypatch.setattr(service, "_check_database", lambda: True)
+
+    status = await service.get_status()
+    assert status["status"] == "degraded"
+    assert status["checks"]["deepagents_runtime"]["healthy"] is False
+    assert status["checks"]["database"] == {"healthy": True}
+
+    client.healthy = True
+    assert await service.get_status() is status
+    assert client.probes == 1
+
+    now[0] = 6
+    assert (await service.get_status())["status"] == "ok"
+    assert client.probes == 2
+
+
+def test_rate_limiter_resets_each_window():
+    """Each key gets limit requests per window."""
+    now = [0.0]
+    limiter = FixedWindowRateLimiter(2, 60, clock=lambda: now[0])
+
+    assert limiter.allow("10.0.0.1")
+    assert limiter.allow("10.0.0.1")
+    assert not limiter.allow("10.0.0.1")
+    assert limiter.allow("10.0.0.2")
+    assert limiter.retry_after("10.0.0.1") == 60
+
+    now[0] = 60
+    assert limiter.allow("10.0.0.1")
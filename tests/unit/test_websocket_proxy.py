@@ -0,0 +1,806 @@
+"""
+Tests for the deepagents-runtime WebSocket proxy.
+
+Drives proxy_websocket_with_state_extraction with in-memory client and
+upstream connections so no network or database is needed.
+"""
+
+import asyncio
+import json
+from datetime import datetime, timezone
+
+import pytest
+from fastapi import WebSocketDisconnect
+
+from api.routers import websockets as websocket_routes
+from core.rate_limit import ConnectionLimiter
+from services.orchestration_service import OrchestrationService
+from services.proposal_service import validate_proposal_transition
+
+
+class FakeClientWebSocket:
+    """Client side of the proxy; disconnects when read from or closed by the server."""
+
+    def __init__(self, disconnect_immediately: bool = True):
+        self.disconnect_immediately = disconnect_immediately
+        self.frames = []
+        self.sent = []
+        self.close_code = None
+        self.closed = asyncio.Event()
+
+    async def receive_text(self):
+        if not self.disconnect_immediately:
+            await self.closed.wait()
+        raise WebSocketDisconnect(code=1001)
+
+    async def send_text(self, text):
+        self.frames.append(text)
+        self.sent.append(json.loads(text))
+
+    async def close(self, code: int = 1000, reason: str = ""):
+        self.close_code = code
+        self.closed.set()
+
+
+class FakeUpstreamWebSocket:
+    """deepagents-runtime side of the proxy; streams events until closed."""
+
+    def __init__(self, events=()):
+        self.events = list(events)
+        self.sent = []
+        self.closed = asyncio.Event()
+
+    async def send(self, message):
+        self.sent.append(message)
+
+    async def close(self):
+        self.closed.set()
+
+    def __aiter__(self):
+        return self._iterate()
+
+    async def _iterate(self):
+        for event in self.events:
+            yield json.dumps(event)
+        await self.closed.wait()
+
+
+class VanishingUpstreamWebSocket(FakeUpstreamWebSocket):
+    """Upstream whose connection drops after its events, as when a heartbeat goes unanswered."""
+
+    async def _iterate(self):
+        for event in self.events:
+            yield json.dumps(event)
+        raise ConnectionError("keepalive ping timeout")
+
+
+class FakeOrchestrationService:
+    """Records proposal updates and cancellation requests made by the proxy."""
+
+    def __init__(self):
+        self.cancelled = []
+        self.status_updates = []
+        self.file_updates = []
+        self.progress_updates = []
+
+    async def cancel_refinement_from_stream(self, thread_id, reason):
+        self.cancelled.append((thread_id, reason))
+
+    async def update_proposal_status_from_stream(self, thread_id, status, error_message=None):
+        self.status_updates.append((thread_id, status, error_message))
+
+    async def update_proposal_files_from_stream(self, thread_id, files, summary=None):
+        self.file_updates.append((thread_id, files, summary))
+
+    async def update_proposal_progress_from_stream(self, thread_id, progress):
+        self.progress_updates.append((thread_id, progress))
+
+
+@pytest.fixture(autouse=True)
+def pruned_threads(monkeypatch):
+    """Record which threads had their snapshots pruned instead of touching the database."""
+    pruned = []
+    monkeypatch.setattr(websocket_routes, "prune_thread_snapshots", pruned.append)
+    return pruned
+
+
+class ClientLeavingAfterEnd(FakeClientWebSocket):
+    """Client that stays connected until it has been sent the end event."""
+
+    def __init__(self):
+        super().__init__(disconnect_immediately=False)
+
+    async def send_text(self, text):
+        await super().send_text(text)
+        if self.sent[-1]["event_type"] == "end":
+            self.closed.set()
+
+
+class SlowClientLeavingAfterEnd(ClientLeavingAfterEnd):
+    """Client that takes a while to receive each event."""
+
+    async def send_text(self, text):
+        await asyncio.sleep(0.01)
+        await super().send_text(text)
+
+
+async def run_refinement_without_changes(monkeypatch, orchestration_service):
+    """Stream a refinement that ends without proposing files and let background updates finish."""
+    monkeypatch.setattr(websocket_routes, "get_orchestration_service", lambda: orchestration_service)
+    monkeypatch.setattr(websocket_routes, "save_thread_snapshot", lambda thread_id, state: None)
+
+    upstream = FakeUpstreamWebSocket([
+        {"event_type": "on_state_update", "data": {"files": {}}},
+        {"event_type": "end", "data": {}},
+    ])
+    await asyncio.wait_for(
+        websocket_routes.proxy_websocket_with_state_extraction(
+            ClientLeavingAfterEnd(), upstream, "thread-1", "user-1"
+        ),
+        timeout=5
+    )
+    # Proposal updates run as background tasks
+    for _ in range(3):
+        await asyncio.sleep(0)
+
+
+@pytest.mark.asyncio
+async def test_client_disconnect_cancels_upstream_run(monkeypatch):
+    """Without a grace period a client disconnecting mid-stream triggers an upstream cancel."""
+    monkeypatch.setenv("WS_DISCONNECT_GRACE_SECONDS", "0")
+    orchestration_service = FakeOrchestrationService()
+    monkeypatch.setattr(websocket_routes, "get_orchestration_service", lambda: orchestration_service)
+
+    upstream = FakeUpstreamWebSocket()
+    await asyncio.wait_for(
+        websocket_routes.proxy_websocket_with_state_extraction(
+            FakeClientWebSocket(), upstream, "thread-1", "user-1"
+        ),
+        timeout=5
+    )
+
+    assert orchestration_service.cancelled == [("thread-1", "client_disconnected")]
+    assert [json.loads(message) for message in upstream.sent] == [
+        {"event_type": "cancel", "data": {"thread_id": "thread-1", "reason": "client_disconnected"}}
+    ]
+    assert upstream.closed.is_set()
+
+
+@pytest.mark.asyncio
+async def test_disconnected_refinement_is_cancelled_after_grace_period(monkeypatch):
+    """A refinement nobody reconnects to is cancelled once the grace period ends."""
+    monkeypatch.setenv("WS_DISCONNECT_GRACE_SECONDS", "0.01")
+    orchestration_service = FakeOrchestrationService()
+    monkeypatch.setattr(websocket_routes, "get_orchestration_service", lambda: orchestration_service)
+
+    upstream = FakeUpstreamWebSocket()
+    await asyncio.wait_for(
+        websocket_routes.proxy_websocket_with_state_extraction(
+            FakeClientWebSocket(), upstream, "thread-1", "user-1"
+        ),
+        timeout=5
+    )
+
+    assert upstream.closed.is_set()
+    assert orchestration_service.cancelled == []
+    await asyncio.wait_for(websocket_routes.abandoned_refinements["thread-1"], timeout=5)
+    assert orchestration_service.cancelled == [("thread-1", "client_disconnected")]
+    assert orchestration_service.status_updates == []
+
+
+class ClientLeavingAfterFirstEvent(FakeClientWebSocket):
+    """Client whose connection drops right after it received one event."""
+
+    def __init__(self):
+        super().__init__(disconnect_immediately=False)
+
+    async def send_text(self, text):
+        await super().send_text(text)
+        self.closed.set()
+
+
+@pytest.mark.asyncio
+async def test_reconnecting_client_resumes_the_refinement(monkeypatch):
+    """A client reconnecting within the grace period gets the missed updates and the live end; nothing is cancelled."""
+    monkeypatch.setenv("WS_DISCONNECT_GRACE_SECONDS", "0.05")
+    orchestration_service = FakeOrchestrationService()
+    sequences = []
+
+    def save_snapshot(thread_id, state):
+        sequences.append(len(sequences) + 1)
+        return sequences[-1]
+
+    monkeypatch.setattr(websocket_routes, "get_orchestration_service", lambda: orchestration_service)
+    monkeypatch.setattr(websocket_routes, "save_thread_snapshot", save_snapshot)
+    monkeypatch.setattr(websocket_routes, "get_snapshot_service", lambda: FakeSnapshotService(sequences))
+
+    first_client = ClientLeavingAfterFirstEvent()
+    await asyncio.wait_for(
+        websocket_routes.proxy_websocket_with_state_extraction(
+            first_client,
+            FakeUpstreamWebSocket([
+                {"event_type": "on_state_update", "data": {"messages": "step 1"}},
+                {"event_type": "on_state_update", "data": {"messages": "step 2"}},
+            ]),
+            "thread-1", "user-1"
+        ),
+        timeout=5
+    )
+    assert first_client.sent[0]["seq"] == 1
+    assert "thread-1" in websocket_routes.abandoned_refinements
+
+    second_client = ClientLeavingAfterEnd()
+    await websocket_routes.replay_thread_snapshots(second_client, "thread-1", first_client.sent[0]["seq"])
+    files = {"/plan.md": {"content": "# Plan"}}
+    await asyncio.wait_for(
+        websocket_routes.proxy_websocket_with_state_extraction(
+            second_client,
+            FakeUpstreamWebSocket([
+                {"event_type": "on_state_update", "data": {"files": files}},
+                {"event_type": "end", "data": {}},
+            ]),
+            "thread-1", "user-1"
+        ),
+        timeout=5
+    )
+    await asyncio.sleep(0.1)
+
+    assert second_client.sent == [
+        {"event_type": "on_state_update", "data": {"messages": "step 2"}, "seq": 2, "replayed": True},
+        {"event_type": "on_state_update", "data": {"files": files}, "seq": 3},
+        {"event_type": "end", "data": {}},
+    ]
+    assert orchestration_service.cancelled == []
+    assert orchestration_service.file_updates == [("thread-1", files, None)]
+    assert "thread-1" not in websocket_routes.abandoned_refinements
+
+
+@pytest.mark.asyncio
+async def test_event_flood_terminates_session(monkeypatch, pruned_threads):
+    """An upstream emitting more events than the cap gets the session closed and the proposal failed."""
+    monkeypatch.setenv("WS_MAX_EVENTS_PER_SESSION", "3")
+    orchestration_service = FakeOrchestrationService()
+    monkeypatch.setattr(websocket_routes, "get_orchestration_service", lambda: orchestration_service)
+
+    client = FakeClientWebSocket(disconnect_immediately=False)
+    upstream = FakeUpstreamWebSocket(
+        [{"event_type": "on_llm_stream", "data": {"messages": str(i)}} for i in range(10)]
+    )
+    await asyncio.wait_for(
+        websocket_routes.proxy_websocket_with_state_extraction(client, upstream, "thread-1", "user-1"),
+        timeout=5
+    )
+
+    forwarded = [event for event in client.sent if event["event_type"] == "on_llm_stream"]
+    assert len(forwarded) == 3
+    assert client.sent[-1]["data"]["reason"] == "event_flood"
+    assert client.close_code == 1008
+    assert upstream.closed.is_set()
+    assert orchestration_service.status_updates == [("thread-1", "failed", "event_flood")]
+    assert orchestration_service.cancelled == []
+    assert pruned_threads == ["thread-1"]
+
+
+@pytest.mark.asyncio
+async def test_empty_result_completes_with_summary_by_default(monkeypatch):
+    """With the default policy an empty result completes the proposal with a no-changes summary."""
+    monkeypatch.delenv("EMPTY_REFINEMENT_POLICY", raising=False)
+    orchestration_service = FakeOrchestrationService()
+
+    await run_refinement_without_changes(monkeypatch, orchestration_service)
+
+    assert orchestration_service.file_updates == [("thread-1", {}, "No changes proposed")]
+    assert orchestration_service.status_updates == []
+    assert orchestration_service.cancelled == []
+
+
+@pytest.mark.asyncio
+async def test_empty_result_fails_proposal_when_configured(monkeypatch):
+    """With EMPTY_REFINEMENT_POLICY=fail an empty result fails the proposal with no_changes."""
+    monkeypatch.setenv("EMPTY_REFINEMENT_POLICY", "fail")
+    orchestration_service = FakeOrchestrationService()
+
+    await run_refinement_without_changes(monkeypatch, orchestration_service)
+
+    assert orchestration_service.status_updates == [("thread-1", "failed", "no_changes")]
+    assert orchestration_service.file_updates == []
+
+
+async def run_refinement(monkeypatch, orchestration_service, events):
+    """Stream a refinement's events through the proxy and let background updates finish."""
+    monkeypatch.setattr(websocket_routes, "get_orchestration_service", lambda: orchestration_service)
+    monkeypatch.setattr(websocket_routes, "save_thread_snapshot", lambda thread_id, state: None)
+
+    await asyncio.wait_for(
+        websocket_routes.proxy_websocket_with_state_extraction(
+            ClientLeavingAfterEnd(), FakeUpstreamWebSocket(events), "thread-1", "user-1"
+        ),
+        timeout=5
+    )
+    for _ in range(3):
+        await asyncio.sleep(0)
+
+
+@pytest.mark.asyncio
+async def test_files_nested_under_state_are_extracted(monkeypatch):
+    """Files the runtime nests under state.files still end up on the proposal."""
+    orchestration_service = FakeOrchestrationService()
+    files = {"/plan.md": {"content": "# Plan"}}
+
+    await run_refinement(monkeypatch, orchestration_service, [
+        {"event_type": "on_state_update", "data": {"state": {"files": files}}},
+        {"event_type": "end", "data": {}},
+    ])
+
+    assert orchestration_service.file_updates == [("thread-1", files, None)]
+
+
+@pytest.mark.asyncio
+async def test_end_without_files_in_any_known_place_is_logged(monkeypatch, caplog):
+    """An end event after states without files logs a warning and completes with no changes."""
+    monkeypatch.delenv("EMPTY_REFINEMENT_POLICY", raising=False)
+    orchestration_service = FakeOrchestrationService()
+
+    with caplog.at_level("WARNING", logger=websocket_routes.__name__):
+        await run_refinement(monkeypatch, orchestration_service, [
+            {"event_type": "on_state_update", "data": {"output": {"files": {"/plan.md": {}}}}},
+            {"event_type": "end", "data": {}},
+        ])
+
+    assert [record.getMessage() for record in caplog.records] == ["No files found in refinement state updates"]
+    assert orchestration_service.file_updates == [("thread-1", {}, "No changes proposed")]
+
+
+@pytest.mark.asyncio
+async def test_lost_upstream_releases_client(monkeypatch):
+    """An upstream that stops answering heartbeats closes the client and fails the proposal."""
+    orchestration_service = FakeOrchestrationService()
+    monkeypatch.setattr(websocket_routes, "get_orchestration_service", lambda: orchestration_service)
+
+    client = FakeClientWebSocket(disconnect_immediately=False)
+    upstream = VanishingUpstreamWebSocket([{"event_type": "on_llm_stream", "data": {"messages": "hi"}}])
+    await asyncio.wait_for(
+        websocket_routes.proxy_websocket_with_state_extraction(client, upstream, "thread-1", "user-1"),
+        timeout=5
+    )
+    await asyncio.sleep(0)
+
+    assert client.close_code == 1011
+    assert orchestration_service.status_updates == [("thread-1", "failed", "keepalive ping timeout")]
+    assert orchestration_service.cancelled == []
+
+
+@pytest.mark.asyncio
+async def test_cancelled_refinement_closes_open_stream(monkeypatch):
+    """Cancelling through the REST API ends the thread's open session without failing the proposal."""
+    orchestration_service = FakeOrchestrationService()
+    monkeypatch.setattr(websocket_routes, "get_orchestration_service", lambda: orchestration_service)
+
+    client = FakeClientWebSocket(disconnect_immediately=False)
+    upstream = FakeUpstreamWebSocket()
+    session = asyncio.create_task(
+        websocket_routes.proxy_websocket_with_state_extraction(client, upstream, "thread-1", "user-1")
+    )
+    await asyncio.sleep(0)
+
+    assert await websocket_routes.close_refinement_stream("thread-1") == 1
+    await asyncio.wait_for(session, timeout=5)
+
+    assert client.sent[-1]["data"]["reason"] == "cancelled"
+    assert client.close_code == 1000
+    assert json.loads(upstream.sent[-1])["event_type"] == "cancel"
+    assert upstream.closed.is_set()
+    assert orchestration_service.status_updates == []
+    assert orchestration_service.cancelled == []
+    assert "thread-1" not in websocket_routes.active_streams
+    assert await websocket_routes.close_refinement_stream("thread-1") == 0
+
+
+class GatedOrchestrationService(FakeOrchestrationService):
+    """Orchestration service whose file updates wait until the test opens the gate."""
+
+    def __init__(self):
+        super().__init__()
+        self.gate = asyncio.Event()
+
+    async def update_proposal_files_from_stream(self, thread_id, files, summary=None):
+        await self.gate.wait()
+        await super().update_proposal_files_from_stream(thread_id, files, summary)
+
+
+@pytest.mark.asyncio
+async def test_shutdown_closes_open_streams_without_failing_them(monkeypatch):
+    """Streams still open when draining times out are closed as restarting, not cancelled or failed."""
+    monkeypatch.setattr(websocket_routes, "draining", False)
+    orchestration_service = FakeOrchestrationService()
+    monkeypatch.setattr(websocket_routes, "get_orchestration_service", lambda: orchestration_service)
+
+    client = FakeClientWebSocket(disconnect_immediately=False)
+    upstream = FakeUpstreamWebSocket()
+    session = asyncio.create_task(
+        websocket_routes.proxy_websocket_with_state_extraction(client, upstream, "thread-1", "user-1")
+    )
+    await asyncio.sleep(0)
+
+    assert await websocket_routes.drain_refinement_streams(timeout=0.2) == 1
+    await asyncio.wait_for(session, timeout=5)
+
+    assert websocket_routes.draining
+    assert client.sent[-1] == {
+        "event_type": "error",
+        "data": {"error": "Server restarting", "reason": "server_restarting"}
+    }
+    assert client.close_code == 1012
+    assert upstream.sent == []
+    assert upstream.closed.is_set()
+    assert orchestration_service.status_updates == []
+    assert orchestration_service.cancelled == []
+    assert websocket_routes.active_streams == {}
+
+
+@pytest.mark.asyncio
+async def test_shutdown_waits_for_finished_stream_to_save_its_files(monkeypatch):
+    """Draining returns only after a finished stream's proposal update has been written."""
+    monkeypatch.setattr(websocket_routes, "draining", False)
+    orchestration_service = GatedOrchestrationService()
+    monkeypatch.setattr(websocket_routes, "get_orchestration_service", lambda: orchestration_service)
+    monkeypatch.setattr(websocket_routes, "save_thread_snapshot", lambda thread_id, state: None)
+
+    upstream = FakeUpstreamWebSocket([
+        {"event_type": "on_state_update", "data": {"files": {"/plan.md": "# Plan"}}},
+        {"event_type": "end", "data": {}},
+    ])
+    await asyncio.wait_for(
+        websocket_routes.proxy_websocket_with_state_extraction(
+            ClientLeavingAfterEnd(), upstream, "thread-1", "user-1"
+        ),
+        timeout=5
+    )
+    assert len(websocket_routes.pending_proposal_updates) == 1
+
+    drain = asyncio.create_task(websocket_routes.drain_refinement_streams(timeout=5))
+    await asyncio.sleep(0.05)
+    assert not drain.done()
+
+    orchestration_service.gate.set()
+    assert await asyncio.wait_for(drain, timeout=5) == 0
+    assert orchestration_service.file_updates == [("thread-1", {"/plan.md": "# Plan"}, None)]
+    assert websocket_routes.pending_proposal_updates == set()
+
+
+@pytest.mark.asyncio
+async def test_drop_oldest_delivers_latest_state_to_slow_client(monkeypatch):
+    """Under drop_oldest a slow client gets coalesced state updates, ending with the newest and the end event."""
+    monkeypatch.setenv("WS_BACKPRESSURE_STRATEGY", "drop_oldest")
+    orchestration_service = FakeOrchestrationService()
+    monkeypatch.setattr(websocket_routes, "get_orchestration_service", lambda: orchestration_service)
+    monkeypatch.setattr(websocket_routes, "save_thread_snapshot", lambda thread_id, state: None)
+
+    client = SlowClientLeavingAfterEnd()
+    upstream = FakeUpstreamWebSocket(
+        [{"event_type": "on_state_update", "data": {"files": {"/plan.md": str(i)}}} for i in range(50)]
+        + [{"event_type": "end", "data": {}}]
+    )
+    await asyncio.wait_for(
+        websocket_routes.proxy_websocket_with_state_extraction(client, upstream, "thread-1", "user-1"),
+        timeout=5
+    )
+
+    state_updates = [event for event in client.sent if event["event_type"] == "on_state_update"]
+    assert len(state_updates) < 50
+    assert state_updates[-1]["data"]["files"] == {"/plan.md": "49"}
+    assert client.sent[-1]["event_type"] == "end"
+    assert orchestration_service.cancelled == []
+
+
+def test_heartbeat_settings(monkeypatch):
+    """The ping interval is configurable and 0 disables heartbeats."""
+    monkeypatch.delenv("WS_HEARTBEAT_INTERVAL_SECONDS", raising=False)
+    monkeypatch.delenv("WS_HEARTBEAT_TIMEOUT_SECONDS", raising=False)
+    assert websocket_routes.get_heartbeat_settings() == (30, 10)
+
+    monkeypatch.setenv("WS_HEARTBEAT_INTERVAL_SECONDS", "5")
+    monkeypatch.setenv("WS_HEARTBEAT_TIMEOUT_SECONDS", "2")
+    assert websocket_routes.get_heartbeat_settings() == (5, 2)
+
+    monkeypatch.setenv("WS_HEARTBEAT_INTERVAL_SECONDS", "0")
+    assert websocket_routes.get_heartbeat_settings() == (None, None)
+
+
+@pytest.mark.asyncio
+async def test_idle_upstream_times_out(monkeypatch, pruned_threads):
+    """An upstream that never sends an event gets the proposal failed and the client told why."""
+    monkeypatch.setenv("WEBSOCKET_IDLE_TIMEOUT", "0.05")
+    orchestration_service = FakeOrchestrationService()
+    monkeypatch.setattr(websocket_routes, "get_orchestration_service", lambda: orchestration_service)
+
+    client = FakeClientWebSocket(disconnect_immediately=False)
+    upstream = FakeUpstreamWebSocket()
+    await asyncio.wait_for(
+        websocket_routes.proxy_websocket_with_state_extraction(client, upstream, "thread-1", "user-1"),
+        timeout=5
+    )
+
+    assert orchestration_service.status_updates == [("thread-1", "failed", "idle_timeout")]
+    assert client.sent[-1] == {
+        "event_type": "error",
+        "data": {"error": "Refinement timed out", "reason": "idle_timeout"}
+    }
+    assert client.close_code == 1011
+    assert upstream.closed.is_set()
+    assert orchestration_service.cancelled == []
+    assert pruned_threads == ["thread-1"]
+
+
+class StoredProposalService:
+    """Proposal store holding one proposal and refusing the status changes ProposalService refuses."""
+
+    def __init__(self, status):
+        self.status = status
+
+    def get_proposal_by_thread_id(self, thread_id):
+        return {"id": "proposal-1", "draft_id": "draft-1", "status": self.status}
+
+    def update_proposal_results(self, proposal_id, status, result=None, generated_files=None):
+        validate_proposal_transition(self.status, status)
+        self.status = status
+        return {"created_at": datetime.now(timezone.utc)}
+
+
+@pytest.mark.asyncio
+@pytest.mark.parametrize("status, expected_status", [
+    ("processing", "failed"),
+    ("completed", "completed"),
+    ("resolved", "resolved"),
+])
+async def test_idle_timeout_only_fails_running_proposals(monkeypatch, status, expected_status):
+    """A session left open after the result was stored times out without failing the finished proposal."""
+    monkeypatch.setenv("WEBSOCKET_IDLE_TIMEOUT", "0.05")
+    orchestration_service = OrchestrationService("postgresql://unused")
+    orchestration_service.proposal_service = StoredProposalService(status)
+    monkeypatch.setattr(websocket_routes, "get_orchestration_service", lambda: orchestration_service)
+
+    client = FakeClientWebSocket(disconnect_immediately=False)
+    await asyncio.wait_for(
+        websocket_routes.proxy_websocket_with_state_extraction(client, FakeUpstreamWebSocket(), "thread-1", "user-1"),
+        timeout=5
+    )
+
+    assert orchestration_service.proposal_service.status == expected_status
+    assert client.sent[-1]["data"]["reason"] == "idle_timeout"
+
+
+class FakeSnapshotService:
+    """Snapshot store holding a fixed list of sequences."""
+
+    snapshot_limit = 2
+
+    def __init__(self, sequences):
+        self.sequences = sequences
+
+    def list_snapshots(self, thread_id, after_sequence=0, limit=None):
+        sequences = [s for s in self.sequences if s > after_sequence][-limit:]
+        return [{"sequence": s, "state": {"messages": f"step {s}"}} for s in sequences]
+
+
+@pytest.mark.asyncio
+async def test_reconnecting_client_gets_missed_state_updates(monkeypatch):
+    """Stored state updates after last_event_seq are replayed, capped at the retention limit."""
+    monkeypatch.setattr(websocket_routes, "get_snapshot_service", lambda: FakeSnapshotService([1, 2, 3, 4]))
+
+    client = FakeClientWebSocket()
+    await websocket_routes.replay_thread_snapshots(client, "thread-1", 1)
+
+    assert client.sent == [
+        {"event_type": "on_state_update", "data": {"messages": "step 3"}, "seq": 3, "replayed": True},
+        {"event_type": "on_state_update", "data": {"messages": "step 4"}, "seq": 4, "replayed": True},
+    ]
+
+    client = FakeClientWebSocket()
+    await websocket_routes.replay_thread_snapshots(client, "thread-1", 4)
+    assert client.sent == []
+
+
+@pytest.mark.asyncio
+async def test_live_state_updates_carry_sequence(monkeypatch):
+    """Forwarded state updates are tagged with their stored sequence so clients can resume from it."""
+    orchestration_service = FakeOrchestrationService()
+    monkeypatch.setattr(websocket_routes, "get_orchestration_service", lambda: orchestration_service)
+    monkeypatch.setattr(websocket_routes, "save_thread_snapshot", lambda thread_id, state: 7)
+
+    client = ClientLeavingAfterEnd()
+    upstream = FakeUpstreamWebSocket([
+        {"event_type": "on_state_update", "data": {"files": {"/plan.md": {"content": "# Plan"}}}},
+        {"event_type": "end", "data": {}},
+    ])
+    await asyncio.wait_for(
+        websocket_routes.proxy_websocket_with_state_extraction(client, upstream, "thread-1", "user-1"),
+        timeout=5
+    )
+
+    assert client.sent[0]["seq"] == 7
+
+
+async def collect_sse(upstream, thread_id="thread-1"):
+    """Relay an upstream as Server-Sent Events and return the messages."""
+    return [message async for message in websocket_routes.relay_upstream_events(upstream, thread_id)]
+
+
+@pytest.mark.asyncio
+async def test_sse_relay_reemits_events_and_finalizes_proposal(monkeypatch):
+    """Events are re-emitted as data lines, state updates get their seq as ID, and the end event saves the files."""
+    orchestration_service = FakeOrchestrationService()
+    monkeypatch.setattr(websocket_routes, "get_orchestration_service", lambda: orchestration_service)
+    monkeypatch.setattr(websocket_routes, "save_thread_snapshot", lambda thread_id, state: 7)
+
+    files = {"/plan.md": {"content": "# Plan"}}
+    upstream = FakeUpstreamWebSocket([
+        {"event_type": "on_state_update", "data": {"files": files}},
+        {"event_type": "end", "data": {}},
+    ])
+    messages = await asyncio.wait_for(collect_sse(upstream), timeout=5)
+    for _ in range(3):
+        await asyncio.sleep(0)
+
+    assert messages == [
+        'id: 7\ndata: {"event_type":"on_state_update","data":{"files":{"/plan.md":{"content":"# Plan"}}},"seq":7}\n\n',
+        'data: {"event_type":"end","data":{}}\n\n',
+    ]
+    assert orchestration_service.file_updates == [("thread-1", files, None)]
+    assert "thread-1" not in websocket_routes.active_streams
+
+
+@pytest.mark.asyncio
+async def test_sse_and_websocket_send_identical_event_json(monkeypatch):
+    """The same upstream events reach WebSocket and SSE clients as byte-identical JSON."""
+    orchestration_service = FakeOrchestrationService()
+    monkeypatch.setattr(websocket_routes, "get_orchestration_service", lambda: orchestration_service)
+    monkeypatch.setattr(websocket_routes, "save_thread_snapshot", lambda thread_id, state: 3)
+    events = [
+        {"event_type": "on_llm_stream", "data": {"chunk": "Résumé ✓"}, "run_id": "run-1"},
+        {"event_type": "on_state_update", "data": {"files": {"/plan.md": {"content": "# Plan"}}}},
+        {"event_type": "end", "data": {}},
+    ]
+
+    client = ClientLeavingAfterEnd()
+    await asyncio.wait_for(
+        websocket_routes.proxy_websocket_with_state_extraction(
+            client, FakeUpstreamWebSocket(events), "thread-1", "user-1"
+        ),
+        timeout=5
+    )
+    messages = await asyncio.wait_for(collect_sse(FakeUpstreamWebSocket(events)), timeout=5)
+
+    sse_payloads = [message.split("data: ", 1)[1][:-len("\n\n")] for message in messages]
+    assert sse_payloads == client.frames
+    assert client.sent[0] == {"event_type": "on_llm_stream", "data": {"chunk": "Résumé ✓"}}
+    assert client.sent[1]["seq"] == 3
+
+
+@pytest.mark.asyncio
+async def test_cancelled_refinement_ends_sse_stream(monkeypatch, pruned_threads):
+    """Cancelling a refinement ends its event stream with the reason, without failing the proposal."""
+    orchestration_service = FakeOrchestrationService()
+    monkeypatch.setattr(websocket_routes, "get_orchestration_service", lambda: orchestration_service)
+
+    upstream = FakeUpstreamWebSocket()
+    relay = asyncio.create_task(collect_sse(upstream))
+    while "thread-1" not in websocket_routes.active_streams:
+        await asyncio.sleep(0)
+
+    assert await websocket_routes.close_refinement_stream("thread-1") == 1
+    messages = await asyncio.wait_for(relay, timeout=5)
+
+    assert [json.loads(message[len("data: "):]) for message in messages] == [
+        {"event_type": "error", "data": {"error": "Refinement cancelled", "reason": "cancelled"}}
+    ]
+    assert json.loads(upstream.sent[-1])["event_type"] == "cancel"
+    assert orchestration_service.status_updates == []
+    assert pruned_threads == ["thread-1"]
+
+
+@pytest.mark.asyncio
+async def test_sse_stream_replays_after_last_event_id(monkeypatch):
+    """A resuming stream starts with the stored state updates after Last-Event-ID."""
+    monkeypatch.setattr(websocket_routes, "get_snapshot_service", lambda: FakeSnapshotService([1, 2, 3]))
+
+    async def unreachable_upstream(url, **kwargs):
+        raise ConnectionError("runtime down")
+
+    monkeypatch.setattr(websocket_routes.websockets, "connect", unreachable_upstream)
+
+    messages = [message async for message in websocket_routes.stream_refinement_events("thread-1", "user-1", 2)]
+
+    assert messages[0].startswith("id: 3\ndata: ")
+    assert json.loads(messages[1][len("data: "):])["data"]["error"] == "Failed to connect to AI service"
+
+    assert websocket_routes.stream_limiter.count("user-1") == 0
+
+
+@pytest.mark.asyncio
+async def test_sse_stream_refused_over_stream_limit(monkeypatch):
+    """A user at the open stream limit gets an error event instead of a stream."""
+    limiter = ConnectionLimiter(1)
+    monkeypatch.setattr(websocket_routes, "stream_limiter", limiter)
+    assert limiter.acquire("user-1")
+
+    messages = [message async for message in websocket_routes.stream_refinement_events("thread-1", "user-1", 0)]
+
+    assert json.loads(messages[0][len("data: "):])["data"]["reason"] == "too_many_streams"
+    assert limiter.count("user-1") == 1
+
+
+@pytest.mark.asyncio
+async def test_progress_writes_are_throttled_and_coalesced(monkeypatch):
+    """Within the interval only the first state is written; flushing writes the newest one."""
+    orchestration_service = FakeOrchestrationService()
+    monkeypatch.setattr(websocket_routes, "get_orchestration_service", lambda: orchestration_service)
+
+    recorder = websocket_routes.ProgressRecorder("thread-1", interval=60)
+    recorder.record({"current_step": "Analyzing"})
+    await asyncio.sleep(0)
+    recorder.record({"current_step": "Planning"})
+    recorder.record({"current_step": "Generating", "progress_percent": 80, "files": {"/plan.md": {}}})
+    await asyncio.sleep(0.01)
+
+    assert [progress["current_step"] for _, progress in orchestration_service.progress_updates] == ["Analyzing"]
+
+    await asyncio.wait_for(recorder.flush(), timeout=5)
+
+    assert orchestration_service.progress_updates[-1] == (
+        "thread-1", {"current_step": "Generating", "progress_percent": 80, "files_count": 1}
+    )
+    assert len(orchestration_service.progress_updates) == 2
+
+
+@pytest.mark.asyncio
+async def test_end_event_flushes_progress(monkeypatch):
+    """The latest progress is written before the proposal is finalized, however long the interval."""
+    monkeypatch.setenv("PROGRESS_WRITE_INTERVAL_SECONDS", "60")
+    orchestration_service = FakeOrchestrationService()
+    monkeypatch.setattr(websocket_routes, "get_orchestration_service", lambda: orchestration_service)
+    monkeypatch.setattr(websocket_routes, "save_thread_snapshot", lambda thread_id, state: None)
+
+    upstream = FakeUpstreamWebSocket([
+        {"event_type": "on_state_update", "data": {"current_step": "Analyzing", "files": {}}},
+        {"event_type": "on_state_update", "data": {"current_step": "Generating", "files": {"/plan.md": {}}}},
+        {"event_type": "end", "data": {}},
+    ])
+    await asyncio.wait_for(
+        websocket_routes.proxy_websocket_with_state_extraction(
+            ClientLeavingAfterEnd(), upstream, "thread-1", "user-1"
+        ),
+        timeout=5
+    )
+
+    assert orchestration_service.progress_updates[-1] == (
+        "thread-1", {"current_step": "Generating", "progress_percent": None, "files_count": 1}
+    )
+
+
+class SlowUpstreamWebSocket(FakeUpstreamWebSocket):
+    """Upstream that takes a while between events, like an agent thinking."""
+
+    async def _iterate(self):
+        for event in self.events:
+            await asyncio.sleep(0.1)
+            yield json.dumps(event)
+        await self.closed.wait()
+
+
+@pytest.mark.asyncio
+async def test_slow_stream_outlives_request_timeouts(monkeypatch):
+    """Runtime request timeouts do not apply to streams; only the idle timeout does."""
+    monkeypatch.setenv("DEEPAGENTS_INVOKE_TIMEOUT", "0.01")
+    monkeypatch.setenv("DEEPAGENTS_STATE_TIMEOUT", "0.01")
+    orchestration_service = FakeOrchestrationService()
+    monkeypatch.setattr(websocket_routes, "get_orchestration_service", lambda: orchestration_service)
+    monkeypatch.setattr(websocket_routes, "save_thread_snapshot", lambda thread_id, state: None)
+
+    upstream = SlowUpstreamWebSocket([
+        {"event_type": "on_state_update", "data": {"files": {"/plan.md": {"content": "# Plan"}}}},
+        {"event_type": "end", "data": {}},
+    ])
+    messages = await asyncio.wait_for(collect_sse(upstream), timeout=5)
+
+    assert json.loads(messages[-1][len("data: "):])["event_type"] == "end"